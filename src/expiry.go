@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/kelvinmwinuka/memstore/src/utils"
+)
+
+// expiryInterval is how often the expiry loop looks for expired keys.
+const expiryInterval = 100 * time.Millisecond
+
+// GetExpiry returns the time at which the key expires. ok is false if the key does not expire.
+func (server *Server) GetExpiry(key string) (time.Time, bool) {
+	server.expiryLock.RLock()
+	defer server.expiryLock.RUnlock()
+	expireAt, ok := server.expiry[key]
+	return expireAt, ok
+}
+
+// SetExpiry sets the time at which the key expires. A zero time removes the expiry.
+// The caller must hold the key's lock.
+func (server *Server) SetExpiry(ctx context.Context, key string, expireAt time.Time) {
+	server.expiryLock.Lock()
+	defer server.expiryLock.Unlock()
+	if expireAt.IsZero() {
+		delete(server.expiry, key)
+		return
+	}
+	server.expiry[key] = expireAt
+}
+
+func (server *Server) isExpired(key string, now time.Time) bool {
+	expireAt, ok := server.GetExpiry(key)
+	return ok && !expireAt.After(now)
+}
+
+// expireKey deletes the key if it has expired at the given time.
+// The expiry is checked again once the key is locked, in case the key was written in the meantime.
+func (server *Server) expireKey(ctx context.Context, key string, now time.Time) {
+	if !server.isExpired(key, now) {
+		return
+	}
+	if _, err := server.KeyLock(ctx, key); err != nil {
+		return
+	}
+	if !server.isExpired(key, now) {
+		server.KeyUnlock(key)
+		return
+	}
+	server.DeleteLockedKey(ctx, key)
+	server.NotifyKeyspaceEvent(ctx, utils.ExpiredEvents, "expired", key)
+}
+
+// expiredKeys returns the keys that have expired at the given time.
+func (server *Server) expiredKeys(now time.Time) []string {
+	server.expiryLock.RLock()
+	defer server.expiryLock.RUnlock()
+	var keys []string
+	for key, expireAt := range server.expiry {
+		if !expireAt.After(now) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// GetFieldExpiry returns the time at which a field of the hash at key expires. ok is false if the field does not expire.
+func (server *Server) GetFieldExpiry(key string, field string) (time.Time, bool) {
+	server.expiryLock.RLock()
+	defer server.expiryLock.RUnlock()
+	expireAt, ok := server.fieldExpiry[key][field]
+	return expireAt, ok
+}
+
+// SetFieldExpiry sets the time at which a field of the hash at key expires. A zero time removes the expiry.
+// The caller must hold the key's lock.
+func (server *Server) SetFieldExpiry(ctx context.Context, key string, field string, expireAt time.Time) {
+	server.expiryLock.Lock()
+	defer server.expiryLock.Unlock()
+	if expireAt.IsZero() {
+		delete(server.fieldExpiry[key], field)
+		if len(server.fieldExpiry[key]) == 0 {
+			delete(server.fieldExpiry, key)
+		}
+		return
+	}
+	if server.fieldExpiry[key] == nil {
+		server.fieldExpiry[key] = make(map[string]time.Time)
+	}
+	server.fieldExpiry[key][field] = expireAt
+}
+
+// ExpiredFields returns the fields of the hash at key that have expired but have not been removed yet.
+// In a cluster, fields only expire when the leader replicates the expiry, so there are never any.
+func (server *Server) ExpiredFields(key string) []string {
+	if server.IsInCluster() {
+		return nil
+	}
+	now := time.Now()
+	server.expiryLock.RLock()
+	defer server.expiryLock.RUnlock()
+	var fields []string
+	for field, expireAt := range server.fieldExpiry[key] {
+		if !expireAt.After(now) {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+func (server *Server) deleteFieldExpiry(key string) {
+	server.expiryLock.Lock()
+	defer server.expiryLock.Unlock()
+	delete(server.fieldExpiry, key)
+}
+
+// expireFields removes the listed fields from the hash at key if they have expired at the given time.
+// The key is deleted if no fields are left, before its lock is released.
+func (server *Server) expireFields(ctx context.Context, key string, fields []string, now time.Time) {
+	if server.getKeyLock(key) == nil {
+		server.deleteFieldExpiry(key)
+		return
+	}
+	if _, err := server.KeyLock(ctx, key); err != nil {
+		return
+	}
+
+	hash, ok := server.GetValue(key).(map[string]interface{})
+	if !ok {
+		// The key was overwritten with a value that is not a hash
+		server.deleteFieldExpiry(key)
+		server.KeyUnlock(key)
+		return
+	}
+
+	removed := 0
+	for _, field := range fields {
+		if expireAt, ok := server.GetFieldExpiry(key, field); ok && !expireAt.After(now) {
+			delete(hash, field)
+			server.SetFieldExpiry(ctx, key, field, time.Time{})
+			removed++
+		}
+	}
+
+	if removed > 0 {
+		server.NotifyKeyspaceEvent(ctx, utils.HashEvents, "hexpired", key)
+	}
+
+	if len(hash) > 0 {
+		if removed > 0 {
+			server.SetValue(ctx, key, hash)
+		}
+		server.KeyUnlock(key)
+		return
+	}
+	server.DeleteLockedKey(ctx, key)
+	server.NotifyKeyspaceEvent(ctx, utils.GenericEvents, "del", key)
+}
+
+// expiredHashFields returns the fields that have expired at the given time, grouped by key.
+func (server *Server) expiredHashFields(now time.Time) map[string][]string {
+	server.expiryLock.RLock()
+	defer server.expiryLock.RUnlock()
+	expired := make(map[string][]string)
+	for key, fields := range server.fieldExpiry {
+		for field, expireAt := range fields {
+			if !expireAt.After(now) {
+				expired[key] = append(expired[key], field)
+			}
+		}
+	}
+	return expired
+}
+
+// StartExpiry periodically deletes the keys and hash fields that have expired.
+// Outside a cluster, keys are deleted directly and are also hidden by KeyExists as soon as they expire.
+// In a cluster, only the leader looks for expired keys. It replicates the expiry through raft so that
+// every node deletes the key at the same point in the log, and followers never expire keys on their own.
+func (server *Server) StartExpiry(ctx context.Context) {
+	ticker := time.NewTicker(expiryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if !server.IsInCluster() {
+			now := time.Now()
+			for _, key := range server.expiredKeys(now) {
+				server.expireKey(ctx, key, now)
+			}
+			for key, fields := range server.expiredHashFields(now) {
+				server.expireFields(ctx, key, fields, now)
+			}
+			continue
+		}
+
+		if !server.isRaftLeader() {
+			continue
+		}
+
+		now := time.Now()
+		for _, key := range server.expiredKeys(now) {
+			b, err := json.Marshal(utils.ApplyRequest{ExpireKey: key})
+			if err != nil {
+				continue
+			}
+			// The key is checked again when the entry is applied, in case it was written in the meantime
+			server.raft.Apply(b, 500*time.Millisecond)
+		}
+		for key, fields := range server.expiredHashFields(now) {
+			b, err := json.Marshal(utils.ApplyRequest{ExpireKey: key, ExpireFields: fields})
+			if err != nil {
+				continue
+			}
+			server.raft.Apply(b, 500*time.Millisecond)
+		}
+	}
+}
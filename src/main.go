@@ -4,18 +4,25 @@ import (
 	"bufio"
 	"context"
 	"crypto/tls"
-	"encoding/json"
 	"fmt"
 	"github.com/kelvinmwinuka/memstore/src/modules/acl"
+	"github.com/kelvinmwinuka/memstore/src/modules/bloom"
+	"github.com/kelvinmwinuka/memstore/src/modules/cuckoo"
 	"github.com/kelvinmwinuka/memstore/src/modules/etc"
 	"github.com/kelvinmwinuka/memstore/src/modules/get"
+	"github.com/kelvinmwinuka/memstore/src/modules/graph"
 	"github.com/kelvinmwinuka/memstore/src/modules/hash"
+	"github.com/kelvinmwinuka/memstore/src/modules/info"
+	jsn "github.com/kelvinmwinuka/memstore/src/modules/json"
 	"github.com/kelvinmwinuka/memstore/src/modules/list"
 	"github.com/kelvinmwinuka/memstore/src/modules/ping"
 	"github.com/kelvinmwinuka/memstore/src/modules/pubsub"
+	"github.com/kelvinmwinuka/memstore/src/modules/search"
 	"github.com/kelvinmwinuka/memstore/src/modules/set"
+	"github.com/kelvinmwinuka/memstore/src/modules/sketch"
 	"github.com/kelvinmwinuka/memstore/src/modules/sorted_set"
 	str "github.com/kelvinmwinuka/memstore/src/modules/string"
+	"github.com/kelvinmwinuka/memstore/src/modules/timeseries"
 	"io"
 	"log"
 	"net"
@@ -42,7 +49,16 @@ type Server struct {
 	keyLocks        map[string]*sync.RWMutex
 	keyCreationLock *sync.Mutex
 
-	commands []utils.Command
+	expiry      map[string]time.Time
+	fieldExpiry map[string]map[string]time.Time // Hash field expiry times by key and field
+	expiryLock  *sync.RWMutex
+
+	versions    map[string]uint64
+	lastVersion uint64 // The version assigned by the last write to any key
+	versionLock *sync.RWMutex
+
+	commands         []utils.Command
+	snapshotDecoders map[string]utils.SnapshotDecoder
 
 	raft *raft.Raft
 
@@ -50,39 +66,72 @@ type Server struct {
 	broadcastQueue *memberlist.TransmitLimitedQueue
 	numOfNodes     int
 
+	publishQueues    map[string]*publishQueue // The messages waiting to be sent to each of the other nodes
+	publishQueuesMut sync.Mutex
+
 	cancelCh *chan os.Signal
 
+	outputBufferLimits map[string]utils.OutputBufferLimit
+	metrics            *utils.Metrics
+	keyspaceEvents     utils.KeyspaceEventClass
+
 	ACL    *acl.ACL
 	PubSub *pubsub.PubSub
+	Search *search.Search
 }
 
-func (server *Server) KeyLock(ctx context.Context, key string) (bool, error) {
+// getKeyLock returns the lock of the key, or nil if the key does not exist.
+func (server *Server) getKeyLock(key string) *sync.RWMutex {
+	server.keyCreationLock.Lock()
+	defer server.keyCreationLock.Unlock()
+	return server.keyLocks[key]
+}
+
+// lockKey write-locks the key and returns the lock that was acquired.
+func (server *Server) lockKey(ctx context.Context, key string) (*sync.RWMutex, error) {
 	ticker := time.NewTicker(5 * time.Millisecond)
+	defer ticker.Stop()
 	for {
 		select {
 		default:
-			ok := server.keyLocks[key].TryLock()
-			if ok {
-				return true, nil
+			keyLock := server.getKeyLock(key)
+			if keyLock == nil {
+				// The key was deleted while we were waiting for the lock
+				return nil, fmt.Errorf("key %s not found", key)
+			}
+			if keyLock.TryLock() {
+				return keyLock, nil
 			}
 		case <-ctx.Done():
-			return false, context.Cause(ctx)
+			return nil, context.Cause(ctx)
 		}
 		<-ticker.C
 	}
 }
 
+func (server *Server) KeyLock(ctx context.Context, key string) (bool, error) {
+	if _, err := server.lockKey(ctx, key); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 func (server *Server) KeyUnlock(key string) {
-	server.keyLocks[key].Unlock()
+	server.getKeyLock(key).Unlock()
 }
 
 func (server *Server) KeyRLock(ctx context.Context, key string) (bool, error) {
 	ticker := time.NewTicker(5 * time.Millisecond)
+	defer ticker.Stop()
 	for {
 		select {
 		default:
-			ok := server.keyLocks[key].TryRLock()
-			if ok {
+			keyLock := server.getKeyLock(key)
+			if keyLock == nil {
+				// The key was deleted while we were waiting for the lock
+				return false, fmt.Errorf("key %s not found", key)
+			}
+			if keyLock.TryRLock() {
 				return true, nil
 			}
 		case <-ctx.Done():
@@ -93,25 +142,89 @@ func (server *Server) KeyRLock(ctx context.Context, key string) (bool, error) {
 }
 
 func (server *Server) KeyRUnlock(key string) {
-	server.keyLocks[key].RUnlock()
+	server.getKeyLock(key).RUnlock()
 }
 
 func (server *Server) KeyExists(key string) bool {
-	return server.keyLocks[key] != nil
+	if server.getKeyLock(key) == nil {
+		return false
+	}
+	// In a cluster, keys only expire when the leader replicates the expiry. See StartExpiry.
+	return server.IsInCluster() || !server.isExpired(key, time.Now())
 }
 
+// CreateKeyAndLock write-locks the key, creating it if it does not exist yet.
+// Key locks are always taken before keyCreationLock, so keyCreationLock is never held while waiting for a key lock.
 func (server *Server) CreateKeyAndLock(ctx context.Context, key string) (bool, error) {
-	server.keyCreationLock.Lock()
-	defer server.keyCreationLock.Unlock()
+	for {
+		server.keyCreationLock.Lock()
+		if server.keyLocks[key] == nil {
+			keyLock := &sync.RWMutex{}
+			keyLock.Lock()
+			server.keyLocks[key] = keyLock
+			server.keyCreationLock.Unlock()
+			return true, nil
+		}
+		server.keyCreationLock.Unlock()
+
+		keyLock, err := server.lockKey(ctx, key)
+		if err != nil {
+			if ctx.Err() != nil {
+				return false, err
+			}
+			// The key was deleted while we were waiting for its lock, so it can be created
+			continue
+		}
+		if server.getKeyLock(key) != keyLock {
+			// The key was deleted and recreated after its old lock was looked up
+			keyLock.Unlock()
+			continue
+		}
+		break
+	}
 
 	if !server.KeyExists(key) {
-		keyLock := &sync.RWMutex{}
-		keyLock.Lock()
-		server.keyLocks[key] = keyLock
-		return true, nil
+		// The key has expired but has not been deleted yet, so it is recreated without a value
+		delete(server.store, key)
+		server.SetExpiry(ctx, key, time.Time{})
+		server.deleteFieldExpiry(key)
+		server.deleteVersion(key)
+		server.Search.RemoveKey(key)
+	}
+
+	return true, nil
+}
+
+// DeleteKey removes the key and its value from the store.
+// The caller must not hold the key's lock, it is acquired here before the key is removed.
+func (server *Server) DeleteKey(ctx context.Context, key string) error {
+	if server.getKeyLock(key) == nil {
+		return nil
+	}
+
+	if _, err := server.KeyLock(ctx, key); err != nil {
+		return err
 	}
+	server.DeleteLockedKey(ctx, key)
 
-	return server.KeyLock(ctx, key)
+	return nil
+}
+
+// DeleteLockedKey removes the key and its value from the store.
+// The caller must hold the key's write lock, which is released once the key is removed.
+func (server *Server) DeleteLockedKey(ctx context.Context, key string) {
+	server.keyCreationLock.Lock()
+	keyLock := server.keyLocks[key]
+	delete(server.keyLocks, key)
+	delete(server.store, key)
+	server.keyCreationLock.Unlock()
+
+	server.SetExpiry(ctx, key, time.Time{})
+	server.deleteFieldExpiry(key)
+	server.deleteVersion(key)
+	keyLock.Unlock()
+
+	server.Search.RemoveKey(key)
 }
 
 func (server *Server) GetValue(key string) interface{} {
@@ -120,6 +233,37 @@ func (server *Server) GetValue(key string) interface{} {
 
 func (server *Server) SetValue(ctx context.Context, key string, value interface{}) {
 	server.store[key] = value
+	server.versionLock.Lock()
+	server.lastVersion++
+	server.versions[key] = server.lastVersion
+	server.versionLock.Unlock()
+	server.Search.IndexKey(key, value)
+}
+
+// GetVersion returns the version of the key's value, which changes every time the value is set.
+// Versions are taken from a counter shared by every key, so a key that is deleted and created again never
+// gets back a version that it had before. It returns 0 if the key does not exist.
+func (server *Server) GetVersion(key string) uint64 {
+	server.versionLock.RLock()
+	defer server.versionLock.RUnlock()
+	return server.versions[key]
+}
+
+func (server *Server) deleteVersion(key string) {
+	server.versionLock.Lock()
+	defer server.versionLock.Unlock()
+	delete(server.versions, key)
+}
+
+func (server *Server) GetAllKeys(ctx context.Context) []string {
+	server.keyCreationLock.Lock()
+	defer server.keyCreationLock.Unlock()
+
+	keys := make([]string, 0, len(server.keyLocks))
+	for key := range server.keyLocks {
+		keys = append(keys, key)
+	}
+	return keys
 }
 
 func (server *Server) GetAllCommands(ctx context.Context) []utils.Command {
@@ -134,6 +278,22 @@ func (server *Server) GetPubSub() interface{} {
 	return server.PubSub
 }
 
+func (server *Server) GetSearch() interface{} {
+	return server.Search
+}
+
+func (server *Server) GetMetrics() *utils.Metrics {
+	return server.metrics
+}
+
+// clientClass returns the class of the client whose output buffer limits apply to the connection.
+func (server *Server) clientClass(conn *net.Conn) string {
+	if server.PubSub.Subscribed(conn) {
+		return utils.PubSubClient
+	}
+	return utils.NormalClient
+}
+
 func (server *Server) getCommand(cmd string) (utils.Command, error) {
 	for _, command := range server.commands {
 		if strings.EqualFold(command.Command, cmd) {
@@ -144,6 +304,14 @@ func (server *Server) getCommand(cmd string) (utils.Command, error) {
 }
 
 func (server *Server) handleConnection(ctx context.Context, conn net.Conn) {
+	// Everything written to the connection is queued, so that a client that reads slowly
+	// does not hold up the goroutines that publish to it
+	output := utils.NewOutputBuffer(conn, server.outputBufferLimits, func(class string) {
+		server.metrics.Incr("client_output_buffer_limit_disconnections")
+		server.metrics.Incr("client_output_buffer_limit_disconnections_" + class)
+	})
+	conn = output
+
 	server.ACL.RegisterConnection(&conn)
 
 	connRW := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
@@ -174,6 +342,12 @@ func (server *Server) handleConnection(ctx context.Context, conn net.Conn) {
 			break
 		}
 
+		if strings.TrimSpace(message) == "+ACK" {
+			// A subscriber acknowledging a pub/sub message outside of compatibility mode, which needs no reply
+			server.PubSub.Ack(&conn)
+			continue
+		}
+
 		if cmd, err := utils.Decode(message); err != nil {
 			// Return error to client
 			connRW.Write([]byte(fmt.Sprintf("-Error %s\r\n\n", err.Error())))
@@ -198,6 +372,12 @@ func (server *Server) handleConnection(ctx context.Context, conn net.Conn) {
 				handler = subCommand.HandlerFunc
 			}
 
+			if err := server.PubSub.CheckSubscribeMode(&conn, command.Command); err != nil {
+				connRW.WriteString(fmt.Sprintf("-%s\r\n\n", err.Error()))
+				connRW.Flush()
+				continue
+			}
+
 			if err := server.ACL.AuthorizeConnection(&conn, cmd, command, subCommand); err != nil {
 				connRW.WriteString(fmt.Sprintf("-%s\r\n\n", err.Error()))
 				connRW.Flush()
@@ -211,62 +391,30 @@ func (server *Server) handleConnection(ctx context.Context, conn net.Conn) {
 					connRW.Write(res)
 				}
 				connRW.Flush()
+				output.SetClass(server.clientClass(&conn))
+				if strings.EqualFold(command.Command, "quit") {
+					break
+				}
 				continue
 			}
 
 			// Handle other commands that need to be synced across the cluster
-			serverId, _ := ctx.Value(utils.ContextServerID("ServerID")).(string)
-			connectionId, _ := ctx.Value(utils.ContextConnID("ConnectionID")).(string)
-
-			applyRequest := utils.ApplyRequest{
-				ServerID:     serverId,
-				ConnectionID: connectionId,
-				CMD:          cmd,
-			}
-
-			b, err := json.Marshal(applyRequest)
-
-			if err != nil {
-				connRW.Write([]byte("-Error could not parse request\r\n\n"))
-				connRW.Flush()
-				continue
-			}
-
-			if server.isRaftLeader() {
-				applyFuture := server.raft.Apply(b, 500*time.Millisecond)
-
-				if err := applyFuture.Error(); err != nil {
-					connRW.WriteString(fmt.Sprintf("-Error %s\r\n\n", err.Error()))
-					connRW.Flush()
-					continue
-				}
-
-				r, ok := applyFuture.Response().(utils.ApplyResponse)
-
-				if !ok {
-					connRW.WriteString(fmt.Sprintf("-Error unprocessable entity %v\r\n\n", r))
-					connRW.Flush()
-					continue
-				}
-
-				if r.Error != nil {
-					connRW.WriteString(fmt.Sprintf("-Error %s\r\n\n", r.Error.Error()))
-					connRW.Flush()
-					continue
-				}
-
-				connRW.Write(r.Response)
-				connRW.Flush()
-
-				// TODO: Add command to AOF
+			if res, err := server.raftApply(ctx, cmd); err != nil {
+				connRW.WriteString(fmt.Sprintf("-Error %s\r\n\n", err.Error()))
 			} else {
-				// TODO: Forward message to leader and wait for a response
-				connRW.Write([]byte("-Error not cluster leader, cannot carry out command\r\n\n"))
-				connRW.Flush()
+				connRW.Write(res)
 			}
+			connRW.Flush()
+
+			// TODO: Add command to AOF
 		}
 	}
 
+	// Remove the connection's subscriptions so that nothing is delivered to a closed connection
+	server.PubSub.Unsubscribe(ctx, &conn, nil)
+	server.PubSub.PUnsubscribe(ctx, &conn, nil)
+	server.PubSub.SUnsubscribe(ctx, &conn, nil)
+
 	conn.Close()
 }
 
@@ -340,12 +488,18 @@ func (server *Server) LoadCommands(plugin utils.Plugin) {
 	for _, command := range commands {
 		server.commands = append(server.commands, command)
 	}
+	if p, ok := plugin.(utils.SnapshotPlugin); ok {
+		for snapshotType, decoder := range p.SnapshotDecoders() {
+			server.snapshotDecoders[snapshotType] = decoder
+		}
+	}
 }
 
 func (server *Server) LoadModules(ctx context.Context) {
 	server.LoadCommands(acl.NewModule())
 	server.LoadCommands(pubsub.NewModule())
 	server.LoadCommands(ping.NewModule())
+	server.LoadCommands(info.NewModule())
 	server.LoadCommands(get.NewModule())
 	server.LoadCommands(list.NewModule())
 	server.LoadCommands(str.NewModule())
@@ -353,6 +507,13 @@ func (server *Server) LoadModules(ctx context.Context) {
 	server.LoadCommands(set.NewModule())
 	server.LoadCommands(sorted_set.NewModule())
 	server.LoadCommands(hash.NewModule())
+	server.LoadCommands(jsn.NewModule())
+	server.LoadCommands(search.NewModule())
+	server.LoadCommands(graph.NewModule())
+	server.LoadCommands(bloom.NewModule())
+	server.LoadCommands(cuckoo.NewModule())
+	server.LoadCommands(sketch.NewModule())
+	server.LoadCommands(timeseries.NewModule())
 }
 
 func (server *Server) Start(ctx context.Context) {
@@ -361,6 +522,12 @@ func (server *Server) Start(ctx context.Context) {
 	server.store = make(map[string]interface{})
 	server.keyLocks = make(map[string]*sync.RWMutex)
 	server.keyCreationLock = &sync.Mutex{}
+	server.expiry = make(map[string]time.Time)
+	server.fieldExpiry = make(map[string]map[string]time.Time)
+	server.expiryLock = &sync.RWMutex{}
+	server.versions = make(map[string]uint64)
+	server.versionLock = &sync.RWMutex{}
+	server.snapshotDecoders = make(map[string]utils.SnapshotDecoder)
 
 	server.LoadModules(ctx)
 
@@ -372,8 +539,11 @@ func (server *Server) Start(ctx context.Context) {
 	if server.IsInCluster() {
 		server.RaftInit(ctx)
 		server.MemberListInit(ctx)
+		server.PubSub.SetCluster(server)
 	}
 
+	go server.StartExpiry(ctx)
+
 	if conf.HTTP {
 		server.StartHTTP(ctx)
 	} else {
@@ -410,6 +580,16 @@ func main() {
 		}
 	}
 
+	outputBufferLimits, err := utils.ParseClientOutputBufferLimits(config.ClientOutputBufferLimit)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	keyspaceEvents, err := utils.ParseKeyspaceEvents(config.NotifyKeyspaceEvents)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	cancelCh := make(chan os.Signal, 1)
 	signal.Notify(cancelCh, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
 
@@ -421,8 +601,16 @@ func main() {
 		broadcastQueue: new(memberlist.TransmitLimitedQueue),
 		numOfNodes:     0,
 
+		publishQueues:    make(map[string]*publishQueue),
+		publishQueuesMut: sync.Mutex{},
+
+		outputBufferLimits: outputBufferLimits,
+		metrics:            utils.NewMetrics(),
+		keyspaceEvents:     keyspaceEvents,
+
 		ACL:    acl.NewACL(config),
-		PubSub: pubsub.NewPubSub(),
+		PubSub: pubsub.NewPubSub(config),
+		Search: search.NewSearch(),
 
 		cancelCh: &cancelCh,
 	}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -17,6 +19,7 @@ type NodeMeta struct {
 	ServerID       raft.ServerID      `json:"ServerID"`
 	MemberlistAddr string             `json:"MemberlistAddr"`
 	RaftAddr       raft.ServerAddress `json:"RaftAddr"`
+	ServerAddr     string             `json:"ServerAddr"`
 }
 
 type BroadcastMessage struct {
@@ -59,6 +62,8 @@ func (broadcastMessage *BroadcastMessage) Finished() {
 
 func (server *Server) MemberListInit(ctx context.Context) {
 	cfg := memberlist.DefaultLocalConfig()
+	// Node names must be unique across the cluster, and they decide which node owns a sharded channel
+	cfg.Name = server.config.ServerID
 	cfg.BindAddr = server.config.BindAddr
 	cfg.BindPort = int(server.config.MemberListBindPort)
 	cfg.Events = server
@@ -123,6 +128,7 @@ func (server *Server) NodeMeta(limit int) []byte {
 		ServerID:       raft.ServerID(server.config.ServerID),
 		RaftAddr:       raft.ServerAddress(fmt.Sprintf("%s:%d", server.config.BindAddr, server.config.RaftBindPort)),
 		MemberlistAddr: fmt.Sprintf("%s:%d", server.config.BindAddr, server.config.MemberListBindPort),
+		ServerAddr:     fmt.Sprintf("%s:%d", server.config.BindAddr, server.config.Port),
 	}
 
 	b, err := json.Marshal(&meta)
@@ -152,6 +158,24 @@ func (server *Server) NotifyMsg(msgBytes []byte) {
 		); err != nil {
 			fmt.Println(err)
 		}
+	case "PubSubPublish":
+		var delivery pubSubDelivery
+		if err := json.Unmarshal([]byte(msg.Content), &delivery); err != nil {
+			fmt.Println(err)
+			return
+		}
+		var channel interface{}
+		if delivery.Channel != "" {
+			channel = delivery.Channel
+		}
+		server.PubSub.Publish(context.Background(), delivery.Message, delivery.Headers, channel)
+	case "PubSubShardPublish":
+		var delivery pubSubDelivery
+		if err := json.Unmarshal([]byte(msg.Content), &delivery); err != nil {
+			fmt.Println(err)
+			return
+		}
+		server.PubSub.PublishShard(context.Background(), delivery.Message, delivery.Channel)
 	case "MutateData":
 		// Mutate the value at a given key
 	case "FetchData":
@@ -159,6 +183,143 @@ func (server *Server) NotifyMsg(msgBytes []byte) {
 	}
 }
 
+// pubSubDelivery is the content of the messages that carry a published message to the other nodes.
+type pubSubDelivery struct {
+	Channel string            `json:"Channel"`
+	Message string            `json:"Message"`
+	Headers map[string]string `json:"Headers,omitempty"`
+}
+
+// sendPubSubDelivery sends a published message straight to the node over a reliable stream.
+func (server *Server) sendPubSubDelivery(node *memberlist.Node, action string, delivery pubSubDelivery) error {
+	content, err := json.Marshal(delivery)
+	if err != nil {
+		return err
+	}
+	msg := BroadcastMessage{
+		Action:  action,
+		Content: string(content),
+		NodeMeta: NodeMeta{
+			ServerID: raft.ServerID(server.config.ServerID),
+		},
+	}
+	return server.memberList.SendReliable(node, msg.Message())
+}
+
+// publishQueueSize is the number of published messages that can wait to be sent to a node.
+// Messages published while a node's queue is full are dropped for that node.
+const publishQueueSize = 1024
+
+// publishQueue sends the messages published on this node to another node, one at a time and in the order
+// that they were queued, so that a slow or unreachable node does not hold up publishers or the other nodes.
+type publishQueue struct {
+	sends chan publishSend
+	done  chan struct{}
+}
+
+type publishSend struct {
+	node     *memberlist.Node
+	delivery pubSubDelivery
+}
+
+// publishQueue returns the queue of the node, creating and starting it if it does not exist.
+func (server *Server) publishQueue(node *memberlist.Node) *publishQueue {
+	server.publishQueuesMut.Lock()
+	defer server.publishQueuesMut.Unlock()
+
+	if queue, ok := server.publishQueues[node.Name]; ok {
+		return queue
+	}
+
+	queue := &publishQueue{
+		sends: make(chan publishSend, publishQueueSize),
+		done:  make(chan struct{}),
+	}
+	go func() {
+		for {
+			select {
+			case <-queue.done:
+				return
+			case send := <-queue.sends:
+				if err := server.sendPubSubDelivery(send.node, "PubSubPublish", send.delivery); err != nil {
+					fmt.Println(err)
+				}
+			}
+		}
+	}()
+	server.publishQueues[node.Name] = queue
+	return queue
+}
+
+// stopPublishQueue stops the queue of a node that left the cluster and drops the messages in it.
+func (server *Server) stopPublishQueue(node *memberlist.Node) {
+	server.publishQueuesMut.Lock()
+	defer server.publishQueuesMut.Unlock()
+
+	if queue, ok := server.publishQueues[node.Name]; ok {
+		close(queue.done)
+		delete(server.publishQueues, node.Name)
+	}
+}
+
+// BroadcastPublish implements pubsub.Cluster. The message is queued for every other node and sent to it directly
+// instead of through the gossip queue, so that each node receives it once. Each node's messages are sent one
+// at a time in the order that they were published, but the receiving node handles every stream on its own
+// goroutine, so messages published in quick succession may still reach its subscribers out of order.
+func (server *Server) BroadcastPublish(channel string, message string, headers map[string]string) {
+	delivery := pubSubDelivery{Channel: channel, Message: message, Headers: headers}
+	for _, node := range server.memberList.Members() {
+		if node.Name == server.memberList.LocalNode().Name {
+			continue
+		}
+		select {
+		case server.publishQueue(node).sends <- publishSend{node: node, delivery: delivery}:
+		default:
+			server.metrics.Incr("pubsub_cluster_publish_dropped")
+			fmt.Printf("dropped message published to %s for node %s, whose queue is full\n", channel, node.Name)
+		}
+	}
+}
+
+// shardOwner returns the node that owns the sharded channel. Ownership is decided by rendezvous hashing
+// so that only the channels of a node that joins or leaves move to another node.
+func (server *Server) shardOwner(channel string) *memberlist.Node {
+	var owner *memberlist.Node
+	var highest uint64
+	for _, node := range server.memberList.Members() {
+		sum := sha256.Sum256([]byte(node.Name + "\x00" + channel))
+		if score := binary.BigEndian.Uint64(sum[:8]); owner == nil || score > highest {
+			owner = node
+			highest = score
+		}
+	}
+	return owner
+}
+
+// ShardOwner implements pubsub.Cluster.
+func (server *Server) ShardOwner(channel string) (addr string, local bool) {
+	owner := server.shardOwner(channel)
+	if owner == nil || owner.Name == server.memberList.LocalNode().Name {
+		return "", true
+	}
+
+	var meta NodeMeta
+	if err := json.Unmarshal(owner.Meta, &meta); err != nil {
+		fmt.Println("Could not get shard owner's metadata.")
+	}
+	return meta.ServerAddr, false
+}
+
+// SendShardPublish implements pubsub.Cluster.
+func (server *Server) SendShardPublish(channel string, message string) error {
+	owner := server.shardOwner(channel)
+	if owner == nil || owner.Name == server.memberList.LocalNode().Name {
+		server.PubSub.PublishShard(context.Background(), message, channel)
+		return nil
+	}
+	return server.sendPubSubDelivery(owner, "PubSubShardPublish", pubSubDelivery{Channel: channel, Message: message})
+}
+
 // Implements Delegate interface
 func (server *Server) GetBroadcasts(overhead, limit int) [][]byte {
 	return server.broadcastQueue.GetBroadcasts(overhead, limit)
@@ -183,6 +344,7 @@ func (server *Server) NotifyJoin(node *memberlist.Node) {
 // Implements EventDelegate interface
 func (server *Server) NotifyLeave(node *memberlist.Node) {
 	server.numOfNodes -= 1
+	server.stopPublishQueue(node)
 
 	var meta NodeMeta
 
@@ -324,19 +324,12 @@ func (acl *ACL) AuthorizeConnection(conn *net.Conn, cmd []string, command utils.
 
 	// 6. PUBSUB authorisation comes first because it has slightly different handling.
 	if slices.Contains(categories, utils.PubSubCategory) {
-		// In PUBSUB, KeyExtractionFunc returns channels so keys[0] is aliased to channel
-		channel := keys[0]
-		// 2.1) Check if the channel is in IncludedPubSubChannels
-		if !slices.ContainsFunc(connection.User.IncludedPubSubChannels, func(includedChannelGlob string) bool {
-			return acl.GlobPatterns[includedChannelGlob].Match(channel)
-		}) {
-			return fmt.Errorf("not authorised to access channel &%s", channel)
-		}
-		// 2.2) Check if the channel is in ExcludedPubSubChannels
-		if slices.ContainsFunc(connection.User.ExcludedPubSubChannels, func(excludedChannelGlob string) bool {
-			return acl.GlobPatterns[excludedChannelGlob].Match(channel)
-		}) {
-			return fmt.Errorf("not authorised to access channel &%s", channel)
+		// In PUBSUB, KeyExtractionFunc returns channels, or channel patterns for PSUBSCRIBE and PUNSUBSCRIBE
+		isPattern := slices.Contains([]string{"psubscribe", "punsubscribe"}, strings.ToLower(comm))
+		for _, channel := range keys {
+			if err := acl.authorizeChannel(connection, channel, isPattern); err != nil {
+				return err
+			}
 		}
 		return nil
 	}
@@ -381,6 +374,49 @@ func (acl *ACL) AuthorizeConnection(conn *net.Conn, cmd []string, command utils.
 	return nil
 }
 
+// authorizeChannel checks a channel, or a channel pattern if isPattern is set, against the connection's
+// IncludedPubSubChannels and ExcludedPubSubChannels.
+func (acl *ACL) authorizeChannel(connection Connection, channel string, isPattern bool) error {
+	if !isPattern {
+		// 6.1) Check if the channel is in IncludedPubSubChannels
+		if !slices.ContainsFunc(connection.User.IncludedPubSubChannels, func(includedChannelGlob string) bool {
+			return acl.GlobPatterns[includedChannelGlob].Match(channel)
+		}) {
+			return fmt.Errorf("not authorised to access channel &%s", channel)
+		}
+		// 6.2) Check if the channel is in ExcludedPubSubChannels
+		if slices.ContainsFunc(connection.User.ExcludedPubSubChannels, func(excludedChannelGlob string) bool {
+			return acl.GlobPatterns[excludedChannelGlob].Match(channel)
+		}) {
+			return fmt.Errorf("not authorised to access channel &%s", channel)
+		}
+		return nil
+	}
+
+	if _, err := glob.Compile(channel); err != nil {
+		return fmt.Errorf("invalid channel pattern %s", channel)
+	}
+	// 6.1) A pattern that only matches an included glob as text could still match channels outside of it,
+	// e.g. "orders.*" matches the glob "orders.?". So patterns have to be included exactly, or all channels included.
+	if !slices.ContainsFunc(connection.User.IncludedPubSubChannels, func(includedChannelGlob string) bool {
+		return includedChannelGlob == "*" || includedChannelGlob == channel
+	}) {
+		return fmt.Errorf("not authorised to access channel pattern &%s", channel)
+	}
+	// 6.2) Two globs can match a common channel without either matching the other as text, e.g. "*s" and
+	// "admin*" both match "admins". So when the user has excluded channels, only patterns without wildcards
+	// are allowed, and they must not match an excluded glob.
+	if len(connection.User.ExcludedPubSubChannels) == 0 {
+		return nil
+	}
+	if strings.ContainsAny(channel, `*?[]{}\`) || slices.ContainsFunc(connection.User.ExcludedPubSubChannels, func(excludedChannelGlob string) bool {
+		return acl.GlobPatterns[excludedChannelGlob].Match(channel)
+	}) {
+		return fmt.Errorf("not authorised to access channel pattern &%s", channel)
+	}
+	return nil
+}
+
 func (acl *ACL) CompileGlobs() {
 	// Extract all the relevant globs from all the users
 	var allGlobs []string
@@ -0,0 +1,299 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"math"
+)
+
+const (
+	DefaultErrorRate = 0.01
+	DefaultCapacity  = 100
+	DefaultExpansion = 2
+
+	// Each new sub-filter has a tighter error rate so that the compound error rate stays below the requested one
+	tighteningRatio = 0.5
+)
+
+var ErrFilterFull = errors.New("non-scaling filter is full")
+
+// subFilter is a fixed size bloom filter.
+type subFilter struct {
+	bits      []uint64
+	numBits   uint64
+	numHashes uint64
+	capacity  uint64
+	count     uint64
+	errorRate float64
+}
+
+func newSubFilter(capacity uint64, errorRate float64) *subFilter {
+	// Optimal number of bits and hash functions for the capacity and error rate
+	numBits := uint64(math.Ceil(-float64(capacity) * math.Log(errorRate) / (math.Ln2 * math.Ln2)))
+	if numBits < 64 {
+		numBits = 64
+	}
+	numHashes := uint64(math.Ceil(-math.Log2(errorRate)))
+	if numHashes < 1 {
+		numHashes = 1
+	}
+	return &subFilter{
+		bits:      make([]uint64, (numBits+63)/64),
+		numBits:   numBits,
+		numHashes: numHashes,
+		capacity:  capacity,
+		errorRate: errorRate,
+	}
+}
+
+// positions returns the bits of the item using double hashing.
+func (f *subFilter) positions(h1, h2 uint64) []uint64 {
+	res := make([]uint64, f.numHashes)
+	for i := uint64(0); i < f.numHashes; i++ {
+		res[i] = (h1 + i*h2) % f.numBits
+	}
+	return res
+}
+
+func (f *subFilter) test(h1, h2 uint64) bool {
+	for _, p := range f.positions(h1, h2) {
+		if f.bits[p/64]&(1<<(p%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *subFilter) add(h1, h2 uint64) {
+	for _, p := range f.positions(h1, h2) {
+		f.bits[p/64] |= 1 << (p % 64)
+	}
+	f.count += 1
+}
+
+// Filter is a scalable bloom filter. When the current sub-filter reaches its capacity,
+// a new sub-filter with a larger capacity and a lower error rate is added.
+type Filter struct {
+	errorRate  float64
+	capacity   uint64
+	expansion  uint64
+	nonScaling bool
+	filters    []*subFilter
+}
+
+func NewFilter(errorRate float64, capacity uint64, expansion uint64, nonScaling bool) (*Filter, error) {
+	if errorRate <= 0 || errorRate >= 1 {
+		return nil, errors.New("error rate must be between 0 and 1 exclusive")
+	}
+	if capacity < 1 {
+		return nil, errors.New("capacity must be greater than 0")
+	}
+	if !nonScaling && expansion < 1 {
+		return nil, errors.New("expansion must be greater than 0")
+	}
+	return &Filter{
+		errorRate:  errorRate,
+		capacity:   capacity,
+		expansion:  expansion,
+		nonScaling: nonScaling,
+		filters:    []*subFilter{newSubFilter(capacity, errorRate*tighteningRatio)},
+	}, nil
+}
+
+func hash(item string) (uint64, uint64) {
+	h := fnv.New128a()
+	_, _ = h.Write([]byte(item))
+	sum := h.Sum(nil)
+	h1 := binary.BigEndian.Uint64(sum[:8])
+	h2 := binary.BigEndian.Uint64(sum[8:])
+	// An even step would only visit half of the positions when the number of bits is even
+	return h1, h2 | 1
+}
+
+// Exists reports whether the item may have been added to the filter.
+func (filter *Filter) Exists(item string) bool {
+	h1, h2 := hash(item)
+	for _, f := range filter.filters {
+		if f.test(h1, h2) {
+			return true
+		}
+	}
+	return false
+}
+
+// Add adds the item to the filter. Returns false if the item may already have been added.
+func (filter *Filter) Add(item string) (bool, error) {
+	h1, h2 := hash(item)
+	for _, f := range filter.filters {
+		if f.test(h1, h2) {
+			return false, nil
+		}
+	}
+
+	current := filter.filters[len(filter.filters)-1]
+	if current.count >= current.capacity {
+		if filter.nonScaling {
+			return false, ErrFilterFull
+		}
+		current = newSubFilter(current.capacity*filter.expansion, current.errorRate*tighteningRatio)
+		filter.filters = append(filter.filters, current)
+	}
+
+	current.add(h1, h2)
+	return true, nil
+}
+
+// Capacity returns the total number of items the filter can hold before it needs to scale.
+func (filter *Filter) Capacity() uint64 {
+	var capacity uint64
+	for _, f := range filter.filters {
+		capacity += f.capacity
+	}
+	return capacity
+}
+
+// Size returns the memory used by the bits of the filter in bytes.
+func (filter *Filter) Size() uint64 {
+	var size uint64
+	for _, f := range filter.filters {
+		size += uint64(len(f.bits) * 8)
+	}
+	return size
+}
+
+func (filter *Filter) NumFilters() int {
+	return len(filter.filters)
+}
+
+func (filter *Filter) Count() uint64 {
+	var count uint64
+	for _, f := range filter.filters {
+		count += f.count
+	}
+	return count
+}
+
+// Expansion returns the expansion rate, or 0 if the filter does not scale.
+func (filter *Filter) Expansion() uint64 {
+	if filter.nonScaling {
+		return 0
+	}
+	return filter.expansion
+}
+
+// SnapshotType implements utils.SnapshotEncoder.
+func (filter *Filter) SnapshotType() string {
+	return "bloom"
+}
+
+// MarshalBinary implements utils.SnapshotEncoder. The filter is encoded as its parameters
+// followed by the raw bit array of each sub-filter.
+func (filter *Filter) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 0, 32+int(filter.Size())+len(filter.filters)*40)
+	b = binary.LittleEndian.AppendUint64(b, math.Float64bits(filter.errorRate))
+	b = binary.AppendUvarint(b, filter.capacity)
+	b = binary.AppendUvarint(b, filter.expansion)
+	if filter.nonScaling {
+		b = append(b, 1)
+	} else {
+		b = append(b, 0)
+	}
+	b = binary.AppendUvarint(b, uint64(len(filter.filters)))
+	for _, f := range filter.filters {
+		b = binary.LittleEndian.AppendUint64(b, math.Float64bits(f.errorRate))
+		b = binary.AppendUvarint(b, f.numBits)
+		b = binary.AppendUvarint(b, f.numHashes)
+		b = binary.AppendUvarint(b, f.capacity)
+		b = binary.AppendUvarint(b, f.count)
+		for _, word := range f.bits {
+			b = binary.LittleEndian.AppendUint64(b, word)
+		}
+	}
+	return b, nil
+}
+
+// DecodeSnapshot restores a filter that was encoded with MarshalBinary.
+func DecodeSnapshot(b []byte) (interface{}, error) {
+	d := &decoder{b: b}
+	filter := &Filter{
+		errorRate: d.float(),
+		capacity:  d.uvarint(),
+		expansion: d.uvarint(),
+	}
+	filter.nonScaling = d.byte() == 1
+
+	numFilters := d.uvarint()
+	for i := uint64(0); i < numFilters && d.err == nil; i++ {
+		f := &subFilter{
+			errorRate: d.float(),
+			numBits:   d.uvarint(),
+			numHashes: d.uvarint(),
+			capacity:  d.uvarint(),
+			count:     d.uvarint(),
+		}
+		words := (f.numBits + 63) / 64
+		if words*8 > uint64(len(d.b)) {
+			return nil, errors.New("invalid bloom filter snapshot")
+		}
+		f.bits = make([]uint64, words)
+		for j := range f.bits {
+			f.bits[j] = d.uint64()
+		}
+		filter.filters = append(filter.filters, f)
+	}
+
+	if d.err != nil || len(filter.filters) == 0 {
+		return nil, errors.New("invalid bloom filter snapshot")
+	}
+	return filter, nil
+}
+
+// decoder reads the values written by MarshalBinary. The first error is kept and subsequent reads return zero values.
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		d.err = errors.New("invalid varint")
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) uint64() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.b) < 8 {
+		d.err = errors.New("unexpected end of data")
+		return 0
+	}
+	v := binary.LittleEndian.Uint64(d.b)
+	d.b = d.b[8:]
+	return v
+}
+
+func (d *decoder) float() float64 {
+	return math.Float64frombits(d.uint64())
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.b) < 1 {
+		d.err = errors.New("unexpected end of data")
+		return 0
+	}
+	v := d.b[0]
+	d.b = d.b[1:]
+	return v
+}
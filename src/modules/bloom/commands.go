@@ -0,0 +1,336 @@
+package bloom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kelvinmwinuka/memstore/src/utils"
+	"net"
+	"strconv"
+	"strings"
+)
+
+type Plugin struct {
+	name        string
+	commands    []utils.Command
+	description string
+}
+
+func (p Plugin) Name() string {
+	return p.name
+}
+
+func (p Plugin) Commands() []utils.Command {
+	return p.commands
+}
+
+func (p Plugin) Description() string {
+	return p.description
+}
+
+// SnapshotDecoders implements utils.SnapshotPlugin.
+func (p Plugin) SnapshotDecoders() map[string]utils.SnapshotDecoder {
+	return map[string]utils.SnapshotDecoder{
+		"bloom": DecodeSnapshot,
+	}
+}
+
+// maxCapacity limits the memory a single BF.RESERVE can allocate.
+const maxCapacity = 1 << 30
+
+func handleBFReserve(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) < 4 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	key := cmd[1]
+
+	errorRate, err := strconv.ParseFloat(cmd[2], 64)
+	if err != nil {
+		return nil, errors.New("error rate must be a number")
+	}
+	capacity, err := strconv.ParseUint(cmd[3], 10, 64)
+	if err != nil || capacity > maxCapacity {
+		return nil, fmt.Errorf("capacity must be an integer between 1 and %d", uint64(maxCapacity))
+	}
+
+	expansion := uint64(DefaultExpansion)
+	nonScaling := false
+	for i := 4; i < len(cmd); i++ {
+		switch strings.ToLower(cmd[i]) {
+		case "expansion":
+			if i+1 >= len(cmd) {
+				return nil, errors.New("EXPANSION must be followed by the expansion rate")
+			}
+			if expansion, err = strconv.ParseUint(cmd[i+1], 10, 64); err != nil {
+				return nil, errors.New("expansion must be an integer")
+			}
+			i += 1
+		case "nonscaling":
+			nonScaling = true
+		default:
+			return nil, fmt.Errorf("unknown option %s", cmd[i])
+		}
+	}
+
+	filter, err := NewFilter(errorRate, capacity, expansion, nonScaling)
+	if err != nil {
+		return nil, err
+	}
+
+	if server.KeyExists(key) {
+		return nil, fmt.Errorf("key %s already exists", key)
+	}
+
+	if _, err = server.CreateKeyAndLock(ctx, key); err != nil {
+		return nil, err
+	}
+	defer server.KeyUnlock(key)
+
+	if server.GetValue(key) != nil {
+		return nil, fmt.Errorf("key %s already exists", key)
+	}
+
+	server.SetValue(ctx, key, filter)
+
+	return []byte(utils.OK_RESPONSE), nil
+}
+
+func handleBFAdd(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) < 3 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+	if strings.EqualFold(cmd[0], "bf.add") && len(cmd) != 3 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	key := cmd[1]
+	items := cmd[2:]
+
+	if !server.KeyExists(key) {
+		if _, err := server.CreateKeyAndLock(ctx, key); err != nil {
+			return nil, err
+		}
+		if server.GetValue(key) == nil {
+			filter, _ := NewFilter(DefaultErrorRate, DefaultCapacity, DefaultExpansion, false)
+			server.SetValue(ctx, key, filter)
+		}
+	} else if _, err := server.KeyLock(ctx, key); err != nil {
+		return nil, err
+	}
+	defer server.KeyUnlock(key)
+
+	filter, ok := server.GetValue(key).(*Filter)
+	if !ok {
+		return nil, fmt.Errorf("value at %s is not a bloom filter", key)
+	}
+
+	results := make([]string, len(items))
+	for i, item := range items {
+		added, err := filter.Add(item)
+		switch {
+		case err != nil:
+			results[i] = fmt.Sprintf("-%s\r\n", err.Error())
+		case added:
+			results[i] = ":1\r\n"
+		default:
+			results[i] = ":0\r\n"
+		}
+	}
+
+	server.SetValue(ctx, key, filter)
+
+	if strings.EqualFold(cmd[0], "bf.add") {
+		if strings.HasPrefix(results[0], "-") {
+			return nil, ErrFilterFull
+		}
+		return []byte(results[0] + "\r\n"), nil
+	}
+
+	return []byte(fmt.Sprintf("*%d\r\n%s\r\n", len(results), strings.Join(results, ""))), nil
+}
+
+func handleBFExists(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) < 3 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+	if strings.EqualFold(cmd[0], "bf.exists") && len(cmd) != 3 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	key := cmd[1]
+	items := cmd[2:]
+	results := make([]string, len(items))
+
+	if !server.KeyExists(key) {
+		for i := range results {
+			results[i] = ":0\r\n"
+		}
+	} else {
+		if _, err := server.KeyRLock(ctx, key); err != nil {
+			return nil, err
+		}
+		defer server.KeyRUnlock(key)
+
+		filter, ok := server.GetValue(key).(*Filter)
+		if !ok {
+			return nil, fmt.Errorf("value at %s is not a bloom filter", key)
+		}
+
+		for i, item := range items {
+			if filter.Exists(item) {
+				results[i] = ":1\r\n"
+			} else {
+				results[i] = ":0\r\n"
+			}
+		}
+	}
+
+	if strings.EqualFold(cmd[0], "bf.exists") {
+		return []byte(results[0] + "\r\n"), nil
+	}
+
+	return []byte(fmt.Sprintf("*%d\r\n%s\r\n", len(results), strings.Join(results, ""))), nil
+}
+
+func handleBFInfo(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) < 2 || len(cmd) > 3 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	key := cmd[1]
+
+	if !server.KeyExists(key) {
+		return nil, fmt.Errorf("key %s does not exist", key)
+	}
+
+	if _, err := server.KeyRLock(ctx, key); err != nil {
+		return nil, err
+	}
+	defer server.KeyRUnlock(key)
+
+	filter, ok := server.GetValue(key).(*Filter)
+	if !ok {
+		return nil, fmt.Errorf("value at %s is not a bloom filter", key)
+	}
+
+	info := []struct {
+		option string
+		name   string
+		value  uint64
+	}{
+		{"capacity", "Capacity", filter.Capacity()},
+		{"size", "Size", filter.Size()},
+		{"filters", "Number of filters", uint64(filter.NumFilters())},
+		{"items", "Number of items inserted", filter.Count()},
+		{"expansion", "Expansion rate", filter.Expansion()},
+	}
+
+	if len(cmd) == 3 {
+		for _, field := range info {
+			if strings.EqualFold(cmd[2], field.option) {
+				return []byte(fmt.Sprintf(":%d\r\n\r\n", field.value)), nil
+			}
+		}
+		return nil, fmt.Errorf("unknown option %s", cmd[2])
+	}
+
+	res := fmt.Sprintf("*%d\r\n", len(info)*2)
+	for _, field := range info {
+		res += fmt.Sprintf("$%d\r\n%s\r\n:%d\r\n", len(field.name), field.name, field.value)
+	}
+	res += "\r\n"
+
+	return []byte(res), nil
+}
+
+func NewModule() Plugin {
+	BloomModule := Plugin{
+		name: "BloomCommands",
+		commands: []utils.Command{
+			{
+				Command:    "bf.reserve",
+				Categories: []string{utils.BloomCategory, utils.WriteCategory, utils.FastCategory},
+				Description: `(BF.RESERVE key error_rate capacity [EXPANSION expansion] [NONSCALING])
+Creates an empty bloom filter with the given false positive rate and initial capacity.
+When the filter is full, a new sub-filter with its capacity multiplied by the expansion rate is added, unless NONSCALING is provided.`,
+				Sync: true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 4 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleBFReserve,
+			},
+			{
+				Command:    "bf.add",
+				Categories: []string{utils.BloomCategory, utils.WriteCategory, utils.FastCategory},
+				Description: `(BF.ADD key item) Adds the item to the bloom filter, creating the filter with the default parameters if it does not exist.
+Returns 1 if the item was added and 0 if it may have been added before.`,
+				Sync: true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) != 3 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleBFAdd,
+			},
+			{
+				Command:     "bf.madd",
+				Categories:  []string{utils.BloomCategory, utils.WriteCategory, utils.FastCategory},
+				Description: "(BF.MADD key item [item ...]) Adds the items to the bloom filter and returns the result of adding each item.",
+				Sync:        true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 3 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleBFAdd,
+			},
+			{
+				Command:     "bf.exists",
+				Categories:  []string{utils.BloomCategory, utils.ReadCategory, utils.FastCategory},
+				Description: "(BF.EXISTS key item) Returns 1 if the item may have been added to the bloom filter and 0 if it definitely has not.",
+				Sync:        false,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) != 3 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleBFExists,
+			},
+			{
+				Command:     "bf.mexists",
+				Categories:  []string{utils.BloomCategory, utils.ReadCategory, utils.FastCategory},
+				Description: "(BF.MEXISTS key item [item ...]) Returns whether each of the items may have been added to the bloom filter.",
+				Sync:        false,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 3 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleBFExists,
+			},
+			{
+				Command:     "bf.info",
+				Categories:  []string{utils.BloomCategory, utils.ReadCategory, utils.FastCategory},
+				Description: "(BF.INFO key [CAPACITY | SIZE | FILTERS | ITEMS | EXPANSION]) Returns information about the bloom filter.",
+				Sync:        false,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 2 || len(cmd) > 3 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleBFInfo,
+			},
+		},
+		description: "Handle bloom filter commands",
+	}
+	return BloomModule
+}
@@ -0,0 +1,346 @@
+package cuckoo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kelvinmwinuka/memstore/src/utils"
+	"net"
+	"strconv"
+	"strings"
+)
+
+type Plugin struct {
+	name        string
+	commands    []utils.Command
+	description string
+}
+
+func (p Plugin) Name() string {
+	return p.name
+}
+
+func (p Plugin) Commands() []utils.Command {
+	return p.commands
+}
+
+func (p Plugin) Description() string {
+	return p.description
+}
+
+// SnapshotDecoders implements utils.SnapshotPlugin.
+func (p Plugin) SnapshotDecoders() map[string]utils.SnapshotDecoder {
+	return map[string]utils.SnapshotDecoder{
+		"cuckoo": DecodeSnapshot,
+	}
+}
+
+// maxCapacity limits the memory a single CF.RESERVE can allocate.
+const maxCapacity = 1 << 30
+
+// readFilter runs fn against the filter at key while holding the key's read lock.
+// If the key does not exist, fn is called with a nil filter.
+func readFilter(ctx context.Context, server utils.Server, key string, fn func(filter *Filter) ([]byte, error)) ([]byte, error) {
+	if !server.KeyExists(key) {
+		return fn(nil)
+	}
+
+	if _, err := server.KeyRLock(ctx, key); err != nil {
+		return nil, err
+	}
+	defer server.KeyRUnlock(key)
+
+	filter, ok := server.GetValue(key).(*Filter)
+	if !ok {
+		return nil, fmt.Errorf("value at %s is not a cuckoo filter", key)
+	}
+
+	return fn(filter)
+}
+
+func handleCFReserve(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) < 3 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	key := cmd[1]
+
+	capacity, err := strconv.ParseUint(cmd[2], 10, 64)
+	if err != nil || capacity > maxCapacity {
+		return nil, fmt.Errorf("capacity must be an integer between 1 and %d", uint64(maxCapacity))
+	}
+
+	options := map[string]uint64{
+		"bucketsize":    DefaultBucketSize,
+		"maxiterations": DefaultMaxIterations,
+		"expansion":     DefaultExpansion,
+	}
+	for i := 3; i < len(cmd); i += 2 {
+		option := strings.ToLower(cmd[i])
+		if _, ok := options[option]; !ok {
+			return nil, fmt.Errorf("unknown option %s", cmd[i])
+		}
+		if i+1 >= len(cmd) {
+			return nil, fmt.Errorf("%s must be followed by a value", strings.ToUpper(option))
+		}
+		if options[option], err = strconv.ParseUint(cmd[i+1], 10, 64); err != nil {
+			return nil, fmt.Errorf("%s must be an integer", strings.ToUpper(option))
+		}
+	}
+
+	filter, err := NewFilter(capacity, options["bucketsize"], options["maxiterations"], options["expansion"])
+	if err != nil {
+		return nil, err
+	}
+
+	if server.KeyExists(key) {
+		return nil, fmt.Errorf("key %s already exists", key)
+	}
+
+	if _, err = server.CreateKeyAndLock(ctx, key); err != nil {
+		return nil, err
+	}
+	defer server.KeyUnlock(key)
+
+	if server.GetValue(key) != nil {
+		return nil, fmt.Errorf("key %s already exists", key)
+	}
+
+	server.SetValue(ctx, key, filter)
+
+	return []byte(utils.OK_RESPONSE), nil
+}
+
+func handleCFAdd(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) != 3 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	key := cmd[1]
+	item := cmd[2]
+
+	if !server.KeyExists(key) {
+		if _, err := server.CreateKeyAndLock(ctx, key); err != nil {
+			return nil, err
+		}
+		if server.GetValue(key) == nil {
+			filter, _ := NewFilter(DefaultCapacity, DefaultBucketSize, DefaultMaxIterations, DefaultExpansion)
+			server.SetValue(ctx, key, filter)
+		}
+	} else if _, err := server.KeyLock(ctx, key); err != nil {
+		return nil, err
+	}
+	defer server.KeyUnlock(key)
+
+	filter, ok := server.GetValue(key).(*Filter)
+	if !ok {
+		return nil, fmt.Errorf("value at %s is not a cuckoo filter", key)
+	}
+
+	if strings.EqualFold(cmd[0], "cf.addnx") && filter.Exists(item) {
+		return []byte(":0\r\n\r\n"), nil
+	}
+
+	if err := filter.Add(item); err != nil {
+		return nil, err
+	}
+
+	server.SetValue(ctx, key, filter)
+
+	return []byte(":1\r\n\r\n"), nil
+}
+
+func handleCFDel(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) != 3 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	key := cmd[1]
+
+	if !server.KeyExists(key) {
+		return nil, fmt.Errorf("key %s does not exist", key)
+	}
+
+	if _, err := server.KeyLock(ctx, key); err != nil {
+		return nil, err
+	}
+	defer server.KeyUnlock(key)
+
+	filter, ok := server.GetValue(key).(*Filter)
+	if !ok {
+		return nil, fmt.Errorf("value at %s is not a cuckoo filter", key)
+	}
+
+	if !filter.Delete(cmd[2]) {
+		return []byte(":0\r\n\r\n"), nil
+	}
+
+	server.SetValue(ctx, key, filter)
+
+	return []byte(":1\r\n\r\n"), nil
+}
+
+func handleCFExists(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) != 3 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	return readFilter(ctx, server, cmd[1], func(filter *Filter) ([]byte, error) {
+		if filter != nil && filter.Exists(cmd[2]) {
+			return []byte(":1\r\n\r\n"), nil
+		}
+		return []byte(":0\r\n\r\n"), nil
+	})
+}
+
+func handleCFCount(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) != 3 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	return readFilter(ctx, server, cmd[1], func(filter *Filter) ([]byte, error) {
+		count := 0
+		if filter != nil {
+			count = filter.Count(cmd[2])
+		}
+		return []byte(fmt.Sprintf(":%d\r\n\r\n", count)), nil
+	})
+}
+
+func handleCFInfo(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) != 2 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	return readFilter(ctx, server, cmd[1], func(filter *Filter) ([]byte, error) {
+		if filter == nil {
+			return nil, fmt.Errorf("key %s does not exist", cmd[1])
+		}
+
+		info := []struct {
+			name  string
+			value uint64
+		}{
+			{"Size", filter.Size()},
+			{"Number of buckets", filter.NumBuckets()},
+			{"Number of filters", uint64(filter.NumFilters())},
+			{"Number of items inserted", filter.Inserted()},
+			{"Number of items deleted", filter.Deleted()},
+			{"Bucket size", filter.BucketSize()},
+			{"Expansion rate", filter.Expansion()},
+			{"Max iterations", filter.MaxIterations()},
+		}
+
+		res := fmt.Sprintf("*%d\r\n", len(info)*2)
+		for _, field := range info {
+			res += fmt.Sprintf("$%d\r\n%s\r\n:%d\r\n", len(field.name), field.name, field.value)
+		}
+		res += "\r\n"
+
+		return []byte(res), nil
+	})
+}
+
+func NewModule() Plugin {
+	CuckooModule := Plugin{
+		name: "CuckooCommands",
+		commands: []utils.Command{
+			{
+				Command:    "cf.reserve",
+				Categories: []string{utils.CuckooCategory, utils.WriteCategory, utils.FastCategory},
+				Description: `(CF.RESERVE key capacity [BUCKETSIZE bucketsize] [MAXITERATIONS maxiterations] [EXPANSION expansion])
+Creates an empty cuckoo filter with the given initial capacity.
+When an item cannot be inserted, a new sub-filter with its capacity multiplied by the expansion rate is added. An expansion of 0 disables scaling.`,
+				Sync: true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 3 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleCFReserve,
+			},
+			{
+				Command:    "cf.add",
+				Categories: []string{utils.CuckooCategory, utils.WriteCategory, utils.FastCategory},
+				Description: `(CF.ADD key item) Adds the item to the cuckoo filter, creating the filter with the default parameters if it does not exist.
+The same item can be added multiple times.`,
+				Sync: true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) != 3 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleCFAdd,
+			},
+			{
+				Command:     "cf.addnx",
+				Categories:  []string{utils.CuckooCategory, utils.WriteCategory, utils.FastCategory},
+				Description: "(CF.ADDNX key item) Adds the item to the cuckoo filter only if it does not already exist. Returns 1 if the item was added, otherwise 0.",
+				Sync:        true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) != 3 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleCFAdd,
+			},
+			{
+				Command:     "cf.del",
+				Categories:  []string{utils.CuckooCategory, utils.WriteCategory, utils.FastCategory},
+				Description: "(CF.DEL key item) Deletes one occurrence of the item from the cuckoo filter. Returns 1 if the item was deleted, otherwise 0.",
+				Sync:        true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) != 3 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleCFDel,
+			},
+			{
+				Command:     "cf.exists",
+				Categories:  []string{utils.CuckooCategory, utils.ReadCategory, utils.FastCategory},
+				Description: "(CF.EXISTS key item) Returns 1 if the item may exist in the cuckoo filter and 0 if it definitely does not.",
+				Sync:        false,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) != 3 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleCFExists,
+			},
+			{
+				Command:     "cf.count",
+				Categories:  []string{utils.CuckooCategory, utils.ReadCategory, utils.FastCategory},
+				Description: "(CF.COUNT key item) Returns an estimate of the number of times the item was added to the cuckoo filter.",
+				Sync:        false,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) != 3 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleCFCount,
+			},
+			{
+				Command:     "cf.info",
+				Categories:  []string{utils.CuckooCategory, utils.ReadCategory, utils.FastCategory},
+				Description: "(CF.INFO key) Returns information about the cuckoo filter.",
+				Sync:        false,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) != 2 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleCFInfo,
+			},
+		},
+		description: "Handle cuckoo filter commands",
+	}
+	return CuckooModule
+}
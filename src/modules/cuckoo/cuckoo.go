@@ -0,0 +1,345 @@
+package cuckoo
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+)
+
+const (
+	DefaultCapacity      = 1024
+	DefaultBucketSize    = 2
+	DefaultMaxIterations = 20
+	DefaultExpansion     = 1
+)
+
+var ErrFilterFull = errors.New("filter is full")
+
+// table is a fixed size cuckoo hash table of 16 bit fingerprints. A fingerprint of 0 marks an empty slot.
+type table struct {
+	numBuckets uint64 // Always a power of 2 so that the alternate bucket can be computed from either bucket
+	bucketSize uint64
+	slots      []uint16
+}
+
+func newTable(capacity uint64, bucketSize uint64) *table {
+	numBuckets := uint64(1)
+	for numBuckets*bucketSize < capacity {
+		numBuckets <<= 1
+	}
+	return &table{
+		numBuckets: numBuckets,
+		bucketSize: bucketSize,
+		slots:      make([]uint16, numBuckets*bucketSize),
+	}
+}
+
+func (t *table) bucket(i uint64) []uint16 {
+	return t.slots[i*t.bucketSize : (i+1)*t.bucketSize]
+}
+
+// indexes returns the two buckets the fingerprint can be stored in.
+func (t *table) indexes(h uint64, fp uint16) (uint64, uint64) {
+	mask := t.numBuckets - 1
+	i1 := h & mask
+	return i1, t.altIndex(i1, fp)
+}
+
+func (t *table) altIndex(i uint64, fp uint16) uint64 {
+	return (i ^ (uint64(fp) * 0x5bd1e995)) & (t.numBuckets - 1)
+}
+
+func (t *table) count(h uint64, fp uint16) int {
+	i1, i2 := t.indexes(h, fp)
+	n := 0
+	for _, slot := range t.bucket(i1) {
+		if slot == fp {
+			n += 1
+		}
+	}
+	if i2 != i1 {
+		for _, slot := range t.bucket(i2) {
+			if slot == fp {
+				n += 1
+			}
+		}
+	}
+	return n
+}
+
+func (t *table) insertInto(i uint64, fp uint16) bool {
+	bucket := t.bucket(i)
+	for j := range bucket {
+		if bucket[j] == 0 {
+			bucket[j] = fp
+			return true
+		}
+	}
+	return false
+}
+
+func (t *table) delete(h uint64, fp uint16) bool {
+	i1, i2 := t.indexes(h, fp)
+	for _, i := range []uint64{i1, i2} {
+		bucket := t.bucket(i)
+		for j := range bucket {
+			if bucket[j] == fp {
+				bucket[j] = 0
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Filter is a cuckoo filter. Unlike a bloom filter, items can be deleted.
+// When an item cannot be inserted into the current table, a new table is added
+// with its capacity multiplied by the expansion rate. An expansion rate of 0 disables scaling.
+type Filter struct {
+	capacity      uint64
+	bucketSize    uint64
+	maxIterations uint64
+	expansion     uint64
+	inserted      uint64
+	deleted       uint64
+	// Evictions are made in a fixed order rather than at random, so that every
+	// node in the cluster that applies the same commands builds the same filter.
+	kicks  uint64
+	tables []*table
+}
+
+func NewFilter(capacity, bucketSize, maxIterations, expansion uint64) (*Filter, error) {
+	if capacity < 1 {
+		return nil, errors.New("capacity must be greater than 0")
+	}
+	if bucketSize < 1 || bucketSize > 255 {
+		return nil, errors.New("bucket size must be between 1 and 255")
+	}
+	if maxIterations < 1 || maxIterations > 65535 {
+		return nil, errors.New("max iterations must be between 1 and 65535")
+	}
+	if expansion > 32768 {
+		return nil, errors.New("expansion must be between 0 and 32768")
+	}
+	return &Filter{
+		capacity:      capacity,
+		bucketSize:    bucketSize,
+		maxIterations: maxIterations,
+		expansion:     expansion,
+		tables:        []*table{newTable(capacity, bucketSize)},
+	}, nil
+}
+
+func hash(item string) (uint64, uint16) {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(item))
+	sum := h.Sum64()
+	// The fingerprint comes from the high bits so that it is independent of the bucket index
+	fp := uint16(sum>>48) % 65535
+	return sum, fp + 1
+}
+
+// Count returns the number of times the item may have been added.
+func (filter *Filter) Count(item string) int {
+	h, fp := hash(item)
+	n := 0
+	for _, t := range filter.tables {
+		n += t.count(h, fp)
+	}
+	return n
+}
+
+func (filter *Filter) Exists(item string) bool {
+	return filter.Count(item) > 0
+}
+
+// Add inserts the item. The same item can be added several times.
+func (filter *Filter) Add(item string) error {
+	h, fp := hash(item)
+
+	t := filter.tables[len(filter.tables)-1]
+	i1, i2 := t.indexes(h, fp)
+	if t.insertInto(i1, fp) || t.insertInto(i2, fp) {
+		filter.inserted += 1
+		return nil
+	}
+
+	// Relocate existing fingerprints to make room. The evictions are recorded so that they can be undone.
+	type eviction struct {
+		slot int
+		fp   uint16
+	}
+	var evictions []eviction
+
+	itemFP := fp
+	i := i1
+	if filter.kicks%2 == 1 {
+		i = i2
+	}
+	for n := uint64(0); n < filter.maxIterations; n++ {
+		j := int(filter.kicks % t.bucketSize)
+		filter.kicks += 1
+
+		slot := int(i*t.bucketSize) + j
+		evictions = append(evictions, eviction{slot: slot, fp: t.slots[slot]})
+		fp, t.slots[slot] = t.slots[slot], fp
+
+		i = t.altIndex(i, fp)
+		if t.insertInto(i, fp) {
+			filter.inserted += 1
+			return nil
+		}
+	}
+
+	// Undo the evictions so that the items that were already in the filter are not lost.
+	// The displaced fingerprint cannot be moved to a new table because the hash of its item is unknown.
+	for k := len(evictions) - 1; k >= 0; k-- {
+		t.slots[evictions[k].slot] = evictions[k].fp
+	}
+
+	if filter.expansion == 0 {
+		return ErrFilterFull
+	}
+
+	next := newTable(t.numBuckets*t.bucketSize*filter.expansion, t.bucketSize)
+	filter.tables = append(filter.tables, next)
+	i1, _ = next.indexes(h, itemFP)
+	next.insertInto(i1, itemFP)
+	filter.inserted += 1
+	return nil
+}
+
+// Delete removes one occurrence of the item. Returns false if the item was not found.
+// The newest tables are searched first.
+func (filter *Filter) Delete(item string) bool {
+	h, fp := hash(item)
+	for k := len(filter.tables) - 1; k >= 0; k-- {
+		if filter.tables[k].delete(h, fp) {
+			filter.deleted += 1
+			return true
+		}
+	}
+	return false
+}
+
+// Size returns the memory used by the tables of the filter in bytes.
+func (filter *Filter) Size() uint64 {
+	var size uint64
+	for _, t := range filter.tables {
+		size += uint64(len(t.slots) * 2)
+	}
+	return size
+}
+
+func (filter *Filter) NumBuckets() uint64 {
+	var buckets uint64
+	for _, t := range filter.tables {
+		buckets += t.numBuckets
+	}
+	return buckets
+}
+
+func (filter *Filter) NumFilters() int {
+	return len(filter.tables)
+}
+
+func (filter *Filter) Inserted() uint64 {
+	return filter.inserted
+}
+
+func (filter *Filter) Deleted() uint64 {
+	return filter.deleted
+}
+
+func (filter *Filter) BucketSize() uint64 {
+	return filter.bucketSize
+}
+
+func (filter *Filter) Expansion() uint64 {
+	return filter.expansion
+}
+
+func (filter *Filter) MaxIterations() uint64 {
+	return filter.maxIterations
+}
+
+// SnapshotType implements utils.SnapshotEncoder.
+func (filter *Filter) SnapshotType() string {
+	return "cuckoo"
+}
+
+// MarshalBinary implements utils.SnapshotEncoder. The filter is encoded as its parameters
+// followed by the fingerprints of each table.
+func (filter *Filter) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 0, 64+int(filter.Size()))
+	for _, v := range []uint64{
+		filter.capacity,
+		filter.bucketSize,
+		filter.maxIterations,
+		filter.expansion,
+		filter.inserted,
+		filter.deleted,
+		filter.kicks,
+		uint64(len(filter.tables)),
+	} {
+		b = binary.AppendUvarint(b, v)
+	}
+	for _, t := range filter.tables {
+		b = binary.AppendUvarint(b, t.numBuckets)
+		for _, slot := range t.slots {
+			b = binary.LittleEndian.AppendUint16(b, slot)
+		}
+	}
+	return b, nil
+}
+
+// DecodeSnapshot restores a filter that was encoded with MarshalBinary.
+func DecodeSnapshot(b []byte) (interface{}, error) {
+	invalid := errors.New("invalid cuckoo filter snapshot")
+
+	values := make([]uint64, 8)
+	for i := range values {
+		v, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, invalid
+		}
+		values[i] = v
+		b = b[n:]
+	}
+
+	filter := &Filter{
+		capacity:      values[0],
+		bucketSize:    values[1],
+		maxIterations: values[2],
+		expansion:     values[3],
+		inserted:      values[4],
+		deleted:       values[5],
+		kicks:         values[6],
+	}
+	if filter.bucketSize < 1 || values[7] < 1 {
+		return nil, invalid
+	}
+
+	for i := uint64(0); i < values[7]; i++ {
+		numBuckets, n := binary.Uvarint(b)
+		if n <= 0 || numBuckets == 0 || numBuckets&(numBuckets-1) != 0 {
+			return nil, invalid
+		}
+		b = b[n:]
+		if uint64(len(b)) < numBuckets*filter.bucketSize*2 {
+			return nil, invalid
+		}
+		t := &table{
+			numBuckets: numBuckets,
+			bucketSize: filter.bucketSize,
+			slots:      make([]uint16, numBuckets*filter.bucketSize),
+		}
+		for j := range t.slots {
+			t.slots[j] = binary.LittleEndian.Uint16(b)
+			b = b[2:]
+		}
+		filter.tables = append(filter.tables, t)
+	}
+
+	return filter, nil
+}
@@ -6,6 +6,9 @@ import (
 	"fmt"
 	"github.com/kelvinmwinuka/memstore/src/utils"
 	"net"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -32,56 +35,166 @@ func (p Plugin) Description() string {
 	return p.description
 }
 
-func handleSet(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
+// setOptions are the options accepted by SET after the key and value.
+type setOptions struct {
+	nx, xx    bool
+	get       bool
+	keepTTL   bool
+	expireAt  time.Time
+	ifEq      *string
+	ifVersion *uint64
+}
 
-	switch x := len(cmd); {
-	default:
-		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
-	case x == 3:
-		key := cmd[1]
+func parseSetOptions(ctx context.Context, cmd []string) (setOptions, error) {
+	var options setOptions
+	hasExpiry := false
 
-		if !server.KeyExists(key) {
-			_, err := server.CreateKeyAndLock(ctx, key)
+	for i := 0; i < len(cmd); i++ {
+		switch option := strings.ToLower(cmd[i]); option {
+		default:
+			return options, fmt.Errorf("unknown option %s", cmd[i])
+		case "nx":
+			options.nx = true
+		case "xx":
+			options.xx = true
+		case "get":
+			options.get = true
+		case "keepttl":
+			if hasExpiry {
+				return options, errors.New("only one of EX, PX, EXAT, PXAT or KEEPTTL can be specified")
+			}
+			options.keepTTL = true
+			hasExpiry = true
+		case "ex", "px", "exat", "pxat":
+			if hasExpiry {
+				return options, errors.New("only one of EX, PX, EXAT, PXAT or KEEPTTL can be specified")
+			}
+			if i+1 >= len(cmd) {
+				return options, errors.New(utils.WRONG_ARGS_RESPONSE)
+			}
+			expireAt, err := utils.ParseExpiry(utils.Now(ctx), option, cmd[i+1])
 			if err != nil {
-				return nil, err
+				return options, err
 			}
-			server.SetValue(ctx, key, utils.AdaptType(cmd[2]))
-			server.KeyUnlock(key)
-			return []byte(utils.OK_RESPONSE), nil
+			options.expireAt = expireAt
+			hasExpiry = true
+			i++
+		case "ifeq":
+			if i+1 >= len(cmd) {
+				return options, errors.New(utils.WRONG_ARGS_RESPONSE)
+			}
+			options.ifEq = &cmd[i+1]
+			i++
+		case "ifversion":
+			if i+1 >= len(cmd) {
+				return options, errors.New(utils.WRONG_ARGS_RESPONSE)
+			}
+			version, err := strconv.ParseUint(cmd[i+1], 10, 64)
+			if err != nil {
+				return options, errors.New("version must be a non-negative integer")
+			}
+			options.ifVersion = &version
+			i++
 		}
+	}
 
-		if _, err := server.KeyLock(ctx, key); err != nil {
-			return nil, err
+	conditions := 0
+	for _, set := range []bool{options.nx, options.xx, options.ifEq != nil, options.ifVersion != nil} {
+		if set {
+			conditions++
 		}
-
-		server.SetValue(ctx, key, utils.AdaptType(cmd[2]))
-		server.KeyUnlock(key)
-		return []byte(utils.OK_RESPONSE), nil
 	}
+	if conditions > 1 {
+		return options, errors.New("only one of NX, XX, IFEQ or IFVERSION can be specified")
+	}
+
+	return options, nil
 }
 
-func handleSetNX(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
-	switch x := len(cmd); {
-	default:
+func handleSet(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if len(cmd) < 3 {
 		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
-	case x == 3:
-		key := cmd[1]
-		if server.KeyExists(key) {
-			return nil, fmt.Errorf("key %s already exists", cmd[1])
+	}
+
+	key := cmd[1]
+
+	options, err := parseSetOptions(ctx, cmd[3:])
+	if err != nil {
+		return nil, err
+	}
+
+	// XX, IFEQ and IFVERSION never create the key, so they only lock it if it already exists
+	mustExist := options.xx || options.ifEq != nil || options.ifVersion != nil
+
+	if !server.KeyExists(key) {
+		if mustExist {
+			return []byte("$-1\r\n\n"), nil
 		}
-		// TODO: Retry CreateKeyAndLock until we manage to obtain the key
-		_, err := server.CreateKeyAndLock(ctx, key)
-		if err != nil {
+		if _, err = server.CreateKeyAndLock(ctx, key); err != nil {
 			return nil, err
 		}
-		server.SetValue(ctx, key, utils.AdaptType(cmd[2]))
-		server.KeyUnlock(key)
+	} else if _, err = server.KeyLock(ctx, key); err != nil {
+		return nil, err
+	}
+	defer server.KeyUnlock(key)
+
+	previous := server.GetValue(key)
+	old, ok := previous.(string)
+	if options.get && previous != nil && !ok {
+		return nil, fmt.Errorf("value at key %s is not a string", key)
+	}
+
+	oldValue := "$-1\r\n\n"
+	if previous != nil {
+		oldValue = fmt.Sprintf("$%d\r\n%s\r\n\n", len(old), old)
+	}
+
+	var matched bool
+	switch {
+	default:
+		matched = true
+	case options.nx:
+		matched = previous == nil
+	case mustExist && previous == nil:
+		matched = false
+	case options.ifEq != nil:
+		matched = ok && old == *options.ifEq
+	case options.ifVersion != nil:
+		matched = server.GetVersion(key) == *options.ifVersion
+	}
+
+	if !matched {
+		if options.get {
+			return []byte(oldValue), nil
+		}
+		return []byte("$-1\r\n\n"), nil
+	}
+
+	server.SetValue(ctx, key, cmd[2])
+	if !options.keepTTL {
+		server.SetExpiry(ctx, key, options.expireAt)
+	}
+	server.NotifyKeyspaceEvent(ctx, utils.StringEvents, "set", key)
+	if !options.expireAt.IsZero() {
+		server.NotifyKeyspaceEvent(ctx, utils.GenericEvents, "expire", key)
+	}
+
+	if options.get {
+		return []byte(oldValue), nil
 	}
 	return []byte(utils.OK_RESPONSE), nil
 }
 
+func handleSetNX(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) != 3 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+	return handleSet(ctx, append([]string{"set"}, cmd[1], cmd[2], "nx"), server, conn)
+}
+
 func handleMSet(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
 	ctx, cancel := context.WithTimeout(ctx, 250*time.Millisecond)
 	defer cancel()
@@ -110,7 +223,7 @@ func handleMSet(ctx context.Context, cmd []string, server utils.Server, conn *ne
 	for i, key := range cmd[1:] {
 		if i%2 == 0 {
 			entries[key] = KeyObject{
-				value:  utils.AdaptType(cmd[1:][i+1]),
+				value:  cmd[1:][i+1],
 				locked: false,
 			}
 		}
@@ -135,11 +248,102 @@ func handleMSet(ctx context.Context, cmd []string, server utils.Server, conn *ne
 	// Set all the values
 	for k, v := range entries {
 		server.SetValue(ctx, k, v.value)
+		server.SetExpiry(ctx, k, time.Time{})
+		server.NotifyKeyspaceEvent(ctx, utils.StringEvents, "set", k)
 	}
 
 	return []byte(utils.OK_RESPONSE), nil
 }
 
+func handleSetEx(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) != 4 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	key := cmd[1]
+
+	option := "ex"
+	if strings.EqualFold(cmd[0], "psetex") {
+		option = "px"
+	}
+	expireAt, err := utils.ParseExpiry(utils.Now(ctx), option, cmd[2])
+	if err != nil {
+		return nil, err
+	}
+
+	if !server.KeyExists(key) {
+		if _, err = server.CreateKeyAndLock(ctx, key); err != nil {
+			return nil, err
+		}
+	} else if _, err = server.KeyLock(ctx, key); err != nil {
+		return nil, err
+	}
+	defer server.KeyUnlock(key)
+
+	server.SetValue(ctx, key, cmd[3])
+	server.SetExpiry(ctx, key, expireAt)
+	server.NotifyKeyspaceEvent(ctx, utils.StringEvents, "set", key)
+	server.NotifyKeyspaceEvent(ctx, utils.GenericEvents, "expire", key)
+
+	return []byte(utils.OK_RESPONSE), nil
+}
+
+func handleMSetNX(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, 250*time.Millisecond)
+	defer cancel()
+
+	if len(cmd) < 3 || len(cmd[1:])%2 != 0 {
+		return nil, errors.New("each key must have a matching value")
+	}
+
+	values := make(map[string]interface{})
+	for i := 1; i < len(cmd); i += 2 {
+		values[cmd[i]] = cmd[i+1]
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		if server.KeyExists(key) {
+			return []byte(":0\r\n\n"), nil
+		}
+		keys = append(keys, key)
+	}
+	// Lock the keys in a fixed order so that concurrent MSETNX calls cannot deadlock
+	slices.Sort(keys)
+
+	var locked []string
+	defer func() {
+		for _, key := range locked {
+			server.KeyUnlock(key)
+		}
+	}()
+
+	for _, key := range keys {
+		if _, err := server.CreateKeyAndLock(ctx, key); err != nil {
+			return nil, err
+		}
+		locked = append(locked, key)
+		if server.GetValue(key) == nil {
+			continue
+		}
+		// Another client set this key after it was checked. The keys locked before it have no value,
+		// so they are removed before their locks are released.
+		server.KeyUnlock(key)
+		for _, k := range locked[:len(locked)-1] {
+			server.DeleteLockedKey(ctx, k)
+		}
+		locked = nil
+		return []byte(":0\r\n\n"), nil
+	}
+
+	for _, key := range keys {
+		server.SetValue(ctx, key, values[key])
+		server.NotifyKeyspaceEvent(ctx, utils.StringEvents, "set", key)
+	}
+
+	return []byte(":1\r\n\n"), nil
+}
+
 func NewModule() Plugin {
 	SetModule := Plugin{
 		name: "OtherCommands",
@@ -147,10 +351,10 @@ func NewModule() Plugin {
 			{
 				Command:     "set",
 				Categories:  []string{utils.WriteCategory, utils.SlowCategory},
-				Description: "(SET key value) Set the value of a key, considering the value's type.",
+				Description: `(SET key value [NX | XX | IFEQ value | IFVERSION version] [GET] [EX seconds | PX milliseconds | EXAT unix-time-seconds | PXAT unix-time-milliseconds | KEEPTTL]) Set the value of a key. NX only sets a new key. XX, IFEQ and IFVERSION only set an existing key, IFEQ when its value matches and IFVERSION when its version matches. GET returns the previous value instead of OK.`,
 				Sync:        true,
 				KeyExtractionFunc: func(cmd []string) ([]string, error) {
-					if len(cmd) != 3 {
+					if len(cmd) < 3 {
 						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
 					}
 					return []string{cmd[1]}, nil
@@ -160,7 +364,7 @@ func NewModule() Plugin {
 			{
 				Command:     "setnx",
 				Categories:  []string{utils.WriteCategory, utils.SlowCategory},
-				Description: "(SETNX key value) Set the key/value only if the key doesn't exist.",
+				Description: "(SETNX key value) Set the key/value only if the key doesn't exist. Returns nil if the key already exists.",
 				Sync:        true,
 				KeyExtractionFunc: func(cmd []string) ([]string, error) {
 					if len(cmd) != 3 {
@@ -189,6 +393,51 @@ func NewModule() Plugin {
 				},
 				HandlerFunc: handleMSet,
 			},
+			{
+				Command:     "setex",
+				Categories:  []string{utils.WriteCategory, utils.SlowCategory},
+				Description: "(SETEX key seconds value) Set the value of a key and make it expire after the given number of seconds.",
+				Sync:        true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) != 4 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return []string{cmd[1]}, nil
+				},
+				HandlerFunc: handleSetEx,
+			},
+			{
+				Command:     "psetex",
+				Categories:  []string{utils.WriteCategory, utils.SlowCategory},
+				Description: "(PSETEX key milliseconds value) Set the value of a key and make it expire after the given number of milliseconds.",
+				Sync:        true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) != 4 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return []string{cmd[1]}, nil
+				},
+				HandlerFunc: handleSetEx,
+			},
+			{
+				Command:     "msetnx",
+				Categories:  []string{utils.WriteCategory, utils.SlowCategory},
+				Description: "(MSETNX key value [key value ...]) Set multiple key/value pairs only if none of the keys exist.",
+				Sync:        true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 3 || len(cmd[1:])%2 != 0 {
+						return nil, errors.New("each key must be paired with a value")
+					}
+					var keys []string
+					for i, key := range cmd[1:] {
+						if i%2 == 0 {
+							keys = append(keys, key)
+						}
+					}
+					return keys, nil
+				},
+				HandlerFunc: handleMSetNX,
+			},
 		},
 		description: "Handle basic SET commands",
 	}
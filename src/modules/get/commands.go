@@ -35,7 +35,7 @@ func handleGet(ctx context.Context, cmd []string, server utils.Server, conn *net
 	key := cmd[1]
 
 	if !server.KeyExists(key) {
-		return []byte("+nil\r\n\n"), nil
+		return []byte("$-1\r\n\n"), nil
 	}
 
 	_, err := server.KeyRLock(ctx, key)
@@ -45,11 +45,13 @@ func handleGet(ctx context.Context, cmd []string, server utils.Server, conn *net
 	value := server.GetValue(key)
 	server.KeyRUnlock(key)
 
-	switch value.(type) {
+	switch v := value.(type) {
 	default:
-		return []byte(fmt.Sprintf("+%v\r\n\n", value)), nil
+		return nil, fmt.Errorf("value at key %s is not a string", key)
 	case nil:
-		return []byte("+nil\r\n\n"), nil
+		return []byte("$-1\r\n\n"), nil
+	case string:
+		return []byte(fmt.Sprintf("$%d\r\n%s\r\n\n", len(v), v)), nil
 	}
 }
 
@@ -58,30 +60,36 @@ func handleMGet(ctx context.Context, cmd []string, server utils.Server, conn *ne
 		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
 	}
 
-	vals := []string{}
+	// A nil entry is returned for keys that do not exist or do not hold a string
+	vals := []*string{}
 
 	for _, key := range cmd[1:] {
 		func(key string) {
 			if !server.KeyExists(key) {
-				vals = append(vals, "nil")
+				vals = append(vals, nil)
 				return
 			}
-			server.KeyRLock(ctx, key)
-			switch server.GetValue(key).(type) {
-			default:
-				vals = append(vals, fmt.Sprintf("%v", server.GetValue(key)))
-			case nil:
-				vals = append(vals, "nil")
+			if _, err := server.KeyRLock(ctx, key); err != nil {
+				vals = append(vals, nil)
+				return
 			}
-			server.KeyRUnlock(key)
-
+			defer server.KeyRUnlock(key)
+			if s, ok := server.GetValue(key).(string); ok {
+				vals = append(vals, &s)
+				return
+			}
+			vals = append(vals, nil)
 		}(key)
 	}
 
 	bytes := []byte(fmt.Sprintf("*%d\r\n", len(vals)))
 
 	for _, val := range vals {
-		bytes = append(bytes, []byte(fmt.Sprintf("$%d\r\n%s\r\n", len(val), val))...)
+		if val == nil {
+			bytes = append(bytes, []byte("$-1\r\n")...)
+			continue
+		}
+		bytes = append(bytes, []byte(fmt.Sprintf("$%d\r\n%s\r\n", len(*val), *val))...)
 	}
 
 	bytes = append(bytes, []byte("\n")...)
@@ -89,6 +97,25 @@ func handleMGet(ctx context.Context, cmd []string, server utils.Server, conn *ne
 	return bytes, nil
 }
 
+func handleGetVersion(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) != 2 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	key := cmd[1]
+
+	if !server.KeyExists(key) {
+		return []byte("$-1\r\n\n"), nil
+	}
+
+	if _, err := server.KeyRLock(ctx, key); err != nil {
+		return nil, err
+	}
+	defer server.KeyRUnlock(key)
+
+	return []byte(fmt.Sprintf(":%d\r\n\n", server.GetVersion(key))), nil
+}
+
 func NewModule() Plugin {
 	GetModule := Plugin{
 		name: "GetCommands",
@@ -119,6 +146,19 @@ func NewModule() Plugin {
 				},
 				HandlerFunc: handleMGet,
 			},
+			{
+				Command:     "getversion",
+				Categories:  []string{utils.ReadCategory, utils.FastCategory},
+				Description: "(GETVERSION key) Get the version of the key's value, which increases every time the value is written. Versions are never reused, even after the key is deleted and created again. Use it with SET IFVERSION.",
+				Sync:        false,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) != 2 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return []string{cmd[1]}, nil
+				},
+				HandlerFunc: handleGetVersion,
+			},
 		},
 		description: "Handle basic GET and MGET commands",
 	}
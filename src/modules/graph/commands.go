@@ -0,0 +1,419 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/kelvinmwinuka/memstore/src/utils"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type Plugin struct {
+	name        string
+	commands    []utils.Command
+	description string
+}
+
+func (p Plugin) Name() string {
+	return p.name
+}
+
+func (p Plugin) Commands() []utils.Command {
+	return p.commands
+}
+
+func (p Plugin) Description() string {
+	return p.description
+}
+
+// SnapshotDecoders implements utils.SnapshotPlugin.
+func (p Plugin) SnapshotDecoders() map[string]utils.SnapshotDecoder {
+	return map[string]utils.SnapshotDecoder{
+		"graph": DecodeSnapshot,
+	}
+}
+
+func handleGraphQuery(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) != 3 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	key := cmd[1]
+	readOnly := strings.EqualFold(cmd[0], "graph.ro_query")
+
+	query, err := ParseQuery(cmd[2])
+	if err != nil {
+		return nil, err
+	}
+
+	if query.ReadOnly() {
+		if !server.KeyExists(key) {
+			// Reading from a graph that does not exist behaves like reading from an empty graph
+			result, err := Execute(NewGraph(), query)
+			if err != nil {
+				return nil, err
+			}
+			return formatResult(result), nil
+		}
+
+		if _, err = server.KeyRLock(ctx, key); err != nil {
+			return nil, err
+		}
+		defer server.KeyRUnlock(key)
+
+		graph, ok := server.GetValue(key).(*Graph)
+		if !ok {
+			return nil, fmt.Errorf("value at %s is not a graph", key)
+		}
+
+		result, err := Execute(graph, query)
+		if err != nil {
+			return nil, err
+		}
+		return formatResult(result), nil
+	}
+
+	if readOnly {
+		return nil, errors.New("GRAPH.RO_QUERY cannot be used with queries that modify the graph")
+	}
+
+	// The query runs against a clone of the graph, so a query that fails leaves the graph unchanged.
+	// The mutations that it made are then replicated with GRAPH.APPLY, which rejects them if another query
+	// modified the graph in the meantime, in which case the query is run again.
+	for attempt := 0; attempt < maxQueryAttempts; attempt++ {
+		graph, err := cloneGraph(ctx, server, key)
+		if err != nil {
+			return nil, err
+		}
+
+		result, err := Execute(graph, query)
+		if err != nil {
+			return nil, err
+		}
+		if len(result.Mutations) == 0 {
+			return formatResult(result), nil
+		}
+
+		mutations, err := EncodeMutations(result.Mutations)
+		if err != nil {
+			return nil, err
+		}
+		revision := strconv.FormatUint(graph.Revision(), 10)
+		if _, err = server.Replicate(ctx, []string{"graph.apply", key, revision, string(mutations)}); err != nil {
+			if errors.Is(err, errRevisionChanged) {
+				continue
+			}
+			return nil, err
+		}
+
+		return formatResult(result), nil
+	}
+
+	return nil, fmt.Errorf("graph %s is being modified by other queries, try again", key)
+}
+
+// maxQueryAttempts is the number of times that a query is run before giving up on a graph
+// that keeps being modified by other queries.
+const maxQueryAttempts = 5
+
+var errRevisionChanged = errors.New("graph was modified by another query")
+
+// cloneGraph returns a clone of the graph stored at key, or an empty graph if the key does not exist.
+func cloneGraph(ctx context.Context, server utils.Server, key string) (*Graph, error) {
+	if !server.KeyExists(key) {
+		return NewGraph(), nil
+	}
+
+	if _, err := server.KeyRLock(ctx, key); err != nil {
+		return nil, err
+	}
+	defer server.KeyRUnlock(key)
+
+	graph, ok := server.GetValue(key).(*Graph)
+	if !ok {
+		return nil, fmt.Errorf("value at %s is not a graph", key)
+	}
+	return graph.Clone(), nil
+}
+
+// handleGraphApply applies the mutations made by a query to the graph, creating the graph if it does not exist.
+// The mutations are rejected if the graph is no longer at the revision that the query ran against.
+func handleGraphApply(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) != 4 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	key := cmd[1]
+
+	revision, err := strconv.ParseUint(cmd[2], 10, 64)
+	if err != nil {
+		return nil, errors.New("revision must be a positive integer")
+	}
+	mutations, err := DecodeMutations([]byte(cmd[3]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid mutations: %v", err)
+	}
+
+	created := false
+	if !server.KeyExists(key) {
+		if _, err = server.CreateKeyAndLock(ctx, key); err != nil {
+			return nil, err
+		}
+		server.SetValue(ctx, key, NewGraph())
+		created = true
+	} else if _, err = server.KeyLock(ctx, key); err != nil {
+		return nil, err
+	}
+
+	graph, ok := server.GetValue(key).(*Graph)
+	if !ok {
+		server.KeyUnlock(key)
+		return nil, fmt.Errorf("value at %s is not a graph", key)
+	}
+
+	if graph.Revision() != revision {
+		err = errRevisionChanged
+	} else {
+		// The mutations are applied to a clone so that the graph is left unchanged if any of them fails
+		graph = graph.Clone()
+		err = graph.Apply(mutations)
+	}
+
+	if err != nil {
+		if created {
+			server.DeleteLockedKey(ctx, key)
+		} else {
+			server.KeyUnlock(key)
+		}
+		return nil, err
+	}
+
+	server.SetValue(ctx, key, graph)
+	server.KeyUnlock(key)
+
+	return []byte(utils.OK_RESPONSE), nil
+}
+
+func handleGraphDelete(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) != 2 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	key := cmd[1]
+
+	if !server.KeyExists(key) {
+		return nil, fmt.Errorf("graph %s does not exist", key)
+	}
+
+	if _, err := server.KeyRLock(ctx, key); err != nil {
+		return nil, err
+	}
+	_, ok := server.GetValue(key).(*Graph)
+	server.KeyRUnlock(key)
+
+	if !ok {
+		return nil, fmt.Errorf("value at %s is not a graph", key)
+	}
+
+	if err := server.DeleteKey(ctx, key); err != nil {
+		return nil, err
+	}
+
+	return []byte(utils.OK_RESPONSE), nil
+}
+
+func handleGraphList(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) != 1 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	var graphs []string
+	for _, key := range server.GetAllKeys(ctx) {
+		if _, err := server.KeyRLock(ctx, key); err != nil {
+			// The key was deleted after the keys were listed
+			continue
+		}
+		if _, ok := server.GetValue(key).(*Graph); ok {
+			graphs = append(graphs, key)
+		}
+		server.KeyRUnlock(key)
+	}
+	slices.Sort(graphs)
+
+	res := fmt.Sprintf("*%d\r\n", len(graphs))
+	for _, name := range graphs {
+		res += bulkString(name)
+	}
+	res += "\r\n"
+
+	return []byte(res), nil
+}
+
+// formatResult encodes the result of a query. Queries with a RETURN clause reply with
+// [columns, rows, statistics]; other queries reply with [statistics] only.
+func formatResult(result *Result) []byte {
+	var res string
+
+	if result.returns {
+		res = "*3\r\n"
+		res += fmt.Sprintf("*%d\r\n", len(result.Columns))
+		for _, column := range result.Columns {
+			res += bulkString(column)
+		}
+		res += fmt.Sprintf("*%d\r\n", len(result.Rows))
+		for _, r := range result.Rows {
+			res += fmt.Sprintf("*%d\r\n", len(r))
+			for _, value := range r {
+				res += formatValue(value)
+			}
+		}
+	} else {
+		res = "*1\r\n"
+	}
+
+	var statistics []string
+	for _, stat := range []struct {
+		name  string
+		count int
+	}{
+		{"Nodes created", result.Statistics.NodesCreated},
+		{"Nodes deleted", result.Statistics.NodesDeleted},
+		{"Relationships created", result.Statistics.RelationshipsCreated},
+		{"Relationships deleted", result.Statistics.RelationshipsDeleted},
+		{"Properties set", result.Statistics.PropertiesSet},
+	} {
+		if stat.count > 0 {
+			statistics = append(statistics, fmt.Sprintf("%s: %d", stat.name, stat.count))
+		}
+	}
+	res += fmt.Sprintf("*%d\r\n", len(statistics))
+	for _, stat := range statistics {
+		res += bulkString(stat)
+	}
+
+	res += "\r\n"
+	return []byte(res)
+}
+
+// formatValue encodes a single value of a result row. Nodes and relationships are encoded as JSON objects.
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "$-1\r\n"
+	case int64:
+		return fmt.Sprintf(":%d\r\n", v)
+	case float64:
+		return bulkString(strconv.FormatFloat(v, 'f', -1, 64))
+	case bool:
+		return bulkString(strconv.FormatBool(v))
+	case string:
+		return bulkString(v)
+	case []interface{}:
+		res := fmt.Sprintf("*%d\r\n", len(v))
+		for _, item := range v {
+			res += formatValue(item)
+		}
+		return res
+	case *Node:
+		b, _ := json.Marshal(map[string]interface{}{
+			"id":         v.ID,
+			"labels":     v.Labels,
+			"properties": v.Properties,
+		})
+		return bulkString(string(b))
+	case *Edge:
+		b, _ := json.Marshal(map[string]interface{}{
+			"id":         v.ID,
+			"type":       v.Type,
+			"src":        v.Source,
+			"dst":        v.Target,
+			"properties": v.Properties,
+		})
+		return bulkString(string(b))
+	}
+	return bulkString(fmt.Sprint(value))
+}
+
+func bulkString(s string) string {
+	return fmt.Sprintf("$%d\r\n%s\r\n", len(s), s)
+}
+
+func NewModule() Plugin {
+	GraphModule := Plugin{
+		name: "GraphCommands",
+		commands: []utils.Command{
+			{
+				Command:    "graph.query",
+				Categories: []string{utils.GraphCategory, utils.WriteCategory, utils.SlowCategory},
+				Description: `(GRAPH.QUERY key query) Runs a Cypher query against the graph stored at key.
+The graph is created if the query modifies it and it does not exist yet. In a cluster, queries that modify
+the graph must be sent to the leader, and the changes that they make are replicated with GRAPH.APPLY.`,
+				Sync: false,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) != 3 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleGraphQuery,
+			},
+			{
+				Command:     "graph.ro_query",
+				Categories:  []string{utils.GraphCategory, utils.ReadCategory, utils.SlowCategory},
+				Description: "(GRAPH.RO_QUERY key query) Runs a Cypher query that does not modify the graph stored at key.",
+				Sync:        false,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) != 3 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleGraphQuery,
+			},
+			{
+				Command:    "graph.apply",
+				Categories: []string{utils.GraphCategory, utils.WriteCategory, utils.SlowCategory},
+				Description: `(GRAPH.APPLY key revision mutations) Applies the changes that a query made to the graph
+stored at key, if the graph is still at the revision that the query ran against. Used by GRAPH.QUERY to
+replicate its changes and not meant to be called directly.`,
+				Sync: true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) != 4 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleGraphApply,
+			},
+			{
+				Command:     "graph.delete",
+				Categories:  []string{utils.GraphCategory, utils.WriteCategory, utils.SlowCategory},
+				Description: "(GRAPH.DELETE key) Deletes the graph stored at key.",
+				Sync:        true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) != 2 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleGraphDelete,
+			},
+			{
+				Command:     "graph.list",
+				Categories:  []string{utils.GraphCategory, utils.ReadCategory, utils.SlowCategory},
+				Description: "(GRAPH.LIST) Returns the keys of all the graphs.",
+				Sync:        false,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					return []string{}, nil
+				},
+				HandlerFunc: handleGraphList,
+			},
+		},
+		description: "Handle property graph commands",
+	}
+	return GraphModule
+}
@@ -0,0 +1,722 @@
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type Statistics struct {
+	NodesCreated         int
+	NodesDeleted         int
+	RelationshipsCreated int
+	RelationshipsDeleted int
+	PropertiesSet        int
+}
+
+type Result struct {
+	Columns    []string
+	Rows       [][]interface{}
+	Statistics Statistics
+	Mutations  []Mutation // The changes that the query made to the graph, in the order that they were made
+	returns    bool
+}
+
+type executor struct {
+	graph  *Graph
+	result *Result
+}
+
+// Execute runs the query against the graph. Matching is done in node and edge ID order,
+// so the same query run against identical graphs produces identical results and mutations.
+// The graph is left partly modified if an error is returned, so queries that modify a graph should be run
+// against a clone of it, and the mutations in the result applied to the graph once the query has succeeded.
+func Execute(graph *Graph, query *Query) (*Result, error) {
+	e := &executor{graph: graph, result: &Result{}}
+	rows := []row{{}}
+
+	for _, clause := range query.clauses {
+		var err error
+		switch c := clause.(type) {
+		case *matchClause:
+			rows, err = e.match(c, rows)
+		case *createClause:
+			rows, err = e.create(c, rows)
+		case *deleteClause:
+			err = e.delete(c, rows)
+		case *returnClause:
+			err = e.project(c, rows)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return e.result, nil
+}
+
+func (e *executor) match(clause *matchClause, rows []row) ([]row, error) {
+	for _, pattern := range clause.patterns {
+		var res []row
+		for _, r := range rows {
+			matches, err := e.matchPath(pattern, r)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, matches...)
+		}
+		rows = res
+	}
+
+	if clause.where == nil {
+		return rows, nil
+	}
+
+	var res []row
+	for _, r := range rows {
+		ok, err := evalBool(clause.where, r)
+		if err != nil {
+			return nil, err
+		}
+		if ok == true {
+			res = append(res, r)
+		}
+	}
+	return res, nil
+}
+
+func (e *executor) matchPath(pattern *pathPattern, r row) ([]row, error) {
+	var res []row
+
+	// Edges may only be traversed once in each path
+	used := make(map[uint64]bool)
+
+	var expand func(i int, current *Node, r row) error
+	expand = func(i int, current *Node, r row) error {
+		if i == len(pattern.rels) {
+			res = append(res, r)
+			return nil
+		}
+
+		rel := pattern.rels[i]
+		next := pattern.nodes[i+1]
+
+		// visit binds the relationship and the node at the end of it, then matches the rest of the path
+		visit := func(node *Node, value interface{}) error {
+			ok, r, err := e.bindNode(next, node, r)
+			if err != nil || !ok {
+				return err
+			}
+			if rel.variable != "" {
+				if bound, ok := r[rel.variable]; ok && !equal(bound, value) {
+					return nil
+				}
+				r = r.with(rel.variable, value)
+			}
+			return expand(i+1, node, r)
+		}
+
+		if !rel.varLength {
+			for _, edge := range e.graph.Relationships(current.ID, rel.direction) {
+				if used[edge.ID] {
+					continue
+				}
+				if ok, err := e.edgeMatches(edge, rel, r); err != nil || !ok {
+					if err != nil {
+						return err
+					}
+					continue
+				}
+				used[edge.ID] = true
+				err := visit(e.graph.nodes[otherEnd(edge, current.ID)], edge)
+				delete(used, edge.ID)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		var walk func(node *Node, trail []interface{}) error
+		walk = func(node *Node, trail []interface{}) error {
+			if len(trail) >= rel.minHops {
+				if err := visit(node, slices.Clone(trail)); err != nil {
+					return err
+				}
+			}
+			if rel.maxHops != -1 && len(trail) >= rel.maxHops {
+				return nil
+			}
+			for _, edge := range e.graph.Relationships(node.ID, rel.direction) {
+				if used[edge.ID] {
+					continue
+				}
+				if ok, err := e.edgeMatches(edge, rel, r); err != nil || !ok {
+					if err != nil {
+						return err
+					}
+					continue
+				}
+				used[edge.ID] = true
+				err := walk(e.graph.nodes[otherEnd(edge, node.ID)], append(trail, edge))
+				delete(used, edge.ID)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		return walk(current, []interface{}{})
+	}
+
+	first := pattern.nodes[0]
+	var candidates []*Node
+	if bound, ok := r[first.variable]; ok && first.variable != "" {
+		node, ok := bound.(*Node)
+		if !ok {
+			return nil, fmt.Errorf("variable %s is not a node", first.variable)
+		}
+		candidates = []*Node{node}
+	} else {
+		candidates = e.graph.Nodes()
+	}
+
+	for _, node := range candidates {
+		ok, r, err := e.bindNode(first, node, r)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		if err = expand(0, node, r); err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
+
+// bindNode checks the node against the pattern and returns the row with the pattern's variable bound to the node.
+func (e *executor) bindNode(pattern *nodePattern, node *Node, r row) (bool, row, error) {
+	if pattern.variable != "" {
+		if bound, ok := r[pattern.variable]; ok {
+			if _, isNode := bound.(*Node); !isNode {
+				return false, nil, fmt.Errorf("variable %s is not a node", pattern.variable)
+			}
+			if !equal(bound, node) {
+				return false, nil, nil
+			}
+		}
+	}
+	for _, label := range pattern.labels {
+		if !node.HasLabel(label) {
+			return false, nil, nil
+		}
+	}
+	if ok, err := propertiesMatch(node.Properties, pattern.properties, r); err != nil || !ok {
+		return false, nil, err
+	}
+	if pattern.variable != "" {
+		r = r.with(pattern.variable, node)
+	}
+	return true, r, nil
+}
+
+func (e *executor) edgeMatches(edge *Edge, pattern *relPattern, r row) (bool, error) {
+	if len(pattern.types) > 0 && !slices.Contains(pattern.types, edge.Type) {
+		return false, nil
+	}
+	return propertiesMatch(edge.Properties, pattern.properties, r)
+}
+
+func propertiesMatch(properties map[string]interface{}, pattern map[string]expression, r row) (bool, error) {
+	for key, expr := range pattern {
+		value, err := expr.eval(r)
+		if err != nil {
+			return false, err
+		}
+		if !equal(properties[key], value) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func otherEnd(edge *Edge, node uint64) uint64 {
+	if edge.Source == node {
+		return edge.Target
+	}
+	return edge.Source
+}
+
+func (e *executor) create(clause *createClause, rows []row) ([]row, error) {
+	res := make([]row, 0, len(rows))
+
+	for _, r := range rows {
+		for _, pattern := range clause.patterns {
+			nodes := make([]*Node, len(pattern.nodes))
+			for i, np := range pattern.nodes {
+				if bound, ok := r[np.variable]; ok && np.variable != "" {
+					node, ok := bound.(*Node)
+					if !ok {
+						return nil, fmt.Errorf("variable %s is not a node", np.variable)
+					}
+					if len(np.labels) > 0 || len(np.properties) > 0 {
+						return nil, fmt.Errorf("variable %s is already declared", np.variable)
+					}
+					nodes[i] = node
+					continue
+				}
+				properties, err := e.evalProperties(np.properties, r)
+				if err != nil {
+					return nil, err
+				}
+				nodes[i] = e.graph.AddNode(slices.Clone(np.labels), properties)
+				e.result.Statistics.NodesCreated += 1
+				e.result.Mutations = append(e.result.Mutations, Mutation{Op: createNode, Node: nodes[i]})
+				if np.variable != "" {
+					r = r.with(np.variable, nodes[i])
+				}
+			}
+
+			for i, rel := range pattern.rels {
+				if _, ok := r[rel.variable]; ok && rel.variable != "" {
+					return nil, fmt.Errorf("variable %s is already declared", rel.variable)
+				}
+				properties, err := e.evalProperties(rel.properties, r)
+				if err != nil {
+					return nil, err
+				}
+				source, target := nodes[i], nodes[i+1]
+				if rel.direction == -1 {
+					source, target = target, source
+				}
+				edge, err := e.graph.AddEdge(rel.types[0], source.ID, target.ID, properties)
+				if err != nil {
+					return nil, err
+				}
+				e.result.Statistics.RelationshipsCreated += 1
+				e.result.Mutations = append(e.result.Mutations, Mutation{Op: createEdge, Edge: edge})
+				if rel.variable != "" {
+					r = r.with(rel.variable, edge)
+				}
+			}
+		}
+		res = append(res, r)
+	}
+
+	return res, nil
+}
+
+// evalProperties evaluates the property map of a pattern. Null properties are not stored.
+func (e *executor) evalProperties(pattern map[string]expression, r row) (map[string]interface{}, error) {
+	properties := make(map[string]interface{}, len(pattern))
+	for key, expr := range pattern {
+		value, err := expr.eval(r)
+		if err != nil {
+			return nil, err
+		}
+		if value == nil {
+			continue
+		}
+		if err = validProperty(value); err != nil {
+			return nil, fmt.Errorf("invalid value for property %s: %v", key, err)
+		}
+		properties[key] = value
+		e.result.Statistics.PropertiesSet += 1
+	}
+	return properties, nil
+}
+
+// validProperty checks that the value can be stored as a property and written to snapshots.
+func validProperty(value interface{}) error {
+	switch v := value.(type) {
+	case *Node, *Edge:
+		return fmt.Errorf("%s cannot be stored as a property", typeName(value))
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return errors.New("numbers must be finite")
+		}
+	case []interface{}:
+		for _, item := range v {
+			if err := validProperty(item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (e *executor) delete(clause *deleteClause, rows []row) error {
+	nodes := make(map[uint64]bool)
+	edges := make(map[uint64]bool)
+
+	var collect func(value interface{}) error
+	collect = func(value interface{}) error {
+		switch v := value.(type) {
+		case nil:
+		case *Node:
+			nodes[v.ID] = true
+		case *Edge:
+			edges[v.ID] = true
+		case []interface{}:
+			for _, item := range v {
+				if err := collect(item); err != nil {
+					return err
+				}
+			}
+		default:
+			return fmt.Errorf("cannot delete %s", typeName(value))
+		}
+		return nil
+	}
+
+	for _, r := range rows {
+		for _, item := range clause.items {
+			value, err := item.eval(r)
+			if err != nil {
+				return err
+			}
+			if err = collect(value); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Check that every node can be deleted before modifying the graph
+	nodeIDs := sortedKeys(nodes)
+	if !clause.detach {
+		for _, id := range nodeIDs {
+			for _, edge := range e.graph.Relationships(id, 0) {
+				if !edges[edge.ID] {
+					return fmt.Errorf("cannot delete node %d because it still has relationships, use DETACH DELETE", id)
+				}
+			}
+		}
+	}
+
+	for _, id := range sortedKeys(edges) {
+		if e.graph.DeleteEdge(id) {
+			e.result.Statistics.RelationshipsDeleted += 1
+			e.result.Mutations = append(e.result.Mutations, Mutation{Op: deleteEdge, ID: id})
+		}
+	}
+	for _, id := range nodeIDs {
+		if _, ok := e.graph.nodes[id]; !ok {
+			continue
+		}
+		count, err := e.graph.DeleteNode(id, true)
+		if err != nil {
+			return err
+		}
+		e.result.Statistics.NodesDeleted += 1
+		e.result.Statistics.RelationshipsDeleted += count
+		e.result.Mutations = append(e.result.Mutations, Mutation{Op: deleteNode, ID: id})
+	}
+
+	return nil
+}
+
+func sortedKeys(m map[uint64]bool) []uint64 {
+	keys := make([]uint64, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func (e *executor) project(clause *returnClause, rows []row) error {
+	e.result.returns = true
+
+	items := clause.items
+	if clause.star {
+		var names []string
+		if len(rows) > 0 {
+			for name := range rows[0] {
+				names = append(names, name)
+			}
+		}
+		if len(names) == 0 {
+			return errors.New("RETURN * is not allowed when there are no variables in scope")
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			items = append(items, returnItem{expr: &variableExpr{name: name}, alias: name})
+		}
+	}
+
+	for _, item := range items {
+		e.result.Columns = append(e.result.Columns, item.alias)
+	}
+
+	// Each projected row keeps the source row so that ORDER BY can refer to variables that are not returned
+	type projected struct {
+		values []interface{}
+		source row
+	}
+	var output []projected
+
+	aggregating := slices.ContainsFunc(items, func(item returnItem) bool {
+		f, ok := item.expr.(*functionExpr)
+		return ok && f.aggregate
+	})
+
+	if !aggregating {
+		for _, r := range rows {
+			values := make([]interface{}, len(items))
+			for i, item := range items {
+				value, err := item.expr.eval(r)
+				if err != nil {
+					return err
+				}
+				values[i] = value
+			}
+			output = append(output, projected{values: values, source: r})
+		}
+	} else {
+		type group struct {
+			values       []interface{}
+			accumulators []accumulator
+			seen         []map[string]bool
+		}
+		var groups []*group
+		index := make(map[string]*group)
+
+		newGroup := func(values []interface{}) *group {
+			g := &group{
+				values:       values,
+				accumulators: make([]accumulator, len(items)),
+				seen:         make([]map[string]bool, len(items)),
+			}
+			for i, item := range items {
+				if f, ok := item.expr.(*functionExpr); ok && f.aggregate {
+					g.accumulators[i] = aggregates[f.name]()
+					g.seen[i] = make(map[string]bool)
+				}
+			}
+			return g
+		}
+
+		for _, r := range rows {
+			values := make([]interface{}, len(items))
+			for i, item := range items {
+				if f, ok := item.expr.(*functionExpr); ok && f.aggregate {
+					continue
+				}
+				value, err := item.expr.eval(r)
+				if err != nil {
+					return err
+				}
+				values[i] = value
+			}
+
+			key := valueKey(values)
+			g, ok := index[key]
+			if !ok {
+				g = newGroup(values)
+				index[key] = g
+				groups = append(groups, g)
+			}
+
+			for i, item := range items {
+				f, ok := item.expr.(*functionExpr)
+				if !ok || !f.aggregate {
+					continue
+				}
+				if f.star {
+					_ = g.accumulators[i].add(nil)
+					continue
+				}
+				value, err := f.args[0].eval(r)
+				if err != nil {
+					return err
+				}
+				// Aggregate functions ignore null values
+				if value == nil {
+					continue
+				}
+				if f.distinct {
+					k := valueKey([]interface{}{value})
+					if g.seen[i][k] {
+						continue
+					}
+					g.seen[i][k] = true
+				}
+				if err = g.accumulators[i].add(value); err != nil {
+					return err
+				}
+			}
+		}
+
+		// Aggregating without grouping keys always produces a single row, e.g. count(*) of no rows is 0
+		if len(groups) == 0 && !slices.ContainsFunc(items, func(item returnItem) bool {
+			f, ok := item.expr.(*functionExpr)
+			return !ok || !f.aggregate
+		}) {
+			groups = append(groups, newGroup(make([]interface{}, len(items))))
+		}
+
+		for _, g := range groups {
+			for i, acc := range g.accumulators {
+				if acc != nil {
+					g.values[i] = acc.result()
+				}
+			}
+			output = append(output, projected{values: g.values, source: row{}})
+		}
+	}
+
+	if clause.distinct {
+		seen := make(map[string]bool)
+		output = slices.DeleteFunc(output, func(p projected) bool {
+			key := valueKey(p.values)
+			if seen[key] {
+				return true
+			}
+			seen[key] = true
+			return false
+		})
+	}
+
+	if len(clause.orderBy) > 0 {
+		keys := make([][]interface{}, len(output))
+		for i, p := range output {
+			r := p.source
+			for j, item := range items {
+				r = r.with(item.alias, p.values[j])
+			}
+			keys[i] = make([]interface{}, len(clause.orderBy))
+			for j, order := range clause.orderBy {
+				// Ordering by the text of a returned expression uses the projected value
+				if k := slices.IndexFunc(items, func(item returnItem) bool {
+					return item.alias == order.text
+				}); k != -1 {
+					keys[i][j] = p.values[k]
+					continue
+				}
+				value, err := order.expr.eval(r)
+				if err != nil {
+					return err
+				}
+				keys[i][j] = value
+			}
+		}
+
+		order := make([]int, len(output))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(a, b int) bool {
+			for j, item := range clause.orderBy {
+				cmp := orderValues(keys[order[a]][j], keys[order[b]][j])
+				if cmp == 0 {
+					continue
+				}
+				if item.descending {
+					return cmp > 0
+				}
+				return cmp < 0
+			}
+			return false
+		})
+
+		sorted := make([]projected, len(output))
+		for i, j := range order {
+			sorted[i] = output[j]
+		}
+		output = sorted
+	}
+
+	if clause.skip >= len(output) {
+		output = nil
+	} else {
+		output = output[clause.skip:]
+	}
+	if clause.limit >= 0 && clause.limit < len(output) {
+		output = output[:clause.limit]
+	}
+
+	for _, p := range output {
+		e.result.Rows = append(e.result.Rows, p.values)
+	}
+
+	return nil
+}
+
+// orderValues orders values of any type for ORDER BY. Values are ordered by type first and nulls sort last.
+func orderValues(a, b interface{}) int {
+	rank := func(value interface{}) int {
+		switch value.(type) {
+		case *Node:
+			return 0
+		case *Edge:
+			return 1
+		case []interface{}:
+			return 2
+		case string:
+			return 3
+		case bool:
+			return 4
+		case int64, float64:
+			return 5
+		}
+		return 6
+	}
+
+	if ra, rb := rank(a), rank(b); ra != rb {
+		return ra - rb
+	}
+	if cmp, ok := compare(a, b); ok {
+		return cmp
+	}
+	switch x := a.(type) {
+	case bool:
+		y := b.(bool)
+		if x == y {
+			return 0
+		}
+		if !x {
+			return -1
+		}
+		return 1
+	case *Node:
+		return int(x.ID) - int(b.(*Node).ID)
+	case *Edge:
+		return int(x.ID) - int(b.(*Edge).ID)
+	}
+	return strings.Compare(valueKey([]interface{}{a}), valueKey([]interface{}{b}))
+}
+
+// valueKey returns a string that is equal for equal lists of values.
+func valueKey(values []interface{}) string {
+	var sb strings.Builder
+	for _, value := range values {
+		switch v := value.(type) {
+		case nil:
+			sb.WriteString("n")
+		case *Node:
+			sb.WriteString("N" + strconv.FormatUint(v.ID, 10))
+		case *Edge:
+			sb.WriteString("E" + strconv.FormatUint(v.ID, 10))
+		case int64:
+			// Integers and floats with the same value are equal
+			sb.WriteString("d" + strconv.FormatFloat(float64(v), 'g', -1, 64))
+		case float64:
+			sb.WriteString("d" + strconv.FormatFloat(v, 'g', -1, 64))
+		case string:
+			sb.WriteString("s" + strconv.Quote(v))
+		case bool:
+			sb.WriteString("b" + strconv.FormatBool(v))
+		case []interface{}:
+			sb.WriteString("[" + valueKey(v) + "]")
+		}
+		sb.WriteString(",")
+	}
+	return sb.String()
+}
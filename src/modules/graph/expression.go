@@ -0,0 +1,574 @@
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+)
+
+// row binds the variables of a query to nodes, edges, lists of edges (variable length relationships) or scalar values.
+type row map[string]interface{}
+
+func (r row) with(name string, value interface{}) row {
+	res := make(row, len(r)+1)
+	for k, v := range r {
+		res[k] = v
+	}
+	res[name] = value
+	return res
+}
+
+type expression interface {
+	eval(r row) (interface{}, error)
+}
+
+type literalExpr struct {
+	value interface{}
+}
+
+func (e *literalExpr) eval(r row) (interface{}, error) {
+	return e.value, nil
+}
+
+type variableExpr struct {
+	name string
+}
+
+func (e *variableExpr) eval(r row) (interface{}, error) {
+	value, ok := r[e.name]
+	if !ok {
+		return nil, fmt.Errorf("variable %s is not defined", e.name)
+	}
+	return value, nil
+}
+
+type propertyExpr struct {
+	operand expression
+	key     string
+}
+
+func (e *propertyExpr) eval(r row) (interface{}, error) {
+	value, err := e.operand.eval(r)
+	if err != nil {
+		return nil, err
+	}
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case *Node:
+		return v.Properties[e.key], nil
+	case *Edge:
+		return v.Properties[e.key], nil
+	}
+	return nil, fmt.Errorf("cannot access property %s of %s", e.key, typeName(value))
+}
+
+type listExpr struct {
+	items []expression
+}
+
+func (e *listExpr) eval(r row) (interface{}, error) {
+	res := make([]interface{}, len(e.items))
+	for i, item := range e.items {
+		value, err := item.eval(r)
+		if err != nil {
+			return nil, err
+		}
+		res[i] = value
+	}
+	return res, nil
+}
+
+type logicalExpr struct {
+	op          string
+	left, right expression
+}
+
+// eval implements three-valued logic where nil represents an unknown value.
+func (e *logicalExpr) eval(r row) (interface{}, error) {
+	left, err := evalBool(e.left, r)
+	if err != nil {
+		return nil, err
+	}
+	if e.op == "and" && left == false {
+		return false, nil
+	}
+	if e.op == "or" && left == true {
+		return true, nil
+	}
+	right, err := evalBool(e.right, r)
+	if err != nil {
+		return nil, err
+	}
+	if e.op == "and" && right == false {
+		return false, nil
+	}
+	if e.op == "or" && right == true {
+		return true, nil
+	}
+	if left == nil || right == nil {
+		return nil, nil
+	}
+	return right, nil
+}
+
+type notExpr struct {
+	operand expression
+}
+
+func (e *notExpr) eval(r row) (interface{}, error) {
+	value, err := evalBool(e.operand, r)
+	if err != nil || value == nil {
+		return nil, err
+	}
+	return !value.(bool), nil
+}
+
+// evalBool evaluates an expression that must return a boolean or null.
+func evalBool(e expression, r row) (interface{}, error) {
+	value, err := e.eval(r)
+	if err != nil {
+		return nil, err
+	}
+	switch value.(type) {
+	case nil, bool:
+		return value, nil
+	}
+	return nil, fmt.Errorf("expected boolean, got %s", typeName(value))
+}
+
+type isNullExpr struct {
+	operand expression
+	negate  bool
+}
+
+func (e *isNullExpr) eval(r row) (interface{}, error) {
+	value, err := e.operand.eval(r)
+	if err != nil {
+		return nil, err
+	}
+	return (value == nil) != e.negate, nil
+}
+
+type comparisonExpr struct {
+	op          string
+	left, right expression
+}
+
+func (e *comparisonExpr) eval(r row) (interface{}, error) {
+	left, err := e.left.eval(r)
+	if err != nil {
+		return nil, err
+	}
+	right, err := e.right.eval(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.op == "in" {
+		if right == nil {
+			return nil, nil
+		}
+		list, ok := right.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("IN expects a list, got %s", typeName(right))
+		}
+		for _, item := range list {
+			if equal(left, item) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	if left == nil || right == nil {
+		return nil, nil
+	}
+
+	switch e.op {
+	case "=":
+		return equal(left, right), nil
+	case "<>":
+		return !equal(left, right), nil
+	case "contains", "starts with", "ends with":
+		l, lok := left.(string)
+		r, rok := right.(string)
+		if !lok || !rok {
+			return nil, nil
+		}
+		switch e.op {
+		case "contains":
+			return strings.Contains(l, r), nil
+		case "starts with":
+			return strings.HasPrefix(l, r), nil
+		default:
+			return strings.HasSuffix(l, r), nil
+		}
+	}
+
+	cmp, ok := compare(left, right)
+	if !ok {
+		// Values of different types cannot be ordered
+		return nil, nil
+	}
+	switch e.op {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	default:
+		return cmp >= 0, nil
+	}
+}
+
+type arithmeticExpr struct {
+	op          string
+	left, right expression
+}
+
+func (e *arithmeticExpr) eval(r row) (interface{}, error) {
+	left, err := e.left.eval(r)
+	if err != nil {
+		return nil, err
+	}
+	right, err := e.right.eval(r)
+	if err != nil {
+		return nil, err
+	}
+	if left == nil || right == nil {
+		return nil, nil
+	}
+
+	if e.op == "+" {
+		if l, ok := left.(string); ok {
+			return l + fmt.Sprint(right), nil
+		}
+		if l, ok := left.([]interface{}); ok {
+			if r, ok := right.([]interface{}); ok {
+				return append(slices.Clone(l), r...), nil
+			}
+			return append(slices.Clone(l), right), nil
+		}
+	}
+
+	li, lInt := left.(int64)
+	ri, rInt := right.(int64)
+	if lInt && rInt {
+		switch e.op {
+		case "+":
+			return li + ri, nil
+		case "-":
+			return li - ri, nil
+		case "*":
+			return li * ri, nil
+		case "/", "%":
+			if ri == 0 {
+				return nil, errors.New("division by zero")
+			}
+			if e.op == "/" {
+				return li / ri, nil
+			}
+			return li % ri, nil
+		}
+	}
+
+	lf, lok := toFloat(left)
+	rf, rok := toFloat(right)
+	if !lok || !rok {
+		return nil, fmt.Errorf("cannot apply %s to %s and %s", e.op, typeName(left), typeName(right))
+	}
+	switch e.op {
+	case "+":
+		return lf + rf, nil
+	case "-":
+		return lf - rf, nil
+	case "*":
+		return lf * rf, nil
+	case "/":
+		return lf / rf, nil
+	default:
+		return math.Mod(lf, rf), nil
+	}
+}
+
+// aggregates maps the supported aggregate functions to a constructor for their accumulator.
+var aggregates = map[string]func() accumulator{
+	"count":   func() accumulator { return &countAccumulator{} },
+	"sum":     func() accumulator { return &sumAccumulator{} },
+	"avg":     func() accumulator { return &avgAccumulator{} },
+	"min":     func() accumulator { return &extremeAccumulator{sign: -1} },
+	"max":     func() accumulator { return &extremeAccumulator{sign: 1} },
+	"collect": func() accumulator { return &collectAccumulator{list: []interface{}{}} },
+}
+
+var functions = map[string]func(value interface{}) (interface{}, error){
+	"id": func(value interface{}) (interface{}, error) {
+		switch v := value.(type) {
+		case *Node:
+			return int64(v.ID), nil
+		case *Edge:
+			return int64(v.ID), nil
+		}
+		return nil, fmt.Errorf("id() expects a node or relationship, got %s", typeName(value))
+	},
+	"labels": func(value interface{}) (interface{}, error) {
+		node, ok := value.(*Node)
+		if !ok {
+			return nil, fmt.Errorf("labels() expects a node, got %s", typeName(value))
+		}
+		res := make([]interface{}, len(node.Labels))
+		for i, label := range node.Labels {
+			res[i] = label
+		}
+		return res, nil
+	},
+	"type": func(value interface{}) (interface{}, error) {
+		edge, ok := value.(*Edge)
+		if !ok {
+			return nil, fmt.Errorf("type() expects a relationship, got %s", typeName(value))
+		}
+		return edge.Type, nil
+	},
+	"size": func(value interface{}) (interface{}, error) {
+		switch v := value.(type) {
+		case string:
+			return int64(len(v)), nil
+		case []interface{}:
+			return int64(len(v)), nil
+		}
+		return nil, fmt.Errorf("size() expects a string or list, got %s", typeName(value))
+	},
+	"tolower": func(value interface{}) (interface{}, error) {
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("toLower() expects a string, got %s", typeName(value))
+		}
+		return strings.ToLower(s), nil
+	},
+	"toupper": func(value interface{}) (interface{}, error) {
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("toUpper() expects a string, got %s", typeName(value))
+		}
+		return strings.ToUpper(s), nil
+	},
+}
+
+type functionExpr struct {
+	name      string
+	args      []expression
+	aggregate bool
+	distinct  bool
+	star      bool
+}
+
+func (e *functionExpr) eval(r row) (interface{}, error) {
+	if e.aggregate {
+		return nil, fmt.Errorf("aggregate function %s can only be used in RETURN", e.name)
+	}
+	value, err := e.args[0].eval(r)
+	if err != nil || value == nil {
+		return nil, err
+	}
+	return functions[e.name](value)
+}
+
+type accumulator interface {
+	add(value interface{}) error
+	result() interface{}
+}
+
+type countAccumulator struct {
+	count int64
+}
+
+func (a *countAccumulator) add(value interface{}) error {
+	a.count += 1
+	return nil
+}
+
+func (a *countAccumulator) result() interface{} {
+	return a.count
+}
+
+type sumAccumulator struct {
+	intSum   int64
+	floatSum float64
+	isFloat  bool
+}
+
+func (a *sumAccumulator) add(value interface{}) error {
+	switch v := value.(type) {
+	case int64:
+		a.intSum += v
+	case float64:
+		a.floatSum += v
+		a.isFloat = true
+	default:
+		return fmt.Errorf("sum() expects numbers, got %s", typeName(value))
+	}
+	return nil
+}
+
+func (a *sumAccumulator) result() interface{} {
+	if a.isFloat {
+		return a.floatSum + float64(a.intSum)
+	}
+	return a.intSum
+}
+
+type avgAccumulator struct {
+	sum   float64
+	count int
+}
+
+func (a *avgAccumulator) add(value interface{}) error {
+	f, ok := toFloat(value)
+	if !ok {
+		return fmt.Errorf("avg() expects numbers, got %s", typeName(value))
+	}
+	a.sum += f
+	a.count += 1
+	return nil
+}
+
+func (a *avgAccumulator) result() interface{} {
+	if a.count == 0 {
+		return nil
+	}
+	return a.sum / float64(a.count)
+}
+
+// extremeAccumulator computes min() when sign is -1 and max() when sign is 1.
+type extremeAccumulator struct {
+	sign  int
+	value interface{}
+}
+
+func (a *extremeAccumulator) add(value interface{}) error {
+	if a.value == nil {
+		a.value = value
+		return nil
+	}
+	if cmp, ok := compare(value, a.value); ok && cmp*a.sign > 0 {
+		a.value = value
+	}
+	return nil
+}
+
+func (a *extremeAccumulator) result() interface{} {
+	return a.value
+}
+
+type collectAccumulator struct {
+	list []interface{}
+}
+
+func (a *collectAccumulator) add(value interface{}) error {
+	a.list = append(a.list, value)
+	return nil
+}
+
+func (a *collectAccumulator) result() interface{} {
+	return a.list
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case int64:
+		return "integer"
+	case float64:
+		return "float"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case []interface{}:
+		return "list"
+	case *Node:
+		return "node"
+	case *Edge:
+		return "relationship"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func equal(a, b interface{}) bool {
+	if cmp, ok := compare(a, b); ok {
+		return cmp == 0
+	}
+	switch x := a.(type) {
+	case bool:
+		y, ok := b.(bool)
+		return ok && x == y
+	case *Node:
+		y, ok := b.(*Node)
+		return ok && x.ID == y.ID
+	case *Edge:
+		y, ok := b.(*Edge)
+		return ok && x.ID == y.ID
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !equal(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// compare orders two numbers or two strings. ok is false if the values cannot be ordered.
+func compare(a, b interface{}) (int, bool) {
+	if x, ok := a.(string); ok {
+		y, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(x, y), true
+	}
+	x, xok := toFloat(a)
+	y, yok := toFloat(b)
+	if !xok || !yok {
+		return 0, false
+	}
+	// Compare integers directly so that large values do not lose precision
+	if xi, ok := a.(int64); ok {
+		if yi, ok := b.(int64); ok {
+			switch {
+			case xi < yi:
+				return -1, true
+			case xi > yi:
+				return 1, true
+			}
+			return 0, true
+		}
+	}
+	switch {
+	case x < y:
+		return -1, true
+	case x > y:
+		return 1, true
+	}
+	return 0, true
+}
@@ -0,0 +1,431 @@
+package graph
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type Node struct {
+	ID         uint64
+	Labels     []string
+	Properties map[string]interface{}
+}
+
+type Edge struct {
+	ID         uint64
+	Type       string
+	Source     uint64
+	Target     uint64
+	Properties map[string]interface{}
+}
+
+// Graph is a property graph stored at a single key.
+// IDs are assigned from monotonically increasing counters and all iteration is done in ID order,
+// so applying the same sequence of queries on every node of the cluster produces identical graphs.
+type Graph struct {
+	revision   uint64 // The number of times that mutations have been applied to the graph
+	nextNodeID uint64
+	nextEdgeID uint64
+	nodes      map[uint64]*Node
+	edges      map[uint64]*Edge
+	outgoing   map[uint64][]uint64 // node -> IDs of edges where the node is the source
+	incoming   map[uint64][]uint64 // node -> IDs of edges where the node is the target
+}
+
+func NewGraph() *Graph {
+	return &Graph{
+		nextNodeID: 0,
+		nextEdgeID: 0,
+		nodes:      make(map[uint64]*Node),
+		edges:      make(map[uint64]*Edge),
+		outgoing:   make(map[uint64][]uint64),
+		incoming:   make(map[uint64][]uint64),
+	}
+}
+
+func (graph *Graph) NodeCount() int {
+	return len(graph.nodes)
+}
+
+func (graph *Graph) EdgeCount() int {
+	return len(graph.edges)
+}
+
+func (graph *Graph) AddNode(labels []string, properties map[string]interface{}) *Node {
+	if properties == nil {
+		properties = make(map[string]interface{})
+	}
+	node := &Node{
+		ID:         graph.nextNodeID,
+		Labels:     labels,
+		Properties: properties,
+	}
+	graph.nodes[node.ID] = node
+	graph.nextNodeID += 1
+	return node
+}
+
+func (graph *Graph) AddEdge(edgeType string, source uint64, target uint64, properties map[string]interface{}) (*Edge, error) {
+	if graph.nodes[source] == nil || graph.nodes[target] == nil {
+		return nil, errors.New("edge endpoints must exist")
+	}
+	if properties == nil {
+		properties = make(map[string]interface{})
+	}
+	edge := &Edge{
+		ID:         graph.nextEdgeID,
+		Type:       edgeType,
+		Source:     source,
+		Target:     target,
+		Properties: properties,
+	}
+	graph.edges[edge.ID] = edge
+	graph.outgoing[source] = append(graph.outgoing[source], edge.ID)
+	graph.incoming[target] = append(graph.incoming[target], edge.ID)
+	graph.nextEdgeID += 1
+	return edge, nil
+}
+
+func (graph *Graph) DeleteEdge(id uint64) bool {
+	edge, ok := graph.edges[id]
+	if !ok {
+		return false
+	}
+	graph.outgoing[edge.Source] = slices.DeleteFunc(graph.outgoing[edge.Source], func(e uint64) bool {
+		return e == id
+	})
+	graph.incoming[edge.Target] = slices.DeleteFunc(graph.incoming[edge.Target], func(e uint64) bool {
+		return e == id
+	})
+	delete(graph.edges, id)
+	return true
+}
+
+// DeleteNode removes the node. If detach is false, the node must not have any edges.
+// Returns the number of edges that were deleted along with the node.
+func (graph *Graph) DeleteNode(id uint64, detach bool) (int, error) {
+	if _, ok := graph.nodes[id]; !ok {
+		return 0, nil
+	}
+	edges := append(slices.Clone(graph.outgoing[id]), graph.incoming[id]...)
+	if len(edges) > 0 && !detach {
+		return 0, fmt.Errorf("cannot delete node %d because it still has relationships, use DETACH DELETE", id)
+	}
+	count := 0
+	for _, e := range edges {
+		if graph.DeleteEdge(e) {
+			count += 1
+		}
+	}
+	delete(graph.nodes, id)
+	delete(graph.outgoing, id)
+	delete(graph.incoming, id)
+	return count, nil
+}
+
+// Nodes returns all the nodes in ID order.
+func (graph *Graph) Nodes() []*Node {
+	ids := make([]uint64, 0, len(graph.nodes))
+	for id := range graph.nodes {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	res := make([]*Node, len(ids))
+	for i, id := range ids {
+		res[i] = graph.nodes[id]
+	}
+	return res
+}
+
+// Relationships returns the edges connected to the node in ID order.
+// direction is 1 for outgoing edges, -1 for incoming edges and 0 for both.
+func (graph *Graph) Relationships(node uint64, direction int) []*Edge {
+	var ids []uint64
+	if direction >= 0 {
+		ids = append(ids, graph.outgoing[node]...)
+	}
+	if direction <= 0 {
+		for _, id := range graph.incoming[node] {
+			// Self-loops are already included in the outgoing edges
+			if direction == 0 && graph.edges[id].Source == node {
+				continue
+			}
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	res := make([]*Edge, len(ids))
+	for i, id := range ids {
+		res[i] = graph.edges[id]
+	}
+	return res
+}
+
+func (node *Node) HasLabel(label string) bool {
+	return slices.Contains(node.Labels, label)
+}
+
+// Revision returns the number of times that mutations have been applied to the graph.
+func (graph *Graph) Revision() uint64 {
+	return graph.revision
+}
+
+// Clone returns a copy of the graph that can be modified without affecting the graph.
+// Nodes and edges are shared, since they are never modified once they have been added.
+func (graph *Graph) Clone() *Graph {
+	clone := &Graph{
+		revision:   graph.revision,
+		nextNodeID: graph.nextNodeID,
+		nextEdgeID: graph.nextEdgeID,
+		nodes:      make(map[uint64]*Node, len(graph.nodes)),
+		edges:      make(map[uint64]*Edge, len(graph.edges)),
+		outgoing:   make(map[uint64][]uint64, len(graph.outgoing)),
+		incoming:   make(map[uint64][]uint64, len(graph.incoming)),
+	}
+	for id, node := range graph.nodes {
+		clone.nodes[id] = node
+	}
+	for id, edge := range graph.edges {
+		clone.edges[id] = edge
+	}
+	for id, edges := range graph.outgoing {
+		clone.outgoing[id] = slices.Clone(edges)
+	}
+	for id, edges := range graph.incoming {
+		clone.incoming[id] = slices.Clone(edges)
+	}
+	return clone
+}
+
+// Mutation operations.
+const (
+	createNode = "CREATE_NODE"
+	createEdge = "CREATE_EDGE"
+	deleteNode = "DELETE_NODE"
+	deleteEdge = "DELETE_EDGE"
+)
+
+// Mutation is a single change that a query made to a graph. Queries that modify a graph are replicated as the
+// mutations that they made rather than as their text, so every node makes exactly the same changes.
+type Mutation struct {
+	Op   string `json:"Op"`
+	Node *Node  `json:"Node,omitempty"` // The node created by CREATE_NODE
+	Edge *Edge  `json:"Edge,omitempty"` // The edge created by CREATE_EDGE
+	ID   uint64 `json:"ID,omitempty"`   // The node or edge removed by DELETE_NODE or DELETE_EDGE
+}
+
+// Apply makes the changes to the graph and increments its revision. Nodes and edges must be created with the IDs
+// that the graph would assign to them, so that mutations made against another revision of the graph are rejected.
+// The graph is left partly modified if an error is returned, so mutations should be applied to a clone.
+func (graph *Graph) Apply(mutations []Mutation) error {
+	for _, mutation := range mutations {
+		switch mutation.Op {
+		case createNode:
+			if mutation.Node == nil || mutation.Node.ID != graph.nextNodeID {
+				return errors.New("node was not created with the next node ID")
+			}
+			graph.AddNode(mutation.Node.Labels, mutation.Node.Properties)
+		case createEdge:
+			edge := mutation.Edge
+			if edge == nil || edge.ID != graph.nextEdgeID {
+				return errors.New("edge was not created with the next edge ID")
+			}
+			if _, err := graph.AddEdge(edge.Type, edge.Source, edge.Target, edge.Properties); err != nil {
+				return err
+			}
+		case deleteNode:
+			if _, err := graph.DeleteNode(mutation.ID, true); err != nil {
+				return err
+			}
+		case deleteEdge:
+			graph.DeleteEdge(mutation.ID)
+		default:
+			return fmt.Errorf("unknown graph mutation %s", mutation.Op)
+		}
+	}
+	graph.revision += 1
+	return nil
+}
+
+// EncodeMutations encodes the mutations for replication.
+func EncodeMutations(mutations []Mutation) ([]byte, error) {
+	encoded := make([]Mutation, len(mutations))
+	for i, mutation := range mutations {
+		encoded[i] = mutation
+		if node := mutation.Node; node != nil {
+			encoded[i].Node = &Node{ID: node.ID, Labels: node.Labels, Properties: encodeProperties(node.Properties)}
+		}
+		if edge := mutation.Edge; edge != nil {
+			encoded[i].Edge = &Edge{
+				ID:         edge.ID,
+				Type:       edge.Type,
+				Source:     edge.Source,
+				Target:     edge.Target,
+				Properties: encodeProperties(edge.Properties),
+			}
+		}
+	}
+	return json.Marshal(encoded)
+}
+
+// DecodeMutations decodes mutations that were encoded with EncodeMutations.
+func DecodeMutations(b []byte) ([]Mutation, error) {
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+
+	var mutations []Mutation
+	if err := decoder.Decode(&mutations); err != nil {
+		return nil, err
+	}
+	for _, mutation := range mutations {
+		if mutation.Node != nil {
+			mutation.Node.Properties = normaliseProperties(mutation.Node.Properties)
+		}
+		if mutation.Edge != nil {
+			mutation.Edge.Properties = normaliseProperties(mutation.Edge.Properties)
+		}
+	}
+	return mutations, nil
+}
+
+// graphSnapshot is the serialized form of a graph.
+type graphSnapshot struct {
+	Revision   uint64  `json:"Revision,omitempty"`
+	NextNodeID uint64  `json:"NextNodeID"`
+	NextEdgeID uint64  `json:"NextEdgeID"`
+	Nodes      []*Node `json:"Nodes"`
+	Edges      []*Edge `json:"Edges"`
+}
+
+// SnapshotType implements utils.SnapshotEncoder.
+func (graph *Graph) SnapshotType() string {
+	return "graph"
+}
+
+// MarshalBinary implements utils.SnapshotEncoder.
+func (graph *Graph) MarshalBinary() ([]byte, error) {
+	snapshot := graphSnapshot{
+		Revision:   graph.revision,
+		NextNodeID: graph.nextNodeID,
+		NextEdgeID: graph.nextEdgeID,
+		Nodes:      make([]*Node, 0, len(graph.nodes)),
+		Edges:      make([]*Edge, 0, len(graph.edges)),
+	}
+	for _, node := range graph.Nodes() {
+		snapshot.Nodes = append(snapshot.Nodes, &Node{
+			ID:         node.ID,
+			Labels:     node.Labels,
+			Properties: encodeProperties(node.Properties),
+		})
+	}
+	for _, id := range sortedEdgeIDs(graph.edges) {
+		edge := graph.edges[id]
+		snapshot.Edges = append(snapshot.Edges, &Edge{
+			ID:         edge.ID,
+			Type:       edge.Type,
+			Source:     edge.Source,
+			Target:     edge.Target,
+			Properties: encodeProperties(edge.Properties),
+		})
+	}
+	return json.Marshal(snapshot)
+}
+
+// DecodeSnapshot restores a graph that was encoded with MarshalBinary.
+func DecodeSnapshot(b []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+
+	var snapshot graphSnapshot
+	if err := decoder.Decode(&snapshot); err != nil {
+		return nil, err
+	}
+
+	graph := NewGraph()
+	for _, node := range snapshot.Nodes {
+		node.Properties = normaliseProperties(node.Properties)
+		graph.nodes[node.ID] = node
+	}
+	for _, edge := range snapshot.Edges {
+		edge.Properties = normaliseProperties(edge.Properties)
+		graph.edges[edge.ID] = edge
+		graph.outgoing[edge.Source] = append(graph.outgoing[edge.Source], edge.ID)
+		graph.incoming[edge.Target] = append(graph.incoming[edge.Target], edge.ID)
+	}
+	graph.revision = snapshot.Revision
+	graph.nextNodeID = snapshot.NextNodeID
+	graph.nextEdgeID = snapshot.NextEdgeID
+
+	return graph, nil
+}
+
+// encodeProperties writes floats with a decimal point so that they are not restored as integers.
+func encodeProperties(properties map[string]interface{}) map[string]interface{} {
+	res := make(map[string]interface{}, len(properties))
+	for k, v := range properties {
+		res[k] = encodeValue(v)
+	}
+	return res
+}
+
+func encodeValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case float64:
+		s := strconv.FormatFloat(v, 'f', -1, 64)
+		if !strings.Contains(s, ".") {
+			s += ".0"
+		}
+		return json.Number(s)
+	case []interface{}:
+		res := make([]interface{}, len(v))
+		for i := range v {
+			res[i] = encodeValue(v[i])
+		}
+		return res
+	}
+	return value
+}
+
+// normaliseProperties converts decoded JSON numbers back into int64 or float64 property values.
+func normaliseProperties(properties map[string]interface{}) map[string]interface{} {
+	if properties == nil {
+		return make(map[string]interface{})
+	}
+	for k, v := range properties {
+		properties[k] = normaliseValue(v)
+	}
+	return properties
+}
+
+func normaliseValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if !strings.Contains(string(v), ".") {
+			if i, err := v.Int64(); err == nil {
+				return i
+			}
+		}
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		for i := range v {
+			v[i] = normaliseValue(v[i])
+		}
+		return v
+	}
+	return value
+}
+
+func sortedEdgeIDs(edges map[uint64]*Edge) []uint64 {
+	ids := make([]uint64, 0, len(edges))
+	for id := range edges {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
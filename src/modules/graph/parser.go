@@ -0,0 +1,889 @@
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenNumber
+	tokenString
+	tokenSymbol
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// lex splits a query into tokens. Keywords are returned as identifiers and matched case-insensitively by the parser.
+func lex(s string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(s) {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+
+		case c == '_' || unicode.IsLetter(c):
+			start := i
+			for i < len(s) && (s[i] == '_' || unicode.IsLetter(rune(s[i])) || unicode.IsDigit(rune(s[i]))) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: s[start:i], pos: start})
+
+		case c == '`':
+			end := strings.IndexByte(s[i+1:], '`')
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated identifier at offset %d", i)
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: s[i+1 : i+1+end], pos: i})
+			i += end + 2
+
+		case unicode.IsDigit(c):
+			start := i
+			for i < len(s) && unicode.IsDigit(rune(s[i])) {
+				i++
+			}
+			// A '.' is only part of the number if a digit follows it, so that ranges such as *1..3 are lexed correctly
+			if i+1 < len(s) && s[i] == '.' && unicode.IsDigit(rune(s[i+1])) {
+				i++
+				for i < len(s) && unicode.IsDigit(rune(s[i])) {
+					i++
+				}
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: s[start:i], pos: start})
+
+		case c == '\'' || c == '"':
+			start := i
+			var sb strings.Builder
+			i++
+			for i < len(s) && rune(s[i]) != c {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				sb.WriteByte(s[i])
+				i++
+			}
+			if i >= len(s) {
+				return nil, fmt.Errorf("unterminated string at offset %d", start)
+			}
+			i++
+			tokens = append(tokens, token{kind: tokenString, text: sb.String(), pos: start})
+
+		default:
+			start := i
+			if i+1 < len(s) && isDoubleSymbol(s[i:i+2]) {
+				i += 2
+			} else if strings.ContainsRune("()[]{}:,.-+*/%<>=|", c) {
+				i++
+			} else {
+				return nil, fmt.Errorf("unexpected character %q at offset %d", c, i)
+			}
+			tokens = append(tokens, token{kind: tokenSymbol, text: s[start:i], pos: start})
+		}
+	}
+	tokens = append(tokens, token{kind: tokenEOF, pos: len(s)})
+	return tokens, nil
+}
+
+// isDoubleSymbol reports whether s is one of the two character symbols.
+func isDoubleSymbol(s string) bool {
+	switch s {
+	case "<>", "<=", ">=", "..":
+		return true
+	}
+	return false
+}
+
+type nodePattern struct {
+	variable   string
+	labels     []string
+	properties map[string]expression
+}
+
+type relPattern struct {
+	variable   string
+	types      []string
+	properties map[string]expression
+	direction  int // 1 for (a)-->(b), -1 for (a)<--(b) and 0 for (a)--(b)
+	varLength  bool
+	minHops    int
+	maxHops    int // -1 if the path length is unbounded
+}
+
+// pathPattern is a chain of nodes connected by relationships, so len(nodes) == len(rels)+1.
+type pathPattern struct {
+	nodes []*nodePattern
+	rels  []*relPattern
+}
+
+type matchClause struct {
+	patterns []*pathPattern
+	where    expression
+}
+
+type createClause struct {
+	patterns []*pathPattern
+}
+
+type deleteClause struct {
+	detach bool
+	items  []expression
+}
+
+type returnItem struct {
+	expr  expression
+	alias string
+}
+
+type orderItem struct {
+	expr       expression
+	text       string
+	descending bool
+}
+
+type returnClause struct {
+	distinct bool
+	star     bool
+	items    []returnItem
+	orderBy  []orderItem
+	skip     int
+	limit    int // -1 if there is no limit
+}
+
+type Query struct {
+	clauses []interface{}
+}
+
+// ReadOnly reports whether the query does not modify the graph.
+func (query *Query) ReadOnly() bool {
+	for _, clause := range query.clauses {
+		switch clause.(type) {
+		case *createClause, *deleteClause:
+			return false
+		}
+	}
+	return true
+}
+
+type parser struct {
+	src    string
+	tokens []token
+	pos    int
+}
+
+// ParseQuery parses the subset of Cypher supported by GRAPH.QUERY:
+//
+//	MATCH (a:Person {name: 'Alice'})-[:KNOWS*1..3]->(b) WHERE b.age > 30
+//	CREATE (a)-[:LIKES {since: 2020}]->(:Movie {title: 'Heat'})
+//	[DETACH] DELETE a, r
+//	RETURN [DISTINCT] b.name AS name, count(*) ORDER BY name DESC SKIP 1 LIMIT 10
+//
+// Clauses may be repeated, except that RETURN must be the last clause.
+func ParseQuery(s string) (*Query, error) {
+	tokens, err := lex(s)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{src: s, tokens: tokens}
+	query := &Query{}
+
+	for p.peek().kind != tokenEOF {
+		switch {
+		case p.acceptKeyword("match"):
+			clause, err := p.parseMatch()
+			if err != nil {
+				return nil, err
+			}
+			query.clauses = append(query.clauses, clause)
+
+		case p.acceptKeyword("create"):
+			patterns, err := p.parsePatterns()
+			if err != nil {
+				return nil, err
+			}
+			if err = validateCreate(patterns); err != nil {
+				return nil, err
+			}
+			query.clauses = append(query.clauses, &createClause{patterns: patterns})
+
+		case p.isKeyword("detach") || p.isKeyword("delete"):
+			detach := p.acceptKeyword("detach")
+			if !p.acceptKeyword("delete") {
+				return nil, p.errorf("expected DELETE")
+			}
+			items, err := p.parseExpressionList()
+			if err != nil {
+				return nil, err
+			}
+			query.clauses = append(query.clauses, &deleteClause{detach: detach, items: items})
+
+		case p.acceptKeyword("return"):
+			clause, err := p.parseReturn()
+			if err != nil {
+				return nil, err
+			}
+			query.clauses = append(query.clauses, clause)
+			if p.peek().kind != tokenEOF {
+				return nil, p.errorf("RETURN must be the last clause")
+			}
+
+		default:
+			return nil, p.errorf("expected MATCH, CREATE, DELETE or RETURN")
+		}
+	}
+
+	if len(query.clauses) == 0 {
+		return nil, errors.New("query cannot be empty")
+	}
+
+	return query, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	t := p.peek()
+	near := "end of query"
+	if t.kind != tokenEOF {
+		near = strconv.Quote(p.src[t.pos:])
+	}
+	return fmt.Errorf("syntax error at offset %d near %s: %s", t.pos, near, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) isSymbol(s string) bool {
+	t := p.peek()
+	return t.kind == tokenSymbol && t.text == s
+}
+
+func (p *parser) acceptSymbol(s string) bool {
+	if p.isSymbol(s) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectSymbol(s string) error {
+	if !p.acceptSymbol(s) {
+		return p.errorf("expected '%s'", s)
+	}
+	return nil
+}
+
+func (p *parser) isKeyword(keyword string) bool {
+	t := p.peek()
+	return t.kind == tokenIdent && strings.EqualFold(t.text, keyword)
+}
+
+func (p *parser) acceptKeyword(keyword string) bool {
+	if p.isKeyword(keyword) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectIdent() (string, error) {
+	if p.peek().kind != tokenIdent {
+		return "", p.errorf("expected identifier")
+	}
+	return p.next().text, nil
+}
+
+func (p *parser) parseInt() (int, error) {
+	if p.peek().kind != tokenNumber {
+		return 0, p.errorf("expected integer")
+	}
+	n, err := strconv.Atoi(p.next().text)
+	if err != nil {
+		return 0, fmt.Errorf("invalid integer: %v", err)
+	}
+	return n, nil
+}
+
+func (p *parser) parseMatch() (*matchClause, error) {
+	patterns, err := p.parsePatterns()
+	if err != nil {
+		return nil, err
+	}
+	clause := &matchClause{patterns: patterns}
+	if p.acceptKeyword("where") {
+		if clause.where, err = p.parseExpression(); err != nil {
+			return nil, err
+		}
+	}
+	return clause, nil
+}
+
+func (p *parser) parsePatterns() ([]*pathPattern, error) {
+	var patterns []*pathPattern
+	for {
+		pattern, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pattern)
+		if !p.acceptSymbol(",") {
+			return patterns, nil
+		}
+	}
+}
+
+func (p *parser) parsePath() (*pathPattern, error) {
+	path := &pathPattern{}
+
+	node, err := p.parseNode()
+	if err != nil {
+		return nil, err
+	}
+	path.nodes = append(path.nodes, node)
+
+	for p.isSymbol("-") || p.isSymbol("<") {
+		rel, err := p.parseRelationship()
+		if err != nil {
+			return nil, err
+		}
+		node, err := p.parseNode()
+		if err != nil {
+			return nil, err
+		}
+		path.rels = append(path.rels, rel)
+		path.nodes = append(path.nodes, node)
+	}
+
+	return path, nil
+}
+
+func (p *parser) parseNode() (*nodePattern, error) {
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+
+	node := &nodePattern{}
+	if p.peek().kind == tokenIdent {
+		node.variable = p.next().text
+	}
+	for p.acceptSymbol(":") {
+		label, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		node.labels = append(node.labels, label)
+	}
+	if p.isSymbol("{") {
+		properties, err := p.parseProperties()
+		if err != nil {
+			return nil, err
+		}
+		node.properties = properties
+	}
+
+	if err := p.expectSymbol(")"); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+func (p *parser) parseRelationship() (*relPattern, error) {
+	rel := &relPattern{minHops: 1, maxHops: 1}
+
+	left := p.acceptSymbol("<")
+	if err := p.expectSymbol("-"); err != nil {
+		return nil, err
+	}
+
+	if p.acceptSymbol("[") {
+		if p.peek().kind == tokenIdent {
+			rel.variable = p.next().text
+		}
+		if p.acceptSymbol(":") {
+			for {
+				relType, err := p.expectIdent()
+				if err != nil {
+					return nil, err
+				}
+				rel.types = append(rel.types, relType)
+				if !p.acceptSymbol("|") {
+					break
+				}
+				// Both [:A|B] and [:A|:B] are accepted
+				p.acceptSymbol(":")
+			}
+		}
+		if p.acceptSymbol("*") {
+			if err := p.parseHops(rel); err != nil {
+				return nil, err
+			}
+		}
+		if p.isSymbol("{") {
+			properties, err := p.parseProperties()
+			if err != nil {
+				return nil, err
+			}
+			rel.properties = properties
+		}
+		if err := p.expectSymbol("]"); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.expectSymbol("-"); err != nil {
+		return nil, err
+	}
+	right := p.acceptSymbol(">")
+
+	switch {
+	case left && right:
+		return nil, p.errorf("relationship cannot point in both directions")
+	case left:
+		rel.direction = -1
+	case right:
+		rel.direction = 1
+	}
+
+	return rel, nil
+}
+
+// parseHops parses the bounds of a variable length relationship following '*': *, *n, *min..max, *min.. or *..max.
+func (p *parser) parseHops(rel *relPattern) error {
+	var err error
+	rel.varLength = true
+	rel.minHops = 1
+	rel.maxHops = -1
+
+	if p.peek().kind == tokenNumber {
+		if rel.minHops, err = p.parseInt(); err != nil {
+			return err
+		}
+		if !p.isSymbol("..") {
+			rel.maxHops = rel.minHops
+			return nil
+		}
+	}
+	if p.acceptSymbol("..") && p.peek().kind == tokenNumber {
+		if rel.maxHops, err = p.parseInt(); err != nil {
+			return err
+		}
+	}
+	if rel.maxHops != -1 && rel.maxHops < rel.minHops {
+		return p.errorf("maximum path length cannot be less than the minimum")
+	}
+	return nil
+}
+
+func (p *parser) parseProperties() (map[string]expression, error) {
+	if err := p.expectSymbol("{"); err != nil {
+		return nil, err
+	}
+	properties := make(map[string]expression)
+	if p.acceptSymbol("}") {
+		return properties, nil
+	}
+	for {
+		key, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expectSymbol(":"); err != nil {
+			return nil, err
+		}
+		value, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		properties[key] = value
+		if p.acceptSymbol("}") {
+			return properties, nil
+		}
+		if err = p.expectSymbol(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) parseReturn() (*returnClause, error) {
+	clause := &returnClause{limit: -1}
+	clause.distinct = p.acceptKeyword("distinct")
+
+	if p.acceptSymbol("*") {
+		clause.star = true
+	} else {
+		for {
+			start := p.peek().pos
+			expr, err := p.parseExpression()
+			if err != nil {
+				return nil, err
+			}
+			item := returnItem{expr: expr, alias: p.text(start)}
+			if p.acceptKeyword("as") {
+				if item.alias, err = p.expectIdent(); err != nil {
+					return nil, err
+				}
+			}
+			clause.items = append(clause.items, item)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+
+	if p.acceptKeyword("order") {
+		if !p.acceptKeyword("by") {
+			return nil, p.errorf("expected BY")
+		}
+		for {
+			start := p.peek().pos
+			expr, err := p.parseExpression()
+			if err != nil {
+				return nil, err
+			}
+			item := orderItem{expr: expr, text: p.text(start)}
+			if p.acceptKeyword("desc") || p.acceptKeyword("descending") {
+				item.descending = true
+			} else if !p.acceptKeyword("asc") {
+				p.acceptKeyword("ascending")
+			}
+			clause.orderBy = append(clause.orderBy, item)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+
+	var err error
+	if p.acceptKeyword("skip") {
+		if clause.skip, err = p.parseInt(); err != nil {
+			return nil, err
+		}
+	}
+	if p.acceptKeyword("limit") {
+		if clause.limit, err = p.parseInt(); err != nil {
+			return nil, err
+		}
+	}
+
+	return clause, nil
+}
+
+// text returns the source of the query from offset start up to the current token.
+func (p *parser) text(start int) string {
+	return strings.TrimSpace(p.src[start:p.peek().pos])
+}
+
+func (p *parser) parseExpressionList() ([]expression, error) {
+	var list []expression
+	for {
+		expr, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, expr)
+		if !p.acceptSymbol(",") {
+			return list, nil
+		}
+	}
+}
+
+func (p *parser) parseExpression() (expression, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalExpr{op: "or", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (expression, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("and") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalExpr{op: "and", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (expression, error) {
+	if p.acceptKeyword("not") {
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notExpr{operand: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (expression, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		switch {
+		case p.isSymbol("=") || p.isSymbol("<>") || p.isSymbol("<") || p.isSymbol("<=") ||
+			p.isSymbol(">") || p.isSymbol(">="):
+			op := p.next().text
+			right, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			left = &comparisonExpr{op: op, left: left, right: right}
+
+		case p.acceptKeyword("is"):
+			negate := p.acceptKeyword("not")
+			if !p.acceptKeyword("null") {
+				return nil, p.errorf("expected NULL")
+			}
+			left = &isNullExpr{operand: left, negate: negate}
+
+		case p.acceptKeyword("in"):
+			right, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			left = &comparisonExpr{op: "in", left: left, right: right}
+
+		case p.acceptKeyword("contains"):
+			right, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			left = &comparisonExpr{op: "contains", left: left, right: right}
+
+		case p.isKeyword("starts") || p.isKeyword("ends"):
+			op := strings.ToLower(p.next().text)
+			if !p.acceptKeyword("with") {
+				return nil, p.errorf("expected WITH")
+			}
+			right, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			left = &comparisonExpr{op: op + " with", left: left, right: right}
+
+		default:
+			return left, nil
+		}
+	}
+}
+
+func (p *parser) parseAdditive() (expression, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for p.isSymbol("+") || p.isSymbol("-") {
+		op := p.next().text
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &arithmeticExpr{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseMultiplicative() (expression, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isSymbol("*") || p.isSymbol("/") || p.isSymbol("%") {
+		op := p.next().text
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &arithmeticExpr{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (expression, error) {
+	if p.acceptSymbol("-") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &arithmeticExpr{op: "-", left: &literalExpr{value: int64(0)}, right: operand}, nil
+	}
+	return p.parsePostfix()
+}
+
+func (p *parser) parsePostfix() (expression, error) {
+	expr, err := p.parseAtom()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptSymbol(".") {
+		key, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		expr = &propertyExpr{operand: expr, key: key}
+	}
+	return expr, nil
+}
+
+func (p *parser) parseAtom() (expression, error) {
+	t := p.peek()
+
+	switch t.kind {
+	case tokenNumber:
+		p.next()
+		if strings.Contains(t.text, ".") {
+			f, err := strconv.ParseFloat(t.text, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %s", t.text)
+			}
+			return &literalExpr{value: f}, nil
+		}
+		i, err := strconv.ParseInt(t.text, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer %s", t.text)
+		}
+		return &literalExpr{value: i}, nil
+
+	case tokenString:
+		p.next()
+		return &literalExpr{value: t.text}, nil
+
+	case tokenIdent:
+		switch strings.ToLower(t.text) {
+		case "true":
+			p.next()
+			return &literalExpr{value: true}, nil
+		case "false":
+			p.next()
+			return &literalExpr{value: false}, nil
+		case "null":
+			p.next()
+			return &literalExpr{value: nil}, nil
+		}
+		p.next()
+		if p.acceptSymbol("(") {
+			return p.parseFunction(strings.ToLower(t.text))
+		}
+		return &variableExpr{name: t.text}, nil
+
+	case tokenSymbol:
+		switch t.text {
+		case "(":
+			p.next()
+			expr, err := p.parseExpression()
+			if err != nil {
+				return nil, err
+			}
+			if err = p.expectSymbol(")"); err != nil {
+				return nil, err
+			}
+			return expr, nil
+		case "[":
+			p.next()
+			list := &listExpr{}
+			if p.acceptSymbol("]") {
+				return list, nil
+			}
+			items, err := p.parseExpressionList()
+			if err != nil {
+				return nil, err
+			}
+			list.items = items
+			if err = p.expectSymbol("]"); err != nil {
+				return nil, err
+			}
+			return list, nil
+		}
+	}
+
+	return nil, p.errorf("expected expression")
+}
+
+func (p *parser) parseFunction(name string) (expression, error) {
+	call := &functionExpr{name: name}
+
+	if _, ok := aggregates[name]; ok {
+		call.aggregate = true
+		call.distinct = p.acceptKeyword("distinct")
+		if name == "count" && p.acceptSymbol("*") {
+			call.star = true
+			if err := p.expectSymbol(")"); err != nil {
+				return nil, err
+			}
+			return call, nil
+		}
+	} else if _, ok := functions[name]; !ok {
+		return nil, fmt.Errorf("unknown function %s", name)
+	}
+
+	if !p.acceptSymbol(")") {
+		args, err := p.parseExpressionList()
+		if err != nil {
+			return nil, err
+		}
+		call.args = args
+		if err = p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(call.args) != 1 {
+		return nil, fmt.Errorf("function %s expects 1 argument, got %d", name, len(call.args))
+	}
+
+	return call, nil
+}
+
+// validateCreate checks the constraints on the patterns of a CREATE clause so that
+// the clause does not fail half way through modifying the graph.
+func validateCreate(patterns []*pathPattern) error {
+	for _, pattern := range patterns {
+		for _, rel := range pattern.rels {
+			if rel.varLength {
+				return errors.New("variable length relationships cannot be created")
+			}
+			if len(rel.types) != 1 {
+				return errors.New("exactly one relationship type must be specified for CREATE")
+			}
+			if rel.direction == 0 {
+				return errors.New("only directed relationships can be created")
+			}
+		}
+	}
+	return nil
+}
@@ -1,15 +1,21 @@
 package hash
 
 import (
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
+	"github.com/gobwas/glob"
 	"github.com/kelvinmwinuka/memstore/src/utils"
+	"hash/fnv"
+	"maps"
+	"math"
 	"math/rand"
 	"net"
 	"slices"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type Plugin struct {
@@ -30,6 +36,64 @@ func (p Plugin) Description() string {
 	return p.description
 }
 
+// visibleHash returns the hash without the fields that have expired but have not been removed yet.
+// The hash is only copied if there are such fields, so the result must not be modified.
+func visibleHash(server utils.Server, key string, hash map[string]interface{}) map[string]interface{} {
+	expired := server.ExpiredFields(key)
+	if len(expired) == 0 {
+		return hash
+	}
+	visible := maps.Clone(hash)
+	for _, field := range expired {
+		delete(visible, field)
+	}
+	return visible
+}
+
+// removeExpiredFields deletes the fields of the hash that have expired but have not been removed yet,
+// and reports whether any were removed. The caller must hold the key's lock.
+func removeExpiredFields(ctx context.Context, server utils.Server, key string, hash map[string]interface{}) bool {
+	expired := server.ExpiredFields(key)
+	for _, field := range expired {
+		delete(hash, field)
+		server.SetFieldExpiry(ctx, key, field, time.Time{})
+	}
+	if len(expired) > 0 {
+		server.NotifyKeyspaceEvent(ctx, utils.HashEvents, "hexpired", key)
+	}
+	return len(expired) > 0
+}
+
+// storeHash writes the hash back if it changed and releases the key's lock. A hash without fields is deleted,
+// the same way as when its last field expires in the background.
+func storeHash(ctx context.Context, server utils.Server, key string, hash map[string]interface{}, changed bool) {
+	if len(hash) == 0 {
+		// The key is deleted before its lock is released, so the fields are read and removed atomically
+		server.DeleteLockedKey(ctx, key)
+		server.NotifyKeyspaceEvent(ctx, utils.GenericEvents, "del", key)
+		return
+	}
+	if changed {
+		server.SetValue(ctx, key, hash)
+	}
+	server.KeyUnlock(key)
+}
+
+// parseFields parses the "FIELDS numfields field [field ...]" argument of the field expiry commands.
+func parseFields(args []string) ([]string, error) {
+	if len(args) < 3 || !strings.EqualFold(args[0], "fields") {
+		return nil, errors.New("mandatory argument FIELDS is missing or not at the right position")
+	}
+	n, err := strconv.Atoi(args[1])
+	if err != nil || n <= 0 {
+		return nil, errors.New("numfields must be a positive integer")
+	}
+	if n != len(args[2:]) {
+		return nil, errors.New("numfields does not match the number of fields")
+	}
+	return args[2:], nil
+}
+
 func handleHSET(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
 	if len(cmd) < 4 {
 		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
@@ -43,7 +107,7 @@ func handleHSET(ctx context.Context, cmd []string, server utils.Server, conn *ne
 	}
 
 	for i := 2; i <= len(cmd)-2; i += 2 {
-		entries[cmd[i]] = utils.AdaptType(cmd[i+1])
+		entries[cmd[i]] = cmd[i+1]
 	}
 
 	if !server.KeyExists(key) {
@@ -53,6 +117,10 @@ func handleHSET(ctx context.Context, cmd []string, server utils.Server, conn *ne
 		}
 		defer server.KeyUnlock(key)
 		server.SetValue(ctx, key, entries)
+		server.NotifyKeyspaceEvent(ctx, utils.HashEvents, "hset", key)
+		if strings.EqualFold(cmd[0], "hmset") {
+			return []byte(utils.OK_RESPONSE), nil
+		}
 		return []byte(fmt.Sprintf(":%d\r\n\r\n", len(entries))), nil
 	}
 
@@ -66,6 +134,7 @@ func handleHSET(ctx context.Context, cmd []string, server utils.Server, conn *ne
 	if !ok {
 		return nil, fmt.Errorf("value at %s is not a hash", key)
 	}
+	removeExpiredFields(ctx, server, key, hash)
 
 	count := 0
 	for field, value := range entries {
@@ -77,10 +146,18 @@ func handleHSET(ctx context.Context, cmd []string, server utils.Server, conn *ne
 			continue
 		}
 		hash[field] = value
+		// Setting a field discards its expiry
+		server.SetFieldExpiry(ctx, key, field, time.Time{})
 		count += 1
 	}
 	server.SetValue(ctx, key, hash)
+	if count > 0 {
+		server.NotifyKeyspaceEvent(ctx, utils.HashEvents, "hset", key)
+	}
 
+	if strings.EqualFold(cmd[0], "hmset") {
+		return []byte(utils.OK_RESPONSE), nil
+	}
 	return []byte(fmt.Sprintf(":%d\r\n\r\n", count)), nil
 }
 
@@ -106,6 +183,7 @@ func handleHGET(ctx context.Context, cmd []string, server utils.Server, conn *ne
 	if !ok {
 		return nil, fmt.Errorf("value at %s is not a hash", key)
 	}
+	hash = visibleHash(server, key, hash)
 
 	var value interface{}
 
@@ -120,16 +198,7 @@ func handleHGET(ctx context.Context, cmd []string, server utils.Server, conn *ne
 			res += fmt.Sprintf("$%d\r\n%s\r\n", len(s), s)
 			continue
 		}
-		if d, ok := value.(int); ok {
-			res += fmt.Sprintf(":%d\r\n", d)
-			continue
-		}
-		if f, ok := value.(float64); ok {
-			fs := strconv.FormatFloat(f, 'f', -1, 64)
-			res += fmt.Sprintf("$%d\r\n%s\r\n", len(fs), fs)
-			continue
-		}
-		res += fmt.Sprintf("$-1\r\n")
+		res += "$-1\r\n"
 	}
 	res += "\r\n"
 
@@ -158,6 +227,7 @@ func handleHSTRLEN(ctx context.Context, cmd []string, server utils.Server, conn
 	if !ok {
 		return nil, fmt.Errorf("value at %s is not a hash", key)
 	}
+	hash = visibleHash(server, key, hash)
 
 	var value interface{}
 
@@ -172,15 +242,6 @@ func handleHSTRLEN(ctx context.Context, cmd []string, server utils.Server, conn
 			res += fmt.Sprintf(":%d\r\n", len(s))
 			continue
 		}
-		if f, ok := value.(float64); ok {
-			fs := strconv.FormatFloat(f, 'f', -1, 64)
-			res += fmt.Sprintf(":%d\r\n", len(fs))
-			continue
-		}
-		if d, ok := value.(int); ok {
-			res += fmt.Sprintf(":%d\r\n", d)
-			continue
-		}
 		res += ":0\r\n"
 	}
 	res += "\r\n"
@@ -208,21 +269,12 @@ func handleHVALS(ctx context.Context, cmd []string, server utils.Server, conn *n
 	if !ok {
 		return nil, fmt.Errorf("value at %s is not a hash", key)
 	}
+	hash = visibleHash(server, key, hash)
 
 	res := fmt.Sprintf("*%d\r\n", len(hash))
 	for _, val := range hash {
-		if s, ok := val.(string); ok {
-			res += fmt.Sprintf("$%d\r\n%s\r\n", len(s), s)
-			continue
-		}
-		if f, ok := val.(float64); ok {
-			fs := strconv.FormatFloat(f, 'f', -1, 64)
-			res += fmt.Sprintf("$%d\r\n%s\r\n", len(fs), fs)
-			continue
-		}
-		if d, ok := val.(int); ok {
-			res += fmt.Sprintf(":%d\r\n", d)
-		}
+		s, _ := val.(string)
+		res += fmt.Sprintf("$%d\r\n%s\r\n", len(s), s)
 	}
 	res += "\r\n"
 
@@ -270,6 +322,7 @@ func handleHRANDFIELD(ctx context.Context, cmd []string, server utils.Server, co
 	if !ok {
 		return nil, fmt.Errorf("value at %s is not a hash", key)
 	}
+	hash = visibleHash(server, key, hash)
 
 	// If count is the >= hash length, then return the entire hash
 	if count >= len(hash) {
@@ -280,19 +333,8 @@ func handleHRANDFIELD(ctx context.Context, cmd []string, server utils.Server, co
 		for field, value := range hash {
 			res += fmt.Sprintf("$%d\r\n%s\r\n", len(field), field)
 			if withvalues {
-				if s, ok := value.(string); ok {
-					res += fmt.Sprintf("$%d\r\n%s\r\n", len(s), s)
-					continue
-				}
-				if f, ok := value.(float64); ok {
-					fs := strconv.FormatFloat(f, 'f', -1, 64)
-					res += fmt.Sprintf("$%d\r\n%s\r\n", len(fs), fs)
-					continue
-				}
-				if d, ok := value.(int); ok {
-					res += fmt.Sprintf(":%d\r\n", d)
-					continue
-				}
+				s, _ := value.(string)
+				res += fmt.Sprintf("$%d\r\n%s\r\n", len(s), s)
 			}
 		}
 		res += "\r\n"
@@ -326,19 +368,8 @@ func handleHRANDFIELD(ctx context.Context, cmd []string, server utils.Server, co
 	for _, field := range pluckedFields {
 		res += fmt.Sprintf("$%d\r\n%s\r\n", len(field), field)
 		if withvalues {
-			if s, ok := hash[field].(string); ok {
-				res += fmt.Sprintf("$%d\r\n%s\r\n", len(s), s)
-				continue
-			}
-			if f, ok := hash[field].(float64); ok {
-				fs := strconv.FormatFloat(f, 'f', -1, 64)
-				res += fmt.Sprintf("$%d\r\n%s\r\n", len(fs), fs)
-				continue
-			}
-			if d, ok := hash[field].(int); ok {
-				res += fmt.Sprintf(":%d\r\n", d)
-				continue
-			}
+			s, _ := hash[field].(string)
+			res += fmt.Sprintf("$%d\r\n%s\r\n", len(s), s)
 		}
 	}
 	res += "\r\n"
@@ -366,6 +397,7 @@ func handleHLEN(ctx context.Context, cmd []string, server utils.Server, conn *ne
 	if !ok {
 		return nil, fmt.Errorf("value at %s is not a hash", key)
 	}
+	hash = visibleHash(server, key, hash)
 
 	return []byte(fmt.Sprintf(":%d\r\n\r\n", len(hash))), nil
 }
@@ -390,6 +422,7 @@ func handleHKEYS(ctx context.Context, cmd []string, server utils.Server, conn *n
 	if !ok {
 		return nil, fmt.Errorf("value at %s is not a hash", key)
 	}
+	hash = visibleHash(server, key, hash)
 
 	res := fmt.Sprintf("*%d\r\n", len(hash))
 	for field, _ := range hash {
@@ -408,16 +441,18 @@ func handleINCRBY(ctx context.Context, cmd []string, server utils.Server, conn *
 	key := cmd[1]
 	field := cmd[2]
 
-	var intIncrement int
+	isFloat := strings.EqualFold(cmd[0], "hincrbyfloat")
+
+	var intIncrement int64
 	var floatIncrement float64
-	if strings.EqualFold(cmd[0], "hincrbyfloat") {
+	if isFloat {
 		f, err := strconv.ParseFloat(cmd[3], 64)
-		if err != nil {
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
 			return nil, errors.New("increment must be a float")
 		}
 		floatIncrement = f
 	} else {
-		i, err := strconv.Atoi(cmd[3])
+		i, err := strconv.ParseInt(cmd[3], 10, 64)
 		if err != nil {
 			return nil, errors.New("increment must be an integer")
 		}
@@ -428,20 +463,8 @@ func handleINCRBY(ctx context.Context, cmd []string, server utils.Server, conn *
 		if _, err := server.CreateKeyAndLock(ctx, key); err != nil {
 			return nil, err
 		}
-		defer server.KeyUnlock(key)
-		hash := make(map[string]interface{})
-		if strings.EqualFold(cmd[0], "hincrbyfloat") {
-			hash[field] = floatIncrement
-			server.SetValue(ctx, key, hash)
-			return []byte(fmt.Sprintf("+%s\r\n\r\n", strconv.FormatFloat(floatIncrement, 'f', -1, 64))), nil
-		} else {
-			hash[field] = intIncrement
-			server.SetValue(ctx, key, hash)
-			return []byte(fmt.Sprintf(":%d\r\n\r\n", intIncrement)), nil
-		}
-	}
-
-	if _, err := server.KeyLock(ctx, key); err != nil {
+		server.SetValue(ctx, key, make(map[string]interface{}))
+	} else if _, err := server.KeyLock(ctx, key); err != nil {
 		return nil, err
 	}
 	defer server.KeyUnlock(key)
@@ -450,38 +473,41 @@ func handleINCRBY(ctx context.Context, cmd []string, server utils.Server, conn *
 	if !ok {
 		return nil, fmt.Errorf("value at %s is not a hash", key)
 	}
+	removeExpiredFields(ctx, server, key, hash)
 
-	if hash[field] == nil {
-		hash[field] = 0
+	current := "0"
+	if hash[field] != nil {
+		current, _ = hash[field].(string)
 	}
 
-	switch hash[field].(type) {
-	default:
-		return nil, errors.New("hash value is not an integer")
-	case int:
-		i, _ := hash[field].(int)
-		if strings.EqualFold(cmd[0], "hincrbyfloat") {
-			hash[field] = float64(i) + floatIncrement
-		} else {
-			hash[field] = i + intIncrement
+	// Values are stored exactly as they were written, so they are only interpreted as numbers here
+	if isFloat {
+		f, err := strconv.ParseFloat(current, 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, errors.New("hash value is not a float")
 		}
-	case float64:
-		f, _ := hash[field].(float64)
-		if strings.EqualFold(cmd[0], "hincrbyfloat") {
-			hash[field] = f + floatIncrement
-		} else {
-			hash[field] = f + float64(intIncrement)
+		result := f + floatIncrement
+		if math.IsNaN(result) || math.IsInf(result, 0) {
+			return nil, errors.New("increment would produce NaN or Infinity")
 		}
+		hash[field] = strconv.FormatFloat(result, 'f', -1, 64)
+		server.SetValue(ctx, key, hash)
+		server.NotifyKeyspaceEvent(ctx, utils.HashEvents, "hincrbyfloat", key)
+		return []byte(fmt.Sprintf("+%s\r\n\r\n", hash[field])), nil
 	}
 
-	server.SetValue(ctx, key, hash)
-
-	if f, ok := hash[field].(float64); ok {
-		return []byte(fmt.Sprintf("+%s\r\n\r\n", strconv.FormatFloat(f, 'f', -1, 64))), nil
+	i, err := strconv.ParseInt(current, 10, 64)
+	if err != nil {
+		return nil, errors.New("hash value is not an integer")
 	}
+	if (intIncrement > 0 && i > math.MaxInt64-intIncrement) || (intIncrement < 0 && i < math.MinInt64-intIncrement) {
+		return nil, errors.New("increment or decrement would overflow")
+	}
+	hash[field] = strconv.FormatInt(i+intIncrement, 10)
+	server.SetValue(ctx, key, hash)
+	server.NotifyKeyspaceEvent(ctx, utils.HashEvents, "hincrby", key)
 
-	i, _ := hash[field].(int)
-	return []byte(fmt.Sprintf(":%d\r\n\r\n", i)), nil
+	return []byte(fmt.Sprintf(":%d\r\n\r\n", i+intIncrement)), nil
 }
 
 func handleHGETALL(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
@@ -504,20 +530,13 @@ func handleHGETALL(ctx context.Context, cmd []string, server utils.Server, conn
 	if !ok {
 		return nil, fmt.Errorf("value at %s is not a hash", key)
 	}
+	hash = visibleHash(server, key, hash)
 
 	res := fmt.Sprintf("*%d\r\n", len(hash)*2)
 	for field, value := range hash {
+		s, _ := value.(string)
 		res += fmt.Sprintf("$%d\r\n%s\r\n", len(field), field)
-		if s, ok := value.(string); ok {
-			res += fmt.Sprintf("$%d\r\n%s\r\n", len(s), s)
-		}
-		if f, ok := value.(float64); ok {
-			fs := strconv.FormatFloat(f, 'f', -1, 64)
-			res += fmt.Sprintf("$%d\r\n%s\r\n", len(fs), fs)
-		}
-		if d, ok := value.(int); ok {
-			res += fmt.Sprintf(":%d\r\n", d)
-		}
+		res += fmt.Sprintf("$%d\r\n%s\r\n", len(s), s)
 	}
 	res += "\r\n"
 
@@ -545,6 +564,7 @@ func handleHEXISTS(ctx context.Context, cmd []string, server utils.Server, conn
 	if !ok {
 		return nil, fmt.Errorf("value at %s is not a hash", key)
 	}
+	hash = visibleHash(server, key, hash)
 
 	if hash[field] != nil {
 		return []byte(":1\r\n\r\n"), nil
@@ -568,27 +588,631 @@ func handleHDEL(ctx context.Context, cmd []string, server utils.Server, conn *ne
 	if _, err := server.KeyLock(ctx, key); err != nil {
 		return nil, err
 	}
-	defer server.KeyUnlock(key)
 
 	hash, ok := server.GetValue(key).(map[string]interface{})
 	if !ok {
+		server.KeyUnlock(key)
 		return nil, fmt.Errorf("value at %s is not a hash", key)
 	}
+	changed := removeExpiredFields(ctx, server, key, hash)
 
 	count := 0
 
 	for _, field := range fields {
 		if hash[field] != nil {
 			delete(hash, field)
+			server.SetFieldExpiry(ctx, key, field, time.Time{})
 			count += 1
 		}
 	}
 
-	server.SetValue(ctx, key, hash)
+	if count > 0 {
+		server.NotifyKeyspaceEvent(ctx, utils.HashEvents, "hdel", key)
+	}
+	storeHash(ctx, server, key, hash, changed || count > 0)
 
 	return []byte(fmt.Sprintf(":%d\r\n\r\n", count)), nil
 }
 
+func handleHEXPIRE(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) < 6 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	key := cmd[1]
+	now := utils.Now(ctx)
+
+	option := map[string]string{
+		"hexpire":    "ex",
+		"hpexpire":   "px",
+		"hexpireat":  "exat",
+		"hpexpireat": "pxat",
+	}[strings.ToLower(cmd[0])]
+
+	n, err := strconv.ParseInt(cmd[2], 10, 64)
+	if err != nil || n < 0 {
+		return nil, errors.New("expire time must be a non-negative integer")
+	}
+	// An expire time of 0 removes the fields straight away
+	expireAt := now
+	if n > 0 {
+		if expireAt, err = utils.ParseExpiry(now, option, cmd[2]); err != nil {
+			return nil, err
+		}
+	}
+
+	args := cmd[3:]
+	condition := ""
+	if slices.Contains([]string{"nx", "xx", "gt", "lt"}, strings.ToLower(args[0])) {
+		condition = strings.ToLower(args[0])
+		args = args[1:]
+	}
+
+	fields, err := parseFields(args)
+	if err != nil {
+		return nil, err
+	}
+
+	res := fmt.Sprintf("*%d\r\n", len(fields))
+
+	if !server.KeyExists(key) {
+		res += strings.Repeat(":-2\r\n", len(fields))
+		return []byte(res + "\r\n"), nil
+	}
+
+	if _, err = server.KeyLock(ctx, key); err != nil {
+		return nil, err
+	}
+
+	hash, ok := server.GetValue(key).(map[string]interface{})
+	if !ok {
+		server.KeyUnlock(key)
+		return nil, fmt.Errorf("value at %s is not a hash", key)
+	}
+	changed := removeExpiredFields(ctx, server, key, hash)
+
+	deleted, updated := false, false
+	for _, field := range fields {
+		if hash[field] == nil {
+			res += ":-2\r\n"
+			continue
+		}
+		current, expires := server.GetFieldExpiry(key, field)
+		var met bool
+		switch condition {
+		default:
+			met = true
+		case "nx":
+			met = !expires
+		case "xx":
+			met = expires
+		case "gt":
+			// A field without an expiry never expires, so no expiry is greater
+			met = expires && expireAt.After(current)
+		case "lt":
+			met = !expires || expireAt.Before(current)
+		}
+		if !met {
+			res += ":0\r\n"
+			continue
+		}
+		if !expireAt.After(now) {
+			delete(hash, field)
+			server.SetFieldExpiry(ctx, key, field, time.Time{})
+			deleted = true
+			res += ":2\r\n"
+			continue
+		}
+		server.SetFieldExpiry(ctx, key, field, expireAt)
+		updated = true
+		res += ":1\r\n"
+	}
+	res += "\r\n"
+
+	if updated {
+		server.NotifyKeyspaceEvent(ctx, utils.HashEvents, "hexpire", key)
+	}
+	if deleted {
+		server.NotifyKeyspaceEvent(ctx, utils.HashEvents, "hdel", key)
+	}
+
+	storeHash(ctx, server, key, hash, changed || deleted)
+
+	return []byte(res), nil
+}
+
+func handleHTTL(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) < 5 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	key := cmd[1]
+	millis := strings.EqualFold(cmd[0], "hpttl")
+
+	fields, err := parseFields(cmd[2:])
+	if err != nil {
+		return nil, err
+	}
+
+	res := fmt.Sprintf("*%d\r\n", len(fields))
+
+	if !server.KeyExists(key) {
+		res += strings.Repeat(":-2\r\n", len(fields))
+		return []byte(res + "\r\n"), nil
+	}
+
+	if _, err = server.KeyRLock(ctx, key); err != nil {
+		return nil, err
+	}
+	defer server.KeyRUnlock(key)
+
+	hash, ok := server.GetValue(key).(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("value at %s is not a hash", key)
+	}
+	hash = visibleHash(server, key, hash)
+
+	now := time.Now()
+	for _, field := range fields {
+		if hash[field] == nil {
+			res += ":-2\r\n"
+			continue
+		}
+		expireAt, expires := server.GetFieldExpiry(key, field)
+		if !expires {
+			res += ":-1\r\n"
+			continue
+		}
+		ttl := max(expireAt.Sub(now).Milliseconds(), 0)
+		if !millis {
+			// Round to the nearest second
+			ttl = (ttl + 500) / 1000
+		}
+		res += fmt.Sprintf(":%d\r\n", ttl)
+	}
+	res += "\r\n"
+
+	return []byte(res), nil
+}
+
+func handleHPERSIST(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) < 5 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	key := cmd[1]
+
+	fields, err := parseFields(cmd[2:])
+	if err != nil {
+		return nil, err
+	}
+
+	res := fmt.Sprintf("*%d\r\n", len(fields))
+
+	if !server.KeyExists(key) {
+		res += strings.Repeat(":-2\r\n", len(fields))
+		return []byte(res + "\r\n"), nil
+	}
+
+	if _, err = server.KeyLock(ctx, key); err != nil {
+		return nil, err
+	}
+
+	hash, ok := server.GetValue(key).(map[string]interface{})
+	if !ok {
+		server.KeyUnlock(key)
+		return nil, fmt.Errorf("value at %s is not a hash", key)
+	}
+	changed := removeExpiredFields(ctx, server, key, hash)
+
+	persisted := false
+	for _, field := range fields {
+		if hash[field] == nil {
+			res += ":-2\r\n"
+			continue
+		}
+		if _, expires := server.GetFieldExpiry(key, field); !expires {
+			res += ":-1\r\n"
+			continue
+		}
+		server.SetFieldExpiry(ctx, key, field, time.Time{})
+		persisted = true
+		res += ":1\r\n"
+	}
+	res += "\r\n"
+
+	if persisted {
+		server.NotifyKeyspaceEvent(ctx, utils.HashEvents, "hpersist", key)
+	}
+	storeHash(ctx, server, key, hash, changed)
+
+	return []byte(res), nil
+}
+
+func handleHSETEX(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) < 6 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	key := cmd[1]
+	now := utils.Now(ctx)
+
+	condition := ""
+	keepTTL := false
+	var expireAt time.Time
+
+	i := 2
+	for i < len(cmd) && !strings.EqualFold(cmd[i], "fields") {
+		switch option := strings.ToLower(cmd[i]); option {
+		default:
+			return nil, fmt.Errorf("invalid option %s", cmd[i])
+		case "fnx", "fxx":
+			if condition != "" {
+				return nil, errors.New("only one of FNX or FXX can be given")
+			}
+			condition = option
+			i++
+		case "keepttl":
+			if keepTTL || !expireAt.IsZero() {
+				return nil, errors.New("only one of EX, PX, EXAT, PXAT or KEEPTTL can be given")
+			}
+			keepTTL = true
+			i++
+		case "ex", "px", "exat", "pxat":
+			if keepTTL || !expireAt.IsZero() {
+				return nil, errors.New("only one of EX, PX, EXAT, PXAT or KEEPTTL can be given")
+			}
+			if i+1 >= len(cmd) {
+				return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+			}
+			t, err := utils.ParseExpiry(now, option, cmd[i+1])
+			if err != nil {
+				return nil, err
+			}
+			expireAt = t
+			i += 2
+		}
+	}
+
+	if i+2 >= len(cmd) {
+		return nil, errors.New("mandatory argument FIELDS is missing or not at the right position")
+	}
+	n, err := strconv.Atoi(cmd[i+1])
+	if err != nil || n <= 0 {
+		return nil, errors.New("numfields must be a positive integer")
+	}
+	if len(cmd[i+2:]) != n*2 {
+		return nil, errors.New("numfields does not match the number of field/value pairs")
+	}
+	entries := cmd[i+2:]
+
+	var hash map[string]interface{}
+	changed := false
+	if !server.KeyExists(key) {
+		if condition == "fxx" {
+			return []byte(":0\r\n\r\n"), nil
+		}
+		if _, err = server.CreateKeyAndLock(ctx, key); err != nil {
+			return nil, err
+		}
+		hash = make(map[string]interface{})
+	} else {
+		if _, err = server.KeyLock(ctx, key); err != nil {
+			return nil, err
+		}
+		var ok bool
+		if hash, ok = server.GetValue(key).(map[string]interface{}); !ok {
+			server.KeyUnlock(key)
+			return nil, fmt.Errorf("value at %s is not a hash", key)
+		}
+		changed = removeExpiredFields(ctx, server, key, hash)
+	}
+
+	for j := 0; j < len(entries); j += 2 {
+		exists := hash[entries[j]] != nil
+		if (condition == "fnx" && exists) || (condition == "fxx" && !exists) {
+			storeHash(ctx, server, key, hash, changed)
+			return []byte(":0\r\n\r\n"), nil
+		}
+	}
+
+	for j := 0; j < len(entries); j += 2 {
+		field := entries[j]
+		switch {
+		case !expireAt.IsZero() && !expireAt.After(now):
+			// The fields expire as soon as they are set
+			delete(hash, field)
+			server.SetFieldExpiry(ctx, key, field, time.Time{})
+		case !expireAt.IsZero():
+			hash[field] = entries[j+1]
+			server.SetFieldExpiry(ctx, key, field, expireAt)
+		default:
+			hash[field] = entries[j+1]
+			if !keepTTL {
+				server.SetFieldExpiry(ctx, key, field, time.Time{})
+			}
+		}
+	}
+
+	switch {
+	case !expireAt.IsZero() && !expireAt.After(now):
+		server.NotifyKeyspaceEvent(ctx, utils.HashEvents, "hdel", key)
+	case !expireAt.IsZero():
+		server.NotifyKeyspaceEvent(ctx, utils.HashEvents, "hset", key)
+		server.NotifyKeyspaceEvent(ctx, utils.HashEvents, "hexpire", key)
+	default:
+		server.NotifyKeyspaceEvent(ctx, utils.HashEvents, "hset", key)
+	}
+
+	storeHash(ctx, server, key, hash, true)
+
+	return []byte(":1\r\n\r\n"), nil
+}
+
+// scanCursor returns the position of a field in the order HSCAN visits the fields of a hash.
+// The order only depends on the field itself, so fields that exist for the whole scan are always returned.
+func scanCursor(field string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(field))
+	return h.Sum64()
+}
+
+func handleHSCAN(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) < 3 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	key := cmd[1]
+
+	cursor, err := strconv.ParseUint(cmd[2], 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+
+	count := 10
+	novalues := false
+	var pattern glob.Glob
+	for i := 3; i < len(cmd); i++ {
+		switch strings.ToLower(cmd[i]) {
+		default:
+			return nil, fmt.Errorf("invalid option %s", cmd[i])
+		case "match":
+			if i+1 >= len(cmd) {
+				return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+			}
+			if pattern, err = glob.Compile(cmd[i+1]); err != nil {
+				return nil, fmt.Errorf("invalid pattern %s", cmd[i+1])
+			}
+			i++
+		case "count":
+			if i+1 >= len(cmd) {
+				return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+			}
+			if count, err = strconv.Atoi(cmd[i+1]); err != nil || count <= 0 {
+				return nil, errors.New("count must be a positive integer")
+			}
+			i++
+		case "novalues":
+			novalues = true
+		}
+	}
+
+	if !server.KeyExists(key) {
+		return []byte("*2\r\n$1\r\n0\r\n*0\r\n\r\n"), nil
+	}
+
+	if _, err = server.KeyRLock(ctx, key); err != nil {
+		return nil, err
+	}
+	defer server.KeyRUnlock(key)
+
+	hash, ok := server.GetValue(key).(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("value at %s is not a hash", key)
+	}
+	hash = visibleHash(server, key, hash)
+
+	type entry struct {
+		field  string
+		cursor uint64
+	}
+	var remaining []entry
+	for field := range hash {
+		if c := scanCursor(field); c >= cursor {
+			remaining = append(remaining, entry{field: field, cursor: c})
+		}
+	}
+	slices.SortFunc(remaining, func(a, b entry) int {
+		return cmp.Compare(a.cursor, b.cursor)
+	})
+
+	// Visit count fields, along with any fields that share the position of the last one
+	n := min(count, len(remaining))
+	for n < len(remaining) && remaining[n].cursor == remaining[n-1].cursor {
+		n++
+	}
+	next := uint64(0)
+	if n < len(remaining) {
+		next = remaining[n].cursor
+	}
+
+	var results []string
+	for _, e := range remaining[:n] {
+		if pattern != nil && !pattern.Match(e.field) {
+			continue
+		}
+		results = append(results, e.field)
+		if !novalues {
+			s, _ := hash[e.field].(string)
+			results = append(results, s)
+		}
+	}
+
+	nextCursor := strconv.FormatUint(next, 10)
+	res := fmt.Sprintf("*2\r\n$%d\r\n%s\r\n*%d\r\n", len(nextCursor), nextCursor, len(results))
+	for _, s := range results {
+		res += fmt.Sprintf("$%d\r\n%s\r\n", len(s), s)
+	}
+	res += "\r\n"
+
+	return []byte(res), nil
+}
+
+func handleHGETDEL(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) < 5 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	key := cmd[1]
+
+	fields, err := parseFields(cmd[2:])
+	if err != nil {
+		return nil, err
+	}
+
+	res := fmt.Sprintf("*%d\r\n", len(fields))
+
+	if !server.KeyExists(key) {
+		res += strings.Repeat("$-1\r\n", len(fields))
+		return []byte(res + "\r\n"), nil
+	}
+
+	if _, err = server.KeyLock(ctx, key); err != nil {
+		return nil, err
+	}
+
+	hash, ok := server.GetValue(key).(map[string]interface{})
+	if !ok {
+		server.KeyUnlock(key)
+		return nil, fmt.Errorf("value at %s is not a hash", key)
+	}
+	changed := removeExpiredFields(ctx, server, key, hash)
+
+	deleted := false
+	for _, field := range fields {
+		s, ok := hash[field].(string)
+		if !ok {
+			res += "$-1\r\n"
+			continue
+		}
+		res += fmt.Sprintf("$%d\r\n%s\r\n", len(s), s)
+		delete(hash, field)
+		server.SetFieldExpiry(ctx, key, field, time.Time{})
+		deleted = true
+	}
+	res += "\r\n"
+
+	if deleted {
+		server.NotifyKeyspaceEvent(ctx, utils.HashEvents, "hdel", key)
+	}
+
+	storeHash(ctx, server, key, hash, changed || deleted)
+
+	return []byte(res), nil
+}
+
+func handleHGETEX(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) < 5 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	key := cmd[1]
+	now := utils.Now(ctx)
+
+	persist := false
+	var expireAt time.Time
+
+	i := 2
+	for i < len(cmd) && !strings.EqualFold(cmd[i], "fields") {
+		switch option := strings.ToLower(cmd[i]); option {
+		default:
+			return nil, fmt.Errorf("invalid option %s", cmd[i])
+		case "persist":
+			if persist || !expireAt.IsZero() {
+				return nil, errors.New("only one of EX, PX, EXAT, PXAT or PERSIST can be given")
+			}
+			persist = true
+			i++
+		case "ex", "px", "exat", "pxat":
+			if persist || !expireAt.IsZero() {
+				return nil, errors.New("only one of EX, PX, EXAT, PXAT or PERSIST can be given")
+			}
+			if i+1 >= len(cmd) {
+				return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+			}
+			t, err := utils.ParseExpiry(now, option, cmd[i+1])
+			if err != nil {
+				return nil, err
+			}
+			expireAt = t
+			i += 2
+		}
+	}
+
+	fields, err := parseFields(cmd[i:])
+	if err != nil {
+		return nil, err
+	}
+
+	res := fmt.Sprintf("*%d\r\n", len(fields))
+
+	if !server.KeyExists(key) {
+		res += strings.Repeat("$-1\r\n", len(fields))
+		return []byte(res + "\r\n"), nil
+	}
+
+	if _, err = server.KeyLock(ctx, key); err != nil {
+		return nil, err
+	}
+
+	hash, ok := server.GetValue(key).(map[string]interface{})
+	if !ok {
+		server.KeyUnlock(key)
+		return nil, fmt.Errorf("value at %s is not a hash", key)
+	}
+	changed := removeExpiredFields(ctx, server, key, hash)
+
+	deleted, persisted, updated := false, false, false
+	for _, field := range fields {
+		s, ok := hash[field].(string)
+		if !ok {
+			res += "$-1\r\n"
+			continue
+		}
+		res += fmt.Sprintf("$%d\r\n%s\r\n", len(s), s)
+		switch {
+		case persist:
+			if _, expires := server.GetFieldExpiry(key, field); expires {
+				server.SetFieldExpiry(ctx, key, field, time.Time{})
+				persisted = true
+			}
+		case !expireAt.IsZero() && !expireAt.After(now):
+			// The field expires as soon as it is read
+			delete(hash, field)
+			server.SetFieldExpiry(ctx, key, field, time.Time{})
+			deleted = true
+		case !expireAt.IsZero():
+			server.SetFieldExpiry(ctx, key, field, expireAt)
+			updated = true
+		}
+	}
+	res += "\r\n"
+
+	if persisted {
+		server.NotifyKeyspaceEvent(ctx, utils.HashEvents, "hpersist", key)
+	}
+	if updated {
+		server.NotifyKeyspaceEvent(ctx, utils.HashEvents, "hexpire", key)
+	}
+	if deleted {
+		server.NotifyKeyspaceEvent(ctx, utils.HashEvents, "hdel", key)
+	}
+
+	storeHash(ctx, server, key, hash, changed || deleted)
+
+	return []byte(res), nil
+}
+
 func NewModule() Plugin {
 	SetModule := Plugin{
 		name: "HashCommands",
@@ -619,6 +1243,19 @@ func NewModule() Plugin {
 				},
 				HandlerFunc: handleHSET,
 			},
+			{
+				Command:     "hmset",
+				Categories:  []string{utils.HashCategory, utils.WriteCategory, utils.FastCategory},
+				Description: `(HMSET key field value [field value ...]) Same as HSET, but replies with OK`,
+				Sync:        true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 4 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleHSET,
+			},
 			{
 				Command:     "hget",
 				Categories:  []string{utils.HashCategory, utils.ReadCategory, utils.FastCategory},
@@ -632,6 +1269,19 @@ func NewModule() Plugin {
 				},
 				HandlerFunc: handleHGET,
 			},
+			{
+				Command:     "hmget",
+				Categories:  []string{utils.HashCategory, utils.ReadCategory, utils.FastCategory},
+				Description: `(HMGET key field [field ...]) Retrieve the value of each of the listed fields from the hash. Same as HGET.`,
+				Sync:        false,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 3 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleHGET,
+			},
 			{
 				Command:    "hstrlen",
 				Categories: []string{utils.HashCategory, utils.ReadCategory, utils.FastCategory},
@@ -766,6 +1416,163 @@ Return the string length of the values stored at the specified fields. 0 if the
 				},
 				HandlerFunc: handleHDEL,
 			},
+			{
+				Command:    "hexpire",
+				Categories: []string{utils.HashCategory, utils.WriteCategory, utils.FastCategory},
+				Description: `(HEXPIRE key seconds [NX | XX | GT | LT] FIELDS numfields field [field ...])
+Sets the expiry of each of the fields in seconds. Returns -2 for fields that do not exist, 0 if the condition is not met,
+1 if the expiry was set and 2 if the field was deleted because the expiry is 0.`,
+				Sync: true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 6 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleHEXPIRE,
+			},
+			{
+				Command:    "hpexpire",
+				Categories: []string{utils.HashCategory, utils.WriteCategory, utils.FastCategory},
+				Description: `(HPEXPIRE key milliseconds [NX | XX | GT | LT] FIELDS numfields field [field ...])
+Sets the expiry of each of the fields in milliseconds. Replies the same way as HEXPIRE.`,
+				Sync: true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 6 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleHEXPIRE,
+			},
+			{
+				Command:    "hexpireat",
+				Categories: []string{utils.HashCategory, utils.WriteCategory, utils.FastCategory},
+				Description: `(HEXPIREAT key unix-time-seconds [NX | XX | GT | LT] FIELDS numfields field [field ...])
+Sets the time at which each of the fields expires as a unix timestamp in seconds. Fields are deleted if the time is in the past.`,
+				Sync: true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 6 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleHEXPIRE,
+			},
+			{
+				Command:    "hpexpireat",
+				Categories: []string{utils.HashCategory, utils.WriteCategory, utils.FastCategory},
+				Description: `(HPEXPIREAT key unix-time-milliseconds [NX | XX | GT | LT] FIELDS numfields field [field ...])
+Sets the time at which each of the fields expires as a unix timestamp in milliseconds. Fields are deleted if the time is in the past.`,
+				Sync: true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 6 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleHEXPIRE,
+			},
+			{
+				Command:    "httl",
+				Categories: []string{utils.HashCategory, utils.ReadCategory, utils.FastCategory},
+				Description: `(HTTL key FIELDS numfields field [field ...]) Returns the remaining time to live of each of the fields in seconds,
+-1 for fields without an expiry and -2 for fields that do not exist.`,
+				Sync: false,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 5 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleHTTL,
+			},
+			{
+				Command:    "hpttl",
+				Categories: []string{utils.HashCategory, utils.ReadCategory, utils.FastCategory},
+				Description: `(HPTTL key FIELDS numfields field [field ...]) Returns the remaining time to live of each of the fields in milliseconds,
+-1 for fields without an expiry and -2 for fields that do not exist.`,
+				Sync: false,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 5 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleHTTL,
+			},
+			{
+				Command:    "hpersist",
+				Categories: []string{utils.HashCategory, utils.WriteCategory, utils.FastCategory},
+				Description: `(HPERSIST key FIELDS numfields field [field ...]) Removes the expiry of each of the fields.
+Returns 1 if the expiry was removed, -1 for fields without an expiry and -2 for fields that do not exist.`,
+				Sync: true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 5 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleHPERSIST,
+			},
+			{
+				Command:    "hsetex",
+				Categories: []string{utils.HashCategory, utils.WriteCategory, utils.FastCategory},
+				Description: `(HSETEX key [FNX | FXX] [EX seconds | PX milliseconds | EXAT unix-time-seconds | PXAT unix-time-milliseconds | KEEPTTL]
+FIELDS numfields field value [field value ...]) Sets the fields and their expiry. FNX only sets the fields if none of them exist,
+FXX only if all of them exist. Returns 1 if the fields were set and 0 otherwise.`,
+				Sync: true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 6 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleHSETEX,
+			},
+			{
+				Command:    "hscan",
+				Categories: []string{utils.HashCategory, utils.ReadCategory, utils.SlowCategory},
+				Description: `(HSCAN key cursor [MATCH pattern] [COUNT count] [NOVALUES]) Incrementally iterates over the fields of the hash.
+Returns the cursor to pass to the next call, which is 0 once the iteration is complete, and the field/value pairs visited.
+Fields that exist for the whole iteration are returned at least once.`,
+				Sync: false,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 3 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleHSCAN,
+			},
+			{
+				Command:    "hgetdel",
+				Categories: []string{utils.HashCategory, utils.WriteCategory, utils.FastCategory},
+				Description: `(HGETDEL key FIELDS numfields field [field ...]) Returns the value of each of the fields and deletes them from the hash.
+The hash is deleted when its last field is deleted.`,
+				Sync: true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 5 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleHGETDEL,
+			},
+			{
+				Command:    "hgetex",
+				Categories: []string{utils.HashCategory, utils.WriteCategory, utils.FastCategory},
+				Description: `(HGETEX key [EX seconds | PX milliseconds | EXAT unix-time-seconds | PXAT unix-time-milliseconds | PERSIST]
+FIELDS numfields field [field ...]) Returns the value of each of the fields and sets or, with PERSIST, removes their expiry.`,
+				Sync: true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 5 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleHGETEX,
+			},
 		},
 		description: "Handle HASH commands",
 	}
@@ -0,0 +1,82 @@
+package info
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kelvinmwinuka/memstore/src/utils"
+	"net"
+	"slices"
+	"strings"
+)
+
+type Plugin struct {
+	name        string
+	commands    []utils.Command
+	description string
+}
+
+func (p Plugin) Name() string {
+	return p.name
+}
+
+func (p Plugin) Commands() []utils.Command {
+	return p.commands
+}
+
+func (p Plugin) Description() string {
+	return p.description
+}
+
+func handleInfo(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) > 2 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+	if len(cmd) == 2 && !slices.Contains([]string{"stats", "all", "default", "everything"}, strings.ToLower(cmd[1])) {
+		return []byte("$0\r\n\r\n\n"), nil
+	}
+
+	metrics := server.GetMetrics()
+
+	counters := metrics.Counters()
+	// The output buffer counters are always listed so that they can be watched before any client is disconnected
+	for _, name := range []string{
+		"client_output_buffer_limit_disconnections",
+		"client_output_buffer_limit_disconnections_" + utils.NormalClient,
+		"client_output_buffer_limit_disconnections_" + utils.PubSubClient,
+	} {
+		counters[name] = metrics.Get(name)
+	}
+
+	names := make([]string, 0, len(counters))
+	for name := range counters {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	info := "# Stats\r\n"
+	for _, name := range names {
+		info += fmt.Sprintf("%s:%d\r\n", name, counters[name])
+	}
+	return []byte(fmt.Sprintf("$%d\r\n%s\r\n\n", len(info), info)), nil
+}
+
+func NewModule() Plugin {
+	InfoModule := Plugin{
+		name: "InfoCommands",
+		commands: []utils.Command{
+			{
+				Command:     "info",
+				Categories:  []string{utils.SlowCategory, utils.DangerousCategory},
+				Description: "(INFO [section]) Return the server's statistics, such as the number of clients disconnected for going over their output buffer limit.",
+				Sync:        false,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					return []string{}, nil
+				},
+				HandlerFunc: handleInfo,
+			},
+		},
+		description: "Handle INFO command",
+	}
+	return InfoModule
+}
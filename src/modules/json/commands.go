@@ -0,0 +1,900 @@
+package json
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/kelvinmwinuka/memstore/src/utils"
+	"net"
+	"strconv"
+	"strings"
+)
+
+type Plugin struct {
+	name        string
+	commands    []utils.Command
+	description string
+}
+
+func (p Plugin) Name() string {
+	return p.name
+}
+
+func (p Plugin) Commands() []utils.Command {
+	return p.commands
+}
+
+func (p Plugin) Description() string {
+	return p.description
+}
+
+// SnapshotDecoders implements utils.SnapshotPlugin.
+func (p Plugin) SnapshotDecoders() map[string]utils.SnapshotDecoder {
+	return map[string]utils.SnapshotDecoder{
+		"json": DecodeSnapshot,
+	}
+}
+
+// readDocument runs fn against the document at key while holding the key's read lock.
+// If the key does not exist, fn is not called and the nil reply is returned.
+func readDocument(ctx context.Context, server utils.Server, key string, fn func(doc *Document) ([]byte, error)) ([]byte, error) {
+	if !server.KeyExists(key) {
+		return []byte("$-1\r\n\r\n"), nil
+	}
+
+	if _, err := server.KeyRLock(ctx, key); err != nil {
+		return nil, err
+	}
+	defer server.KeyRUnlock(key)
+
+	doc, ok := server.GetValue(key).(*Document)
+	if !ok {
+		return nil, fmt.Errorf("value at %s is not a JSON document", key)
+	}
+
+	return fn(doc)
+}
+
+// writeDocument runs fn against the document at key while holding the key's write lock.
+func writeDocument(ctx context.Context, server utils.Server, key string, fn func(doc *Document) ([]byte, error)) ([]byte, error) {
+	if !server.KeyExists(key) {
+		return nil, fmt.Errorf("key %s does not exist", key)
+	}
+
+	if _, err := server.KeyLock(ctx, key); err != nil {
+		return nil, err
+	}
+	defer server.KeyUnlock(key)
+
+	doc, ok := server.GetValue(key).(*Document)
+	if !ok {
+		return nil, fmt.Errorf("value at %s is not a JSON document", key)
+	}
+
+	res, err := fn(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	server.SetValue(ctx, key, doc)
+	return res, nil
+}
+
+// formatResults builds the reply for commands that compute one result per matched location.
+// Each result is an already encoded RESP value, or an empty string if the operation did not apply to the location.
+// JSONPath queries reply with an array of all the results. Legacy paths reply with the first result only.
+func formatResults(path *Path, results []string) ([]byte, error) {
+	if path.IsLegacy() {
+		if len(results) == 0 {
+			return nil, fmt.Errorf("path %s does not exist", path)
+		}
+		if results[0] == "" {
+			return nil, fmt.Errorf("wrong type of value at path %s", path)
+		}
+		return []byte(results[0] + "\r\n"), nil
+	}
+
+	res := fmt.Sprintf("*%d\r\n", len(results))
+	for _, r := range results {
+		if r == "" {
+			res += "$-1\r\n"
+			continue
+		}
+		res += r
+	}
+	res += "\r\n"
+	return []byte(res), nil
+}
+
+func bulkString(s string) string {
+	return fmt.Sprintf("$%d\r\n%s\r\n", len(s), s)
+}
+
+// clone returns a deep copy of a JSON tree so that a value written to several locations is not shared between them.
+func clone(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		res := make(map[string]interface{}, len(v))
+		for k, child := range v {
+			res[k] = clone(child)
+		}
+		return res
+	case []interface{}:
+		res := make([]interface{}, len(v))
+		for i, child := range v {
+			res[i] = clone(child)
+		}
+		return res
+	}
+	return value
+}
+
+func handleJSONSet(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) < 4 || len(cmd) > 5 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	key := cmd[1]
+
+	path, err := ParsePath(cmd[2])
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := ParseValue(cmd[3])
+	if err != nil {
+		return nil, err
+	}
+
+	condition := ""
+	if len(cmd) == 5 {
+		condition = strings.ToLower(cmd[4])
+		if !utils.Contains([]string{"nx", "xx"}, condition) {
+			return nil, errors.New("condition must be NX or XX")
+		}
+	}
+
+	if !server.KeyExists(key) {
+		if !path.IsRoot() {
+			return nil, errors.New("new objects must be created at the root")
+		}
+		if condition == "xx" {
+			return []byte("$-1\r\n\r\n"), nil
+		}
+		if _, err = server.CreateKeyAndLock(ctx, key); err != nil {
+			return nil, err
+		}
+		defer server.KeyUnlock(key)
+		server.SetValue(ctx, key, &Document{root: value})
+		return []byte(utils.OK_RESPONSE), nil
+	}
+
+	if _, err = server.KeyLock(ctx, key); err != nil {
+		return nil, err
+	}
+	defer server.KeyUnlock(key)
+
+	doc, ok := server.GetValue(key).(*Document)
+	if !ok {
+		if path.IsRoot() && condition != "nx" {
+			// Setting the root replaces whatever value was previously stored at the key
+			server.SetValue(ctx, key, &Document{root: value})
+			return []byte(utils.OK_RESPONSE), nil
+		}
+		return nil, fmt.Errorf("value at %s is not a JSON document", key)
+	}
+
+	if matches := path.Evaluate(doc); len(matches) > 0 {
+		if condition == "nx" {
+			return []byte("$-1\r\n\r\n"), nil
+		}
+		for i, loc := range matches {
+			if i == 0 {
+				loc.set(value)
+				continue
+			}
+			loc.set(clone(value))
+		}
+		server.SetValue(ctx, key, doc)
+		return []byte(utils.OK_RESPONSE), nil
+	}
+
+	// The path does not exist, add it as a new member of the parent object(s)
+	if condition == "xx" {
+		return []byte("$-1\r\n\r\n"), nil
+	}
+
+	parentPath, name, ok := path.Parent()
+	if !ok {
+		return []byte("$-1\r\n\r\n"), nil
+	}
+
+	count := 0
+	for _, parent := range parentPath.Evaluate(doc) {
+		obj, ok := parent.value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if count == 0 {
+			obj[name] = value
+		} else {
+			obj[name] = clone(value)
+		}
+		count += 1
+	}
+
+	if count == 0 {
+		return []byte("$-1\r\n\r\n"), nil
+	}
+
+	server.SetValue(ctx, key, doc)
+	return []byte(utils.OK_RESPONSE), nil
+}
+
+// getPaths returns the JSON text of the values at the given paths in the same shape as JSON.GET.
+func getPaths(doc *Document, paths []*Path) (string, error) {
+	results := make(map[string]interface{})
+
+	for _, path := range paths {
+		matches := path.Evaluate(doc)
+
+		if path.IsLegacy() {
+			if len(matches) == 0 {
+				return "", fmt.Errorf("path %s does not exist", path)
+			}
+			results[path.String()] = matches[0].value
+			continue
+		}
+
+		values := make([]interface{}, len(matches))
+		for i, loc := range matches {
+			values[i] = loc.value
+		}
+		results[path.String()] = values
+	}
+
+	if len(paths) == 1 {
+		return marshal(results[paths[0].String()]), nil
+	}
+
+	return marshal(results), nil
+}
+
+func handleJSONGet(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) < 2 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	key := cmd[1]
+
+	rawPaths := cmd[2:]
+	if len(rawPaths) == 0 {
+		rawPaths = []string{"."}
+	}
+
+	var paths []*Path
+	for _, raw := range rawPaths {
+		path, err := ParsePath(raw)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+
+	return readDocument(ctx, server, key, func(doc *Document) ([]byte, error) {
+		res, err := getPaths(doc, paths)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(bulkString(res) + "\r\n"), nil
+	})
+}
+
+func handleJSONMGet(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) < 3 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	keys := cmd[1 : len(cmd)-1]
+
+	path, err := ParsePath(cmd[len(cmd)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	res := fmt.Sprintf("*%d\r\n", len(keys))
+	for _, key := range keys {
+		value, ok := func(key string) (string, bool) {
+			if !server.KeyExists(key) {
+				return "", false
+			}
+			if _, err := server.KeyRLock(ctx, key); err != nil {
+				return "", false
+			}
+			defer server.KeyRUnlock(key)
+			doc, ok := server.GetValue(key).(*Document)
+			if !ok {
+				return "", false
+			}
+			value, err := getPaths(doc, []*Path{path})
+			if err != nil {
+				return "", false
+			}
+			return value, true
+		}(key)
+		if !ok {
+			res += "$-1\r\n"
+			continue
+		}
+		res += bulkString(value)
+	}
+	res += "\r\n"
+
+	return []byte(res), nil
+}
+
+func handleJSONDel(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) < 2 || len(cmd) > 3 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	key := cmd[1]
+
+	rawPath := "$"
+	if len(cmd) == 3 {
+		rawPath = cmd[2]
+	}
+
+	path, err := ParsePath(rawPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if !server.KeyExists(key) {
+		return []byte(":0\r\n\r\n"), nil
+	}
+
+	if path.IsRoot() {
+		if err = server.DeleteKey(ctx, key); err != nil {
+			return nil, err
+		}
+		return []byte(":1\r\n\r\n"), nil
+	}
+
+	return writeDocument(ctx, server, key, func(doc *Document) ([]byte, error) {
+		matches := path.Evaluate(doc)
+		for _, loc := range matches {
+			loc.del()
+		}
+		doc.root = compact(doc.root)
+		return []byte(fmt.Sprintf(":%d\r\n\r\n", len(matches))), nil
+	})
+}
+
+func handleJSONType(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) < 2 || len(cmd) > 3 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	key := cmd[1]
+
+	rawPath := "."
+	if len(cmd) == 3 {
+		rawPath = cmd[2]
+	}
+
+	path, err := ParsePath(rawPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return readDocument(ctx, server, key, func(doc *Document) ([]byte, error) {
+		var results []string
+		for _, loc := range path.Evaluate(doc) {
+			results = append(results, fmt.Sprintf("+%s\r\n", typeName(loc.value)))
+		}
+		return formatResults(path, results)
+	})
+}
+
+func handleJSONNumIncrBy(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) != 4 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	key := cmd[1]
+
+	path, err := ParsePath(cmd[2])
+	if err != nil {
+		return nil, err
+	}
+
+	increment, ok := func() (json.Number, bool) {
+		value, err := ParseValue(cmd[3])
+		if err != nil {
+			return "", false
+		}
+		n, ok := value.(json.Number)
+		return n, ok
+	}()
+	if !ok {
+		return nil, errors.New("increment must be a number")
+	}
+
+	return writeDocument(ctx, server, key, func(doc *Document) ([]byte, error) {
+		matches := path.Evaluate(doc)
+
+		values := make([]interface{}, len(matches))
+		for i, loc := range matches {
+			n, err := incrementNumber(loc.value, increment)
+			if err != nil {
+				if path.IsLegacy() {
+					return nil, err
+				}
+				values[i] = nil
+				continue
+			}
+			loc.set(n)
+			values[i] = n
+		}
+
+		if path.IsLegacy() {
+			if len(values) == 0 {
+				return nil, fmt.Errorf("path %s does not exist", path)
+			}
+			return []byte(bulkString(marshal(values[0])) + "\r\n"), nil
+		}
+
+		return []byte(bulkString(marshal(values)) + "\r\n"), nil
+	})
+}
+
+func handleJSONStrAppend(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) < 3 || len(cmd) > 4 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	key := cmd[1]
+
+	rawPath := "."
+	if len(cmd) == 4 {
+		rawPath = cmd[2]
+	}
+
+	path, err := ParsePath(rawPath)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := ParseValue(cmd[len(cmd)-1])
+	if err != nil {
+		return nil, err
+	}
+	suffix, ok := value.(string)
+	if !ok {
+		return nil, errors.New("value must be a JSON string")
+	}
+
+	return writeDocument(ctx, server, key, func(doc *Document) ([]byte, error) {
+		var results []string
+		for _, loc := range path.Evaluate(doc) {
+			s, ok := loc.value.(string)
+			if !ok {
+				results = append(results, "")
+				continue
+			}
+			s += suffix
+			loc.set(s)
+			results = append(results, fmt.Sprintf(":%d\r\n", len(s)))
+		}
+		return formatResults(path, results)
+	})
+}
+
+func handleJSONArrAppend(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) < 4 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	key := cmd[1]
+
+	path, err := ParsePath(cmd[2])
+	if err != nil {
+		return nil, err
+	}
+
+	var values []interface{}
+	for _, raw := range cmd[3:] {
+		value, err := ParseValue(raw)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+
+	return writeDocument(ctx, server, key, func(doc *Document) ([]byte, error) {
+		var results []string
+		for _, loc := range path.Evaluate(doc) {
+			arr, ok := loc.value.([]interface{})
+			if !ok {
+				results = append(results, "")
+				continue
+			}
+			for _, value := range values {
+				arr = append(arr, clone(value))
+			}
+			loc.set(arr)
+			results = append(results, fmt.Sprintf(":%d\r\n", len(arr)))
+		}
+		return formatResults(path, results)
+	})
+}
+
+func handleJSONArrInsert(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) < 5 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	key := cmd[1]
+
+	path, err := ParsePath(cmd[2])
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := strconv.Atoi(cmd[3])
+	if err != nil {
+		return nil, errors.New("index must be an integer")
+	}
+
+	var values []interface{}
+	for _, raw := range cmd[4:] {
+		value, err := ParseValue(raw)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+
+	return writeDocument(ctx, server, key, func(doc *Document) ([]byte, error) {
+		matches := path.Evaluate(doc)
+
+		// Validate the index against every array before modifying any of them
+		for _, loc := range matches {
+			arr, ok := loc.value.([]interface{})
+			if !ok {
+				continue
+			}
+			if index > len(arr) || index < -len(arr) {
+				return nil, errors.New("index out of bounds")
+			}
+		}
+
+		var results []string
+		for _, loc := range matches {
+			arr, ok := loc.value.([]interface{})
+			if !ok {
+				results = append(results, "")
+				continue
+			}
+			i := index
+			if i < 0 {
+				i = len(arr) + i
+			}
+			inserted := make([]interface{}, 0, len(arr)+len(values))
+			inserted = append(inserted, arr[:i]...)
+			for _, value := range values {
+				inserted = append(inserted, clone(value))
+			}
+			inserted = append(inserted, arr[i:]...)
+			loc.set(inserted)
+			results = append(results, fmt.Sprintf(":%d\r\n", len(inserted)))
+		}
+		return formatResults(path, results)
+	})
+}
+
+func handleJSONArrPop(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) < 2 || len(cmd) > 4 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	key := cmd[1]
+
+	rawPath := "$"
+	if len(cmd) >= 3 {
+		rawPath = cmd[2]
+	}
+
+	path, err := ParsePath(rawPath)
+	if err != nil {
+		return nil, err
+	}
+
+	index := -1
+	if len(cmd) == 4 {
+		if index, err = strconv.Atoi(cmd[3]); err != nil {
+			return nil, errors.New("index must be an integer")
+		}
+	}
+
+	return writeDocument(ctx, server, key, func(doc *Document) ([]byte, error) {
+		var results []string
+		for _, loc := range path.Evaluate(doc) {
+			arr, ok := loc.value.([]interface{})
+			if !ok {
+				results = append(results, "")
+				continue
+			}
+			if len(arr) == 0 {
+				if path.IsLegacy() {
+					return nil, errors.New("array is empty")
+				}
+				results = append(results, "")
+				continue
+			}
+			// Out of range indices are clamped to the first and last elements
+			i := index
+			if i < 0 {
+				i = len(arr) + i
+			}
+			if i < 0 {
+				i = 0
+			}
+			if i >= len(arr) {
+				i = len(arr) - 1
+			}
+			popped := arr[i]
+			loc.set(append(arr[:i:i], arr[i+1:]...))
+			results = append(results, bulkString(marshal(popped)))
+		}
+		return formatResults(path, results)
+	})
+}
+
+func handleJSONObjKeys(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) < 2 || len(cmd) > 3 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	key := cmd[1]
+
+	rawPath := "$"
+	if len(cmd) == 3 {
+		rawPath = cmd[2]
+	}
+
+	path, err := ParsePath(rawPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return readDocument(ctx, server, key, func(doc *Document) ([]byte, error) {
+		var results []string
+		for _, loc := range path.Evaluate(doc) {
+			obj, ok := loc.value.(map[string]interface{})
+			if !ok {
+				results = append(results, "")
+				continue
+			}
+			keys := sortedKeys(obj)
+			r := fmt.Sprintf("*%d\r\n", len(keys))
+			for _, k := range keys {
+				r += bulkString(k)
+			}
+			results = append(results, r)
+		}
+		return formatResults(path, results)
+	})
+}
+
+func handleJSONObjLen(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) < 2 || len(cmd) > 3 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	key := cmd[1]
+
+	rawPath := "$"
+	if len(cmd) == 3 {
+		rawPath = cmd[2]
+	}
+
+	path, err := ParsePath(rawPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return readDocument(ctx, server, key, func(doc *Document) ([]byte, error) {
+		var results []string
+		for _, loc := range path.Evaluate(doc) {
+			obj, ok := loc.value.(map[string]interface{})
+			if !ok {
+				results = append(results, "")
+				continue
+			}
+			results = append(results, fmt.Sprintf(":%d\r\n", len(obj)))
+		}
+		return formatResults(path, results)
+	})
+}
+
+func NewModule() Plugin {
+	JSONModule := Plugin{
+		name: "JSONCommands",
+		commands: []utils.Command{
+			{
+				Command:     "json.set",
+				Categories:  []string{utils.JSONCategory, utils.WriteCategory, utils.SlowCategory},
+				Description: "(JSON.SET key path value [NX | XX]) Sets the JSON value at path in key. New keys must be created at the root path.",
+				Sync:        true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 4 || len(cmd) > 5 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return []string{cmd[1]}, nil
+				},
+				HandlerFunc: handleJSONSet,
+			},
+			{
+				Command:     "json.get",
+				Categories:  []string{utils.JSONCategory, utils.ReadCategory, utils.SlowCategory},
+				Description: "(JSON.GET key [path ...]) Returns the values at the given paths serialized as JSON.",
+				Sync:        false,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 2 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return []string{cmd[1]}, nil
+				},
+				HandlerFunc: handleJSONGet,
+			},
+			{
+				Command:     "json.mget",
+				Categories:  []string{utils.JSONCategory, utils.ReadCategory, utils.SlowCategory},
+				Description: "(JSON.MGET key [key ...] path) Returns the values at path from multiple keys.",
+				Sync:        false,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 3 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1 : len(cmd)-1], nil
+				},
+				HandlerFunc: handleJSONMGet,
+			},
+			{
+				Command:     "json.del",
+				Categories:  []string{utils.JSONCategory, utils.WriteCategory, utils.SlowCategory},
+				Description: "(JSON.DEL key [path]) Deletes the values at path. Deleting the root path deletes the key.",
+				Sync:        true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 2 || len(cmd) > 3 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return []string{cmd[1]}, nil
+				},
+				HandlerFunc: handleJSONDel,
+			},
+			{
+				Command:     "json.forget",
+				Categories:  []string{utils.JSONCategory, utils.WriteCategory, utils.SlowCategory},
+				Description: "(JSON.FORGET key [path]) Alias for JSON.DEL.",
+				Sync:        true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 2 || len(cmd) > 3 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return []string{cmd[1]}, nil
+				},
+				HandlerFunc: handleJSONDel,
+			},
+			{
+				Command:     "json.type",
+				Categories:  []string{utils.JSONCategory, utils.ReadCategory, utils.FastCategory},
+				Description: "(JSON.TYPE key [path]) Returns the type of the values at path.",
+				Sync:        false,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 2 || len(cmd) > 3 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return []string{cmd[1]}, nil
+				},
+				HandlerFunc: handleJSONType,
+			},
+			{
+				Command:     "json.numincrby",
+				Categories:  []string{utils.JSONCategory, utils.WriteCategory, utils.FastCategory},
+				Description: "(JSON.NUMINCRBY key path value) Increments the numbers at path by value.",
+				Sync:        true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) != 4 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return []string{cmd[1]}, nil
+				},
+				HandlerFunc: handleJSONNumIncrBy,
+			},
+			{
+				Command:     "json.strappend",
+				Categories:  []string{utils.JSONCategory, utils.WriteCategory, utils.FastCategory},
+				Description: "(JSON.STRAPPEND key [path] value) Appends the JSON string value to the strings at path.",
+				Sync:        true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 3 || len(cmd) > 4 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return []string{cmd[1]}, nil
+				},
+				HandlerFunc: handleJSONStrAppend,
+			},
+			{
+				Command:     "json.arrappend",
+				Categories:  []string{utils.JSONCategory, utils.WriteCategory, utils.SlowCategory},
+				Description: "(JSON.ARRAPPEND key path value [value ...]) Appends the values to the arrays at path.",
+				Sync:        true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 4 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return []string{cmd[1]}, nil
+				},
+				HandlerFunc: handleJSONArrAppend,
+			},
+			{
+				Command:     "json.arrinsert",
+				Categories:  []string{utils.JSONCategory, utils.WriteCategory, utils.SlowCategory},
+				Description: "(JSON.ARRINSERT key path index value [value ...]) Inserts the values into the arrays at path before index.",
+				Sync:        true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 5 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return []string{cmd[1]}, nil
+				},
+				HandlerFunc: handleJSONArrInsert,
+			},
+			{
+				Command:     "json.arrpop",
+				Categories:  []string{utils.JSONCategory, utils.WriteCategory, utils.SlowCategory},
+				Description: "(JSON.ARRPOP key [path [index]]) Removes and returns the element at index from the arrays at path. Index defaults to the last element.",
+				Sync:        true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 2 || len(cmd) > 4 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return []string{cmd[1]}, nil
+				},
+				HandlerFunc: handleJSONArrPop,
+			},
+			{
+				Command:     "json.objkeys",
+				Categories:  []string{utils.JSONCategory, utils.ReadCategory, utils.SlowCategory},
+				Description: "(JSON.OBJKEYS key [path]) Returns the member names of the objects at path.",
+				Sync:        false,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 2 || len(cmd) > 3 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return []string{cmd[1]}, nil
+				},
+				HandlerFunc: handleJSONObjKeys,
+			},
+			{
+				Command:     "json.objlen",
+				Categories:  []string{utils.JSONCategory, utils.ReadCategory, utils.FastCategory},
+				Description: "(JSON.OBJLEN key [path]) Returns the number of members of the objects at path.",
+				Sync:        false,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 2 || len(cmd) > 3 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return []string{cmd[1]}, nil
+				},
+				HandlerFunc: handleJSONObjLen,
+			},
+		},
+		description: "Handle JSON document commands",
+	}
+	return JSONModule
+}
@@ -0,0 +1,156 @@
+package json
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"slices"
+	"strconv"
+)
+
+// Document is the parsed tree of a JSON value stored at a key.
+// Objects are represented as map[string]interface{}, arrays as []interface{} and numbers as json.Number
+// so that integers keep their exact representation.
+type Document struct {
+	root interface{}
+}
+
+func NewDocument(raw string) (*Document, error) {
+	value, err := ParseValue(raw)
+	if err != nil {
+		return nil, err
+	}
+	return &Document{root: value}, nil
+}
+
+// ParseValue parses a JSON text into a tree.
+func ParseValue(raw string) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewBufferString(raw))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, errors.New("invalid JSON value")
+	}
+	if decoder.More() {
+		return nil, errors.New("invalid JSON value")
+	}
+	return value, nil
+}
+
+func (doc *Document) Root() interface{} {
+	return doc.root
+}
+
+func (doc *Document) MarshalJSON() ([]byte, error) {
+	return json.Marshal(doc.root)
+}
+
+func (doc *Document) UnmarshalJSON(b []byte) error {
+	value, err := ParseValue(string(b))
+	if err != nil {
+		return err
+	}
+	doc.root = value
+	return nil
+}
+
+// SnapshotType implements utils.SnapshotEncoder.
+func (doc *Document) SnapshotType() string {
+	return "json"
+}
+
+// MarshalBinary implements utils.SnapshotEncoder. The document is encoded as JSON text,
+// which keeps the exact representation of its numbers.
+func (doc *Document) MarshalBinary() ([]byte, error) {
+	return doc.MarshalJSON()
+}
+
+// DecodeSnapshot restores a document that was encoded with MarshalBinary.
+func DecodeSnapshot(b []byte) (interface{}, error) {
+	return NewDocument(string(b))
+}
+
+func marshal(value interface{}) string {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return "null"
+	}
+	return string(b)
+}
+
+func typeName(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return "unknown"
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	n, ok := value.(json.Number)
+	if !ok {
+		return 0, false
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return 0, false
+	}
+	return f, true
+}
+
+// incrementNumber adds increment to the number value.
+// The result remains an integer if both operands are integers and the sum does not overflow.
+func incrementNumber(value interface{}, increment json.Number) (json.Number, error) {
+	n, ok := value.(json.Number)
+	if !ok {
+		return "", errors.New("value is not a number")
+	}
+
+	a, errA := n.Int64()
+	b, errB := increment.Int64()
+	if errA == nil && errB == nil {
+		sum := a + b
+		if (b > 0 && sum < a) || (b < 0 && sum > a) {
+			return "", errors.New("increment would overflow")
+		}
+		return json.Number(strconv.FormatInt(sum, 10)), nil
+	}
+
+	fa, err := n.Float64()
+	if err != nil {
+		return "", err
+	}
+	fb, err := increment.Float64()
+	if err != nil {
+		return "", err
+	}
+	res := fa + fb
+	if math.IsInf(res, 0) || math.IsNaN(res) {
+		return "", errors.New("result is not a finite number")
+	}
+	return json.Number(strconv.FormatFloat(res, 'f', -1, 64)), nil
+}
+
+func sortedKeys(obj map[string]interface{}) []string {
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,753 @@
+package json
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type segmentType int
+
+const (
+	segmentChild    segmentType = iota // .name or ['name', 'other']
+	segmentWildcard                    // .* or [*]
+	segmentIndex                       // [0] or [0, -1]
+	segmentSlice                       // [start:end:step]
+	segmentFilter                      // [?(expression)]
+)
+
+type segment struct {
+	kind      segmentType
+	recursive bool // Set when the segment is preceded by the '..' descent operator
+	names     []string
+	indices   []int
+	start     *int
+	end       *int
+	step      int
+	filter    filterExpr
+}
+
+// Path is a compiled JSONPath expression.
+// Paths that do not start with '$' are treated as legacy paths, they are evaluated relative to the root
+// and the commands reply with a single value instead of an array of matches.
+type Path struct {
+	raw      string
+	legacy   bool
+	segments []segment
+}
+
+// location is a single node matched by a path together with the means to modify it in its parent.
+type location struct {
+	value interface{}
+	set   func(value interface{})
+	del   func()
+}
+
+// deleted marks an array element for removal. Deleted elements are compacted after all matches are processed
+// so that indices of sibling matches remain valid while the deletion is in progress.
+type deleted struct{}
+
+func ParsePath(raw string) (*Path, error) {
+	p := &Path{raw: raw}
+
+	s := strings.TrimSpace(raw)
+	if s == "" {
+		return nil, errors.New("path cannot be empty")
+	}
+
+	if s[0] == '$' {
+		s = s[1:]
+	} else {
+		p.legacy = true
+		if s == "." {
+			s = ""
+		} else if s[0] != '.' && s[0] != '[' {
+			s = "." + s
+		}
+	}
+
+	for len(s) > 0 {
+		seg, rest, err := parseSegment(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path %s: %s", raw, err.Error())
+		}
+		p.segments = append(p.segments, seg)
+		s = rest
+	}
+
+	return p, nil
+}
+
+func (p *Path) String() string {
+	return p.raw
+}
+
+func (p *Path) IsRoot() bool {
+	return len(p.segments) == 0
+}
+
+// IsLegacy returns true when the path does not start with '$'.
+func (p *Path) IsLegacy() bool {
+	return p.legacy
+}
+
+// Parent splits the path into the path of the parent container and the name of the child the path refers to.
+// It returns false if the last segment of the path is not a single child name.
+func (p *Path) Parent() (*Path, string, bool) {
+	if len(p.segments) == 0 {
+		return nil, "", false
+	}
+	last := p.segments[len(p.segments)-1]
+	if last.kind != segmentChild || last.recursive || len(last.names) != 1 {
+		return nil, "", false
+	}
+	return &Path{
+		raw:      p.raw,
+		legacy:   p.legacy,
+		segments: p.segments[:len(p.segments)-1],
+	}, last.names[0], true
+}
+
+func parseSegment(s string) (segment, string, error) {
+	seg := segment{}
+
+	if strings.HasPrefix(s, "..") {
+		seg.recursive = true
+		s = s[2:]
+		if len(s) > 0 && s[0] == '[' {
+			return parseBracket(seg, s)
+		}
+		return parseDotted(seg, s)
+	}
+
+	switch s[0] {
+	case '.':
+		return parseDotted(seg, s[1:])
+	case '[':
+		return parseBracket(seg, s)
+	default:
+		return seg, "", fmt.Errorf("unexpected character %q", s[0])
+	}
+}
+
+func parseDotted(seg segment, s string) (segment, string, error) {
+	if len(s) > 0 && s[0] == '*' {
+		seg.kind = segmentWildcard
+		return seg, s[1:], nil
+	}
+
+	end := strings.IndexAny(s, ".[")
+	if end == -1 {
+		end = len(s)
+	}
+	if end == 0 {
+		return seg, "", errors.New("expected member name")
+	}
+
+	seg.kind = segmentChild
+	seg.names = []string{s[:end]}
+	return seg, s[end:], nil
+}
+
+func parseBracket(seg segment, s string) (segment, string, error) {
+	end := matchingBracket(s)
+	if end == -1 {
+		return seg, "", errors.New("unterminated '['")
+	}
+
+	inner := strings.TrimSpace(s[1:end])
+	rest := s[end+1:]
+
+	switch {
+	case inner == "*":
+		seg.kind = segmentWildcard
+		return seg, rest, nil
+
+	case strings.HasPrefix(inner, "?"):
+		expr := strings.TrimSpace(inner[1:])
+		if !strings.HasPrefix(expr, "(") || !strings.HasSuffix(expr, ")") {
+			return seg, "", errors.New("filter expression must be enclosed in parentheses")
+		}
+		filter, err := parseFilter(expr[1 : len(expr)-1])
+		if err != nil {
+			return seg, "", err
+		}
+		seg.kind = segmentFilter
+		seg.filter = filter
+		return seg, rest, nil
+
+	case strings.HasPrefix(inner, "'") || strings.HasPrefix(inner, "\""):
+		names, err := splitQuoted(inner)
+		if err != nil {
+			return seg, "", err
+		}
+		seg.kind = segmentChild
+		seg.names = names
+		return seg, rest, nil
+
+	case strings.Contains(inner, ":"):
+		parts := strings.Split(inner, ":")
+		if len(parts) > 3 {
+			return seg, "", errors.New("slice must be in the format [start:end:step]")
+		}
+		seg.kind = segmentSlice
+		seg.step = 1
+		for i, part := range parts {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			n, err := strconv.Atoi(part)
+			if err != nil {
+				return seg, "", errors.New("slice bounds must be integers")
+			}
+			switch i {
+			case 0:
+				seg.start = &n
+			case 1:
+				seg.end = &n
+			case 2:
+				if n <= 0 {
+					return seg, "", errors.New("slice step must be a positive integer")
+				}
+				seg.step = n
+			}
+		}
+		return seg, rest, nil
+
+	default:
+		seg.kind = segmentIndex
+		for _, part := range strings.Split(inner, ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil {
+				return seg, "", fmt.Errorf("invalid array index %s", part)
+			}
+			seg.indices = append(seg.indices, n)
+		}
+		return seg, rest, nil
+	}
+}
+
+// matchingBracket returns the index of the ']' that closes the '[' at the start of s, skipping quoted strings.
+func matchingBracket(s string) int {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if quote != 0 {
+			if c == '\\' {
+				i++
+				continue
+			}
+			if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch c {
+		case '\'', '"':
+			quote = c
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func splitQuoted(s string) ([]string, error) {
+	var names []string
+	for len(s) > 0 {
+		s = strings.TrimSpace(s)
+		if len(s) == 0 || (s[0] != '\'' && s[0] != '"') {
+			return nil, errors.New("member names must be quoted")
+		}
+		str, rest, err := readQuoted(s)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, str)
+		rest = strings.TrimSpace(rest)
+		if len(rest) > 0 {
+			if rest[0] != ',' {
+				return nil, errors.New("member names must be separated by ','")
+			}
+			rest = rest[1:]
+		}
+		s = rest
+	}
+	return names, nil
+}
+
+// readQuoted reads a single or double-quoted string from the start of s and returns the unquoted value
+// along with the remainder of s.
+func readQuoted(s string) (string, string, error) {
+	quote := s[0]
+	var sb strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		if c == '\\' && i+1 < len(s) {
+			i++
+			sb.WriteByte(s[i])
+			continue
+		}
+		if c == quote {
+			return sb.String(), s[i+1:], nil
+		}
+		sb.WriteByte(c)
+	}
+	return "", "", errors.New("unterminated string")
+}
+
+// Evaluate returns the locations of all the nodes in the document that match the path.
+func (p *Path) Evaluate(doc *Document) []location {
+	current := []location{
+		{
+			value: doc.root,
+			set: func(value interface{}) {
+				doc.root = value
+			},
+			del: func() {
+				doc.root = nil
+			},
+		},
+	}
+
+	for _, seg := range p.segments {
+		var next []location
+		for _, loc := range current {
+			if seg.recursive {
+				for _, l := range descendants(loc) {
+					next = append(next, seg.apply(l)...)
+				}
+				continue
+			}
+			next = append(next, seg.apply(loc)...)
+		}
+		current = next
+	}
+
+	return current
+}
+
+// descendants returns the location itself followed by all of its descendants in pre-order.
+func descendants(loc location) []location {
+	res := []location{loc}
+	for _, child := range children(loc) {
+		res = append(res, descendants(child)...)
+	}
+	return res
+}
+
+func children(loc location) []location {
+	switch v := loc.value.(type) {
+	case map[string]interface{}:
+		res := make([]location, 0, len(v))
+		for _, k := range sortedKeys(v) {
+			res = append(res, objectMember(v, k))
+		}
+		return res
+	case []interface{}:
+		res := make([]location, 0, len(v))
+		for i := range v {
+			res = append(res, arrayElement(v, i))
+		}
+		return res
+	}
+	return nil
+}
+
+func objectMember(obj map[string]interface{}, key string) location {
+	return location{
+		value: obj[key],
+		set: func(value interface{}) {
+			obj[key] = value
+		},
+		del: func() {
+			delete(obj, key)
+		},
+	}
+}
+
+func arrayElement(arr []interface{}, index int) location {
+	return location{
+		value: arr[index],
+		set: func(value interface{}) {
+			arr[index] = value
+		},
+		del: func() {
+			arr[index] = deleted{}
+		},
+	}
+}
+
+func (seg segment) apply(loc location) []location {
+	switch seg.kind {
+	case segmentChild:
+		obj, ok := loc.value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		var res []location
+		for _, name := range seg.names {
+			if _, ok := obj[name]; ok {
+				res = append(res, objectMember(obj, name))
+			}
+		}
+		return res
+
+	case segmentWildcard:
+		return children(loc)
+
+	case segmentIndex:
+		arr, ok := loc.value.([]interface{})
+		if !ok {
+			return nil
+		}
+		var res []location
+		for _, i := range seg.indices {
+			if i < 0 {
+				i = len(arr) + i
+			}
+			if i >= 0 && i < len(arr) {
+				res = append(res, arrayElement(arr, i))
+			}
+		}
+		return res
+
+	case segmentSlice:
+		arr, ok := loc.value.([]interface{})
+		if !ok {
+			return nil
+		}
+		start, end := 0, len(arr)
+		if seg.start != nil {
+			start = normaliseIndex(*seg.start, len(arr))
+		}
+		if seg.end != nil {
+			end = normaliseIndex(*seg.end, len(arr))
+		}
+		var res []location
+		for i := start; i < end; i += seg.step {
+			res = append(res, arrayElement(arr, i))
+		}
+		return res
+
+	case segmentFilter:
+		var res []location
+		for _, child := range children(loc) {
+			if seg.filter.eval(child.value) {
+				res = append(res, child)
+			}
+		}
+		return res
+	}
+
+	return nil
+}
+
+func normaliseIndex(i int, length int) int {
+	if i < 0 {
+		i = length + i
+	}
+	if i < 0 {
+		return 0
+	}
+	if i > length {
+		return length
+	}
+	return i
+}
+
+// compact removes array elements that were marked as deleted.
+func compact(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			v[k] = compact(child)
+		}
+		return v
+	case []interface{}:
+		res := make([]interface{}, 0, len(v))
+		for _, child := range v {
+			if _, ok := child.(deleted); ok {
+				continue
+			}
+			res = append(res, compact(child))
+		}
+		return res
+	}
+	return value
+}
+
+// filterExpr is a predicate over a single node, used by [?(...)] path segments.
+type filterExpr interface {
+	eval(node interface{}) bool
+}
+
+type orExpr struct{ left, right filterExpr }
+
+func (e orExpr) eval(node interface{}) bool { return e.left.eval(node) || e.right.eval(node) }
+
+type andExpr struct{ left, right filterExpr }
+
+func (e andExpr) eval(node interface{}) bool { return e.left.eval(node) && e.right.eval(node) }
+
+type notExpr struct{ expr filterExpr }
+
+func (e notExpr) eval(node interface{}) bool { return !e.expr.eval(node) }
+
+// operand is either a literal value or a path relative to the current node ('@').
+type operand struct {
+	literal interface{}
+	path    *Path
+}
+
+func (o operand) resolve(node interface{}) (interface{}, bool) {
+	if o.path == nil {
+		return o.literal, true
+	}
+	matches := o.path.Evaluate(&Document{root: node})
+	if len(matches) == 0 {
+		return nil, false
+	}
+	return matches[0].value, true
+}
+
+type comparisonExpr struct {
+	left     operand
+	operator string // Empty when the expression only tests for the existence of the left operand
+	right    operand
+}
+
+func (e comparisonExpr) eval(node interface{}) bool {
+	left, ok := e.left.resolve(node)
+	if !ok {
+		return false
+	}
+	if e.operator == "" {
+		return true
+	}
+	right, ok := e.right.resolve(node)
+	if !ok {
+		return false
+	}
+
+	if l, ok := toFloat(left); ok {
+		if r, ok := toFloat(right); ok {
+			switch e.operator {
+			case "==":
+				return l == r
+			case "!=":
+				return l != r
+			case "<":
+				return l < r
+			case "<=":
+				return l <= r
+			case ">":
+				return l > r
+			case ">=":
+				return l >= r
+			}
+			return false
+		}
+	}
+
+	if l, ok := left.(string); ok {
+		if r, ok := right.(string); ok {
+			switch e.operator {
+			case "==":
+				return l == r
+			case "!=":
+				return l != r
+			case "<":
+				return l < r
+			case "<=":
+				return l <= r
+			case ">":
+				return l > r
+			case ">=":
+				return l >= r
+			}
+			return false
+		}
+	}
+
+	switch e.operator {
+	case "==":
+		return marshal(left) == marshal(right)
+	case "!=":
+		return marshal(left) != marshal(right)
+	}
+	return false
+}
+
+type filterParser struct {
+	s   string
+	pos int
+}
+
+func parseFilter(s string) (filterExpr, error) {
+	p := &filterParser{s: s}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos != len(p.s) {
+		return nil, fmt.Errorf("unexpected token in filter at position %d", p.pos)
+	}
+	return expr, nil
+}
+
+func (p *filterParser) skipSpace() {
+	for p.pos < len(p.s) && p.s[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+func (p *filterParser) consume(token string) bool {
+	p.skipSpace()
+	if strings.HasPrefix(p.s[p.pos:], token) {
+		p.pos += len(token)
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) parseOr() (filterExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.consume("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orExpr{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filterExpr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.consume("&&") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andExpr{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (filterExpr, error) {
+	if p.consume("!") {
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{expr: expr}, nil
+	}
+	if p.consume("(") {
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.consume(")") {
+			return nil, errors.New("expected ')' in filter")
+		}
+		return expr, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (filterExpr, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	for _, operator := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if p.consume(operator) {
+			right, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			return comparisonExpr{left: left, operator: operator, right: right}, nil
+		}
+	}
+	return comparisonExpr{left: left}, nil
+}
+
+func (p *filterParser) parseOperand() (operand, error) {
+	p.skipSpace()
+	if p.pos >= len(p.s) {
+		return operand{}, errors.New("unexpected end of filter")
+	}
+
+	rest := p.s[p.pos:]
+
+	switch {
+	case rest[0] == '@':
+		end := 1
+		for end < len(rest) {
+			if rest[end] == '[' {
+				closing := matchingBracket(rest[end:])
+				if closing == -1 {
+					return operand{}, errors.New("unterminated '[' in filter")
+				}
+				end += closing + 1
+				continue
+			}
+			if strings.ContainsRune(" =!<>&|)", rune(rest[end])) {
+				break
+			}
+			end++
+		}
+		path, err := ParsePath("$" + rest[1:end])
+		if err != nil {
+			return operand{}, err
+		}
+		p.pos += end
+		return operand{path: path}, nil
+
+	case rest[0] == '\'' || rest[0] == '"':
+		str, remainder, err := readQuoted(rest)
+		if err != nil {
+			return operand{}, err
+		}
+		p.pos += len(rest) - len(remainder)
+		return operand{literal: str}, nil
+	}
+
+	end := strings.IndexAny(rest, " =!<>&|)")
+	if end == -1 {
+		end = len(rest)
+	}
+	token := rest[:end]
+	p.pos += end
+
+	switch token {
+	case "true":
+		return operand{literal: true}, nil
+	case "false":
+		return operand{literal: false}, nil
+	case "null":
+		return operand{literal: nil}, nil
+	}
+
+	if _, err := strconv.ParseFloat(token, 64); err != nil {
+		return operand{}, fmt.Errorf("invalid literal %s in filter", token)
+	}
+	return operand{literal: json.Number(token)}, nil
+}
@@ -5,8 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"github.com/kelvinmwinuka/memstore/src/utils"
-	"math"
 	"net"
+	"slices"
+	"strconv"
 	"strings"
 )
 
@@ -29,6 +30,13 @@ func (p Plugin) Description() string {
 	return p.description
 }
 
+// SnapshotDecoders implements utils.SnapshotPlugin.
+func (p Plugin) SnapshotDecoders() map[string]utils.SnapshotDecoder {
+	return map[string]utils.SnapshotDecoder{
+		"list": DecodeSnapshot,
+	}
+}
+
 func handleLLen(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
 	if len(cmd) != 2 {
 		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
@@ -37,22 +45,22 @@ func handleLLen(ctx context.Context, cmd []string, server utils.Server, conn *ne
 	key := cmd[1]
 
 	if !server.KeyExists(key) {
-		// Key, does not exist, return
-		return nil, errors.New("LLEN command on non-list item")
+		// Empty lists are deleted, so a missing key is an empty list
+		return []byte(":0\r\n\r\n"), nil
 	}
 
 	_, err := server.KeyRLock(ctx, key)
 	if err != nil {
 		return nil, err
 	}
-	list, ok := server.GetValue(key).([]interface{})
-	server.KeyRUnlock(key)
+	defer server.KeyRUnlock(key)
 
+	list, ok := server.GetValue(key).(*List)
 	if !ok {
 		return nil, errors.New("LLEN command on non-list item")
 	}
 
-	return []byte(fmt.Sprintf(":%d\r\n\r\n", len(list))), nil
+	return []byte(fmt.Sprintf(":%d\r\n\r\n", list.Len())), nil
 }
 
 func handleLIndex(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
@@ -61,32 +69,33 @@ func handleLIndex(ctx context.Context, cmd []string, server utils.Server, conn *
 	}
 
 	key := cmd[1]
-	index, ok := utils.AdaptType(cmd[2]).(int)
+	index, err := strconv.Atoi(cmd[2])
 
-	if !ok {
+	if err != nil {
 		return nil, errors.New("index must be an integer")
 	}
 
 	if !server.KeyExists(key) {
-		return nil, errors.New("LINDEX command on non-list item")
+		return []byte("$-1\r\n\r\n"), nil
 	}
 
-	_, err := server.KeyRLock(ctx, key)
+	_, err = server.KeyRLock(ctx, key)
 	if err != nil {
 		return nil, err
 	}
-	list, ok := server.GetValue(key).([]interface{})
-	server.KeyRUnlock(key)
+	defer server.KeyRUnlock(key)
 
+	list, ok := server.GetValue(key).(*List)
 	if !ok {
 		return nil, errors.New("LINDEX command on non-list item")
 	}
 
-	if !(index >= 0 && int(index) < len(list)) {
+	if !(index >= 0 && index < list.Len()) {
 		return nil, errors.New("index must be within list range")
 	}
 
-	return []byte(fmt.Sprintf("+%s\r\n\r\n", list[index])), nil
+	elem, _ := list.Index(index)
+	return []byte(fmt.Sprintf("$%d\r\n%s\r\n\r\n", len(elem), elem)), nil
 }
 
 func handleLRange(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
@@ -95,49 +104,41 @@ func handleLRange(ctx context.Context, cmd []string, server utils.Server, conn *
 	}
 
 	key := cmd[1]
-	start, startOk := utils.AdaptType(cmd[2]).(int)
-	end, endOk := utils.AdaptType(cmd[3]).(int)
+	start, startErr := strconv.Atoi(cmd[2])
+	end, endErr := strconv.Atoi(cmd[3])
 
-	if !startOk || !endOk {
+	if startErr != nil || endErr != nil {
 		return nil, errors.New("both start and end indices must be integers")
 	}
 
 	if !server.KeyExists(key) {
-		return nil, errors.New("LRANGE command on non-list item")
+		return []byte("*0\r\n\r\n"), nil
 	}
 
 	_, err := server.KeyRLock(ctx, key)
 	if err != nil {
 		return nil, err
 	}
-	list, ok := server.GetValue(key).([]interface{})
-	server.KeyRUnlock(key)
+	defer server.KeyRUnlock(key)
 
+	list, ok := server.GetValue(key).(*List)
 	if !ok {
 		return nil, errors.New("type cannot be returned with LRANGE command")
 	}
 
 	// Make sure start is within range
-	if !(start >= 0 && int(start) < len(list)) {
+	if !(start >= 0 && start < list.Len()) {
 		return nil, errors.New("start index not within list range")
 	}
 
 	// Make sure end is within range, or is -1 otherwise
-	if !((end >= 0 && int(end) < len(list)) || end == -1) {
+	if !((end >= 0 && end < list.Len()) || end == -1) {
 		return nil, errors.New("end index must be within list range or -1")
 	}
 
-	var bytes []byte
-
 	// If end is -1, read list from start to the end of the list
 	if end == -1 {
-		bytes = []byte("*" + fmt.Sprint(len(list)-int(start)) + "\r\n")
-		for i := int(start); i < len(list); i++ {
-			str := fmt.Sprintf("%v", list[i])
-			bytes = append(bytes, []byte("$"+fmt.Sprint(len(str))+"\r\n"+str+"\r\n")...)
-		}
-		bytes = append(bytes, []byte("\r\n")...)
-		return bytes, nil
+		return []byte(encodeElements(list.Range(start, list.Len())) + "\r\n"), nil
 	}
 
 	// Make sure start and end are not equal to each other
@@ -148,28 +149,14 @@ func handleLRange(ctx context.Context, cmd []string, server utils.Server, conn *
 	// If end is not -1:
 	//	1) If end is larger than start, return slice from start -> end
 	//	2) If end is smaller than start, return slice from end -> start
-	bytes = []byte("*" + fmt.Sprint(int(math.Abs(float64(start-end)))+1) + "\r\n")
-
-	i := start
-	j := end + 1
-	if start > end {
-		j = end - 1
-	}
-
-	for i != j {
-		str := fmt.Sprintf("%v", list[i])
-		bytes = append(bytes, []byte("$"+fmt.Sprint(len(str))+"\r\n"+str+"\r\n")...)
-		if start < end {
-			i++
-		} else {
-			i--
-		}
-
+	if start < end {
+		return []byte(encodeElements(list.Range(start, end+1)) + "\r\n"), nil
 	}
 
-	bytes = append(bytes, []byte("\r\n")...)
+	elems := list.Range(end, start+1)
+	slices.Reverse(elems)
 
-	return bytes, nil
+	return []byte(encodeElements(elems) + "\r\n"), nil
 }
 
 func handleLSet(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
@@ -187,28 +174,23 @@ func handleLSet(ctx context.Context, cmd []string, server utils.Server, conn *ne
 	if err != nil {
 		return nil, err
 	}
-	list, ok := server.GetValue(key).([]interface{})
+	defer server.KeyUnlock(key)
 
+	list, ok := server.GetValue(key).(*List)
 	if !ok {
-		server.KeyUnlock(key)
 		return nil, errors.New("LSET command on non-list item")
 	}
 
-	index, ok := utils.AdaptType(cmd[2]).(int)
-
-	if !ok {
-		server.KeyUnlock(key)
+	index, err := strconv.Atoi(cmd[2])
+	if err != nil {
 		return nil, errors.New("index must be an integer")
 	}
 
-	if !(index >= 0 && index < len(list)) {
-		server.KeyUnlock(key)
+	if !list.Set(index, cmd[3]) {
 		return nil, errors.New("index must be within range")
 	}
-
-	list[index] = utils.AdaptType(cmd[3])
 	server.SetValue(ctx, key, list)
-	server.KeyUnlock(key)
+	server.NotifyKeyspaceEvent(ctx, utils.ListEvents, "lset", key)
 
 	return []byte(utils.OK_RESPONSE), nil
 }
@@ -219,10 +201,10 @@ func handleLTrim(ctx context.Context, cmd []string, server utils.Server, conn *n
 	}
 
 	key := cmd[1]
-	start, startOk := utils.AdaptType(cmd[2]).(int)
-	end, endOk := utils.AdaptType(cmd[3]).(int)
+	start, startErr := strconv.Atoi(cmd[2])
+	end, endErr := strconv.Atoi(cmd[3])
 
-	if !startOk || !endOk {
+	if startErr != nil || endErr != nil {
 		return nil, errors.New("start and end indices must be integers")
 	}
 
@@ -234,24 +216,34 @@ func handleLTrim(ctx context.Context, cmd []string, server utils.Server, conn *n
 		return nil, errors.New("LTRIM command on non-list item")
 	}
 
-	server.KeyLock(ctx, key)
-	list, ok := server.GetValue(key).([]interface{})
+	if _, err := server.KeyLock(ctx, key); err != nil {
+		return nil, err
+	}
+	list, ok := server.GetValue(key).(*List)
 
 	if !ok {
+		server.KeyUnlock(key)
 		return nil, errors.New("LTRIM command on non-list item")
 	}
 
-	if !(start >= 0 && int(start) < len(list)) {
+	if !(start >= 0 && start < list.Len()) {
+		server.KeyUnlock(key)
 		return nil, errors.New("start index must be within list boundary")
 	}
 
-	if end == -1 || int(end) > len(list) {
-		server.SetValue(ctx, key, list[start:])
-		server.KeyUnlock(key)
+	if end == -1 || end > list.Len() {
+		end = list.Len()
+	}
+	list.Trim(start, end)
+	server.NotifyKeyspaceEvent(ctx, utils.ListEvents, "ltrim", key)
+
+	if list.Len() == 0 {
+		server.DeleteLockedKey(ctx, key)
+		server.NotifyKeyspaceEvent(ctx, utils.GenericEvents, "del", key)
 		return []byte(utils.OK_RESPONSE), nil
 	}
 
-	server.SetValue(ctx, key, list[start:end])
+	server.SetValue(ctx, key, list)
 	server.KeyUnlock(key)
 	return []byte(utils.OK_RESPONSE), nil
 }
@@ -263,121 +255,157 @@ func handleLRem(ctx context.Context, cmd []string, server utils.Server, conn *ne
 
 	key := cmd[1]
 	value := cmd[3]
-	count, ok := utils.AdaptType(cmd[2]).(int)
+	count, err := strconv.Atoi(cmd[2])
 
-	if !ok {
+	if err != nil {
 		return nil, errors.New("count must be an integer")
 	}
 
-	absoluteCount := math.Abs(float64(count))
-
 	if !server.KeyExists(key) {
 		return nil, errors.New("LREM command on non-list item")
 	}
 
-	_, err := server.KeyLock(ctx, key)
+	_, err = server.KeyLock(ctx, key)
 	if err != nil {
 		return nil, err
 	}
-	defer server.KeyUnlock(key)
 
-	list, ok := server.GetValue(key).([]interface{})
+	list, ok := server.GetValue(key).(*List)
 
 	if !ok {
+		server.KeyUnlock(key)
 		return nil, errors.New("LREM command on non-list item")
 	}
 
-	switch {
-	default:
-		// Count is zero, keep list the same
-	case count > 0:
-		// Start from the head
-		for i := 0; i < len(list); i++ {
-			if absoluteCount == 0 {
-				break
-			}
-			if fmt.Sprintf("%v", list[i]) == value {
-				list[i] = nil
-				absoluteCount -= 1
-			}
-		}
-	case count < 0:
-		// Start from the tail
-		for i := len(list) - 1; i >= 0; i-- {
-			if absoluteCount == 0 {
-				break
-			}
-			if fmt.Sprintf("%v", list[i]) == value {
-				list[i] = nil
-				absoluteCount -= 1
-			}
-		}
+	// A count of zero keeps the list the same
+	if count != 0 && list.Remove(value, count) > 0 {
+		server.NotifyKeyspaceEvent(ctx, utils.ListEvents, "lrem", key)
 	}
 
-	list = utils.Filter[interface{}](list, func(elem interface{}) bool {
-		return elem != nil
-	})
+	if list.Len() == 0 {
+		server.DeleteLockedKey(ctx, key)
+		server.NotifyKeyspaceEvent(ctx, utils.GenericEvents, "del", key)
+		return []byte(utils.OK_RESPONSE), nil
+	}
 
 	server.SetValue(ctx, key, list)
+	server.KeyUnlock(key)
 
 	return []byte(utils.OK_RESPONSE), nil
 }
 
 func handleLMove(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
-	if len(cmd) != 5 {
-		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
-	}
+	var source, destination, whereFrom, whereTo string
 
-	source := cmd[1]
-	destination := cmd[2]
-	whereFrom := strings.ToLower(cmd[3])
-	whereTo := strings.ToLower(cmd[4])
+	switch strings.ToLower(cmd[0]) {
+	case "rpoplpush":
+		if len(cmd) != 3 {
+			return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+		}
+		source, destination, whereFrom, whereTo = cmd[1], cmd[2], "right", "left"
+	default:
+		if len(cmd) != 5 {
+			return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+		}
+		source, destination = cmd[1], cmd[2]
+		whereFrom, whereTo = strings.ToLower(cmd[3]), strings.ToLower(cmd[4])
+	}
 
 	if !utils.Contains[string]([]string{"left", "right"}, whereFrom) || !utils.Contains[string]([]string{"left", "right"}, whereTo) {
 		return nil, errors.New("wherefrom and whereto arguments must be either LEFT or RIGHT")
 	}
 
-	if !server.KeyExists(source) || !server.KeyExists(destination) {
-		return nil, errors.New("both source and destination must be lists")
+	if !server.KeyExists(source) {
+		return []byte("$-1\r\n\r\n"), nil
 	}
 
-	_, err := server.KeyLock(ctx, source)
-	if err != nil {
-		return nil, err
+	// Lock both keys in a fixed order so that moves in opposite directions cannot deadlock
+	keys := []string{source}
+	if destination != source {
+		keys = append(keys, destination)
 	}
-	defer server.KeyUnlock(source)
+	slices.Sort(keys)
 
-	_, err = server.KeyLock(ctx, destination)
-	if err != nil {
-		return nil, err
-	}
-	defer server.KeyUnlock(destination)
+	var locked []string
+	created, moved, emptied := false, false, false
+	// Keys that are left empty are deleted before their locks are released
+	defer func() {
+		for _, key := range locked {
+			switch {
+			case key == source && emptied:
+				server.DeleteLockedKey(ctx, key)
+				server.NotifyKeyspaceEvent(ctx, utils.GenericEvents, "del", key)
+			case key == destination && created && !moved:
+				server.DeleteLockedKey(ctx, key)
+			default:
+				server.KeyUnlock(key)
+			}
+		}
+	}()
 
-	sourceList, sourceOk := server.GetValue(source).([]interface{})
-	destinationList, destinationOk := server.GetValue(destination).([]interface{})
+	for _, key := range keys {
+		if key == destination && !server.KeyExists(key) {
+			if _, err := server.CreateKeyAndLock(ctx, key); err != nil {
+				return nil, err
+			}
+			created = true
+		} else if _, err := server.KeyLock(ctx, key); err != nil {
+			return nil, err
+		}
+		locked = append(locked, key)
+	}
 
-	if !sourceOk || !destinationOk {
-		return nil, errors.New("both source and destination must be lists")
+	sourceList, ok := server.GetValue(source).(*List)
+	if !ok {
+		return nil, fmt.Errorf("%s command on non-list item", strings.ToUpper(cmd[0]))
 	}
 
-	switch whereFrom {
-	case "left":
-		server.SetValue(ctx, source, append([]interface{}{}, sourceList[1:]...))
-		if whereTo == "left" {
-			server.SetValue(ctx, destination, append(sourceList[0:1], destinationList...))
-		} else if whereTo == "right" {
-			server.SetValue(ctx, destination, append(destinationList, sourceList[0]))
+	destinationList := NewList()
+	if !created {
+		if destinationList, ok = server.GetValue(destination).(*List); !ok {
+			return nil, fmt.Errorf("%s command on non-list item", strings.ToUpper(cmd[0]))
 		}
-	case "right":
-		server.SetValue(ctx, source, append([]interface{}{}, sourceList[:len(sourceList)-1]...))
-		if whereTo == "left" {
-			server.SetValue(ctx, destination, append(sourceList[len(source)-1:], destinationList...))
-		} else if whereTo == "right" {
-			server.SetValue(ctx, destination, append(destinationList, source[len(source)-1]))
+	}
+
+	var elem string
+	if whereFrom == "left" {
+		elem, ok = sourceList.PopFront()
+	} else {
+		elem, ok = sourceList.PopBack()
+	}
+	if !ok {
+		return []byte("$-1\r\n\r\n"), nil
+	}
+
+	if whereTo == "left" {
+		destinationList.PushFront(elem)
+	} else {
+		destinationList.PushBack(elem)
+	}
+
+	server.SetValue(ctx, destination, destinationList)
+	moved = true
+
+	if whereFrom == "left" {
+		server.NotifyKeyspaceEvent(ctx, utils.ListEvents, "lpop", source)
+	} else {
+		server.NotifyKeyspaceEvent(ctx, utils.ListEvents, "rpop", source)
+	}
+	if whereTo == "left" {
+		server.NotifyKeyspaceEvent(ctx, utils.ListEvents, "lpush", destination)
+	} else {
+		server.NotifyKeyspaceEvent(ctx, utils.ListEvents, "rpush", destination)
+	}
+
+	if destination != source {
+		if sourceList.Len() == 0 {
+			emptied = true
+		} else {
+			server.SetValue(ctx, source, sourceList)
 		}
 	}
 
-	return []byte(utils.OK_RESPONSE), nil
+	return []byte(fmt.Sprintf("$%d\r\n%s\r\n\r\n", len(elem), elem)), nil
 }
 
 func handleLPush(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
@@ -385,12 +413,6 @@ func handleLPush(ctx context.Context, cmd []string, server utils.Server, conn *n
 		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
 	}
 
-	newElems := []interface{}{}
-
-	for _, elem := range cmd[2:] {
-		newElems = append(newElems, utils.AdaptType(elem))
-	}
-
 	key := cmd[1]
 
 	if !server.KeyExists(key) {
@@ -400,7 +422,7 @@ func handleLPush(ctx context.Context, cmd []string, server utils.Server, conn *n
 		default:
 			// TODO: Retry CreateKeyAndLock until we obtain the key lock
 			server.CreateKeyAndLock(ctx, key)
-			server.SetValue(ctx, key, []interface{}{})
+			server.SetValue(ctx, key, NewList())
 		}
 	} else {
 		_, err := server.KeyLock(ctx, key)
@@ -411,15 +433,19 @@ func handleLPush(ctx context.Context, cmd []string, server utils.Server, conn *n
 
 	defer server.KeyUnlock(key)
 
-	currentList := server.GetValue(key)
-
-	l, ok := currentList.([]interface{})
+	l, ok := server.GetValue(key).(*List)
 
 	if !ok {
 		return nil, fmt.Errorf("%s command on non-list item", cmd[0])
 	}
 
-	server.SetValue(ctx, key, append(newElems, l...))
+	// The new elements are prepended as a block, keeping the order they were given in
+	for i := len(cmd) - 1; i >= 2; i-- {
+		l.PushFront(cmd[i])
+	}
+
+	server.SetValue(ctx, key, l)
+	server.NotifyKeyspaceEvent(ctx, utils.ListEvents, "lpush", key)
 	return []byte(utils.OK_RESPONSE), nil
 }
 
@@ -430,12 +456,6 @@ func handleRPush(ctx context.Context, cmd []string, server utils.Server, conn *n
 
 	key := cmd[1]
 
-	newElems := []interface{}{}
-
-	for _, elem := range cmd[2:] {
-		newElems = append(newElems, utils.AdaptType(elem))
-	}
-
 	if !server.KeyExists(key) {
 		switch strings.ToLower(cmd[0]) {
 		case "rpushx":
@@ -446,7 +466,7 @@ func handleRPush(ctx context.Context, cmd []string, server utils.Server, conn *n
 			if err != nil {
 				return nil, err
 			}
-			server.SetValue(ctx, key, []interface{}{})
+			server.SetValue(ctx, key, NewList())
 		}
 	} else {
 		_, err := server.KeyLock(ctx, key)
@@ -457,53 +477,299 @@ func handleRPush(ctx context.Context, cmd []string, server utils.Server, conn *n
 
 	defer server.KeyUnlock(key)
 
-	currentList := server.GetValue(key)
-
-	l, ok := currentList.([]interface{})
+	l, ok := server.GetValue(key).(*List)
 
 	if !ok {
 		return nil, errors.New("RPUSH command on non-list item")
 	}
 
-	server.SetValue(ctx, key, append(l, newElems...))
+	l.PushBack(cmd[2:]...)
+
+	server.SetValue(ctx, key, l)
+	server.NotifyKeyspaceEvent(ctx, utils.ListEvents, "rpush", key)
 	return []byte(utils.OK_RESPONSE), nil
 }
 
+// encodeElements formats list elements as an array of bulk strings.
+func encodeElements(elems []string) string {
+	var res strings.Builder
+	res.WriteString(fmt.Sprintf("*%d\r\n", len(elems)))
+	for _, elem := range elems {
+		res.WriteString(fmt.Sprintf("$%d\r\n%s\r\n", len(elem), elem))
+	}
+	return res.String()
+}
+
+// popElements removes up to count elements from the head or the tail of the list at the key,
+// and deletes the key once the list is empty. ok is false if the key does not exist.
+func popElements(ctx context.Context, server utils.Server, command string, key string, left bool, count int) (elems []string, ok bool, err error) {
+	if !server.KeyExists(key) {
+		return nil, false, nil
+	}
+
+	if _, err = server.KeyLock(ctx, key); err != nil {
+		return nil, false, err
+	}
+
+	list, isList := server.GetValue(key).(*List)
+	if !isList {
+		server.KeyUnlock(key)
+		return nil, false, fmt.Errorf("%s command on non-list item", strings.ToUpper(command))
+	}
+
+	count = min(count, list.Len())
+	elems = make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		var elem string
+		if left {
+			elem, _ = list.PopFront()
+		} else {
+			elem, _ = list.PopBack()
+		}
+		elems = append(elems, elem)
+	}
+
+	if count > 0 {
+		if left {
+			server.NotifyKeyspaceEvent(ctx, utils.ListEvents, "lpop", key)
+		} else {
+			server.NotifyKeyspaceEvent(ctx, utils.ListEvents, "rpop", key)
+		}
+	}
+
+	if list.Len() > 0 {
+		server.SetValue(ctx, key, list)
+		server.KeyUnlock(key)
+		return elems, true, nil
+	}
+
+	server.DeleteLockedKey(ctx, key)
+	server.NotifyKeyspaceEvent(ctx, utils.GenericEvents, "del", key)
+	return elems, true, nil
+}
+
 func handlePop(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
-	if len(cmd) != 2 {
+	if len(cmd) < 2 || len(cmd) > 3 {
 		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
 	}
 
 	key := cmd[1]
+	left := strings.EqualFold(cmd[0], "lpop")
 
-	if !server.KeyExists(key) {
-		return nil, fmt.Errorf("%s command on non-list item", strings.ToUpper(cmd[0]))
+	count := 1
+	if len(cmd) == 3 {
+		c, err := strconv.Atoi(cmd[2])
+		if err != nil || c < 0 {
+			return nil, errors.New("count must be a positive integer")
+		}
+		count = c
 	}
 
-	if !server.KeyExists(key) {
-		return nil, fmt.Errorf("%s command on non-list item", strings.ToUpper(cmd[0]))
+	elems, ok, err := popElements(ctx, server, cmd[0], key, left, count)
+	if err != nil {
+		return nil, err
 	}
 
-	_, err := server.KeyLock(ctx, key)
+	// With COUNT, the reply is always an array
+	if len(cmd) == 3 {
+		if !ok {
+			return []byte("*-1\r\n\r\n"), nil
+		}
+		return []byte(encodeElements(elems) + "\r\n"), nil
+	}
+
+	if len(elems) == 0 {
+		return []byte("$-1\r\n\r\n"), nil
+	}
+	return []byte(fmt.Sprintf("$%d\r\n%s\r\n\r\n", len(elems[0]), elems[0])), nil
+}
+
+func handleLMPop(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	keys, err := lmpopKeys(cmd)
 	if err != nil {
 		return nil, err
 	}
-	defer server.KeyUnlock(key)
 
-	list, ok := server.GetValue(key).([]interface{})
+	where := strings.ToLower(cmd[2+len(keys)])
+	if where != "left" && where != "right" {
+		return nil, errors.New("where must be either LEFT or RIGHT")
+	}
+
+	count := 1
+	switch options := cmd[3+len(keys):]; {
+	case len(options) == 0:
+	case len(options) == 2 && strings.EqualFold(options[0], "count"):
+		c, err := strconv.Atoi(options[1])
+		if err != nil || c <= 0 {
+			return nil, errors.New("count must be a positive integer")
+		}
+		count = c
+	default:
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	for _, key := range keys {
+		elems, ok, err := popElements(ctx, server, cmd[0], key, where == "left", count)
+		if err != nil {
+			return nil, err
+		}
+		if ok && len(elems) > 0 {
+			return []byte(fmt.Sprintf("*2\r\n$%d\r\n%s\r\n%s\r\n", len(key), key, encodeElements(elems))), nil
+		}
+	}
+
+	return []byte("*-1\r\n\r\n"), nil
+}
+
+// lmpopKeys returns the keys of an LMPOP command, which are preceded by the number of keys.
+func lmpopKeys(cmd []string) ([]string, error) {
+	if len(cmd) < 4 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+	numKeys, err := strconv.Atoi(cmd[1])
+	if err != nil || numKeys <= 0 {
+		return nil, errors.New("numkeys must be a positive integer")
+	}
+	if len(cmd) < numKeys+3 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+	return cmd[2 : 2+numKeys], nil
+}
+
+func handleLInsert(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) != 5 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	key := cmd[1]
+	where := strings.ToLower(cmd[2])
+	pivot := cmd[3]
+	elem := cmd[4]
+
+	if where != "before" && where != "after" {
+		return nil, errors.New("where must be either BEFORE or AFTER")
+	}
+
+	if !server.KeyExists(key) {
+		return []byte(":0\r\n\r\n"), nil
+	}
+
+	if _, err := server.KeyLock(ctx, key); err != nil {
+		return nil, err
+	}
+	defer server.KeyUnlock(key)
 
+	list, ok := server.GetValue(key).(*List)
 	if !ok {
-		return nil, fmt.Errorf("%s command on non-list item", strings.ToUpper(cmd[0]))
+		return nil, errors.New("LINSERT command on non-list item")
 	}
 
-	switch strings.ToLower(cmd[0]) {
-	default:
-		server.SetValue(ctx, key, list[1:])
-		return []byte(fmt.Sprintf("+%v\r\n\r\n", list[0])), nil
-	case "rpop":
-		server.SetValue(ctx, key, list[:len(list)-1])
-		return []byte(fmt.Sprintf("+%v\r\n\r\n", list[len(list)-1])), nil
+	index := list.IndexFunc(func(e string) bool {
+		return e == pivot
+	})
+	if index == -1 {
+		return []byte(":-1\r\n\r\n"), nil
+	}
+
+	if where == "after" {
+		index += 1
+	}
+	list.Insert(index, elem)
+	server.SetValue(ctx, key, list)
+	server.NotifyKeyspaceEvent(ctx, utils.ListEvents, "linsert", key)
+
+	return []byte(fmt.Sprintf(":%d\r\n\r\n", list.Len())), nil
+}
+
+func handleLPos(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) < 3 || len(cmd)%2 != 1 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	key := cmd[1]
+	elem := cmd[2]
+
+	rank, count, maxLen := 1, -1, 0
+	for i := 3; i < len(cmd); i += 2 {
+		option := strings.ToLower(cmd[i])
+		if !utils.Contains([]string{"rank", "count", "maxlen"}, option) {
+			return nil, fmt.Errorf("unknown option %s", cmd[i])
+		}
+		n, err := strconv.Atoi(cmd[i+1])
+		if err != nil {
+			return nil, fmt.Errorf("%s must be an integer", strings.ToUpper(option))
+		}
+		switch option {
+		case "rank":
+			if n == 0 {
+				return nil, errors.New("RANK can't be zero: use 1 to start from the first match or -1 to start from the last match")
+			}
+			rank = n
+		case "count":
+			if n < 0 {
+				return nil, errors.New("COUNT can't be negative")
+			}
+			count = n
+		case "maxlen":
+			if n < 0 {
+				return nil, errors.New("MAXLEN can't be negative")
+			}
+			maxLen = n
+		}
+	}
+
+	// Without COUNT, only the first match is returned and the reply is a single integer
+	withCount := count >= 0
+	if !withCount {
+		count = 1
+	}
+
+	var positions []int
+
+	if server.KeyExists(key) {
+		if _, err := server.KeyRLock(ctx, key); err != nil {
+			return nil, err
+		}
+		list, ok := server.GetValue(key).(*List)
+		if !ok {
+			server.KeyRUnlock(key)
+			return nil, errors.New("LPOS command on non-list item")
+		}
+
+		skip := utils.AbsInt(rank) - 1
+		compared := 0
+		list.Scan(rank < 0, func(i int, e string) bool {
+			if maxLen != 0 && compared == maxLen {
+				return false
+			}
+			compared++
+			if e != elem {
+				return true
+			}
+			if skip > 0 {
+				skip--
+				return true
+			}
+			positions = append(positions, i)
+			return count == 0 || len(positions) < count
+		})
+		server.KeyRUnlock(key)
+	}
+
+	if !withCount {
+		if len(positions) == 0 {
+			return []byte("$-1\r\n\r\n"), nil
+		}
+		return []byte(fmt.Sprintf(":%d\r\n\r\n", positions[0])), nil
+	}
+
+	res := fmt.Sprintf("*%d\r\n", len(positions))
+	for _, position := range positions {
+		res += fmt.Sprintf(":%d\r\n", position)
 	}
+	res += "\r\n"
+
+	return []byte(res), nil
 }
 
 func NewModule() Plugin {
@@ -539,10 +805,10 @@ func NewModule() Plugin {
 			{
 				Command:     "lpop",
 				Categories:  []string{utils.ListCategory, utils.WriteCategory, utils.FastCategory},
-				Description: "(LPOP key) Removes and returns the first element of a list.",
+				Description: "(LPOP key [count]) Removes and returns the first element of a list, or up to count elements when count is given. The key is deleted once the list is empty.",
 				Sync:        true,
 				KeyExtractionFunc: func(cmd []string) ([]string, error) {
-					if len(cmd) != 2 {
+					if len(cmd) < 2 || len(cmd) > 3 {
 						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
 					}
 					return []string{cmd[1]}, nil
@@ -630,7 +896,7 @@ func NewModule() Plugin {
 			{
 				Command:     "lmove",
 				Categories:  []string{utils.ListCategory, utils.WriteCategory, utils.SlowCategory},
-				Description: "(LMOVE source destination <LEFT | RIGHT> <LEFT | RIGHT>) Move element from one list to the other specifying left/right for both lists.",
+				Description: "(LMOVE source destination <LEFT | RIGHT> <LEFT | RIGHT>) Move element from one list to the other specifying left/right for both lists. Returns the element and creates the destination list if it does not exist.",
 				Sync:        true,
 				KeyExtractionFunc: func(cmd []string) ([]string, error) {
 					if len(cmd) != 5 {
@@ -643,10 +909,10 @@ func NewModule() Plugin {
 			{
 				Command:     "rpop",
 				Categories:  []string{utils.ListCategory, utils.WriteCategory, utils.FastCategory},
-				Description: "(RPOP key) Removes and gets the last element in a list.",
+				Description: "(RPOP key [count]) Removes and gets the last element in a list, or up to count elements when count is given. The key is deleted once the list is empty.",
 				Sync:        true,
 				KeyExtractionFunc: func(cmd []string) ([]string, error) {
-					if len(cmd) != 2 {
+					if len(cmd) < 2 || len(cmd) > 3 {
 						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
 					}
 					return []string{cmd[1]}, nil
@@ -679,6 +945,55 @@ func NewModule() Plugin {
 				},
 				HandlerFunc: handleRPush,
 			},
+			{
+				Command:     "rpoplpush",
+				Categories:  []string{utils.ListCategory, utils.WriteCategory, utils.SlowCategory},
+				Description: "(RPOPLPUSH source destination) Removes the last element of the source list and prepends it to the destination list. Returns the element.",
+				Sync:        true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) != 3 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:3], nil
+				},
+				HandlerFunc: handleLMove,
+			},
+			{
+				Command:     "lmpop",
+				Categories:  []string{utils.ListCategory, utils.WriteCategory, utils.SlowCategory},
+				Description: "(LMPOP numkeys key [key ...] <LEFT | RIGHT> [COUNT count]) Pops up to count elements from the first non-empty list among the keys.",
+				Sync:        true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					return lmpopKeys(cmd)
+				},
+				HandlerFunc: handleLMPop,
+			},
+			{
+				Command:     "linsert",
+				Categories:  []string{utils.ListCategory, utils.WriteCategory, utils.SlowCategory},
+				Description: "(LINSERT key <BEFORE | AFTER> pivot element) Inserts the element before or after the first occurrence of pivot. Returns the new length, or -1 if pivot was not found.",
+				Sync:        true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) != 5 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return []string{cmd[1]}, nil
+				},
+				HandlerFunc: handleLInsert,
+			},
+			{
+				Command:     "lpos",
+				Categories:  []string{utils.ListCategory, utils.ReadCategory, utils.SlowCategory},
+				Description: "(LPOS key element [RANK rank] [COUNT num-matches] [MAXLEN len]) Returns the index of matching elements in the list.",
+				Sync:        false,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 3 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return []string{cmd[1]}, nil
+				},
+				HandlerFunc: handleLPos,
+			},
 		},
 		description: "Handle List commands",
 	}
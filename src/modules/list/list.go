@@ -0,0 +1,370 @@
+package list
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// chunkSize is the maximum number of elements held by each chunk of a list.
+const chunkSize = 128
+
+// chunk is a block of consecutive list elements. The elements are buf[lo:hi], which leaves room
+// on both sides so that a chunk at the head can grow towards the front and a chunk at the tail
+// towards the back without shifting.
+type chunk struct {
+	buf        []string
+	lo, hi     int
+	prev, next *chunk
+}
+
+func (c *chunk) len() int {
+	return c.hi - c.lo
+}
+
+// List is a deque made of a doubly linked list of chunks. Pushing and popping at either end
+// is O(1), and access by index only walks the chunks rather than the elements.
+type List struct {
+	head, tail *chunk
+	length     int
+}
+
+func NewList(elems ...string) *List {
+	list := &List{}
+	list.PushBack(elems...)
+	return list
+}
+
+// Len returns the number of elements in the list.
+func (list *List) Len() int {
+	return list.length
+}
+
+// PushFront prepends the elements one at a time, so the last element ends up at the head.
+func (list *List) PushFront(elems ...string) {
+	for _, elem := range elems {
+		if list.head == nil || list.head.lo == 0 {
+			c := &chunk{buf: make([]string, chunkSize), lo: chunkSize, hi: chunkSize, next: list.head}
+			if list.head != nil {
+				list.head.prev = c
+			} else {
+				list.tail = c
+			}
+			list.head = c
+		}
+		list.head.lo--
+		list.head.buf[list.head.lo] = elem
+		list.length++
+	}
+}
+
+// PushBack appends the elements in order.
+func (list *List) PushBack(elems ...string) {
+	for _, elem := range elems {
+		if list.tail == nil || list.tail.hi == chunkSize {
+			c := &chunk{buf: make([]string, chunkSize), prev: list.tail}
+			if list.tail != nil {
+				list.tail.next = c
+			} else {
+				list.head = c
+			}
+			list.tail = c
+		}
+		list.tail.buf[list.tail.hi] = elem
+		list.tail.hi++
+		list.length++
+	}
+}
+
+// PopFront removes and returns the first element. ok is false if the list is empty.
+func (list *List) PopFront() (elem string, ok bool) {
+	if list.length == 0 {
+		return "", false
+	}
+	c := list.head
+	elem = c.buf[c.lo]
+	c.buf[c.lo] = ""
+	c.lo++
+	list.length--
+	if c.len() == 0 {
+		list.unlink(c)
+	}
+	return elem, true
+}
+
+// PopBack removes and returns the last element. ok is false if the list is empty.
+func (list *List) PopBack() (elem string, ok bool) {
+	if list.length == 0 {
+		return "", false
+	}
+	c := list.tail
+	c.hi--
+	elem = c.buf[c.hi]
+	c.buf[c.hi] = ""
+	list.length--
+	if c.len() == 0 {
+		list.unlink(c)
+	}
+	return elem, true
+}
+
+func (list *List) unlink(c *chunk) {
+	if c.prev != nil {
+		c.prev.next = c.next
+	} else {
+		list.head = c.next
+	}
+	if c.next != nil {
+		c.next.prev = c.prev
+	} else {
+		list.tail = c.prev
+	}
+	c.prev, c.next = nil, nil
+}
+
+// locate returns the chunk holding the element at index i and the element's position in the chunk's buffer.
+// It walks from whichever end of the list is closer. i must be within range.
+func (list *List) locate(i int) (*chunk, int) {
+	if i < list.length/2 {
+		for c := list.head; ; c = c.next {
+			if i < c.len() {
+				return c, c.lo + i
+			}
+			i -= c.len()
+		}
+	}
+	i = list.length - 1 - i
+	for c := list.tail; ; c = c.prev {
+		if i < c.len() {
+			return c, c.hi - 1 - i
+		}
+		i -= c.len()
+	}
+}
+
+// Index returns the element at index i. Negative indices count from the tail. ok is false if i is out of range.
+func (list *List) Index(i int) (elem string, ok bool) {
+	if i < 0 {
+		i += list.length
+	}
+	if i < 0 || i >= list.length {
+		return "", false
+	}
+	c, pos := list.locate(i)
+	return c.buf[pos], true
+}
+
+// Set replaces the element at index i. It returns false if i is out of range.
+func (list *List) Set(i int, elem string) bool {
+	if i < 0 || i >= list.length {
+		return false
+	}
+	c, pos := list.locate(i)
+	c.buf[pos] = elem
+	return true
+}
+
+// Range returns the elements from index start up to, but not including, index end.
+// The indices must satisfy 0 <= start <= end <= Len().
+func (list *List) Range(start, end int) []string {
+	res := make([]string, 0, end-start)
+	if start >= end {
+		return res
+	}
+	c, pos := list.locate(start)
+	for len(res) < end-start {
+		n := min(c.hi-pos, end-start-len(res))
+		res = append(res, c.buf[pos:pos+n]...)
+		if c = c.next; c != nil {
+			pos = c.lo
+		}
+	}
+	return res
+}
+
+// Elements returns all the elements of the list in order.
+func (list *List) Elements() []string {
+	return list.Range(0, list.length)
+}
+
+// Insert inserts the element so that it ends up at index i. i must satisfy 0 <= i <= Len().
+func (list *List) Insert(i int, elem string) {
+	if i == 0 {
+		list.PushFront(elem)
+		return
+	}
+	if i == list.length {
+		list.PushBack(elem)
+		return
+	}
+
+	c, pos := list.locate(i)
+	if c.len() == chunkSize {
+		// Split the full chunk in half and insert into whichever half holds the position
+		half := c.lo + chunkSize/2
+		next := &chunk{buf: make([]string, chunkSize), prev: c, next: c.next}
+		next.hi = copy(next.buf, c.buf[half:c.hi])
+		clear(c.buf[half:c.hi])
+		c.hi = half
+		if c.next != nil {
+			c.next.prev = next
+		} else {
+			list.tail = next
+		}
+		c.next = next
+		if pos >= half {
+			c, pos = next, pos-half
+		}
+	}
+
+	// The chunk is no longer full, so there is room on at least one side of the buffer.
+	// Shift whichever part of the elements is shorter.
+	if c.hi < chunkSize && (c.lo == 0 || pos-c.lo >= c.hi-pos) {
+		copy(c.buf[pos+1:c.hi+1], c.buf[pos:c.hi])
+		c.hi++
+	} else {
+		copy(c.buf[c.lo-1:pos-1], c.buf[c.lo:pos])
+		c.lo--
+		pos--
+	}
+	c.buf[pos] = elem
+	list.length++
+}
+
+// Remove removes up to count elements equal to elem, starting from the head if count is positive
+// and from the tail if it is negative. A count of 0 removes all of them. It returns the number removed.
+func (list *List) Remove(elem string, count int) int {
+	limit := count
+	if limit < 0 {
+		limit = -limit
+	}
+	removed := 0
+	list.filter(count < 0, func(e string) bool {
+		if e == elem && (limit == 0 || removed < limit) {
+			removed++
+			return false
+		}
+		return true
+	})
+	return removed
+}
+
+// filter keeps the elements for which keep returns true, visiting them from the tail if reverse is set.
+func (list *List) filter(reverse bool, keep func(elem string) bool) {
+	elems := list.Elements()
+	kept := make([]bool, len(elems))
+	for n := range elems {
+		i := n
+		if reverse {
+			i = len(elems) - 1 - n
+		}
+		kept[i] = keep(elems[i])
+	}
+	*list = List{}
+	for i, elem := range elems {
+		if kept[i] {
+			list.PushBack(elem)
+		}
+	}
+}
+
+// Trim keeps only the elements from index start up to, but not including, index end.
+// The indices must satisfy 0 <= start <= end <= Len().
+func (list *List) Trim(start, end int) {
+	for i := list.length; i > end; i-- {
+		list.PopBack()
+	}
+	for i := 0; i < start; i++ {
+		list.PopFront()
+	}
+}
+
+// IndexFunc returns the index of the first element for which match returns true, or -1 if there is none.
+func (list *List) IndexFunc(match func(elem string) bool) int {
+	index := -1
+	list.Scan(false, func(i int, elem string) bool {
+		if match(elem) {
+			index = i
+			return false
+		}
+		return true
+	})
+	return index
+}
+
+// Scan calls fn with each element and its index, from the head or from the tail if reverse is set,
+// until fn returns false.
+func (list *List) Scan(reverse bool, fn func(i int, elem string) bool) {
+	if !reverse {
+		i := 0
+		for c := list.head; c != nil; c = c.next {
+			for _, elem := range c.buf[c.lo:c.hi] {
+				if !fn(i, elem) {
+					return
+				}
+				i++
+			}
+		}
+		return
+	}
+	i := list.length - 1
+	for c := list.tail; c != nil; c = c.prev {
+		for j := c.hi - 1; j >= c.lo; j-- {
+			if !fn(i, c.buf[j]) {
+				return
+			}
+			i--
+		}
+	}
+}
+
+// SnapshotType implements utils.SnapshotEncoder.
+func (list *List) SnapshotType() string {
+	return "list"
+}
+
+// MarshalBinary implements utils.SnapshotEncoder. The list is encoded as its length
+// followed by each element prefixed with its length.
+func (list *List) MarshalBinary() ([]byte, error) {
+	size := binary.MaxVarintLen64
+	for c := list.head; c != nil; c = c.next {
+		for _, elem := range c.buf[c.lo:c.hi] {
+			size += len(elem) + 2
+		}
+	}
+	b := make([]byte, 0, size)
+	b = binary.AppendUvarint(b, uint64(list.length))
+	for c := list.head; c != nil; c = c.next {
+		for _, elem := range c.buf[c.lo:c.hi] {
+			b = binary.AppendUvarint(b, uint64(len(elem)))
+			b = append(b, elem...)
+		}
+	}
+	return b, nil
+}
+
+// DecodeSnapshot restores a list that was encoded with MarshalBinary.
+func DecodeSnapshot(b []byte) (interface{}, error) {
+	errInvalid := errors.New("invalid list snapshot")
+
+	length, n := binary.Uvarint(b)
+	if n <= 0 {
+		return nil, errInvalid
+	}
+	b = b[n:]
+
+	list := NewList()
+	for i := uint64(0); i < length; i++ {
+		size, n := binary.Uvarint(b)
+		if n <= 0 || size > uint64(len(b)-n) {
+			return nil, errInvalid
+		}
+		b = b[n:]
+		list.PushBack(string(b[:size]))
+		b = b[size:]
+	}
+	if len(b) != 0 {
+		return nil, errInvalid
+	}
+
+	return list, nil
+}
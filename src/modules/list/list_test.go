@@ -0,0 +1,320 @@
+package list
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// checkList compares the list with the expected elements and checks that its chunks are consistent.
+func checkList(t *testing.T, list *List, expected []string) {
+	t.Helper()
+
+	if list.Len() != len(expected) {
+		t.Fatalf("expected length %d, got %d", len(expected), list.Len())
+	}
+	if elems := list.Elements(); !slices.Equal(elems, expected) {
+		t.Fatalf("expected elements %v, got %v", expected, elems)
+	}
+
+	length := 0
+	var prev *chunk
+	for c := list.head; c != nil; c = c.next {
+		if c.prev != prev {
+			t.Fatal("chunk is not linked to the previous chunk")
+		}
+		if c.len() == 0 {
+			t.Fatal("list holds an empty chunk")
+		}
+		if c.lo < 0 || c.hi > chunkSize || c.lo > c.hi {
+			t.Fatalf("chunk bounds %d:%d are out of range", c.lo, c.hi)
+		}
+		length += c.len()
+		prev = c
+	}
+	if list.tail != prev {
+		t.Fatal("the tail is not the last chunk")
+	}
+	if length != list.Len() {
+		t.Fatalf("chunks hold %d elements, but the length is %d", length, list.Len())
+	}
+}
+
+func TestList(t *testing.T) {
+	elems := func(n int) []string {
+		res := make([]string, n)
+		for i := range res {
+			res[i] = fmt.Sprintf("e%d", i)
+		}
+		return res
+	}
+
+	tests := []struct {
+		name     string
+		build    func() *List
+		expected []string
+	}{
+		{
+			name:     "push back fills several chunks",
+			build:    func() *List { return NewList(elems(3*chunkSize + 1)...) },
+			expected: elems(3*chunkSize + 1),
+		},
+		{
+			name: "push front reverses the elements",
+			build: func() *List {
+				list := NewList()
+				list.PushFront("a", "b", "c")
+				return list
+			},
+			expected: []string{"c", "b", "a"},
+		},
+		{
+			name: "insert into a full chunk splits it",
+			build: func() *List {
+				list := NewList(elems(chunkSize)...)
+				list.Insert(1, "x")
+				list.Insert(chunkSize, "y")
+				return list
+			},
+			expected: slices.Insert(slices.Insert(elems(chunkSize), 1, "x"), chunkSize, "y"),
+		},
+		{
+			name: "insert at both ends",
+			build: func() *List {
+				list := NewList("b")
+				list.Insert(0, "a")
+				list.Insert(2, "c")
+				return list
+			},
+			expected: []string{"a", "b", "c"},
+		},
+		{
+			name: "popping every element empties the list",
+			build: func() *List {
+				list := NewList(elems(chunkSize + 2)...)
+				for list.Len() > 1 {
+					list.PopBack()
+				}
+				list.PopFront()
+				return list
+			},
+			expected: []string{},
+		},
+		{
+			name: "remove from the tail",
+			build: func() *List {
+				list := NewList("a", "b", "a", "c", "a")
+				list.Remove("a", -2)
+				return list
+			},
+			expected: []string{"a", "b", "c"},
+		},
+		{
+			name: "remove every match",
+			build: func() *List {
+				list := NewList("a", "b", "a", "c", "a")
+				list.Remove("a", 0)
+				return list
+			},
+			expected: []string{"b", "c"},
+		},
+		{
+			name: "trim across chunks",
+			build: func() *List {
+				list := NewList(elems(2 * chunkSize)...)
+				list.Trim(chunkSize-1, chunkSize+1)
+				return list
+			},
+			expected: elems(2 * chunkSize)[chunkSize-1 : chunkSize+1],
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			checkList(t, test.build(), test.expected)
+		})
+	}
+}
+
+func TestListIndex(t *testing.T) {
+	list := NewList("a", "b", "c")
+
+	tests := []struct {
+		index    int
+		expected string
+		ok       bool
+	}{
+		{index: 0, expected: "a", ok: true},
+		{index: 2, expected: "c", ok: true},
+		{index: -1, expected: "c", ok: true},
+		{index: -3, expected: "a", ok: true},
+		{index: 3, ok: false},
+		{index: -4, ok: false},
+	}
+
+	for _, test := range tests {
+		elem, ok := list.Index(test.index)
+		if ok != test.ok || elem != test.expected {
+			t.Errorf("Index(%d): expected %q, %v, got %q, %v", test.index, test.expected, test.ok, elem, ok)
+		}
+	}
+}
+
+// TestListRandom applies random operations to a list and to a slice, and checks that they stay the same.
+func TestListRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	list := NewList()
+	var expected []string
+
+	for op := 0; op < 20000; op++ {
+		elem := fmt.Sprintf("e%d", rng.Intn(50))
+
+		switch n := rng.Intn(100); {
+		case n < 20:
+			list.PushBack(elem)
+			expected = append(expected, elem)
+		case n < 40:
+			list.PushFront(elem)
+			expected = slices.Insert(expected, 0, elem)
+		case n < 50:
+			elem, ok := list.PopBack()
+			if ok != (len(expected) > 0) {
+				t.Fatalf("PopBack: expected ok to be %v", !ok)
+			}
+			if ok {
+				if elem != expected[len(expected)-1] {
+					t.Fatalf("PopBack: expected %s, got %s", expected[len(expected)-1], elem)
+				}
+				expected = expected[:len(expected)-1]
+			}
+		case n < 60:
+			elem, ok := list.PopFront()
+			if ok != (len(expected) > 0) {
+				t.Fatalf("PopFront: expected ok to be %v", !ok)
+			}
+			if ok {
+				if elem != expected[0] {
+					t.Fatalf("PopFront: expected %s, got %s", expected[0], elem)
+				}
+				expected = expected[1:]
+			}
+		case n < 80:
+			i := rng.Intn(len(expected) + 1)
+			list.Insert(i, elem)
+			expected = slices.Insert(expected, i, elem)
+		case n < 88:
+			if len(expected) == 0 {
+				continue
+			}
+			i := rng.Intn(len(expected))
+			list.Set(i, elem)
+			expected[i] = elem
+		case n < 92:
+			count := rng.Intn(5) - 2
+			removed := list.Remove(elem, count)
+			expectedRemoved := 0
+			if count < 0 {
+				slices.Reverse(expected)
+			}
+			expected = slices.DeleteFunc(expected, func(e string) bool {
+				if e == elem && (count == 0 || expectedRemoved < max(count, -count)) {
+					expectedRemoved++
+					return true
+				}
+				return false
+			})
+			if count < 0 {
+				slices.Reverse(expected)
+			}
+			if removed != expectedRemoved {
+				t.Fatalf("Remove(%s, %d): expected %d removed, got %d", elem, count, expectedRemoved, removed)
+			}
+		case n < 94:
+			start := rng.Intn(len(expected) + 1)
+			end := start + rng.Intn(len(expected)-start+1)
+			list.Trim(start, end)
+			expected = slices.Clone(expected[start:end])
+		default:
+			start := rng.Intn(len(expected) + 1)
+			end := start + rng.Intn(len(expected)-start+1)
+			if r := list.Range(start, end); !slices.Equal(r, expected[start:end]) {
+				t.Fatalf("Range(%d, %d): expected %v, got %v", start, end, expected[start:end], r)
+			}
+		}
+
+		if op%100 == 0 {
+			checkList(t, list, expected)
+		}
+	}
+
+	checkList(t, list, expected)
+}
+
+func TestListScan(t *testing.T) {
+	list := NewList()
+	var expected []string
+	for i := 0; i < 3*chunkSize; i++ {
+		elem := fmt.Sprintf("e%d", i)
+		list.PushBack(elem)
+		expected = append(expected, elem)
+	}
+
+	var forward []string
+	list.Scan(false, func(i int, elem string) bool {
+		if elem != expected[i] {
+			t.Fatalf("Scan: expected %s at %d, got %s", expected[i], i, elem)
+		}
+		forward = append(forward, elem)
+		return true
+	})
+	if !slices.Equal(forward, expected) {
+		t.Errorf("Scan did not visit every element in order")
+	}
+
+	var backward []string
+	list.Scan(true, func(i int, elem string) bool {
+		if elem != expected[i] {
+			t.Fatalf("Scan: expected %s at %d, got %s", expected[i], i, elem)
+		}
+		backward = append(backward, elem)
+		return len(backward) < 10
+	})
+	if len(backward) != 10 || backward[0] != expected[len(expected)-1] {
+		t.Errorf("reverse Scan did not stop after 10 elements from the tail, got %v", backward)
+	}
+
+	if i := list.IndexFunc(func(elem string) bool { return elem == "e200" }); i != 200 {
+		t.Errorf("IndexFunc: expected 200, got %d", i)
+	}
+	if i := list.IndexFunc(func(elem string) bool { return elem == "missing" }); i != -1 {
+		t.Errorf("IndexFunc: expected -1, got %d", i)
+	}
+}
+
+func TestListSnapshot(t *testing.T) {
+	long := make([]string, 2*chunkSize+3)
+	for i := range long {
+		long[i] = fmt.Sprintf("e%d", i)
+	}
+
+	for _, elems := range [][]string{
+		{},
+		{"", "a", "with\r\nnewline"},
+		long,
+	} {
+		b, err := NewList(elems...).MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := DecodeSnapshot(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkList(t, decoded.(*List), elems)
+	}
+
+	if _, err := DecodeSnapshot([]byte{3, 1, 'a'}); err == nil {
+		t.Error("expected a truncated snapshot to be rejected")
+	}
+}
@@ -50,6 +50,18 @@ func NewModule() Plugin {
 				},
 				HandlerFunc: handlePing,
 			},
+			{
+				Command:     "quit",
+				Categories:  []string{utils.FastCategory, utils.ConnectionCategory},
+				Description: "(QUIT) Close the connection once the reply has been sent.",
+				Sync:        false,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					return []string{}, nil
+				},
+				HandlerFunc: func(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+					return []byte(utils.OK_RESPONSE), nil
+				},
+			},
 			{
 				Command:     "ack",
 				Categories:  []string{},
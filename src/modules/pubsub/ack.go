@@ -0,0 +1,84 @@
+package pubsub
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// ackTimeout is how long a subscriber has to acknowledge a message outside of compatibility mode
+// before it is unsubscribed from the channel or pattern that the message was delivered through.
+const ackTimeout = 200 * time.Millisecond
+
+// pendingAck is a message delivered to a subscriber that has not been acknowledged yet.
+type pendingAck struct {
+	timer *time.Timer
+}
+
+// ackTracker keeps the messages that each subscriber still has to acknowledge with +ACK, oldest first.
+// The ACKs are read by the connection's own reader and passed to Ack, so delivering a message never waits
+// for the subscriber. A subscriber acknowledges messages in the order that they were sent.
+type ackTracker struct {
+	mut     sync.Mutex
+	pending map[*net.Conn][]*pendingAck
+}
+
+func newAckTracker() *ackTracker {
+	return &ackTracker{
+		mut:     sync.Mutex{},
+		pending: make(map[*net.Conn][]*pendingAck),
+	}
+}
+
+// expect records a message sent to the connection. If the message is not acknowledged within ackTimeout,
+// unsubscribe is called to remove the subscription that it was delivered through.
+func (tracker *ackTracker) expect(conn *net.Conn, unsubscribe func()) {
+	tracker.mut.Lock()
+	defer tracker.mut.Unlock()
+
+	ack := &pendingAck{}
+	ack.timer = time.AfterFunc(ackTimeout, func() {
+		if tracker.remove(conn, ack) {
+			unsubscribe()
+		}
+	})
+	tracker.pending[conn] = append(tracker.pending[conn], ack)
+}
+
+// remove drops the pending message and reports whether it was still waiting for an ACK.
+func (tracker *ackTracker) remove(conn *net.Conn, ack *pendingAck) bool {
+	tracker.mut.Lock()
+	defer tracker.mut.Unlock()
+
+	acks := tracker.pending[conn]
+	for i, pending := range acks {
+		if pending != ack {
+			continue
+		}
+		if len(acks) == 1 {
+			delete(tracker.pending, conn)
+		} else {
+			tracker.pending[conn] = append(acks[:i:i], acks[i+1:]...)
+		}
+		return true
+	}
+	return false
+}
+
+// ack acknowledges the oldest message sent to the connection. It reports whether one was waiting.
+func (tracker *ackTracker) ack(conn *net.Conn) bool {
+	tracker.mut.Lock()
+	defer tracker.mut.Unlock()
+
+	acks := tracker.pending[conn]
+	if len(acks) == 0 {
+		return false
+	}
+	acks[0].timer.Stop()
+	if len(acks) == 1 {
+		delete(tracker.pending, conn)
+	} else {
+		tracker.pending[conn] = acks[1:]
+	}
+	return true
+}
@@ -0,0 +1,163 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+)
+
+// Cluster connects the pub/sub of this node to the other nodes of the cluster.
+type Cluster interface {
+	// Replicate applies the command on every node through the raft log.
+	Replicate(ctx context.Context, cmd []string) ([]byte, error)
+	// BroadcastPublish delivers a message published on this node to the subscribers on every other node.
+	// An empty channel publishes the message to every channel.
+	BroadcastPublish(channel string, message string, headers map[string]string)
+	// ShardOwner returns the client address of the node that owns the sharded channel, and whether it is this node.
+	ShardOwner(channel string) (addr string, local bool)
+	// SendShardPublish delivers a message published to a sharded channel to the node that owns the channel.
+	SendShardPublish(channel string, message string) error
+}
+
+// SetCluster makes the pub/sub deliver messages across the cluster.
+func (ps *PubSub) SetCluster(cluster Cluster) {
+	ps.cluster = cluster
+	ps.shards.cluster = cluster
+}
+
+// durable reports whether the channel retains messages.
+func (ps *PubSub) durable(channelName string) bool {
+	ps.logsRWMut.RLock()
+	defer ps.logsRWMut.RUnlock()
+	_, ok := ps.logs[channelName]
+	return ok
+}
+
+// PublishToCluster publishes the message on this node and delivers it to the subscribers on every other node.
+// Messages published to durable channels are replicated through the raft log instead, so that every node
+// retains them with the same offsets. A nil channel name publishes the message to every channel.
+func (ps *PubSub) PublishToCluster(ctx context.Context, message string, headers map[string]string, channelName interface{}) error {
+	if ps.cluster == nil {
+		ps.Publish(ctx, message, headers, channelName)
+		return nil
+	}
+
+	if channelName == nil {
+		ps.Publish(ctx, message, headers, nil)
+		ps.cluster.BroadcastPublish("", message, headers)
+		return nil
+	}
+
+	if ps.durable(channelName.(string)) {
+		_, err := ps.cluster.Replicate(ctx, publishCommand(channelName.(string), message, headers))
+		return err
+	}
+
+	ps.Publish(ctx, message, headers, channelName)
+	ps.cluster.BroadcastPublish(channelName.(string), message, headers)
+	return nil
+}
+
+// publishCommand returns the PUBLISH command that publishes the message with the headers.
+// Headers are sorted by name so that the command is the same on every call.
+func publishCommand(channelName string, message string, headers map[string]string) []string {
+	cmd := []string{"publish", channelName, message}
+	if len(headers) == 0 {
+		return cmd
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	cmd = append(cmd, "HEADERS")
+	for _, name := range names {
+		cmd = append(cmd, name, headers[name])
+	}
+	return cmd
+}
+
+// ShardOwner returns the client address of the node that owns the sharded channel, and whether it is this node.
+// Every sharded channel is owned by this node unless the server is part of a cluster.
+func (ps *PubSub) ShardOwner(channelName string) (addr string, local bool) {
+	if ps.cluster == nil {
+		return "", true
+	}
+	return ps.cluster.ShardOwner(channelName)
+}
+
+// SPublish delivers the message to the subscribers of the sharded channel, which are all connected to the node
+// that owns the channel. The message is sent to the owner if it is another node.
+func (ps *PubSub) SPublish(ctx context.Context, message string, channelName string) error {
+	if _, local := ps.ShardOwner(channelName); local {
+		ps.shards.Publish(ctx, message, nil, channelName)
+		return nil
+	}
+	if err := ps.cluster.SendShardPublish(channelName, message); err != nil {
+		return fmt.Errorf("could not reach the owner of channel %s: %v", channelName, err)
+	}
+	return nil
+}
+
+// PublishShard delivers a message that another node published to a sharded channel owned by this node.
+func (ps *PubSub) PublishShard(ctx context.Context, message string, channelName string) {
+	ps.shards.Publish(ctx, message, nil, channelName)
+}
+
+// SSubscribe subscribes the connection to the sharded channels. The channels must be owned by this node.
+// Otherwise, nothing is subscribed and a MOVED error with the address of the owner is returned.
+func (ps *PubSub) SSubscribe(ctx context.Context, conn *net.Conn, channelNames []string) error {
+	for _, channelName := range channelNames {
+		if addr, local := ps.ShardOwner(channelName); !local {
+			return fmt.Errorf("MOVED %s", addr)
+		}
+	}
+	for _, channelName := range channelNames {
+		ps.shards.Subscribe(ctx, conn, channelName, nil)
+	}
+	return nil
+}
+
+// SubscribeGroup subscribes the connection to the consumer group of the channel. Every node receives the messages
+// published to the channel, so a group is only kept on the node that owns the channel to have each message handled
+// by one of its consumers once. Otherwise, nothing is subscribed and a MOVED error with the address of the owner
+// is returned.
+func (ps *PubSub) SubscribeGroup(ctx context.Context, conn *net.Conn, channelName string, groupName string) error {
+	if err := ps.checkGroupOwner(channelName); err != nil {
+		return err
+	}
+	ps.Subscribe(ctx, conn, channelName, groupName)
+	return nil
+}
+
+// checkGroupOwner returns a MOVED error with the address of the owner if the consumer groups of the channel
+// are kept on another node.
+func (ps *PubSub) checkGroupOwner(channelName string) error {
+	if addr, local := ps.ShardOwner(channelName); !local {
+		return fmt.Errorf("MOVED %s", addr)
+	}
+	return nil
+}
+
+// SUnsubscribe unsubscribes the connection from the sharded channel, or from every sharded channel
+// if no channel name is given.
+func (ps *PubSub) SUnsubscribe(ctx context.Context, conn *net.Conn, channelName interface{}) {
+	ps.shards.Unsubscribe(ctx, conn, channelName)
+}
+
+// ShardSubscriptions returns the sharded channels that the connection is subscribed to.
+func (ps *PubSub) ShardSubscriptions(conn *net.Conn) []string {
+	channels, _ := ps.shards.Subscriptions(conn)
+	return channels
+}
+
+// ShardChannels returns the names of the sharded channels that have at least one subscriber on this node.
+func (ps *PubSub) ShardChannels(pattern string) ([]string, error) {
+	return ps.shards.Channels(pattern)
+}
+
+// ShardNumSub returns the number of subscribers of each of the sharded channels on this node.
+func (ps *PubSub) ShardNumSub(channelNames []string) []int {
+	return ps.shards.NumSub(channelNames)
+}
@@ -3,8 +3,14 @@ package pubsub
 import (
 	"context"
 	"errors"
+	"fmt"
+	"github.com/gobwas/glob"
 	"github.com/kelvinmwinuka/memstore/src/utils"
 	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Plugin struct {
@@ -26,11 +32,124 @@ func (p Plugin) Description() string {
 	return p.description
 }
 
+// subscriptionFrame returns a Redis style confirmation for (P)SUBSCRIBE and (P)UNSUBSCRIBE.
+// It carries the kind of the confirmation, the channel or pattern, and the number of subscriptions
+// that the connection has left. An empty name is sent as a nil bulk string.
+func subscriptionFrame(kind string, name string, count int) string {
+	if name == "" {
+		return fmt.Sprintf("*3\r\n$%d\r\n%s\r\n$-1\r\n:%d\r\n", len(kind), kind, count)
+	}
+	return fmt.Sprintf("*3\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n:%d\r\n", len(kind), kind, len(name), name, count)
+}
+
+func subscriptionCount(pubsub *PubSub, conn *net.Conn) int {
+	channels, patterns := pubsub.Subscriptions(conn)
+	return len(channels) + len(patterns)
+}
+
+// parseFrom splits a trailing FROM offset off the arguments of SUBSCRIBE. hasOffset is false if there is none.
+func parseFrom(args []string) (rest []string, offset uint64, hasOffset bool, err error) {
+	if len(args) < 2 || !strings.EqualFold(args[len(args)-2], "from") {
+		return args, 0, false, nil
+	}
+	offset, err = strconv.ParseUint(args[len(args)-1], 10, 64)
+	if err != nil {
+		return nil, 0, false, errors.New("offset must be a positive integer")
+	}
+	return args[:len(args)-2], offset, true, nil
+}
+
+// parseWhere splits a trailing WHERE filter off the arguments of SUBSCRIBE. filter is nil if there is none.
+func parseWhere(args []string) (rest []string, filter *Filter, err error) {
+	if len(args) < 2 || !strings.EqualFold(args[len(args)-2], "where") {
+		return args, nil, nil
+	}
+	filter, err = ParseFilter(args[len(args)-1])
+	if err != nil {
+		return nil, nil, err
+	}
+	return args[:len(args)-2], filter, nil
+}
+
+// parseHeaders parses the HEADERS name value [name value ...] arguments that follow the message of PUBLISH.
+// headers is nil if there are no arguments.
+func parseHeaders(args []string) (headers map[string]string, err error) {
+	if len(args) == 0 {
+		return nil, nil
+	}
+	if !strings.EqualFold(args[0], "headers") || len(args) < 3 || len(args)%2 == 0 {
+		return nil, errors.New("headers must be given as HEADERS name value [name value ...]")
+	}
+	headers = make(map[string]string)
+	for i := 1; i < len(args); i += 2 {
+		headers[args[i]] = args[i+1]
+	}
+	return headers, nil
+}
+
 func handleSubscribe(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
 	pubsub, ok := server.GetPubSub().(*PubSub)
 	if !ok {
 		return nil, errors.New("could not load pubsub")
 	}
+
+	args, filter, err := parseWhere(cmd[1:])
+	if err != nil {
+		return nil, err
+	}
+	args, offset, hasOffset, err := parseFrom(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if pubsub.Compat() {
+		// In compatibility mode, every argument is a channel
+		if len(args) < 1 {
+			return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+		}
+		if !hasOffset {
+			res := ""
+			for _, channel := range args {
+				pubsub.SubscribeWhere(ctx, conn, channel, filter)
+				res += subscriptionFrame("subscribe", channel, subscriptionCount(pubsub, conn))
+			}
+			return []byte(res + "\n"), nil
+		}
+		// Each confirmation is written along with the messages replayed from its channel
+		for _, channel := range args {
+			channels, patterns := pubsub.Subscriptions(conn)
+			count := len(channels) + len(patterns)
+			if !slices.Contains(channels, channel) {
+				count++
+			}
+			confirmation := subscriptionFrame("subscribe", channel, count) + "\n"
+			if err := pubsub.SubscribeFrom(ctx, conn, channel, offset, filter, confirmation); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	}
+
+	if hasOffset {
+		// Replay is only available to direct subscribers of a single channel
+		if len(args) != 1 {
+			return nil, errors.New("FROM requires a single channel and cannot be used with a consumer group")
+		}
+		if err := pubsub.SubscribeFrom(ctx, conn, args[0], offset, filter, "+SUBSCRIBE_OK\r\n\n"); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	if filter != nil {
+		// Filters only apply to direct subscribers of a single channel
+		if len(args) != 1 {
+			return nil, errors.New("WHERE requires a single channel and cannot be used with a consumer group")
+		}
+		pubsub.SubscribeWhere(ctx, conn, args[0], filter)
+		return []byte("+SUBSCRIBE_OK\r\n\n"), nil
+	}
+
 	switch len(cmd) {
 	case 1:
 		// Subscribe to all channels
@@ -40,7 +159,9 @@ func handleSubscribe(ctx context.Context, cmd []string, server utils.Server, con
 		pubsub.Subscribe(ctx, conn, cmd[1], nil)
 	case 3:
 		// Subscribe to specified channel and specified consumer group
-		pubsub.Subscribe(ctx, conn, cmd[1], cmd[2])
+		if err := pubsub.SubscribeGroup(ctx, conn, cmd[1], cmd[2]); err != nil {
+			return nil, err
+		}
 	default:
 		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
 	}
@@ -52,6 +173,21 @@ func handleUnsubscribe(ctx context.Context, cmd []string, server utils.Server, c
 	if !ok {
 		return nil, errors.New("could not load pubsub")
 	}
+	if pubsub.Compat() {
+		channels := cmd[1:]
+		if len(channels) == 0 {
+			channels, _ = pubsub.Subscriptions(conn)
+		}
+		if len(channels) == 0 {
+			return []byte(subscriptionFrame("unsubscribe", "", subscriptionCount(pubsub, conn)) + "\n"), nil
+		}
+		res := ""
+		for _, channel := range channels {
+			pubsub.Unsubscribe(ctx, conn, channel)
+			res += subscriptionFrame("unsubscribe", channel, subscriptionCount(pubsub, conn))
+		}
+		return []byte(res + "\n"), nil
+	}
 	switch len(cmd) {
 	case 1:
 		pubsub.Unsubscribe(ctx, conn, nil)
@@ -63,18 +199,581 @@ func handleUnsubscribe(ctx context.Context, cmd []string, server utils.Server, c
 	return []byte(utils.OK_RESPONSE), nil
 }
 
+func handlePSubscribe(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	pubsub, ok := server.GetPubSub().(*PubSub)
+	if !ok {
+		return nil, errors.New("could not load pubsub")
+	}
+	if len(cmd) < 2 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+	if !pubsub.Compat() {
+		if err := pubsub.PSubscribe(ctx, conn, cmd[1:]); err != nil {
+			return nil, err
+		}
+		return []byte("+PSUBSCRIBE_OK\r\n\n"), nil
+	}
+	// Check every pattern first so that nothing is subscribed if one of them is invalid
+	for _, pattern := range cmd[1:] {
+		if _, err := glob.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("invalid pattern %s", pattern)
+		}
+	}
+	res := ""
+	for _, pattern := range cmd[1:] {
+		if err := pubsub.PSubscribe(ctx, conn, []string{pattern}); err != nil {
+			return nil, err
+		}
+		res += subscriptionFrame("psubscribe", pattern, subscriptionCount(pubsub, conn))
+	}
+	return []byte(res + "\n"), nil
+}
+
+func handlePUnsubscribe(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	pubsub, ok := server.GetPubSub().(*PubSub)
+	if !ok {
+		return nil, errors.New("could not load pubsub")
+	}
+	if !pubsub.Compat() {
+		pubsub.PUnsubscribe(ctx, conn, cmd[1:])
+		return []byte(utils.OK_RESPONSE), nil
+	}
+	patterns := cmd[1:]
+	if len(patterns) == 0 {
+		_, patterns = pubsub.Subscriptions(conn)
+	}
+	if len(patterns) == 0 {
+		return []byte(subscriptionFrame("punsubscribe", "", subscriptionCount(pubsub, conn)) + "\n"), nil
+	}
+	res := ""
+	for _, pattern := range patterns {
+		pubsub.PUnsubscribe(ctx, conn, []string{pattern})
+		res += subscriptionFrame("punsubscribe", pattern, subscriptionCount(pubsub, conn))
+	}
+	return []byte(res + "\n"), nil
+}
+
 func handlePublish(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
 	pubsub, ok := server.GetPubSub().(*PubSub)
 	if !ok {
 		return nil, errors.New("could not load pubsub")
 	}
+
+	var channel interface{}
+	var headers map[string]string
+	message := cmd[len(cmd)-1]
+	switch {
+	case len(cmd) == 2:
+		// Publish to all channels
+	case len(cmd) >= 3:
+		var err error
+		if headers, err = parseHeaders(cmd[3:]); err != nil {
+			return nil, err
+		}
+		channel, message = cmd[1], cmd[2]
+	default:
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	if conn == nil {
+		// The message was replicated through the raft log, so it is only delivered on this node
+		pubsub.Publish(ctx, message, headers, channel)
+		return []byte(utils.OK_RESPONSE), nil
+	}
+
+	if err := pubsub.PublishToCluster(ctx, message, headers, channel); err != nil {
+		return nil, err
+	}
+	return []byte(utils.OK_RESPONSE), nil
+}
+
+func handleSPublish(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	pubsub, ok := server.GetPubSub().(*PubSub)
+	if !ok {
+		return nil, errors.New("could not load pubsub")
+	}
+	if len(cmd) != 3 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+	if err := pubsub.SPublish(ctx, cmd[2], cmd[1]); err != nil {
+		return nil, err
+	}
+	return []byte(utils.OK_RESPONSE), nil
+}
+
+func handleSSubscribe(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	pubsub, ok := server.GetPubSub().(*PubSub)
+	if !ok {
+		return nil, errors.New("could not load pubsub")
+	}
+	if len(cmd) < 2 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	subscribed := pubsub.ShardSubscriptions(conn)
+	if err := pubsub.SSubscribe(ctx, conn, cmd[1:]); err != nil {
+		return nil, err
+	}
+
+	if !pubsub.Compat() {
+		return []byte("+SSUBSCRIBE_OK\r\n\n"), nil
+	}
+	res := ""
+	for _, channel := range cmd[1:] {
+		if !slices.Contains(subscribed, channel) {
+			subscribed = append(subscribed, channel)
+		}
+		res += subscriptionFrame("ssubscribe", channel, len(subscribed))
+	}
+	return []byte(res + "\n"), nil
+}
+
+func handleSUnsubscribe(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	pubsub, ok := server.GetPubSub().(*PubSub)
+	if !ok {
+		return nil, errors.New("could not load pubsub")
+	}
+
+	channels := cmd[1:]
+	if len(channels) == 0 {
+		channels = pubsub.ShardSubscriptions(conn)
+	}
+
+	if !pubsub.Compat() {
+		for _, channel := range channels {
+			pubsub.SUnsubscribe(ctx, conn, channel)
+		}
+		return []byte(utils.OK_RESPONSE), nil
+	}
+
+	if len(channels) == 0 {
+		return []byte(subscriptionFrame("sunsubscribe", "", 0) + "\n"), nil
+	}
+	res := ""
+	for _, channel := range channels {
+		pubsub.SUnsubscribe(ctx, conn, channel)
+		res += subscriptionFrame("sunsubscribe", channel, len(pubsub.ShardSubscriptions(conn)))
+	}
+	return []byte(res + "\n"), nil
+}
+
+func handlePubSub(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) < 2 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+	return nil, fmt.Errorf("unknown subcommand %s", strings.ToUpper(cmd[1]))
+}
+
+func handlePubSubChannels(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	pubsub, ok := server.GetPubSub().(*PubSub)
+	if !ok {
+		return nil, errors.New("could not load pubsub")
+	}
+	if len(cmd) > 3 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	pattern := ""
+	if len(cmd) == 3 {
+		pattern = cmd[2]
+	}
+
+	channels, err := pubsub.Channels(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	res := fmt.Sprintf("*%d\r\n", len(channels))
+	for _, channel := range channels {
+		res += fmt.Sprintf("$%d\r\n%s\r\n", len(channel), channel)
+	}
+	return []byte(res + "\n"), nil
+}
+
+func handlePubSubNumSub(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	pubsub, ok := server.GetPubSub().(*PubSub)
+	if !ok {
+		return nil, errors.New("could not load pubsub")
+	}
+
+	channels := cmd[2:]
+	counts := pubsub.NumSub(channels)
+
+	res := fmt.Sprintf("*%d\r\n", len(channels)*2)
+	for i, channel := range channels {
+		res += fmt.Sprintf("$%d\r\n%s\r\n:%d\r\n", len(channel), channel, counts[i])
+	}
+	return []byte(res + "\n"), nil
+}
+
+func handlePubSubShardChannels(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	pubsub, ok := server.GetPubSub().(*PubSub)
+	if !ok {
+		return nil, errors.New("could not load pubsub")
+	}
+	if len(cmd) > 3 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	pattern := ""
+	if len(cmd) == 3 {
+		pattern = cmd[2]
+	}
+
+	channels, err := pubsub.ShardChannels(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	res := fmt.Sprintf("*%d\r\n", len(channels))
+	for _, channel := range channels {
+		res += fmt.Sprintf("$%d\r\n%s\r\n", len(channel), channel)
+	}
+	return []byte(res + "\n"), nil
+}
+
+func handlePubSubShardNumSub(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	pubsub, ok := server.GetPubSub().(*PubSub)
+	if !ok {
+		return nil, errors.New("could not load pubsub")
+	}
+
+	channels := cmd[2:]
+	counts := pubsub.ShardNumSub(channels)
+
+	res := fmt.Sprintf("*%d\r\n", len(channels)*2)
+	for i, channel := range channels {
+		res += fmt.Sprintf("$%d\r\n%s\r\n:%d\r\n", len(channel), channel, counts[i])
+	}
+	return []byte(res + "\n"), nil
+}
+
+func handlePubSubNumPat(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	pubsub, ok := server.GetPubSub().(*PubSub)
+	if !ok {
+		return nil, errors.New("could not load pubsub")
+	}
+	if len(cmd) != 2 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+	return []byte(fmt.Sprintf(":%d\r\n\n", pubsub.NumPat())), nil
+}
+
+func handlePubSubRetention(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	pubsub, ok := server.GetPubSub().(*PubSub)
+	if !ok {
+		return nil, errors.New("could not load pubsub")
+	}
+	if len(cmd) < 3 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	channel := cmd[2]
+
 	if len(cmd) == 3 {
-		pubsub.Publish(ctx, cmd[2], cmd[1])
-	} else if len(cmd) == 2 {
-		pubsub.Publish(ctx, cmd[1], nil)
+		retention, first, last, ok := pubsub.GetRetention(channel)
+		if !ok {
+			return nil, fmt.Errorf("channel %s is not durable", channel)
+		}
+		return []byte(fmt.Sprintf(
+			"*8\r\n$6\r\nmaxlen\r\n:%d\r\n$6\r\nmaxage\r\n:%d\r\n$12\r\nfirst-offset\r\n:%d\r\n$11\r\nlast-offset\r\n:%d\r\n\n",
+			retention.MaxLen, retention.MaxAge.Milliseconds(), first, last,
+		)), nil
+	}
+
+	if len(cmd) == 4 && strings.EqualFold(cmd[3], "off") {
+		if !pubsub.RemoveRetention(channel) {
+			return []byte(":0\r\n\n"), nil
+		}
+		return []byte(":1\r\n\n"), nil
+	}
+
+	var retention Retention
+	for i := 3; i < len(cmd); i += 2 {
+		if i+1 >= len(cmd) {
+			return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+		}
+		n, err := strconv.Atoi(cmd[i+1])
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("%s must be a positive integer", strings.ToUpper(cmd[i]))
+		}
+		switch strings.ToLower(cmd[i]) {
+		default:
+			return nil, fmt.Errorf("invalid option %s", cmd[i])
+		case "maxlen":
+			retention.MaxLen = n
+		case "maxage":
+			retention.MaxAge = time.Duration(n) * time.Millisecond
+		}
+	}
+
+	pubsub.SetRetention(utils.Now(ctx), channel, retention)
+	return []byte(utils.OK_RESPONSE), nil
+}
+
+func handlePubSubWebhook(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	pubsub, ok := server.GetPubSub().(*PubSub)
+	if !ok {
+		return nil, errors.New("could not load pubsub")
+	}
+	if len(cmd) < 3 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	switch strings.ToLower(cmd[2]) {
+	default:
+		return nil, fmt.Errorf("unknown webhook subcommand %s, must be ADD, REMOVE, LIST or LOG", cmd[2])
+
+	case "add":
+		// PUBSUB WEBHOOK ADD CHANNEL|PATTERN target url [SECRET secret]
+		if len(cmd) != 6 && len(cmd) != 8 {
+			return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+		}
+		var isPattern bool
+		switch strings.ToLower(cmd[3]) {
+		default:
+			return nil, fmt.Errorf("invalid option %s, must be CHANNEL or PATTERN", cmd[3])
+		case "channel":
+		case "pattern":
+			isPattern = true
+		}
+		secret := ""
+		if len(cmd) == 8 {
+			if !strings.EqualFold(cmd[6], "secret") || cmd[7] == "" {
+				return nil, fmt.Errorf("invalid option %s", cmd[6])
+			}
+			secret = cmd[7]
+		}
+		webhook, secret, err := pubsub.AddWebhook(cmd[4], isPattern, cmd[5], secret)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(fmt.Sprintf("*2\r\n:%d\r\n$%d\r\n%s\r\n\n", webhook.ID, len(secret), secret)), nil
+
+	case "remove":
+		if len(cmd) != 4 {
+			return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+		}
+		id, err := strconv.ParseUint(cmd[3], 10, 64)
+		if err != nil {
+			return nil, errors.New("webhook ID must be a positive integer")
+		}
+		if !pubsub.RemoveWebhook(id) {
+			return []byte(":0\r\n\n"), nil
+		}
+		return []byte(":1\r\n\n"), nil
+
+	case "list":
+		// Each webhook is returned as its ID, whether it is registered for a channel or a pattern,
+		// the channel or pattern, and the URL. Secrets are never returned.
+		webhooks := pubsub.Webhooks()
+		res := fmt.Sprintf("*%d\r\n", len(webhooks))
+		for _, webhook := range webhooks {
+			kind, target := "channel", webhook.Channel
+			if webhook.Pattern != "" {
+				kind, target = "pattern", webhook.Pattern
+			}
+			res += fmt.Sprintf("*4\r\n:%d\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n",
+				webhook.ID, len(kind), kind, len(target), target, len(webhook.URL), webhook.URL)
+		}
+		return []byte(res + "\n"), nil
+
+	case "log":
+		// PUBSUB WEBHOOK LOG id [COUNT count]
+		if len(cmd) != 4 && len(cmd) != 6 {
+			return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+		}
+		id, err := strconv.ParseUint(cmd[3], 10, 64)
+		if err != nil {
+			return nil, errors.New("webhook ID must be a positive integer")
+		}
+		webhook := pubsub.Webhook(id)
+		if webhook == nil {
+			return nil, fmt.Errorf("webhook %d not found", id)
+		}
+		deliveries := webhook.Log()
+		if len(cmd) == 6 {
+			count, err := strconv.Atoi(cmd[5])
+			if !strings.EqualFold(cmd[4], "count") || err != nil || count <= 0 {
+				return nil, errors.New("COUNT must be a positive integer")
+			}
+			deliveries = deliveries[:min(count, len(deliveries))]
+		}
+		// Each delivery is returned as the message ID, the channel, the status, the number of attempts,
+		// the status code of the last response, the last error, and when the delivery finished
+		// in milliseconds since the epoch. The newest delivery comes first.
+		res := fmt.Sprintf("*%d\r\n", len(deliveries))
+		for _, d := range deliveries {
+			res += fmt.Sprintf("*7\r\n:%d\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n:%d\r\n:%d\r\n",
+				d.ID, len(d.Channel), d.Channel, len(d.Status), d.Status, d.Attempts, d.StatusCode)
+			if d.Error == "" {
+				res += "$-1\r\n"
+			} else {
+				res += fmt.Sprintf("$%d\r\n%s\r\n", len(d.Error), d.Error)
+			}
+			res += fmt.Sprintf(":%d\r\n", d.Time.UnixMilli())
+		}
+		return []byte(res + "\n"), nil
+	}
+}
+
+func handlePubSubGroups(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	pubsub, ok := server.GetPubSub().(*PubSub)
+	if !ok {
+		return nil, errors.New("could not load pubsub")
+	}
+	if len(cmd) != 3 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	groups := pubsub.Groups(cmd[2])
+
+	// Each group is returned as a pair of the group name and the addresses of its members
+	res := fmt.Sprintf("*%d\r\n", len(groups))
+	for _, group := range groups {
+		members := group.Members()
+		res += fmt.Sprintf("*2\r\n$%d\r\n%s\r\n*%d\r\n", len(group.name), group.name, len(members))
+		for _, member := range members {
+			addr := (*member).RemoteAddr().String()
+			res += fmt.Sprintf("$%d\r\n%s\r\n", len(addr), addr)
+		}
+	}
+	return []byte(res + "\n"), nil
+}
+
+func handleGroup(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) < 2 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+	return nil, fmt.Errorf("unknown subcommand %s", strings.ToUpper(cmd[1]))
+}
+
+// parseDeliveryIDs parses the delivery IDs given to GROUP ACK and GROUP NACK.
+func parseDeliveryIDs(args []string) ([]uint64, error) {
+	ids := make([]uint64, len(args))
+	for i, arg := range args {
+		id, err := strconv.ParseUint(arg, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid delivery ID %s", arg)
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+func handleGroupAck(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	pubsub, ok := server.GetPubSub().(*PubSub)
+	if !ok {
+		return nil, errors.New("could not load pubsub")
+	}
+	if len(cmd) < 5 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	if err := pubsub.checkGroupOwner(cmd[2]); err != nil {
+		return nil, err
+	}
+
+	ids, err := parseDeliveryIDs(cmd[4:])
+	if err != nil {
+		return nil, err
+	}
+
+	group := pubsub.Group(cmd[2], cmd[3])
+	if group == nil {
+		return []byte(":0\r\n\n"), nil
+	}
+
+	var count int
+	if strings.EqualFold(cmd[1], "nack") {
+		count = group.Nack(conn, ids)
 	} else {
+		count = group.Ack(conn, ids)
+	}
+	return []byte(fmt.Sprintf(":%d\r\n\n", count)), nil
+}
+
+func handleGroupPending(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	pubsub, ok := server.GetPubSub().(*PubSub)
+	if !ok {
+		return nil, errors.New("could not load pubsub")
+	}
+	if len(cmd) != 4 {
 		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
 	}
+	if err := pubsub.checkGroupOwner(cmd[2]); err != nil {
+		return nil, err
+	}
+
+	group := pubsub.Group(cmd[2], cmd[3])
+	if group == nil {
+		return []byte("*0\r\n\n"), nil
+	}
+
+	// Each message is returned as its delivery ID, the address of the consumer it is pending for,
+	// the number of deliveries so far and the milliseconds left until it is redelivered.
+	// Messages waiting for a consumer have a nil consumer and -1 milliseconds.
+	now := time.Now()
+	deliveries := group.Pending()
+	res := fmt.Sprintf("*%d\r\n", len(deliveries))
+	for _, d := range deliveries {
+		if d.consumer == nil {
+			res += fmt.Sprintf("*4\r\n:%d\r\n$-1\r\n:%d\r\n:-1\r\n", d.id, d.attempts)
+			continue
+		}
+		addr := (*d.consumer).RemoteAddr().String()
+		res += fmt.Sprintf("*4\r\n:%d\r\n$%d\r\n%s\r\n:%d\r\n:%d\r\n",
+			d.id, len(addr), addr, d.attempts, max(d.deadline.Sub(now).Milliseconds(), 0))
+	}
+	return []byte(res + "\n"), nil
+}
+
+func handleGroupConfig(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	pubsub, ok := server.GetPubSub().(*PubSub)
+	if !ok {
+		return nil, errors.New("could not load pubsub")
+	}
+	if len(cmd) < 4 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+	if err := pubsub.checkGroupOwner(cmd[2]); err != nil {
+		return nil, err
+	}
+
+	config := pubsub.GroupConfig(cmd[2], cmd[3])
+
+	if len(cmd) == 4 {
+		return []byte(fmt.Sprintf(
+			"*6\r\n$10\r\nvisibility\r\n:%d\r\n$11\r\nmaxattempts\r\n:%d\r\n$10\r\ndeadletter\r\n$%d\r\n%s\r\n\n",
+			config.VisibilityTimeout.Milliseconds(), config.MaxAttempts, len(config.DeadLetter), config.DeadLetter,
+		)), nil
+	}
+
+	for i := 4; i < len(cmd); i += 2 {
+		if i+1 >= len(cmd) {
+			return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+		}
+		switch strings.ToLower(cmd[i]) {
+		default:
+			return nil, fmt.Errorf("invalid option %s", cmd[i])
+		case "visibility":
+			n, err := strconv.Atoi(cmd[i+1])
+			if err != nil || n <= 0 {
+				return nil, errors.New("VISIBILITY must be a positive integer")
+			}
+			config.VisibilityTimeout = time.Duration(n) * time.Millisecond
+		case "maxattempts":
+			n, err := strconv.Atoi(cmd[i+1])
+			if err != nil || n < 0 {
+				return nil, errors.New("MAXATTEMPTS must be a non-negative integer")
+			}
+			config.MaxAttempts = n
+		case "deadletter":
+			config.DeadLetter = cmd[i+1]
+		}
+	}
+
+	pubsub.SetGroupConfig(cmd[2], cmd[3], config)
 	return []byte(utils.OK_RESPONSE), nil
 }
 
@@ -83,13 +782,14 @@ func NewModule() Plugin {
 		name: "PubSubCommands",
 		commands: []utils.Command{
 			{
-				Command:     "publish",
-				Categories:  []string{utils.PubSubCategory, utils.FastCategory},
-				Description: "(PUBLISH channel message) Publish a message to the specified channel.",
-				Sync:        true,
+				Command:    "publish",
+				Categories: []string{utils.PubSubCategory, utils.FastCategory},
+				Description: `(PUBLISH channel message [HEADERS name value [name value ...]]) Publish a message to the specified
+channel on every node of the cluster. The headers are matched against the WHERE filters of the channel's subscribers.`,
+				Sync: false,
 				KeyExtractionFunc: func(cmd []string) ([]string, error) {
 					// Treat the channel as a key
-					if len(cmd) != 3 {
+					if len(cmd) < 3 {
 						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
 					}
 					return []string{cmd[1]}, nil
@@ -97,33 +797,299 @@ func NewModule() Plugin {
 				HandlerFunc: handlePublish,
 			},
 			{
-				Command:     "subscribe",
-				Categories:  []string{utils.PubSubCategory, utils.ConnectionCategory, utils.SlowCategory},
-				Description: "(SUBSCRIBE channel [consumer_group]) Subscribe to a channel with an option to join a consumer group on the channel.",
+				Command:     "spublish",
+				Categories:  []string{utils.PubSubCategory, utils.FastCategory},
+				Description: "(SPUBLISH channel message) Publish a message to the sharded channel on the node that owns it.",
 				Sync:        false,
 				KeyExtractionFunc: func(cmd []string) ([]string, error) {
 					// Treat the channel as a key
-					if len(cmd) < 2 {
+					if len(cmd) != 3 {
 						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
 					}
 					return []string{cmd[1]}, nil
 				},
-				HandlerFunc: handleSubscribe,
+				HandlerFunc: handleSPublish,
 			},
 			{
-				Command:     "unsubscribe",
+				Command:    "ssubscribe",
+				Categories: []string{utils.PubSubCategory, utils.ConnectionCategory, utils.SlowCategory},
+				Description: `(SSUBSCRIBE channel [channel ...]) Subscribe to sharded channels. Every channel must be owned by the node
+that the client is connected to, otherwise a MOVED error with the address of the owner is returned.`,
+				Sync: false,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					// Treat the channels as keys
+					if len(cmd) < 2 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:], nil
+				},
+				HandlerFunc: handleSSubscribe,
+			},
+			{
+				Command:     "sunsubscribe",
 				Categories:  []string{utils.PubSubCategory, utils.ConnectionCategory, utils.SlowCategory},
-				Description: "(UNSUBSCRIBE channel) Unsubscribe from a channel.",
+				Description: "(SUNSUBSCRIBE [channel ...]) Unsubscribe from the sharded channels, or from all sharded channels if none are given.",
 				Sync:        false,
 				KeyExtractionFunc: func(cmd []string) ([]string, error) {
-					// Treat the channel as a key
-					if len(cmd) != 2 {
+					// Treat the channels as keys
+					return cmd[1:], nil
+				},
+				HandlerFunc: handleSUnsubscribe,
+			},
+			{
+				Command:    "subscribe",
+				Categories: []string{utils.PubSubCategory, utils.ConnectionCategory, utils.SlowCategory},
+				Description: `(SUBSCRIBE channel [consumer_group] [FROM offset] [WHERE filter]) Subscribe to a channel with an option to join a consumer group on the channel.
+Consumer group messages carry a delivery ID and must be acknowledged with GROUP ACK.
+In a cluster, the consumer groups of a channel live on the node that owns the channel, like a sharded channel,
+and subscribing to a group on another node returns a MOVED error with the owner's address.
+With FROM, the messages retained by a durable channel from the offset onwards are replayed before live delivery starts.
+With WHERE, only the messages whose headers pass the filter are delivered, for example
+"tenant = 'acme' AND (type IN ('order', 'refund') OR trace PREFIX 'checkout-')". Filters support =, !=, IN, NOT IN,
+PREFIX, AND, OR, NOT and parentheses, and cannot be used with a consumer group.
+In pub/sub compatibility mode, the syntax is (SUBSCRIBE channel [channel ...] [FROM offset] [WHERE filter]) and consumer groups are not available.`,
+				Sync: false,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					// Treat the channels as keys. Every argument is a channel in compatibility mode, and the
+					// syntaxes cannot be told apart here, so a consumer group name is checked like a channel.
+					if len(cmd) < 2 {
 						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
 					}
-					return []string{cmd[1]}, nil
+					args, _, err := parseWhere(cmd[1:])
+					if err != nil {
+						return nil, err
+					}
+					args, _, _, err = parseFrom(args)
+					if err != nil {
+						return nil, err
+					}
+					return args, nil
+				},
+				HandlerFunc: handleSubscribe,
+			},
+			{
+				Command:    "unsubscribe",
+				Categories: []string{utils.PubSubCategory, utils.ConnectionCategory, utils.SlowCategory},
+				Description: `(UNSUBSCRIBE [channel]) Unsubscribe from a channel, or from all channels if none is given.
+In pub/sub compatibility mode, the syntax is (UNSUBSCRIBE [channel ...]).`,
+				Sync: false,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					// Treat the channels as keys
+					return cmd[1:], nil
 				},
 				HandlerFunc: handleUnsubscribe,
 			},
+			{
+				Command:    "psubscribe",
+				Categories: []string{utils.PubSubCategory, utils.ConnectionCategory, utils.SlowCategory},
+				Description: `(PSUBSCRIBE pattern [pattern ...]) Subscribe to every channel that matches one of the glob patterns.
+Messages are delivered as pmessage frames that carry the matched pattern and the channel.`,
+				Sync: false,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					// Treat the patterns as keys
+					if len(cmd) < 2 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:], nil
+				},
+				HandlerFunc: handlePSubscribe,
+			},
+			{
+				Command:     "punsubscribe",
+				Categories:  []string{utils.PubSubCategory, utils.ConnectionCategory, utils.SlowCategory},
+				Description: "(PUNSUBSCRIBE [pattern ...]) Unsubscribe from the patterns, or from all patterns if none are given.",
+				Sync:        false,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					// Treat the patterns as keys
+					return cmd[1:], nil
+				},
+				HandlerFunc: handlePUnsubscribe,
+			},
+			{
+				Command:     "pubsub",
+				Categories:  []string{},
+				Description: "Pub/Sub introspection commands",
+				Sync:        false,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					return []string{}, nil
+				},
+				HandlerFunc: handlePubSub,
+				SubCommands: []utils.SubCommand{
+					{
+						Command:     "channels",
+						Categories:  []string{utils.PubSubCategory, utils.SlowCategory},
+						Description: "(PUBSUB CHANNELS [pattern]) List the channels that have subscribers, optionally filtered by a glob pattern.",
+						Sync:        false,
+						KeyExtractionFunc: func(cmd []string) ([]string, error) {
+							return []string{}, nil
+						},
+						HandlerFunc: handlePubSubChannels,
+					},
+					{
+						Command:     "numsub",
+						Categories:  []string{utils.PubSubCategory, utils.SlowCategory},
+						Description: "(PUBSUB NUMSUB [channel ...]) Return the number of subscribers of each channel, not counting pattern subscribers.",
+						Sync:        false,
+						KeyExtractionFunc: func(cmd []string) ([]string, error) {
+							return []string{}, nil
+						},
+						HandlerFunc: handlePubSubNumSub,
+					},
+					{
+						Command:     "shardchannels",
+						Categories:  []string{utils.PubSubCategory, utils.SlowCategory},
+						Description: "(PUBSUB SHARDCHANNELS [pattern]) List the sharded channels that have subscribers on this node, optionally filtered by a glob pattern.",
+						Sync:        false,
+						KeyExtractionFunc: func(cmd []string) ([]string, error) {
+							return []string{}, nil
+						},
+						HandlerFunc: handlePubSubShardChannels,
+					},
+					{
+						Command:     "shardnumsub",
+						Categories:  []string{utils.PubSubCategory, utils.SlowCategory},
+						Description: "(PUBSUB SHARDNUMSUB [channel ...]) Return the number of subscribers of each sharded channel on this node.",
+						Sync:        false,
+						KeyExtractionFunc: func(cmd []string) ([]string, error) {
+							return []string{}, nil
+						},
+						HandlerFunc: handlePubSubShardNumSub,
+					},
+					{
+						Command:     "numpat",
+						Categories:  []string{utils.PubSubCategory, utils.SlowCategory},
+						Description: "(PUBSUB NUMPAT) Return the number of distinct patterns that are subscribed to.",
+						Sync:        false,
+						KeyExtractionFunc: func(cmd []string) ([]string, error) {
+							return []string{}, nil
+						},
+						HandlerFunc: handlePubSubNumPat,
+					},
+					{
+						Command:    "retention",
+						Categories: []string{utils.PubSubCategory, utils.WriteCategory, utils.SlowCategory},
+						Description: `(PUBSUB RETENTION channel [MAXLEN count] [MAXAGE milliseconds] | [OFF])
+Make the channel durable so that it retains up to count messages, or the messages published within the age limit,
+for subscribers to replay with SUBSCRIBE FROM. OFF stops retaining messages and drops the ones that were retained.
+Without options, the limits of the channel and the offsets of its oldest and newest retained messages are returned.`,
+						Sync: true,
+						KeyExtractionFunc: func(cmd []string) ([]string, error) {
+							// Treat the channel as a key
+							if len(cmd) < 3 {
+								return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+							}
+							return []string{cmd[2]}, nil
+						},
+						HandlerFunc: handlePubSubRetention,
+					},
+					{
+						Command:    "webhook",
+						Categories: []string{utils.PubSubCategory, utils.AdminCategory, utils.DangerousCategory, utils.SlowCategory},
+						Description: `(PUBSUB WEBHOOK ADD CHANNEL|PATTERN target url [SECRET secret] | REMOVE id | LIST | LOG id [COUNT count])
+Register an HTTP endpoint that the messages published to a channel, or to the channels that match a pattern, are POSTed to.
+Failed deliveries are retried with exponential backoff. Each request body is signed with HMAC-SHA256 using the secret,
+which is generated if it is not given, and the signature is sent in the X-Memstore-Signature header.
+ADD returns the ID of the webhook and its secret. LOG returns the latest delivery results of a webhook.
+Webhooks are registered on the node that runs the command.`,
+						Sync: false,
+						KeyExtractionFunc: func(cmd []string) ([]string, error) {
+							// Treat the channel or pattern as a key
+							if len(cmd) >= 5 && strings.EqualFold(cmd[2], "add") {
+								return []string{cmd[4]}, nil
+							}
+							return []string{}, nil
+						},
+						HandlerFunc: handlePubSubWebhook,
+					},
+					{
+						Command:     "groups",
+						Categories:  []string{utils.PubSubCategory, utils.SlowCategory},
+						Description: "(PUBSUB GROUPS channel) List the consumer groups of a channel along with the addresses of their members.",
+						Sync:        false,
+						KeyExtractionFunc: func(cmd []string) ([]string, error) {
+							// Treat the channel as a key
+							if len(cmd) != 3 {
+								return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+							}
+							return cmd[2:3], nil
+						},
+						HandlerFunc: handlePubSubGroups,
+					},
+				},
+			},
+			{
+				Command:     "group",
+				Categories:  []string{},
+				Description: "Consumer group commands. Groups are kept on the node that owns the channel, other nodes return a MOVED error.",
+				Sync:        false,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					return []string{}, nil
+				},
+				HandlerFunc: handleGroup,
+				SubCommands: []utils.SubCommand{
+					{
+						Command:    "ack",
+						Categories: []string{utils.PubSubCategory, utils.FastCategory},
+						Description: `(GROUP ACK channel group id [id ...]) Acknowledge messages delivered to this connection by the consumer group,
+removing them from its pending entries. Returns the number of messages acknowledged.`,
+						Sync: false,
+						KeyExtractionFunc: func(cmd []string) ([]string, error) {
+							// Treat the channel as a key
+							if len(cmd) < 5 {
+								return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+							}
+							return []string{cmd[2]}, nil
+						},
+						HandlerFunc: handleGroupAck,
+					},
+					{
+						Command:    "nack",
+						Categories: []string{utils.PubSubCategory, utils.FastCategory},
+						Description: `(GROUP NACK channel group id [id ...]) Reject messages delivered to this connection by the consumer group
+so that they are redelivered to the next consumer straight away. Returns the number of messages rejected.`,
+						Sync: false,
+						KeyExtractionFunc: func(cmd []string) ([]string, error) {
+							// Treat the channel as a key
+							if len(cmd) < 5 {
+								return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+							}
+							return []string{cmd[2]}, nil
+						},
+						HandlerFunc: handleGroupAck,
+					},
+					{
+						Command:    "pending",
+						Categories: []string{utils.PubSubCategory, utils.SlowCategory},
+						Description: `(GROUP PENDING channel group) List the messages that the consumer group has not had acknowledged,
+with the consumer that each message is pending for, the number of deliveries and the time left until redelivery.`,
+						Sync: false,
+						KeyExtractionFunc: func(cmd []string) ([]string, error) {
+							// Treat the channel as a key
+							if len(cmd) != 4 {
+								return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+							}
+							return []string{cmd[2]}, nil
+						},
+						HandlerFunc: handleGroupPending,
+					},
+					{
+						Command:    "config",
+						Categories: []string{utils.PubSubCategory, utils.SlowCategory},
+						Description: `(GROUP CONFIG channel group [VISIBILITY milliseconds] [MAXATTEMPTS count] [DEADLETTER channel])
+Set how long consumers have to acknowledge a message before it is redelivered, and the number of deliveries after which
+it is published to the dead-letter channel instead. Without options, the current settings are returned.`,
+						Sync: false,
+						KeyExtractionFunc: func(cmd []string) ([]string, error) {
+							// Treat the channel as a key
+							if len(cmd) < 4 {
+								return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+							}
+							return []string{cmd[2]}, nil
+						},
+						HandlerFunc: handleGroupConfig,
+					},
+				},
+			},
 		},
 		description: "Handle PUBSUB feature",
 	}
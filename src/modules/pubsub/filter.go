@@ -0,0 +1,299 @@
+package pubsub
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Filter selects the messages delivered to a subscriber by the headers that they were published with.
+// Filters are written as expressions such as
+//
+//	tenant = 'acme' AND (type IN ('order', 'refund') OR trace PREFIX 'checkout-')
+//
+// A comparison is a header name followed by = value, != value, IN (value, ...), NOT IN (value, ...)
+// or PREFIX value. Comparisons are combined with AND, OR and NOT, with NOT binding tightest and OR loosest,
+// and may be grouped with parentheses. Values are quoted with single or double quotes, or written bare if they
+// only contain letters, digits and the characters _ . : -. Keywords are case insensitive, header names and values
+// are not. A message without the header does not match =, IN or PREFIX, so it matches != and NOT IN.
+type Filter struct {
+	expr string
+	root filterNode
+}
+
+type filterNode interface {
+	match(headers map[string]string) bool
+}
+
+type orNode []filterNode
+
+func (n orNode) match(headers map[string]string) bool {
+	return slices.ContainsFunc(n, func(node filterNode) bool { return node.match(headers) })
+}
+
+type andNode []filterNode
+
+func (n andNode) match(headers map[string]string) bool {
+	return !slices.ContainsFunc(n, func(node filterNode) bool { return !node.match(headers) })
+}
+
+type notNode struct {
+	node filterNode
+}
+
+func (n notNode) match(headers map[string]string) bool {
+	return !n.node.match(headers)
+}
+
+type inNode struct {
+	header string
+	values []string // A single value for =
+}
+
+func (n inNode) match(headers map[string]string) bool {
+	value, ok := headers[n.header]
+	return ok && slices.Contains(n.values, value)
+}
+
+type prefixNode struct {
+	header string
+	prefix string
+}
+
+func (n prefixNode) match(headers map[string]string) bool {
+	value, ok := headers[n.header]
+	return ok && strings.HasPrefix(value, n.prefix)
+}
+
+// ParseFilter parses a filter expression.
+func ParseFilter(expr string) (*Filter, error) {
+	tokens, err := tokenizeFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %s in filter", p.tokens[p.pos].text)
+	}
+	return &Filter{expr: expr, root: root}, nil
+}
+
+// Match reports whether a message published with the headers passes the filter.
+func (f *Filter) Match(headers map[string]string) bool {
+	return f.root.match(headers)
+}
+
+func (f *Filter) String() string {
+	return f.expr
+}
+
+type filterToken struct {
+	text   string
+	quoted bool // Quoted values are never keywords or symbols
+}
+
+func isBareChar(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_.:-", r)
+}
+
+func tokenizeFilter(expr string) ([]filterToken, error) {
+	var tokens []filterToken
+	runes := []rune(expr)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case strings.ContainsRune("(),=", r):
+			tokens = append(tokens, filterToken{text: string(r)})
+			i++
+		case r == '!':
+			if i+1 >= len(runes) || runes[i+1] != '=' {
+				return nil, errors.New("expected != in filter")
+			}
+			tokens = append(tokens, filterToken{text: "!="})
+			i += 2
+		case r == '\'' || r == '"':
+			var value strings.Builder
+			i++
+			for ; i < len(runes) && runes[i] != r; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				value.WriteRune(runes[i])
+			}
+			if i >= len(runes) {
+				return nil, errors.New("unterminated string in filter")
+			}
+			tokens = append(tokens, filterToken{text: value.String(), quoted: true})
+			i++
+		case isBareChar(r):
+			start := i
+			for i < len(runes) && isBareChar(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, filterToken{text: string(runes[start:i])})
+		default:
+			return nil, fmt.Errorf("unexpected character %q in filter", r)
+		}
+	}
+	if len(tokens) == 0 {
+		return nil, errors.New("filter is empty")
+	}
+	return tokens, nil
+}
+
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+// accept consumes the next token if it is the keyword or symbol.
+func (p *filterParser) accept(keyword string) bool {
+	if p.pos < len(p.tokens) && !p.tokens[p.pos].quoted && strings.EqualFold(p.tokens[p.pos].text, keyword) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) expect(keyword string) error {
+	if !p.accept(keyword) {
+		return fmt.Errorf("expected %s in filter", keyword)
+	}
+	return nil
+}
+
+// value consumes a header name or value. Unquoted keywords and symbols are not values.
+func (p *filterParser) value() (string, error) {
+	if p.pos >= len(p.tokens) {
+		return "", errors.New("unexpected end of filter")
+	}
+	token := p.tokens[p.pos]
+	if !token.quoted && (!isBareChar([]rune(token.text)[0]) ||
+		slices.Contains([]string{"AND", "OR", "NOT", "IN", "PREFIX"}, strings.ToUpper(token.text))) {
+		return "", fmt.Errorf("unexpected %s in filter", token.text)
+	}
+	p.pos++
+	return token.text, nil
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	nodes := orNode{}
+	for {
+		node, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+		if !p.accept("or") {
+			break
+		}
+	}
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return nodes, nil
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	nodes := andNode{}
+	for {
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+		if !p.accept("and") {
+			break
+		}
+	}
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return nodes, nil
+}
+
+func (p *filterParser) parseUnary() (filterNode, error) {
+	if p.accept("not") {
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{node: node}, nil
+	}
+	if p.accept("(") {
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return node, p.expect(")")
+	}
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (filterNode, error) {
+	header, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case p.accept("="):
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		return inNode{header: header, values: []string{value}}, nil
+	case p.accept("!="):
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{node: inNode{header: header, values: []string{value}}}, nil
+	case p.accept("prefix"):
+		prefix, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		return prefixNode{header: header, prefix: prefix}, nil
+	case p.accept("not"):
+		if err := p.expect("in"); err != nil {
+			return nil, err
+		}
+		node, err := p.parseIn(header)
+		if err != nil {
+			return nil, err
+		}
+		return notNode{node: node}, nil
+	case p.accept("in"):
+		return p.parseIn(header)
+	default:
+		return nil, fmt.Errorf("expected =, !=, IN, NOT IN or PREFIX after %s in filter", header)
+	}
+}
+
+// parseIn parses the parenthesised list of values after IN.
+func (p *filterParser) parseIn(header string) (filterNode, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var values []string
+	for {
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+		if !p.accept(",") {
+			break
+		}
+	}
+	return inNode{header: header, values: values}, p.expect(")")
+}
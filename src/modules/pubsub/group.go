@@ -0,0 +1,307 @@
+package pubsub
+
+import (
+	"cmp"
+	"fmt"
+	"net"
+	"slices"
+	"sync"
+	"time"
+)
+
+// GroupConfig controls how a consumer group redelivers the messages that its consumers do not acknowledge.
+type GroupConfig struct {
+	// VisibilityTimeout is how long a consumer has to acknowledge a message before it is redelivered.
+	VisibilityTimeout time.Duration
+	// MaxAttempts is the number of deliveries after which an unacknowledged message is moved to the
+	// dead-letter channel. If it is 0, messages are redelivered until they are acknowledged.
+	MaxAttempts int
+	// DeadLetter is the channel that messages are published to once they run out of attempts.
+	// If it is empty, those messages are dropped.
+	DeadLetter string
+}
+
+func defaultGroupConfig() GroupConfig {
+	return GroupConfig{VisibilityTimeout: 30 * time.Second}
+}
+
+// delivery is a message held by a consumer group until a consumer acknowledges it.
+// The ID stays the same when the message is redelivered.
+type delivery struct {
+	id       uint64
+	payload  string
+	attempts int
+	consumer *net.Conn // nil while the message waits for a consumer
+	deadline time.Time // when the message is redelivered if it has not been acknowledged
+}
+
+// ConsumerGroup allows multiple subscribers to share the consumption load of a channel.
+// Each message published to the channel is delivered to one consumer of the group in turn, and stays in that
+// consumer's pending entries until the consumer acknowledges it with GROUP ACK. Messages that are not
+// acknowledged within the visibility timeout, that are rejected with GROUP NACK, or that were pending for a
+// consumer that left are redelivered to the next consumer.
+type ConsumerGroup struct {
+	name       string
+	channel    string
+	mut        sync.Mutex
+	config     GroupConfig
+	consumers  []*net.Conn
+	next       int // The index of the consumer that receives the next message
+	lastID     uint64
+	queue      []*delivery          // Messages waiting for a consumer, ordered by ID
+	pending    map[uint64]*delivery // Messages delivered to a consumer and not acknowledged yet
+	deadLetter func(channel string, message string)
+	wake       chan struct{}
+	done       chan struct{}
+}
+
+// NewConsumerGroup creates a consumer group for the channel. deadLetter is called to publish
+// the messages that run out of attempts.
+func NewConsumerGroup(name string, channel string, config GroupConfig, deadLetter func(channel string, message string)) *ConsumerGroup {
+	return &ConsumerGroup{
+		name:       name,
+		channel:    channel,
+		mut:        sync.Mutex{},
+		config:     config,
+		consumers:  []*net.Conn{},
+		queue:      []*delivery{},
+		pending:    make(map[uint64]*delivery),
+		deadLetter: deadLetter,
+		wake:       make(chan struct{}, 1),
+		done:       make(chan struct{}),
+	}
+}
+
+// Start runs the delivery loop of the group until Stop is called.
+func (cg *ConsumerGroup) Start() {
+	go func() {
+		for {
+			timer := time.NewTimer(cg.dispatch(time.Now()))
+			select {
+			case <-cg.done:
+				timer.Stop()
+				return
+			case <-cg.wake:
+				timer.Stop()
+			case <-timer.C:
+			}
+		}
+	}()
+}
+
+// Stop ends the delivery loop started by Start.
+func (cg *ConsumerGroup) Stop() {
+	close(cg.done)
+}
+
+// notify wakes the delivery loop up.
+func (cg *ConsumerGroup) notify() {
+	select {
+	case cg.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (cg *ConsumerGroup) frame(d *delivery) string {
+	return fmt.Sprintf("*5\r\n$5\r\ngroup\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n:%d\r\n$%d\r\n%s\r\n\n",
+		len(cg.channel), cg.channel, len(cg.name), cg.name, d.id, len(d.payload), d.payload)
+}
+
+// requeue puts messages back in the queue so that they are delivered again. The caller must hold mut.
+func (cg *ConsumerGroup) requeue(deliveries ...*delivery) {
+	for _, d := range deliveries {
+		delete(cg.pending, d.id)
+		d.consumer = nil
+		cg.queue = append(cg.queue, d)
+	}
+	slices.SortFunc(cg.queue, func(a, b *delivery) int {
+		return cmp.Compare(a.id, b.id)
+	})
+}
+
+// dispatch requeues the messages whose visibility timeout has passed and hands the queued messages
+// to the consumers in turn. It returns how long to wait until the next visibility timeout.
+func (cg *ConsumerGroup) dispatch(now time.Time) time.Duration {
+	type send struct {
+		conn  *net.Conn
+		frame string
+	}
+	var sends []send
+	var dead []string
+
+	cg.mut.Lock()
+
+	var expired []*delivery
+	for _, d := range cg.pending {
+		if !now.Before(d.deadline) {
+			expired = append(expired, d)
+		}
+	}
+	cg.requeue(expired...)
+
+	for len(cg.queue) > 0 && len(cg.consumers) > 0 {
+		d := cg.queue[0]
+		cg.queue = cg.queue[1:]
+
+		if cg.config.MaxAttempts > 0 && d.attempts >= cg.config.MaxAttempts {
+			dead = append(dead, d.payload)
+			continue
+		}
+
+		cg.next %= len(cg.consumers)
+		d.consumer = cg.consumers[cg.next]
+		cg.next++
+		d.attempts++
+		d.deadline = now.Add(cg.config.VisibilityTimeout)
+		cg.pending[d.id] = d
+
+		sends = append(sends, send{conn: d.consumer, frame: cg.frame(d)})
+	}
+
+	wait := time.Hour
+	for _, d := range cg.pending {
+		wait = min(wait, d.deadline.Sub(now))
+	}
+
+	deadLetter := cg.config.DeadLetter
+
+	cg.mut.Unlock()
+
+	for _, s := range sends {
+		if _, err := (*s.conn).Write([]byte(s.frame)); err != nil {
+			// The consumer is gone, so its pending messages go to the other consumers
+			cg.Unsubscribe(s.conn)
+		}
+	}
+
+	if deadLetter != "" {
+		for _, message := range dead {
+			cg.deadLetter(deadLetter, message)
+		}
+	}
+
+	return wait
+}
+
+func (cg *ConsumerGroup) Subscribe(conn *net.Conn) {
+	cg.mut.Lock()
+	defer cg.mut.Unlock()
+
+	if !slices.Contains(cg.consumers, conn) {
+		cg.consumers = append(cg.consumers, conn)
+	}
+	cg.notify()
+}
+
+// Unsubscribe removes the consumer from the group. The messages pending for the consumer are redelivered
+// to the other consumers, or kept until a consumer joins.
+func (cg *ConsumerGroup) Unsubscribe(conn *net.Conn) {
+	cg.mut.Lock()
+	defer cg.mut.Unlock()
+
+	idx := slices.Index(cg.consumers, conn)
+	if idx == -1 {
+		return
+	}
+	cg.consumers = slices.Delete(cg.consumers, idx, idx+1)
+	if idx < cg.next {
+		cg.next--
+	}
+
+	var inFlight []*delivery
+	for _, d := range cg.pending {
+		if d.consumer == conn {
+			inFlight = append(inFlight, d)
+		}
+	}
+	cg.requeue(inFlight...)
+	cg.notify()
+}
+
+// Publish queues the message for delivery. The message is dropped if the group has no consumers.
+func (cg *ConsumerGroup) Publish(message string) {
+	cg.mut.Lock()
+	defer cg.mut.Unlock()
+
+	if len(cg.consumers) == 0 {
+		return
+	}
+
+	cg.lastID++
+	cg.queue = append(cg.queue, &delivery{id: cg.lastID, payload: message})
+	cg.notify()
+}
+
+// Ack removes the messages from the consumer's pending entries and returns how many were removed.
+// Messages that are pending for another consumer are left alone.
+func (cg *ConsumerGroup) Ack(conn *net.Conn, ids []uint64) int {
+	cg.mut.Lock()
+	defer cg.mut.Unlock()
+
+	count := 0
+	for _, id := range ids {
+		if d, ok := cg.pending[id]; ok && d.consumer == conn {
+			delete(cg.pending, id)
+			count++
+		}
+	}
+	return count
+}
+
+// Nack returns the messages from the consumer's pending entries to the group so that they are
+// redelivered straight away. It returns how many messages were returned.
+func (cg *ConsumerGroup) Nack(conn *net.Conn, ids []uint64) int {
+	cg.mut.Lock()
+	defer cg.mut.Unlock()
+
+	var rejected []*delivery
+	for _, id := range ids {
+		if d, ok := cg.pending[id]; ok && d.consumer == conn {
+			rejected = append(rejected, d)
+		}
+	}
+	cg.requeue(rejected...)
+	cg.notify()
+	return len(rejected)
+}
+
+// Pending returns copies of the messages that the group holds, ordered by ID. Messages that wait for a consumer
+// have a nil consumer.
+func (cg *ConsumerGroup) Pending() []delivery {
+	cg.mut.Lock()
+	defer cg.mut.Unlock()
+
+	deliveries := make([]delivery, 0, len(cg.pending)+len(cg.queue))
+	for _, d := range cg.pending {
+		deliveries = append(deliveries, *d)
+	}
+	for _, d := range cg.queue {
+		deliveries = append(deliveries, *d)
+	}
+	slices.SortFunc(deliveries, func(a, b delivery) int {
+		return cmp.Compare(a.id, b.id)
+	})
+	return deliveries
+}
+
+// SetConfig changes the redelivery settings of the group. Pending messages keep their current deadlines.
+func (cg *ConsumerGroup) SetConfig(config GroupConfig) {
+	cg.mut.Lock()
+	defer cg.mut.Unlock()
+	cg.config = config
+	cg.notify()
+}
+
+// Members returns the consumers of the group, in the order in which they receive messages.
+func (cg *ConsumerGroup) Members() []*net.Conn {
+	cg.mut.Lock()
+	defer cg.mut.Unlock()
+	return slices.Clone(cg.consumers)
+}
+
+// holdsMessages reports whether the group has messages that have not been acknowledged.
+func (cg *ConsumerGroup) holdsMessages() bool {
+	cg.mut.Lock()
+	defer cg.mut.Unlock()
+	return len(cg.pending)+len(cg.queue) > 0
+}
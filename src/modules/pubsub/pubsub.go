@@ -1,302 +1,795 @@
 package pubsub
 
 import (
-	"bufio"
-	"container/ring"
 	"context"
 	"fmt"
+	"github.com/gobwas/glob"
 	"github.com/kelvinmwinuka/memstore/src/utils"
 	"net"
+	"slices"
 	"strings"
 	"sync"
-	"time"
 )
 
-// ConsumerGroup allows multiple subscribers to share the consumption load of a channel.
-// Only one subscriber in the consumer group will receive messages published to the channel.
-type ConsumerGroup struct {
+// sendMessage writes a message frame to a subscriber and reports whether it was written. The connection's output
+// buffer queues the frame, so a slow subscriber does not hold up the caller. The frame is written with a single
+// call so that it is not interleaved with replies written to the same connection.
+func sendMessage(conn *net.Conn, frame string) bool {
+	_, err := (*conn).Write([]byte(frame))
+	return err == nil
+}
+
+// message is a message published to a channel. offset is 0 unless the channel is durable.
+type message struct {
+	payload string
+	headers map[string]string
+	offset  uint64
+}
+
+// Channel - A channel can be subscribed to directly, or via a consumer group.
+// All direct subscribers to the channel will receive any message published to the channel.
+// Only one subscriber of a channel's consumer group will receive a message posted to the channel.
+// In compatibility mode, messages are sent as Redis message arrays and are not acknowledged.
+// Otherwise, a subscriber that does not acknowledge a message with +ACK in time is unsubscribed.
+type Channel struct {
 	name             string
+	compat           bool
+	messageType      string      // The type of the message arrays sent in compatibility mode, message or smessage
+	acks             *ackTracker // The ACKs that subscribers owe outside of compatibility mode
 	subscribersRWMut sync.RWMutex
-	subscribers      *ring.Ring
-	messageChan      *chan string
+	subscribers      []*net.Conn
+	consumerGroups   []*ConsumerGroup
+	newGroup         func(name string) *ConsumerGroup // Creates the consumer groups of the channel
+	replayed         map[*net.Conn]uint64             // The last offset replayed to each subscriber that subscribed with an offset
+	filters          map[*net.Conn]*Filter            // The filters of the direct subscribers that subscribed with WHERE
+	messageChan      *chan message
+	done             chan struct{}
 }
 
-func NewConsumerGroup(name string) *ConsumerGroup {
-	messageChan := make(chan string)
+func NewChannel(name string, compat bool, newGroup func(name string) *ConsumerGroup) *Channel {
+	messageChan := make(chan message)
 
-	return &ConsumerGroup{
+	return &Channel{
 		name:             name,
+		compat:           compat,
+		messageType:      "message",
+		newGroup:         newGroup,
 		subscribersRWMut: sync.RWMutex{},
-		subscribers:      nil,
+		subscribers:      []*net.Conn{},
+		consumerGroups:   []*ConsumerGroup{},
+		replayed:         make(map[*net.Conn]uint64),
+		filters:          make(map[*net.Conn]*Filter),
 		messageChan:      &messageChan,
+		done:             make(chan struct{}),
 	}
 }
 
-func (cg *ConsumerGroup) SendMessage(message string) {
-	cg.subscribersRWMut.RLock()
+// frame returns the frame that delivers a message to a direct subscriber of the channel.
+// Messages published to durable channels carry their offset.
+func (ch *Channel) frame(payload string, offset uint64) string {
+	switch {
+	case ch.compat && offset > 0:
+		return fmt.Sprintf("*4\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n:%d\r\n\n",
+			len(ch.messageType), ch.messageType, len(ch.name), ch.name, len(payload), payload, offset)
+	case ch.compat:
+		return fmt.Sprintf("*3\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n\n",
+			len(ch.messageType), ch.messageType, len(ch.name), ch.name, len(payload), payload)
+	case offset > 0:
+		return fmt.Sprintf("*2\r\n:%d\r\n$%d\r\n%s\r\n\n", offset, len(payload), payload)
+	default:
+		return fmt.Sprintf("$%d\r\n%s\r\n\n", len(payload), payload)
+	}
+}
 
-	conn := cg.subscribers.Value.(*net.Conn)
+func (ch *Channel) Start() {
+	go func() {
+		for {
+			var msg message
+			select {
+			case <-ch.done:
+				return
+			case msg = <-*ch.messageChan:
+			}
 
-	cg.subscribersRWMut.RUnlock()
+			frame := ch.frame(msg.payload, msg.offset)
 
-	rw := bufio.NewReadWriter(bufio.NewReader(*conn), bufio.NewWriter(*conn))
-	rw.WriteString(fmt.Sprintf("$%d\r\n%s\r\n\n", len(message), message))
-	rw.Flush()
+			ch.subscribersRWMut.RLock()
 
-	// Wait for an ACK
-	// If no ACK is received within a time limit, remove this connection from subscribers and retry
-	(*conn).SetReadDeadline(time.Now().Add(250 * time.Millisecond))
-	if msg, err := utils.ReadMessage(rw); err != nil {
-		// Remove the connection from subscribers list
-		cg.Unsubscribe(conn)
-		// Reset the deadline
-		(*conn).SetReadDeadline(time.Time{})
-		// Retry sending the message
-		cg.SendMessage(message)
-	} else {
-		if strings.TrimSpace(msg) != "+ACK" {
-			cg.Unsubscribe(conn)
-			(*conn).SetReadDeadline(time.Time{})
-			cg.SendMessage(message)
-		}
-	}
+			var failed []*net.Conn
+			for _, conn := range ch.subscribers {
+				if msg.offset > 0 && msg.offset <= ch.replayed[conn] {
+					// The subscriber received this message when it was replayed
+					continue
+				}
+				if filter, ok := ch.filters[conn]; ok && !filter.Match(msg.headers) {
+					continue
+				}
+				if !sendMessage(conn, frame) {
+					failed = append(failed, conn)
+					continue
+				}
+				if !ch.compat {
+					ch.acks.expect(conn, func() { ch.Unsubscribe(conn) })
+				}
+			}
 
-	(*conn).SetDeadline(time.Time{})
-	cg.subscribers = cg.subscribers.Next()
-}
+			ch.subscribersRWMut.RUnlock()
 
-func (cg *ConsumerGroup) Start() {
-	go func() {
-		for {
-			message := <-*cg.messageChan
-			if cg.subscribers != nil {
-				cg.SendMessage(message)
+			for _, conn := range failed {
+				ch.Unsubscribe(conn)
 			}
 		}
 	}()
 }
 
-func (cg *ConsumerGroup) Subscribe(conn *net.Conn) {
-	cg.subscribersRWMut.Lock()
-	defer cg.subscribersRWMut.Unlock()
+// Stop ends the goroutines started for the channel and its consumer groups.
+func (ch *Channel) Stop() {
+	ch.subscribersRWMut.Lock()
+	defer ch.subscribersRWMut.Unlock()
 
-	r := ring.New(1)
-	for i := 0; i < r.Len(); i++ {
-		r.Value = conn
-		r = r.Next()
+	for _, group := range ch.consumerGroups {
+		group.Stop()
 	}
+	close(ch.done)
+}
+
+func (ch *Channel) Subscribe(conn *net.Conn, consumerGroupName interface{}) {
+	ch.subscribersRWMut.Lock()
+	defer ch.subscribersRWMut.Unlock()
 
-	if cg.subscribers == nil {
-		cg.subscribers = r
+	if consumerGroupName == nil {
+		ch.subscribeDirect(conn, nil)
 		return
 	}
 
-	cg.subscribers = cg.subscribers.Link(r)
+	idx := slices.IndexFunc(ch.consumerGroups, func(group *ConsumerGroup) bool {
+		return group.name == consumerGroupName.(string)
+	})
+
+	if idx == -1 {
+		newGroup := ch.newGroup(consumerGroupName.(string))
+		newGroup.Start()
+		ch.consumerGroups = append(ch.consumerGroups, newGroup)
+		idx = len(ch.consumerGroups) - 1
+	}
+
+	ch.consumerGroups[idx].Subscribe(conn)
 }
 
-func (cg *ConsumerGroup) Unsubscribe(conn *net.Conn) {
-	cg.subscribersRWMut.Lock()
-	defer cg.subscribersRWMut.Unlock()
+// Unsubscribe removes the connection from the channel and from its consumer groups.
+// Consumer groups that are left without members and without unacknowledged messages are removed.
+func (ch *Channel) Unsubscribe(conn *net.Conn) {
+	ch.subscribersRWMut.Lock()
+	defer ch.subscribersRWMut.Unlock()
 
-	// If length is 1 and the connection passed is the one contained within, unlink it
-	if cg.subscribers.Len() == 1 {
-		if cg.subscribers.Value == conn {
-			cg.subscribers = nil
-		}
-		return
+	ch.subscribers = utils.Filter[*net.Conn](ch.subscribers, func(c *net.Conn) bool {
+		return c != conn
+	})
+	delete(ch.replayed, conn)
+	delete(ch.filters, conn)
+
+	for _, group := range ch.consumerGroups {
+		group.Unsubscribe(conn)
 	}
 
-	for i := 0; i < cg.subscribers.Len(); i++ {
-		if cg.subscribers.Value == conn {
-			cg.subscribers = cg.subscribers.Prev()
-			cg.subscribers.Unlink(1)
-			break
+	ch.consumerGroups = slices.DeleteFunc(ch.consumerGroups, func(group *ConsumerGroup) bool {
+		if len(group.Members()) > 0 || group.holdsMessages() {
+			return false
 		}
-		cg.subscribers = cg.subscribers.Next()
+		group.Stop()
+		return true
+	})
+}
+
+// subscribeDirect subscribes the connection directly to the channel. Only the messages that pass the filter
+// are delivered to it, or every message if the filter is nil. The caller must hold subscribersRWMut.
+func (ch *Channel) subscribeDirect(conn *net.Conn, filter *Filter) {
+	if !utils.Contains[*net.Conn](ch.subscribers, conn) {
+		ch.subscribers = append(ch.subscribers, conn)
+	}
+	if filter == nil {
+		delete(ch.filters, conn)
+	} else {
+		ch.filters[conn] = filter
 	}
 }
 
-func (cg *ConsumerGroup) Publish(message string) {
-	*cg.messageChan <- message
+// SubscribeWhere subscribes the connection directly to the channel, replacing the filter of an existing
+// subscription. A nil filter delivers every message.
+func (ch *Channel) SubscribeWhere(conn *net.Conn, filter *Filter) {
+	ch.subscribersRWMut.Lock()
+	defer ch.subscribersRWMut.Unlock()
+	ch.subscribeDirect(conn, filter)
 }
 
-// Channel - A channel can be subscribed to directly, or via a consumer group.
-// All direct subscribers to the channel will receive any message published to the channel.
-// Only one subscriber of a channel's consumer group will receive a message posted to the channel.
-type Channel struct {
-	name             string
-	subscribersRWMut sync.RWMutex
-	subscribers      []*net.Conn
-	consumerGroups   []*ConsumerGroup
-	messageChan      *chan string
+// subscribeReplayed subscribes the connection directly to the channel after the messages up to offset
+// have been replayed to it, so that those messages are not delivered again.
+func (ch *Channel) subscribeReplayed(conn *net.Conn, offset uint64, filter *Filter) {
+	ch.subscribersRWMut.Lock()
+	defer ch.subscribersRWMut.Unlock()
+
+	ch.subscribeDirect(conn, filter)
+	ch.replayed[conn] = offset
 }
 
-func NewChannel(name string) *Channel {
-	messageChan := make(chan string)
+// Publish delivers the message to the channel's subscribers. Consumer groups receive every message,
+// while direct subscribers only receive the messages that pass their filter. It returns once the channel's
+// delivery loop has taken the message, so messages are delivered in the order that Publish is called.
+func (ch *Channel) Publish(msg message) {
+	ch.subscribersRWMut.RLock()
+	for _, group := range ch.consumerGroups {
+		group.Publish(msg.payload)
+	}
+	ch.subscribersRWMut.RUnlock()
 
-	return &Channel{
-		name:             name,
-		subscribersRWMut: sync.RWMutex{},
-		subscribers:      []*net.Conn{},
-		consumerGroups:   []*ConsumerGroup{},
-		messageChan:      &messageChan,
+	select {
+	case <-ch.done:
+	case *ch.messageChan <- msg:
 	}
 }
 
-func (ch *Channel) Start() {
-	go func() {
-		for {
-			message := <-*ch.messageChan
-
-			ch.subscribersRWMut.RLock()
+// NumSubscribers returns the number of connections subscribed to the channel,
+// either directly or through one of its consumer groups.
+func (ch *Channel) NumSubscribers() int {
+	ch.subscribersRWMut.RLock()
+	defer ch.subscribersRWMut.RUnlock()
 
-			for _, conn := range ch.subscribers {
-				go func(conn *net.Conn) {
-					rw := bufio.NewReadWriter(bufio.NewReader(*conn), bufio.NewWriter(*conn))
-					rw.WriteString(fmt.Sprintf("$%d\r\n%s\r\n\n", len(message), message))
-					rw.Flush()
-
-					(*conn).SetReadDeadline(time.Now().Add(200 * time.Millisecond))
-					defer func() {
-						(*conn).SetReadDeadline(time.Time{})
-					}()
-
-					if msg, err := utils.ReadMessage(rw); err != nil {
-						ch.Unsubscribe(conn)
-					} else {
-						if strings.TrimSpace(msg) != "+ACK" {
-							ch.Unsubscribe(conn)
-						}
-					}
-				}(conn)
+	conns := slices.Clone(ch.subscribers)
+	for _, group := range ch.consumerGroups {
+		for _, conn := range group.Members() {
+			if !slices.Contains(conns, conn) {
+				conns = append(conns, conn)
 			}
-
-			ch.subscribersRWMut.RUnlock()
 		}
-	}()
+	}
+	return len(conns)
 }
 
-func (ch *Channel) Subscribe(conn *net.Conn, consumerGroupName interface{}) {
-	if consumerGroupName == nil && !utils.Contains[*net.Conn](ch.subscribers, conn) {
-		ch.subscribersRWMut.Lock()
-		defer ch.subscribersRWMut.Unlock()
-		ch.subscribers = append(ch.subscribers, conn)
-		return
+// HasSubscriber reports whether the connection is subscribed to the channel,
+// either directly or through one of its consumer groups.
+func (ch *Channel) HasSubscriber(conn *net.Conn) bool {
+	ch.subscribersRWMut.RLock()
+	defer ch.subscribersRWMut.RUnlock()
+
+	if slices.Contains(ch.subscribers, conn) {
+		return true
 	}
+	return slices.ContainsFunc(ch.consumerGroups, func(group *ConsumerGroup) bool {
+		return slices.Contains(group.Members(), conn)
+	})
+}
 
-	groups := utils.Filter[*ConsumerGroup](ch.consumerGroups, func(group *ConsumerGroup) bool {
-		return group.name == consumerGroupName.(string)
+// idle reports whether the channel has no subscribers and none of its consumer groups hold
+// unacknowledged messages, so that it can be removed.
+func (ch *Channel) idle() bool {
+	if ch.NumSubscribers() > 0 {
+		return false
+	}
+	ch.subscribersRWMut.RLock()
+	defer ch.subscribersRWMut.RUnlock()
+	return !slices.ContainsFunc(ch.consumerGroups, func(group *ConsumerGroup) bool {
+		return group.holdsMessages()
 	})
+}
 
-	if len(groups) == 0 {
-		go func() {
-			newGroup := NewConsumerGroup(consumerGroupName.(string))
-			newGroup.Start()
-			newGroup.Subscribe(conn)
-			ch.consumerGroups = append(ch.consumerGroups, newGroup)
-		}()
-		return
+// ConsumerGroup returns the consumer group with the given name, or nil if the channel has no such group.
+func (ch *Channel) ConsumerGroup(name string) *ConsumerGroup {
+	ch.subscribersRWMut.RLock()
+	defer ch.subscribersRWMut.RUnlock()
+
+	idx := slices.IndexFunc(ch.consumerGroups, func(group *ConsumerGroup) bool {
+		return group.name == name
+	})
+	if idx == -1 {
+		return nil
 	}
+	return ch.consumerGroups[idx]
+}
 
-	for _, group := range groups {
-		go group.Subscribe(conn)
+// ConsumerGroups returns the consumer groups of the channel.
+func (ch *Channel) ConsumerGroups() []*ConsumerGroup {
+	ch.subscribersRWMut.RLock()
+	defer ch.subscribersRWMut.RUnlock()
+	return slices.Clone(ch.consumerGroups)
+}
+
+// Pattern is a glob pattern subscription. The subscribers receive every message published to a channel
+// that matches the pattern, as a pmessage frame that carries the pattern and the channel.
+type Pattern struct {
+	pattern          string
+	glob             glob.Glob
+	compat           bool
+	acks             *ackTracker // The ACKs that subscribers owe outside of compatibility mode
+	subscribersRWMut sync.RWMutex
+	subscribers      []*net.Conn
+}
+
+func NewPattern(pattern string, compat bool) (*Pattern, error) {
+	g, err := glob.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %s", pattern)
 	}
+	return &Pattern{
+		pattern:          pattern,
+		glob:             g,
+		compat:           compat,
+		subscribersRWMut: sync.RWMutex{},
+		subscribers:      []*net.Conn{},
+	}, nil
 }
 
-func (ch *Channel) Unsubscribe(conn *net.Conn) {
-	ch.subscribersRWMut.Lock()
-	defer ch.subscribersRWMut.Unlock()
+func (p *Pattern) Subscribe(conn *net.Conn) {
+	p.subscribersRWMut.Lock()
+	defer p.subscribersRWMut.Unlock()
+	if !utils.Contains[*net.Conn](p.subscribers, conn) {
+		p.subscribers = append(p.subscribers, conn)
+	}
+}
 
-	ch.subscribers = utils.Filter[*net.Conn](ch.subscribers, func(c *net.Conn) bool {
+func (p *Pattern) Unsubscribe(conn *net.Conn) {
+	p.subscribersRWMut.Lock()
+	defer p.subscribersRWMut.Unlock()
+	p.subscribers = utils.Filter[*net.Conn](p.subscribers, func(c *net.Conn) bool {
 		return c != conn
 	})
+}
 
-	for _, group := range ch.consumerGroups {
-		go group.Unsubscribe(conn)
+func (p *Pattern) Publish(channelName string, message string) {
+	frame := fmt.Sprintf("*4\r\n$8\r\npmessage\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n\n",
+		len(p.pattern), p.pattern, len(channelName), channelName, len(message), message)
+
+	p.subscribersRWMut.RLock()
+
+	var failed []*net.Conn
+	for _, conn := range p.subscribers {
+		if !sendMessage(conn, frame) {
+			failed = append(failed, conn)
+			continue
+		}
+		if !p.compat {
+			p.acks.expect(conn, func() { p.Unsubscribe(conn) })
+		}
 	}
-}
 
-func (ch *Channel) Publish(message string) {
-	for _, group := range ch.consumerGroups {
-		go group.Publish(message)
+	p.subscribersRWMut.RUnlock()
+
+	for _, conn := range failed {
+		p.Unsubscribe(conn)
 	}
-	*ch.messageChan <- message
 }
 
 // PubSub container
 type PubSub struct {
-	channels []*Channel
+	compat        bool
+	cluster       Cluster // nil unless the server is part of a cluster
+	shards        *PubSub // The sharded channels, which are kept apart from the other channels
+	messageType   string
+	channelsRWMut sync.RWMutex
+	channels      []*Channel
+	patternsRWMut sync.RWMutex
+	patterns      []*Pattern
+	logsRWMut     sync.RWMutex
+	logs          map[string]*channelLog // The retained messages of durable channels
+	groupsRWMut   sync.RWMutex
+	groupConfigs  map[groupKey]GroupConfig // The redelivery settings of consumer groups set with GROUP CONFIG
+	webhooks      webhooks
+	acks          *ackTracker // Shared with the sharded channels, since a connection acknowledges both in one order
+}
+
+// groupKey identifies a consumer group of a channel.
+type groupKey struct {
+	channel string
+	group   string
 }
 
-func NewPubSub() *PubSub {
+func NewPubSub(config utils.Config) *PubSub {
+	ps := newPubSub(config, "message")
+	ps.shards = newPubSub(config, "smessage")
+	ps.shards.acks = ps.acks
+	return ps
+}
+
+func newPubSub(config utils.Config, messageType string) *PubSub {
 	return &PubSub{
-		channels: []*Channel{
-			NewChannel("chan"),
-		},
+		compat:        config.PubSubCompat,
+		messageType:   messageType,
+		channelsRWMut: sync.RWMutex{},
+		channels:      []*Channel{},
+		patternsRWMut: sync.RWMutex{},
+		patterns:      []*Pattern{},
+		logsRWMut:     sync.RWMutex{},
+		logs:          make(map[string]*channelLog),
+		groupsRWMut:   sync.RWMutex{},
+		groupConfigs:  make(map[groupKey]GroupConfig),
+		acks:          newAckTracker(),
+	}
+}
+
+// channel returns the channel with the given name, creating and starting it if it does not exist.
+// The caller must hold channelsRWMut for writing.
+func (ps *PubSub) channel(channelName string) *Channel {
+	idx := slices.IndexFunc(ps.channels, func(c *Channel) bool {
+		return c.name == channelName
+	})
+	if idx != -1 {
+		return ps.channels[idx]
 	}
+
+	newChan := NewChannel(channelName, ps.compat, func(name string) *ConsumerGroup {
+		return NewConsumerGroup(name, channelName, ps.GroupConfig(channelName, name), func(channel string, message string) {
+			if err := ps.PublishToCluster(context.Background(), message, nil, channel); err != nil {
+				fmt.Printf("could not publish to dead-letter channel %s: %v\n", channel, err)
+			}
+		})
+	})
+	newChan.messageType = ps.messageType
+	newChan.acks = ps.acks
+	newChan.Start()
+	ps.channels = append(ps.channels, newChan)
+	return newChan
 }
 
 func (ps *PubSub) Subscribe(ctx context.Context, conn *net.Conn, channelName interface{}, consumerGroup interface{}) {
+	ps.channelsRWMut.Lock()
+	defer ps.channelsRWMut.Unlock()
+
 	// If no channel name is given, subscribe to all channels
 	if channelName == nil {
 		for _, channel := range ps.channels {
-			go channel.Subscribe(conn, nil)
+			channel.Subscribe(conn, nil)
 		}
 		return
 	}
 
-	// Check if channel with given name exists
-	// If it does, subscribe the connection to the channel
-	// If it does not, create the channel and subscribe to it
-	channels := utils.Filter[*Channel](ps.channels, func(c *Channel) bool {
-		return c.name == channelName
+	// Create the channel if it does not exist, and subscribe to it
+	ps.channel(channelName.(string)).Subscribe(conn, consumerGroup)
+}
+
+// Unsubscribe removes the connection from the channel, or from all channels if no channel name is given.
+// Channels that are left without subscribers and without unacknowledged consumer group messages are removed.
+func (ps *PubSub) Unsubscribe(ctx context.Context, conn *net.Conn, channelName interface{}) {
+	ps.channelsRWMut.Lock()
+	defer ps.channelsRWMut.Unlock()
+
+	for _, channel := range ps.channels {
+		if channelName == nil || channel.name == channelName {
+			channel.Unsubscribe(conn)
+		}
+	}
+
+	ps.channels = slices.DeleteFunc(ps.channels, func(channel *Channel) bool {
+		if !channel.idle() {
+			return false
+		}
+		channel.Stop()
+		return true
 	})
+}
 
-	if len(channels) <= 0 {
-		go func() {
-			newChan := NewChannel(channelName.(string))
-			newChan.Start()
-			newChan.Subscribe(conn, consumerGroup)
-			ps.channels = append(ps.channels, newChan)
-		}()
-		return
+// SubscribeWhere subscribes the connection directly to the channel, delivering only the messages that pass
+// the filter. A nil filter delivers every message.
+func (ps *PubSub) SubscribeWhere(ctx context.Context, conn *net.Conn, channelName string, filter *Filter) {
+	ps.channelsRWMut.Lock()
+	defer ps.channelsRWMut.Unlock()
+	ps.channel(channelName).SubscribeWhere(conn, filter)
+}
+
+// SubscribeFrom subscribes the connection directly to the channel. If the channel is durable, the retained
+// messages with an offset of at least offset are replayed before live delivery starts.
+// The confirmation and the replayed messages are written to the connection together, and
+// live messages that were already replayed are not delivered again. Both replayed and live messages
+// must pass the filter, unless it is nil.
+func (ps *PubSub) SubscribeFrom(ctx context.Context, conn *net.Conn, channelName string, offset uint64, filter *Filter, confirmation string) error {
+	ps.logsRWMut.RLock()
+	log, durable := ps.logs[channelName]
+	ps.logsRWMut.RUnlock()
+
+	if !durable {
+		ps.SubscribeWhere(ctx, conn, channelName, filter)
+		_, err := (*conn).Write([]byte(confirmation))
+		return err
 	}
 
-	for _, channel := range channels {
-		go channel.Subscribe(conn, consumerGroup)
+	// Publishers take the channels lock before the log's lock, so the same order is kept here.
+	// Holding the log's lock keeps new messages from being retained until the replay has been written.
+	ps.channelsRWMut.Lock()
+	log.mut.Lock()
+	defer log.mut.Unlock()
+
+	channel := ps.channel(channelName)
+	channel.subscribeReplayed(conn, log.LastOffset, filter)
+	ps.channelsRWMut.Unlock()
+
+	frames := confirmation
+	for _, m := range log.from(offset, utils.Now(ctx)) {
+		if filter != nil && !filter.Match(m.Headers) {
+			continue
+		}
+		frames += channel.frame(m.Message, m.Offset)
 	}
+	_, err := (*conn).Write([]byte(frames))
+	return err
 }
 
-func (ps *PubSub) Unsubscribe(ctx context.Context, conn *net.Conn, channelName interface{}) {
+// Publish delivers the message to the subscribers of the channel on this node, or to the subscribers of every
+// channel if no channel name is given. headers may be nil.
+func (ps *PubSub) Publish(ctx context.Context, message string, headers map[string]string, channelName interface{}) {
+	ps.channelsRWMut.RLock()
+	defer ps.channelsRWMut.RUnlock()
+
 	if channelName == nil {
 		for _, channel := range ps.channels {
-			go channel.Unsubscribe(conn)
+			ps.publishToChannel(ctx, channel.name, message, headers)
 		}
 		return
 	}
 
-	channels := utils.Filter[*Channel](ps.channels, func(c *Channel) bool {
+	ps.publishToChannel(ctx, channelName.(string), message, headers)
+}
+
+// publishToChannel retains the message if the channel is durable, and delivers it to the channel's subscribers
+// and to the patterns that match the channel. The caller must hold channelsRWMut.
+func (ps *PubSub) publishToChannel(ctx context.Context, channelName string, payload string, headers map[string]string) {
+	ps.logsRWMut.RLock()
+	log, durable := ps.logs[channelName]
+	ps.logsRWMut.RUnlock()
+
+	var offset uint64
+	if durable {
+		log.mut.Lock()
+		defer log.mut.Unlock()
+		offset = log.append(payload, headers, utils.Now(ctx))
+	}
+
+	// The message is handed to the channel while the log's lock is held, so that durable messages reach the
+	// channel in offset order and a subscriber replaying the log does not miss the messages that follow the replay.
+	// Deliveries are only queued on the subscribers' output buffers, so the handoff does not wait on a subscriber.
+	for _, channel := range ps.channels {
+		if channel.name == channelName {
+			channel.Publish(message{payload: payload, headers: headers, offset: offset})
+		}
+	}
+
+	// Pattern subscribers and webhooks receive the message even if nobody has subscribed to the channel itself
+	ps.publishToPatterns(channelName, payload)
+	ps.publishToWebhooks(channelName, payload, headers, offset)
+}
+
+// Channels returns the names of the channels that have at least one subscriber, in sorted order.
+// If pattern is not empty, only the channels that match the glob pattern are returned.
+// Pattern subscriptions are not counted.
+func (ps *PubSub) Channels(pattern string) ([]string, error) {
+	var g glob.Glob
+	if pattern != "" {
+		var err error
+		if g, err = glob.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("invalid pattern %s", pattern)
+		}
+	}
+
+	ps.channelsRWMut.RLock()
+	defer ps.channelsRWMut.RUnlock()
+
+	var names []string
+	for _, channel := range ps.channels {
+		if channel.NumSubscribers() == 0 || (g != nil && !g.Match(channel.name)) {
+			continue
+		}
+		names = append(names, channel.name)
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// NumSub returns the number of subscribers of each of the channels, not counting pattern subscribers.
+func (ps *PubSub) NumSub(channelNames []string) []int {
+	ps.channelsRWMut.RLock()
+	defer ps.channelsRWMut.RUnlock()
+
+	counts := make([]int, len(channelNames))
+	for i, name := range channelNames {
+		idx := slices.IndexFunc(ps.channels, func(c *Channel) bool {
+			return c.name == name
+		})
+		if idx != -1 {
+			counts[i] = ps.channels[idx].NumSubscribers()
+		}
+	}
+	return counts
+}
+
+// NumPat returns the number of distinct patterns that are subscribed to.
+func (ps *PubSub) NumPat() int {
+	ps.patternsRWMut.RLock()
+	defer ps.patternsRWMut.RUnlock()
+
+	count := 0
+	for _, p := range ps.patterns {
+		p.subscribersRWMut.RLock()
+		if len(p.subscribers) > 0 {
+			count++
+		}
+		p.subscribersRWMut.RUnlock()
+	}
+	return count
+}
+
+// Groups returns the consumer groups of the channel that have at least one member.
+func (ps *PubSub) Groups(channelName string) []*ConsumerGroup {
+	ps.channelsRWMut.RLock()
+	defer ps.channelsRWMut.RUnlock()
+
+	idx := slices.IndexFunc(ps.channels, func(c *Channel) bool {
 		return c.name == channelName
 	})
+	if idx == -1 {
+		return []*ConsumerGroup{}
+	}
+	return slices.DeleteFunc(ps.channels[idx].ConsumerGroups(), func(group *ConsumerGroup) bool {
+		return len(group.Members()) == 0
+	})
+}
+
+// publishToPatterns delivers a message published to the channel to the patterns that match the channel.
+func (ps *PubSub) publishToPatterns(channelName string, message string) {
+	ps.patternsRWMut.RLock()
+	defer ps.patternsRWMut.RUnlock()
 
-	for _, channel := range channels {
-		go channel.Unsubscribe(conn)
+	for _, pattern := range ps.patterns {
+		if pattern.glob.Match(channelName) {
+			pattern.Publish(channelName, message)
+		}
 	}
 }
 
-func (ps *PubSub) Publish(ctx context.Context, message string, channelName interface{}) {
-	if channelName == nil {
-		for _, channel := range ps.channels {
-			go channel.Publish(message)
+// PSubscribe subscribes the connection to each of the patterns.
+// Nothing is subscribed if any of the patterns is invalid.
+func (ps *PubSub) PSubscribe(ctx context.Context, conn *net.Conn, patterns []string) error {
+	ps.patternsRWMut.Lock()
+	defer ps.patternsRWMut.Unlock()
+
+	var subscribe []*Pattern
+	for _, pattern := range patterns {
+		idx := slices.IndexFunc(ps.patterns, func(p *Pattern) bool {
+			return p.pattern == pattern
+		})
+		if idx != -1 {
+			subscribe = append(subscribe, ps.patterns[idx])
+			continue
 		}
-		return
+		p, err := NewPattern(pattern, ps.compat)
+		if err != nil {
+			return err
+		}
+		p.acks = ps.acks
+		subscribe = append(subscribe, p)
 	}
 
-	channels := utils.Filter[*Channel](ps.channels, func(c *Channel) bool {
-		return c.name == channelName
+	for _, p := range subscribe {
+		if !slices.Contains(ps.patterns, p) {
+			ps.patterns = append(ps.patterns, p)
+		}
+		p.Subscribe(conn)
+	}
+
+	return nil
+}
+
+// PUnsubscribe unsubscribes the connection from each of the patterns, or from all patterns if none are given.
+// Patterns without subscribers are removed.
+func (ps *PubSub) PUnsubscribe(ctx context.Context, conn *net.Conn, patterns []string) {
+	ps.patternsRWMut.Lock()
+	defer ps.patternsRWMut.Unlock()
+
+	for _, p := range ps.patterns {
+		if len(patterns) == 0 || slices.Contains(patterns, p.pattern) {
+			p.Unsubscribe(conn)
+		}
+	}
+
+	ps.patterns = slices.DeleteFunc(ps.patterns, func(p *Pattern) bool {
+		p.subscribersRWMut.RLock()
+		defer p.subscribersRWMut.RUnlock()
+		return len(p.subscribers) == 0
 	})
+}
+
+// Subscriptions returns the channels and the patterns that the connection is subscribed to.
+func (ps *PubSub) Subscriptions(conn *net.Conn) (channels []string, patterns []string) {
+	ps.channelsRWMut.RLock()
+	for _, channel := range ps.channels {
+		if channel.HasSubscriber(conn) {
+			channels = append(channels, channel.name)
+		}
+	}
+	ps.channelsRWMut.RUnlock()
+
+	ps.patternsRWMut.RLock()
+	for _, p := range ps.patterns {
+		p.subscribersRWMut.RLock()
+		if slices.Contains(p.subscribers, conn) {
+			patterns = append(patterns, p.pattern)
+		}
+		p.subscribersRWMut.RUnlock()
+	}
+	ps.patternsRWMut.RUnlock()
+
+	return channels, patterns
+}
 
-	for _, channel := range channels {
-		go channel.Publish(message)
+// Compat reports whether the server runs pub/sub in Redis compatibility mode.
+func (ps *PubSub) Compat() bool {
+	return ps.compat
+}
+
+// Ack acknowledges the oldest message delivered to the connection outside of compatibility mode.
+// It reports whether a message was waiting for an ACK.
+func (ps *PubSub) Ack(conn *net.Conn) bool {
+	return ps.acks.ack(conn)
+}
+
+// Subscribed reports whether the connection is subscribed to a channel, a pattern or a sharded channel,
+// or is a member of a consumer group.
+func (ps *PubSub) Subscribed(conn *net.Conn) bool {
+	channels, patterns := ps.Subscriptions(conn)
+	shardChannels, _ := ps.shards.Subscriptions(conn)
+	return len(channels)+len(patterns)+len(shardChannels) > 0
+}
+
+// CheckSubscribeMode returns an error if the connection may not run the command.
+// In compatibility mode, a connection that is subscribed to a channel, a pattern or a sharded channel may only run
+// (P|S)SUBSCRIBE, (P|S)UNSUBSCRIBE, PING and QUIT until it unsubscribes from everything.
+func (ps *PubSub) CheckSubscribeMode(conn *net.Conn, command string) error {
+	if !ps.compat {
+		return nil
+	}
+	if slices.Contains([]string{
+		"subscribe", "unsubscribe", "psubscribe", "punsubscribe", "ssubscribe", "sunsubscribe", "ping", "quit",
+	}, strings.ToLower(command)) {
+		return nil
+	}
+	if !ps.Subscribed(conn) {
+		return nil
+	}
+	return fmt.Errorf(
+		"Can't execute '%s': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT are allowed in this context",
+		strings.ToLower(command),
+	)
+}
+
+// GroupConfig returns the redelivery settings of the consumer group.
+func (ps *PubSub) GroupConfig(channelName string, groupName string) GroupConfig {
+	ps.groupsRWMut.RLock()
+	defer ps.groupsRWMut.RUnlock()
+
+	if config, ok := ps.groupConfigs[groupKey{channel: channelName, group: groupName}]; ok {
+		return config
+	}
+	return defaultGroupConfig()
+}
+
+// SetGroupConfig changes the redelivery settings of the consumer group. The settings are kept
+// when the group is removed, and apply to the group again when a consumer joins it.
+func (ps *PubSub) SetGroupConfig(channelName string, groupName string, config GroupConfig) {
+	ps.groupsRWMut.Lock()
+	ps.groupConfigs[groupKey{channel: channelName, group: groupName}] = config
+	ps.groupsRWMut.Unlock()
+
+	if group := ps.Group(channelName, groupName); group != nil {
+		group.SetConfig(config)
+	}
+}
+
+// Group returns the consumer group of the channel, or nil if there is no such group.
+func (ps *PubSub) Group(channelName string, groupName string) *ConsumerGroup {
+	ps.channelsRWMut.RLock()
+	defer ps.channelsRWMut.RUnlock()
+
+	idx := slices.IndexFunc(ps.channels, func(c *Channel) bool {
+		return c.name == channelName
+	})
+	if idx == -1 {
+		return nil
 	}
+	return ps.channels[idx].ConsumerGroup(groupName)
 }
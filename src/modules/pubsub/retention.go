@@ -0,0 +1,157 @@
+package pubsub
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// Retention limits the messages that a durable channel keeps for replay.
+// A zero limit does not apply, but at least one of the limits must be set.
+type Retention struct {
+	MaxLen int           `json:"MaxLen,omitempty"`
+	MaxAge time.Duration `json:"MaxAge,omitempty"`
+}
+
+type retainedMessage struct {
+	Offset      uint64            `json:"Offset"`
+	Message     string            `json:"Message"`
+	Headers     map[string]string `json:"Headers,omitempty"`
+	PublishedAt time.Time         `json:"PublishedAt"`
+}
+
+// channelLog holds the messages retained by a durable channel, oldest first.
+// Offsets start at 1 and keep increasing for as long as the channel is durable, even after
+// old messages have been dropped. The log outlives the channel's subscribers.
+type channelLog struct {
+	mut        sync.Mutex
+	Retention  Retention         `json:"Retention"`
+	LastOffset uint64            `json:"LastOffset"`
+	Messages   []retainedMessage `json:"Messages"`
+}
+
+// append retains a message and returns its offset. The caller must hold mut.
+func (log *channelLog) append(message string, headers map[string]string, now time.Time) uint64 {
+	log.LastOffset++
+	log.Messages = append(log.Messages, retainedMessage{
+		Offset:      log.LastOffset,
+		Message:     message,
+		Headers:     headers,
+		PublishedAt: now,
+	})
+	log.trim(now)
+	return log.LastOffset
+}
+
+// trim drops the messages that are beyond the retention limits. The caller must hold mut.
+func (log *channelLog) trim(now time.Time) {
+	drop := 0
+	if log.Retention.MaxLen > 0 && len(log.Messages) > log.Retention.MaxLen {
+		drop = len(log.Messages) - log.Retention.MaxLen
+	}
+	if log.Retention.MaxAge > 0 {
+		for drop < len(log.Messages) && now.Sub(log.Messages[drop].PublishedAt) > log.Retention.MaxAge {
+			drop++
+		}
+	}
+	if drop > 0 {
+		log.Messages = append([]retainedMessage{}, log.Messages[drop:]...)
+	}
+}
+
+// from returns the retained messages with an offset of at least offset that have not outlived
+// the maximum age. The caller must hold mut.
+func (log *channelLog) from(offset uint64, now time.Time) []retainedMessage {
+	var messages []retainedMessage
+	for _, m := range log.Messages {
+		if m.Offset < offset {
+			continue
+		}
+		if log.Retention.MaxAge > 0 && now.Sub(m.PublishedAt) > log.Retention.MaxAge {
+			continue
+		}
+		messages = append(messages, m)
+	}
+	return messages
+}
+
+// firstOffset returns the offset of the oldest retained message, or 0 if nothing is retained.
+// The caller must hold mut.
+func (log *channelLog) firstOffset() uint64 {
+	if len(log.Messages) == 0 {
+		return 0
+	}
+	return log.Messages[0].Offset
+}
+
+// SetRetention makes the channel durable, or changes the limits of a durable channel.
+// Messages that are already retained are kept if they are within the new limits.
+func (ps *PubSub) SetRetention(now time.Time, channelName string, retention Retention) {
+	ps.logsRWMut.Lock()
+	defer ps.logsRWMut.Unlock()
+
+	log, ok := ps.logs[channelName]
+	if !ok {
+		ps.logs[channelName] = &channelLog{Retention: retention}
+		return
+	}
+
+	log.mut.Lock()
+	defer log.mut.Unlock()
+	log.Retention = retention
+	log.trim(now)
+}
+
+// RemoveRetention stops retaining messages for the channel and drops the messages that were retained.
+// It reports whether the channel was durable.
+func (ps *PubSub) RemoveRetention(channelName string) bool {
+	ps.logsRWMut.Lock()
+	defer ps.logsRWMut.Unlock()
+
+	_, ok := ps.logs[channelName]
+	delete(ps.logs, channelName)
+	return ok
+}
+
+// GetRetention returns the retention limits of the channel along with the offsets of the oldest and newest
+// retained messages. ok is false if the channel is not durable.
+func (ps *PubSub) GetRetention(channelName string) (retention Retention, first uint64, last uint64, ok bool) {
+	ps.logsRWMut.RLock()
+	defer ps.logsRWMut.RUnlock()
+
+	log, ok := ps.logs[channelName]
+	if !ok {
+		return Retention{}, 0, 0, false
+	}
+
+	log.mut.Lock()
+	defer log.mut.Unlock()
+	return log.Retention, log.firstOffset(), log.LastOffset, true
+}
+
+// Snapshot encodes the retained messages of the durable channels so that they can be included in raft snapshots.
+func (ps *PubSub) Snapshot() ([]byte, error) {
+	ps.logsRWMut.RLock()
+	defer ps.logsRWMut.RUnlock()
+
+	for _, log := range ps.logs {
+		log.mut.Lock()
+		defer log.mut.Unlock()
+	}
+
+	return json.Marshal(ps.logs)
+}
+
+// Restore replaces the durable channels with the ones encoded by Snapshot.
+func (ps *PubSub) Restore(b []byte) error {
+	logs := make(map[string]*channelLog)
+	if err := json.Unmarshal(b, &logs); err != nil {
+		return err
+	}
+
+	ps.logsRWMut.Lock()
+	defer ps.logsRWMut.Unlock()
+	ps.logs = logs
+
+	return nil
+}
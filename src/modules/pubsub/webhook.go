@@ -0,0 +1,298 @@
+package pubsub
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/gobwas/glob"
+	"github.com/kelvinmwinuka/memstore/src/utils"
+	"github.com/sethvargo/go-retry"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	webhookQueueSize = 1024 // Messages waiting for delivery to a webhook before new ones are dropped
+	webhookLogSize   = 100  // Delivery results kept for each webhook
+)
+
+// webhookBackoff returns the retry policy for a single message: up to 5 retries, starting at 500ms and
+// doubling each time, with no wait longer than 30 seconds.
+func webhookBackoff() retry.Backoff {
+	return utils.RetryBackoff(retry.NewExponential(500*time.Millisecond), 5, 100*time.Millisecond, 30*time.Second, 0)
+}
+
+// webhookPayload is the JSON body POSTed for each message.
+type webhookPayload struct {
+	ID      uint64            `json:"id"`
+	Channel string            `json:"channel"`
+	Pattern string            `json:"pattern,omitempty"`
+	Message string            `json:"message"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Offset  uint64            `json:"offset,omitempty"`
+}
+
+// WebhookDelivery records the outcome of POSTing a message to a webhook.
+type WebhookDelivery struct {
+	ID         uint64
+	Channel    string
+	Status     string // delivered, failed or dropped
+	Attempts   int
+	StatusCode int // The status code of the last response, 0 if there was none
+	Error      string
+	Time       time.Time
+}
+
+// Webhook POSTs the messages published to a channel, or to the channels that match a pattern, to an HTTP endpoint.
+// Messages are delivered one at a time in the order that they were published. The body of each request is signed
+// with HMAC-SHA256 using the webhook's secret, and the hex encoded signature is sent in the X-Memstore-Signature
+// header as sha256=<signature>.
+type Webhook struct {
+	ID      uint64
+	Channel string // Empty if the webhook is registered for a pattern
+	Pattern string // Empty if the webhook is registered for a channel
+	URL     string
+	secret  []byte
+	glob    glob.Glob
+	client  *http.Client
+	backoff func() retry.Backoff
+	queue   chan webhookPayload
+	logMut  sync.Mutex
+	log     []WebhookDelivery // The latest delivery results, oldest first
+	cancel  context.CancelFunc
+}
+
+// matches reports whether messages published to the channel are delivered to the webhook.
+func (w *Webhook) matches(channelName string) bool {
+	if w.glob != nil {
+		return w.glob.Match(channelName)
+	}
+	return w.Channel == channelName
+}
+
+// start delivers the queued messages until ctx is cancelled.
+func (w *Webhook) start(ctx context.Context) {
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case payload := <-w.queue:
+				w.record(w.deliver(ctx, payload))
+			}
+		}
+	}()
+}
+
+// deliver POSTs the message, retrying on network errors, 429 responses and server errors.
+func (w *Webhook) deliver(ctx context.Context, payload webhookPayload) WebhookDelivery {
+	result := WebhookDelivery{ID: payload.ID, Channel: payload.Channel}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		result.Status = "failed"
+		result.Error = err.Error()
+		result.Time = time.Now()
+		return result
+	}
+
+	mac := hmac.New(sha256.New, w.secret)
+	mac.Write(body)
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	err = retry.Do(ctx, w.backoff(), func(ctx context.Context) error {
+		result.Attempts++
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Memstore-Signature", signature)
+		req.Header.Set("X-Memstore-Delivery", fmt.Sprintf("%d", payload.ID))
+
+		res, err := w.client.Do(req)
+		if err != nil {
+			result.StatusCode = 0
+			return retry.RetryableError(err)
+		}
+		io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+
+		result.StatusCode = res.StatusCode
+		switch {
+		case res.StatusCode >= 200 && res.StatusCode < 300:
+			return nil
+		case res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500:
+			return retry.RetryableError(fmt.Errorf("endpoint responded with %s", res.Status))
+		default:
+			return fmt.Errorf("endpoint responded with %s", res.Status)
+		}
+	})
+
+	result.Time = time.Now()
+	if err != nil {
+		result.Status = "failed"
+		result.Error = err.Error()
+		return result
+	}
+	result.Status = "delivered"
+	return result
+}
+
+func (w *Webhook) record(delivery WebhookDelivery) {
+	w.logMut.Lock()
+	defer w.logMut.Unlock()
+	w.log = append(w.log, delivery)
+	if len(w.log) > webhookLogSize {
+		w.log = slices.Delete(w.log, 0, len(w.log)-webhookLogSize)
+	}
+}
+
+// enqueue queues the message for delivery. The message is dropped and recorded as such if the queue is full.
+func (w *Webhook) enqueue(payload webhookPayload) {
+	select {
+	case w.queue <- payload:
+	default:
+		w.record(WebhookDelivery{
+			ID:      payload.ID,
+			Channel: payload.Channel,
+			Status:  "dropped",
+			Error:   "delivery queue is full",
+			Time:    time.Now(),
+		})
+	}
+}
+
+// Log returns the latest delivery results of the webhook, newest first.
+func (w *Webhook) Log() []WebhookDelivery {
+	w.logMut.Lock()
+	defer w.logMut.Unlock()
+	log := slices.Clone(w.log)
+	slices.Reverse(log)
+	return log
+}
+
+// webhooks holds the webhooks registered on this node. Webhooks are not replicated, since every node
+// receives every message and each registered webhook should only be called once per message.
+type webhooks struct {
+	mut       sync.RWMutex
+	hooks     []*Webhook
+	lastID    uint64
+	messageID uint64
+}
+
+// AddWebhook registers a webhook for the channel, or for the channels that match the pattern if isPattern
+// is true. If secret is empty, a random one is generated. The webhook and its secret are returned.
+func (ps *PubSub) AddWebhook(target string, isPattern bool, endpoint string, secret string) (*Webhook, string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, "", fmt.Errorf("invalid webhook url %s, must be an http or https url", endpoint)
+	}
+
+	w := &Webhook{
+		URL:     endpoint,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		backoff: webhookBackoff,
+		queue:   make(chan webhookPayload, webhookQueueSize),
+		log:     []WebhookDelivery{},
+	}
+
+	if isPattern {
+		if w.glob, err = glob.Compile(target); err != nil {
+			return nil, "", fmt.Errorf("invalid pattern %s", target)
+		}
+		w.Pattern = target
+	} else {
+		w.Channel = target
+	}
+
+	if secret == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return nil, "", err
+		}
+		secret = hex.EncodeToString(b)
+	}
+	w.secret = []byte(secret)
+
+	ps.webhooks.mut.Lock()
+	defer ps.webhooks.mut.Unlock()
+
+	ps.webhooks.lastID++
+	w.ID = ps.webhooks.lastID
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w.cancel = cancel
+	w.start(ctx)
+
+	ps.webhooks.hooks = append(ps.webhooks.hooks, w)
+	return w, secret, nil
+}
+
+// RemoveWebhook stops delivering messages to the webhook and reports whether it was registered.
+// Messages that have not been delivered yet are dropped.
+func (ps *PubSub) RemoveWebhook(id uint64) bool {
+	ps.webhooks.mut.Lock()
+	defer ps.webhooks.mut.Unlock()
+
+	idx := slices.IndexFunc(ps.webhooks.hooks, func(w *Webhook) bool {
+		return w.ID == id
+	})
+	if idx == -1 {
+		return false
+	}
+	ps.webhooks.hooks[idx].cancel()
+	ps.webhooks.hooks = slices.Delete(ps.webhooks.hooks, idx, idx+1)
+	return true
+}
+
+// Webhooks returns the registered webhooks, ordered by ID.
+func (ps *PubSub) Webhooks() []*Webhook {
+	ps.webhooks.mut.RLock()
+	defer ps.webhooks.mut.RUnlock()
+	return slices.Clone(ps.webhooks.hooks)
+}
+
+// Webhook returns the webhook with the given ID, or nil if there is none.
+func (ps *PubSub) Webhook(id uint64) *Webhook {
+	ps.webhooks.mut.RLock()
+	defer ps.webhooks.mut.RUnlock()
+	idx := slices.IndexFunc(ps.webhooks.hooks, func(w *Webhook) bool {
+		return w.ID == id
+	})
+	if idx == -1 {
+		return nil
+	}
+	return ps.webhooks.hooks[idx]
+}
+
+// publishToWebhooks queues the message for delivery to every webhook that matches the channel.
+func (ps *PubSub) publishToWebhooks(channelName string, message string, headers map[string]string, offset uint64) {
+	ps.webhooks.mut.Lock()
+	defer ps.webhooks.mut.Unlock()
+
+	for _, w := range ps.webhooks.hooks {
+		if !w.matches(channelName) {
+			continue
+		}
+		ps.webhooks.messageID++
+		w.enqueue(webhookPayload{
+			ID:      ps.webhooks.messageID,
+			Channel: channelName,
+			Pattern: w.Pattern,
+			Message: message,
+			Headers: headers,
+			Offset:  offset,
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package pubsub
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kelvinmwinuka/memstore/src/utils"
+	"github.com/sethvargo/go-retry"
+)
+
+// addTestWebhook registers a webhook for the channel that retries without waiting, and removes it
+// once the test is done.
+func addTestWebhook(t *testing.T, ps *PubSub, channel string, endpoint string, secret string) *Webhook {
+	t.Helper()
+	w, _, err := ps.AddWebhook(channel, false, endpoint, secret)
+	if err != nil {
+		t.Fatalf("could not add webhook: %v", err)
+	}
+	w.backoff = func() retry.Backoff {
+		return utils.RetryBackoff(retry.NewConstant(time.Millisecond), 5, 0, 0, 0)
+	}
+	t.Cleanup(func() {
+		ps.RemoveWebhook(w.ID)
+	})
+	return w
+}
+
+// waitForLog waits until the webhook has recorded n deliveries and returns them, newest first.
+func waitForLog(t *testing.T, w *Webhook, n int) []WebhookDelivery {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		log := w.Log()
+		if len(log) >= n {
+			return log
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d deliveries, got %d: %+v", n, len(log), log)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWebhookSignature(t *testing.T) {
+	const secret = "s3cret"
+
+	type request struct {
+		body      []byte
+		signature string
+		delivery  string
+	}
+	requests := make(chan request, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- request{
+			body:      body,
+			signature: r.Header.Get("X-Memstore-Signature"),
+			delivery:  r.Header.Get("X-Memstore-Delivery"),
+		}
+	}))
+	defer server.Close()
+
+	ps := NewPubSub(utils.Config{})
+	w := addTestWebhook(t, ps, "orders", server.URL, secret)
+
+	ps.Publish(context.Background(), "order created", map[string]string{"tenant": "acme"}, "orders")
+
+	var req request
+	select {
+	case req = <-requests:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the webhook was not called")
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(req.body)
+	if expected := "sha256=" + hex.EncodeToString(mac.Sum(nil)); req.signature != expected {
+		t.Errorf("expected signature %s, got %s", expected, req.signature)
+	}
+
+	var payload webhookPayload
+	if err := json.Unmarshal(req.body, &payload); err != nil {
+		t.Fatalf("could not decode payload: %v", err)
+	}
+	if payload.Channel != "orders" || payload.Message != "order created" || payload.Headers["tenant"] != "acme" {
+		t.Errorf("unexpected payload %+v", payload)
+	}
+	if req.delivery != "1" || payload.ID != 1 {
+		t.Errorf("expected delivery 1, got header %s and ID %d", req.delivery, payload.ID)
+	}
+
+	log := waitForLog(t, w, 1)
+	if log[0].Status != "delivered" || log[0].Attempts != 1 || log[0].StatusCode != http.StatusOK {
+		t.Errorf("unexpected delivery %+v", log[0])
+	}
+}
+
+func TestWebhookRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		responses  []int // The status codes returned for each attempt, the last one is repeated
+		status     string
+		attempts   int
+		statusCode int
+	}{
+		{
+			name:       "server errors are retried",
+			responses:  []int{http.StatusInternalServerError, http.StatusBadGateway, http.StatusOK},
+			status:     "delivered",
+			attempts:   3,
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "too many requests is retried",
+			responses:  []int{http.StatusTooManyRequests, http.StatusNoContent},
+			status:     "delivered",
+			attempts:   2,
+			statusCode: http.StatusNoContent,
+		},
+		{
+			name:       "client errors are not retried",
+			responses:  []int{http.StatusBadRequest},
+			status:     "failed",
+			attempts:   1,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "delivery fails once the retries run out",
+			responses:  []int{http.StatusServiceUnavailable},
+			status:     "failed",
+			attempts:   6,
+			statusCode: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mut sync.Mutex
+			calls := 0
+			server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				mut.Lock()
+				status := test.responses[min(calls, len(test.responses)-1)]
+				calls++
+				mut.Unlock()
+				rw.WriteHeader(status)
+			}))
+			defer server.Close()
+
+			ps := NewPubSub(utils.Config{})
+			w := addTestWebhook(t, ps, "orders", server.URL, "secret")
+
+			ps.Publish(context.Background(), "order created", nil, "orders")
+
+			delivery := waitForLog(t, w, 1)[0]
+			if delivery.Status != test.status {
+				t.Errorf("expected status %s, got %s (%s)", test.status, delivery.Status, delivery.Error)
+			}
+			if delivery.Attempts != test.attempts {
+				t.Errorf("expected %d attempts, got %d", test.attempts, delivery.Attempts)
+			}
+			if delivery.StatusCode != test.statusCode {
+				t.Errorf("expected status code %d, got %d", test.statusCode, delivery.StatusCode)
+			}
+			if test.status == "failed" && delivery.Error == "" {
+				t.Error("expected the failed delivery to record an error")
+			}
+
+			mut.Lock()
+			defer mut.Unlock()
+			if calls != test.attempts {
+				t.Errorf("expected the endpoint to be called %d times, got %d", test.attempts, calls)
+			}
+		})
+	}
+}
+
+func TestWebhookDropped(t *testing.T) {
+	release := make(chan struct{})
+	received := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		select {
+		case received <- struct{}{}:
+		default:
+		}
+		<-release
+	}))
+	defer server.Close()
+	// Unblock the handler before the server is closed, since Close waits for requests to finish
+	defer close(release)
+
+	ps := NewPubSub(utils.Config{})
+	w := addTestWebhook(t, ps, "orders", server.URL, "secret")
+
+	// The first message is held by the endpoint, so the next ones fill the queue and the last is dropped
+	ps.Publish(context.Background(), "first", nil, "orders")
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the webhook was not called")
+	}
+	for i := 0; i < webhookQueueSize+1; i++ {
+		ps.Publish(context.Background(), "queued", nil, "orders")
+	}
+
+	log := waitForLog(t, w, 1)
+	if len(log) != 1 {
+		t.Fatalf("expected only the dropped message to be logged, got %+v", log)
+	}
+	dropped := log[0]
+	if dropped.Status != "dropped" || dropped.Attempts != 0 || dropped.Error == "" {
+		t.Errorf("unexpected delivery %+v", dropped)
+	}
+	if expected := uint64(webhookQueueSize + 2); dropped.ID != expected {
+		t.Errorf("expected message %d to be dropped, got %d", expected, dropped.ID)
+	}
+}
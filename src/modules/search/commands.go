@@ -0,0 +1,531 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kelvinmwinuka/memstore/src/utils"
+	"net"
+	"strconv"
+	"strings"
+)
+
+type Plugin struct {
+	name        string
+	commands    []utils.Command
+	description string
+}
+
+func (p Plugin) Name() string {
+	return p.name
+}
+
+func (p Plugin) Commands() []utils.Command {
+	return p.commands
+}
+
+func (p Plugin) Description() string {
+	return p.description
+}
+
+func parseSchema(cmd []string) ([]string, []Field, error) {
+	var prefixes []string
+	var fields []Field
+
+	i := 0
+	for i < len(cmd) && !strings.EqualFold(cmd[i], "schema") {
+		switch strings.ToLower(cmd[i]) {
+		case "on":
+			if i+1 >= len(cmd) || !strings.EqualFold(cmd[i+1], "hash") {
+				return nil, nil, errors.New("only HASH indexes are supported")
+			}
+			i += 2
+		case "prefix":
+			if i+1 >= len(cmd) {
+				return nil, nil, errors.New("PREFIX must be followed by the number of prefixes")
+			}
+			count, err := strconv.Atoi(cmd[i+1])
+			if err != nil || count < 0 || i+2+count > len(cmd) {
+				return nil, nil, errors.New("invalid number of prefixes")
+			}
+			prefixes = append(prefixes, cmd[i+2:i+2+count]...)
+			i += 2 + count
+		default:
+			return nil, nil, fmt.Errorf("unknown argument %s", cmd[i])
+		}
+	}
+
+	if i >= len(cmd) {
+		return nil, nil, errors.New("SCHEMA is required")
+	}
+
+	// Parse the field definitions following SCHEMA
+	i += 1
+	for i < len(cmd) {
+		if i+1 >= len(cmd) {
+			return nil, nil, fmt.Errorf("field %s must have a type", cmd[i])
+		}
+
+		field := Field{
+			Name: cmd[i],
+			Type: FieldType(strings.ToUpper(cmd[i+1])),
+		}
+		if !utils.Contains([]FieldType{TextField, TagField, NumericField, VectorField}, field.Type) {
+			return nil, nil, fmt.Errorf("field type must be TEXT, TAG, NUMERIC or VECTOR, got %s", cmd[i+1])
+		}
+		i += 2
+
+		if field.Type == VectorField {
+			options, n, err := parseVectorOptions(cmd[i:])
+			if err != nil {
+				return nil, nil, err
+			}
+			field.Vector = options
+			i += n
+		}
+
+		// Field options
+	options:
+		for i < len(cmd) {
+			switch strings.ToLower(cmd[i]) {
+			case "sortable":
+				if field.Type == VectorField {
+					return nil, nil, errors.New("VECTOR fields cannot be SORTABLE")
+				}
+				field.Sortable = true
+				i += 1
+				continue
+			case "separator":
+				if field.Type != TagField || i+1 >= len(cmd) || len(cmd[i+1]) != 1 {
+					return nil, nil, errors.New("SEPARATOR must be a single character on a TAG field")
+				}
+				field.Separator = cmd[i+1]
+				i += 2
+				continue
+			case "casesensitive":
+				if field.Type != TagField {
+					return nil, nil, errors.New("CASESENSITIVE can only be used on a TAG field")
+				}
+				field.CaseSensitive = true
+				i += 1
+				continue
+			}
+			break options
+		}
+
+		fields = append(fields, field)
+	}
+
+	return prefixes, fields, nil
+}
+
+func handleFTCreate(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) < 5 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	search, ok := server.GetSearch().(*Search)
+	if !ok {
+		return nil, errors.New("could not load search")
+	}
+
+	prefixes, fields, err := parseSchema(cmd[2:])
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := NewIndex(cmd[1], prefixes, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = search.CreateIndex(index); err != nil {
+		return nil, err
+	}
+
+	// Index the hashes that already exist
+	for _, key := range server.GetAllKeys(ctx) {
+		if !index.Covers(key) {
+			continue
+		}
+		if _, err = server.KeyRLock(ctx, key); err != nil {
+			continue
+		}
+		if hash, ok := server.GetValue(key).(map[string]interface{}); ok {
+			index.Add(key, hash)
+		}
+		server.KeyRUnlock(key)
+	}
+
+	return []byte(utils.OK_RESPONSE), nil
+}
+
+func handleFTSearch(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) < 3 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	search, ok := server.GetSearch().(*Search)
+	if !ok {
+		return nil, errors.New("could not load search")
+	}
+
+	index, err := search.GetIndex(cmd[1])
+	if err != nil {
+		return nil, err
+	}
+
+	query := cmd[2]
+	noContent := false
+	var returnFields []string
+	params := make(map[string]string)
+	sortBy := ""
+	descending := false
+	offset, limit := 0, 10
+
+	for i := 3; i < len(cmd); i++ {
+		switch strings.ToLower(cmd[i]) {
+		case "nocontent":
+			noContent = true
+		case "return":
+			if i+1 >= len(cmd) {
+				return nil, errors.New("RETURN must be followed by the number of fields")
+			}
+			count, err := strconv.Atoi(cmd[i+1])
+			if err != nil || count < 0 || i+2+count > len(cmd) {
+				return nil, errors.New("invalid number of RETURN fields")
+			}
+			returnFields = cmd[i+2 : i+2+count]
+			if count == 0 {
+				noContent = true
+			}
+			i += 1 + count
+		case "sortby":
+			if i+1 >= len(cmd) {
+				return nil, errors.New("SORTBY must be followed by a field")
+			}
+			sortBy = cmd[i+1]
+			i += 1
+			if i+1 < len(cmd) && utils.Contains([]string{"asc", "desc"}, strings.ToLower(cmd[i+1])) {
+				descending = strings.EqualFold(cmd[i+1], "desc")
+				i += 1
+			}
+		case "limit":
+			if i+2 >= len(cmd) {
+				return nil, errors.New("LIMIT must be followed by offset and num")
+			}
+			o, err := strconv.Atoi(cmd[i+1])
+			if err != nil || o < 0 {
+				return nil, errors.New("LIMIT offset must be a positive integer")
+			}
+			n, err := strconv.Atoi(cmd[i+2])
+			if err != nil || n < 0 {
+				return nil, errors.New("LIMIT num must be a positive integer")
+			}
+			offset, limit = o, n
+			i += 2
+		case "params":
+			if i+1 >= len(cmd) {
+				return nil, errors.New("PARAMS must be followed by the number of arguments")
+			}
+			count, err := strconv.Atoi(cmd[i+1])
+			if err != nil || count < 0 || count%2 != 0 || i+2+count > len(cmd) {
+				return nil, errors.New("PARAMS must be followed by name value pairs")
+			}
+			for j := i + 2; j < i+2+count; j += 2 {
+				params[cmd[j]] = cmd[j+1]
+			}
+			i += 1 + count
+		case "dialect":
+			// Only one query dialect is supported, the version is accepted for compatibility
+			if i+1 >= len(cmd) {
+				return nil, errors.New("DIALECT must be followed by a version")
+			}
+			i += 1
+		default:
+			return nil, fmt.Errorf("unknown argument %s", cmd[i])
+		}
+	}
+
+	result, err := index.Search(query, params, sortBy, descending)
+	if err != nil {
+		return nil, err
+	}
+	keys := result.Keys
+
+	total := len(keys)
+	if offset > len(keys) {
+		offset = len(keys)
+	}
+	keys = keys[offset:]
+	if limit < len(keys) {
+		keys = keys[:limit]
+	}
+
+	if noContent {
+		res := fmt.Sprintf("*%d\r\n:%d\r\n", len(keys)+1, total)
+		for _, key := range keys {
+			res += fmt.Sprintf("$%d\r\n%s\r\n", len(key), key)
+		}
+		res += "\r\n"
+		return []byte(res), nil
+	}
+
+	res := fmt.Sprintf("*%d\r\n:%d\r\n", len(keys)*2+1, total)
+	for _, key := range keys {
+		res += fmt.Sprintf("$%d\r\n%s\r\n", len(key), key)
+		var extra map[string]string
+		if result.ScoreField != "" {
+			extra = map[string]string{
+				result.ScoreField: strconv.FormatFloat(result.Scores[key], 'f', -1, 64),
+			}
+		}
+		res += documentContent(ctx, server, key, returnFields, extra)
+	}
+	res += "\r\n"
+
+	return []byte(res), nil
+}
+
+// documentContent returns the field/value array of the hash at key. If fields is empty, all fields are returned.
+// Extra fields, such as the distance of KNN results, are returned alongside the fields of the hash.
+func documentContent(ctx context.Context, server utils.Server, key string, fields []string, extra map[string]string) string {
+	if !server.KeyExists(key) {
+		return "*0\r\n"
+	}
+	if _, err := server.KeyRLock(ctx, key); err != nil {
+		return "*0\r\n"
+	}
+	defer server.KeyRUnlock(key)
+
+	hash, ok := server.GetValue(key).(map[string]interface{})
+	if !ok {
+		return "*0\r\n"
+	}
+
+	if len(fields) == 0 {
+		for field := range hash {
+			fields = append(fields, field)
+		}
+		for field := range extra {
+			fields = append(fields, field)
+		}
+	}
+
+	count := 0
+	res := ""
+	for _, field := range fields {
+		s, ok := extra[field]
+		if !ok {
+			value, ok := hash[field]
+			if !ok {
+				continue
+			}
+			s = formatValue(value)
+		}
+		res += fmt.Sprintf("$%d\r\n%s\r\n$%d\r\n%s\r\n", len(field), field, len(s), s)
+		count += 1
+	}
+
+	return fmt.Sprintf("*%d\r\n%s", count*2, res)
+}
+
+func handleFTDropIndex(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) < 2 || len(cmd) > 3 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	deleteDocuments := false
+	if len(cmd) == 3 {
+		if !strings.EqualFold(cmd[2], "dd") {
+			return nil, fmt.Errorf("unknown argument %s", cmd[2])
+		}
+		deleteDocuments = true
+	}
+
+	search, ok := server.GetSearch().(*Search)
+	if !ok {
+		return nil, errors.New("could not load search")
+	}
+
+	index, err := search.DropIndex(cmd[1])
+	if err != nil {
+		return nil, err
+	}
+
+	if deleteDocuments {
+		for _, key := range index.Keys() {
+			if err = server.DeleteKey(ctx, key); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return []byte(utils.OK_RESPONSE), nil
+}
+
+func handleFTInfo(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) != 2 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	search, ok := server.GetSearch().(*Search)
+	if !ok {
+		return nil, errors.New("could not load search")
+	}
+
+	index, err := search.GetIndex(cmd[1])
+	if err != nil {
+		return nil, err
+	}
+
+	res := "*8\r\n"
+	res += fmt.Sprintf("+index_name\r\n$%d\r\n%s\r\n", len(index.Name()), index.Name())
+
+	res += "+index_definition\r\n*4\r\n+key_type\r\n+HASH\r\n+prefixes\r\n"
+	res += fmt.Sprintf("*%d\r\n", len(index.Prefixes()))
+	for _, prefix := range index.Prefixes() {
+		res += fmt.Sprintf("$%d\r\n%s\r\n", len(prefix), prefix)
+	}
+
+	res += fmt.Sprintf("+attributes\r\n*%d\r\n", len(index.Fields()))
+	for _, field := range index.Fields() {
+		var flags []string
+		if field.Sortable {
+			flags = append(flags, "SORTABLE")
+		}
+		if field.Type == TagField {
+			separator := field.Separator
+			if separator == "" {
+				separator = ","
+			}
+			flags = append(flags, "SEPARATOR", separator)
+			if field.CaseSensitive {
+				flags = append(flags, "CASESENSITIVE")
+			}
+		}
+		if field.Type == VectorField {
+			flags = append(flags,
+				"ALGORITHM", string(field.Vector.Algorithm),
+				"DIM", strconv.Itoa(field.Vector.Dim),
+				"DISTANCE_METRIC", string(field.Vector.Metric),
+			)
+			if field.Vector.Algorithm == HNSWAlgorithm {
+				flags = append(flags,
+					"M", strconv.Itoa(field.Vector.M),
+					"EF_CONSTRUCTION", strconv.Itoa(field.Vector.EfConstruction),
+					"EF_RUNTIME", strconv.Itoa(field.Vector.EfRuntime),
+				)
+			}
+		}
+		res += fmt.Sprintf("*%d\r\n", 4+len(flags))
+		res += fmt.Sprintf("+identifier\r\n$%d\r\n%s\r\n+type\r\n+%s\r\n", len(field.Name), field.Name, field.Type)
+		for _, flag := range flags {
+			res += fmt.Sprintf("$%d\r\n%s\r\n", len(flag), flag)
+		}
+	}
+
+	res += fmt.Sprintf("+num_docs\r\n:%d\r\n\r\n", index.NumDocs())
+
+	return []byte(res), nil
+}
+
+func handleFTList(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) != 1 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	search, ok := server.GetSearch().(*Search)
+	if !ok {
+		return nil, errors.New("could not load search")
+	}
+
+	names := search.ListIndexes()
+
+	res := fmt.Sprintf("*%d\r\n", len(names))
+	for _, name := range names {
+		res += fmt.Sprintf("$%d\r\n%s\r\n", len(name), name)
+	}
+	res += "\r\n"
+
+	return []byte(res), nil
+}
+
+func NewModule() Plugin {
+	SearchModule := Plugin{
+		name: "SearchCommands",
+		commands: []utils.Command{
+			{
+				Command:    "ft.create",
+				Categories: []string{utils.SearchCategory, utils.WriteCategory, utils.SlowCategory},
+				Description: `(FT.CREATE index [ON HASH] [PREFIX count prefix [prefix ...]]
+SCHEMA field <TEXT | TAG [SEPARATOR sep] [CASESENSITIVE] | NUMERIC | VECTOR <FLAT | HNSW> nargs attribute value ...> [SORTABLE] [field ...])
+Creates an index over the hashes whose keys start with one of the prefixes.
+VECTOR fields take the attributes TYPE FLOAT32, DIM dim and DISTANCE_METRIC <COSINE | L2 | IP>, and for HNSW optionally M, EF_CONSTRUCTION and EF_RUNTIME.
+Vectors are stored in hash fields either as little endian FLOAT32 blobs or as numbers separated by commas.`,
+				Sync: true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 5 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return []string{}, nil
+				},
+				HandlerFunc: handleFTCreate,
+			},
+			{
+				Command:    "ft.search",
+				Categories: []string{utils.SearchCategory, utils.ReadCategory, utils.SlowCategory},
+				Description: `(FT.SEARCH index query [NOCONTENT] [RETURN count field [field ...]] [SORTBY field [ASC | DESC]] [LIMIT offset num]
+[PARAMS nargs name value [name value ...]] [DIALECT dialect])
+Searches the index and returns the matching hashes. A query of the form "filter=>[KNN k @field $vector [EF_RUNTIME ef] [AS alias]]"
+returns the k documents matching the filter whose vectors are nearest to the vector parameter, ordered by distance.`,
+				Sync: false,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 3 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return []string{}, nil
+				},
+				HandlerFunc: handleFTSearch,
+			},
+			{
+				Command:     "ft.dropindex",
+				Categories:  []string{utils.SearchCategory, utils.WriteCategory, utils.SlowCategory},
+				Description: "(FT.DROPINDEX index [DD]) Deletes the index. If DD is provided, the indexed hashes are deleted as well.",
+				Sync:        true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 2 || len(cmd) > 3 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return []string{}, nil
+				},
+				HandlerFunc: handleFTDropIndex,
+			},
+			{
+				Command:     "ft.info",
+				Categories:  []string{utils.SearchCategory, utils.ReadCategory, utils.SlowCategory},
+				Description: "(FT.INFO index) Returns the definition and statistics of the index.",
+				Sync:        false,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) != 2 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return []string{}, nil
+				},
+				HandlerFunc: handleFTInfo,
+			},
+			{
+				Command:     "ft._list",
+				Categories:  []string{utils.SearchCategory, utils.ReadCategory, utils.SlowCategory},
+				Description: "(FT._LIST) Returns the names of all the indexes.",
+				Sync:        false,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					return []string{}, nil
+				},
+				HandlerFunc: handleFTList,
+			},
+		},
+		description: "Handle secondary index and search commands",
+	}
+	return SearchModule
+}
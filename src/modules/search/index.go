@@ -0,0 +1,650 @@
+package search
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+type FieldType string
+
+const (
+	TextField    FieldType = "TEXT"
+	TagField     FieldType = "TAG"
+	NumericField FieldType = "NUMERIC"
+	VectorField  FieldType = "VECTOR"
+)
+
+type Field struct {
+	Name          string
+	Type          FieldType
+	Sortable      bool
+	Separator     string         // Only applies to TAG fields
+	CaseSensitive bool           // Only applies to TAG fields
+	Vector        *VectorOptions // Only applies to VECTOR fields
+}
+
+// numericEntry is a single value of a NUMERIC field, entries are kept sorted by value for range queries.
+type numericEntry struct {
+	value float64
+	key   string
+}
+
+// Index is a secondary index over the hashes whose keys start with one of the index prefixes.
+type Index struct {
+	rwMutex sync.RWMutex
+
+	name     string
+	prefixes []string
+	fields   []Field
+
+	// The raw values of the indexed fields of each document, used for SORTBY and for removing stale entries
+	documents map[string]map[string]string
+
+	text    map[string]map[string]map[string]int      // field -> term -> key -> term frequency
+	tags    map[string]map[string]map[string]struct{} // field -> tag -> keys
+	numeric map[string][]numericEntry                 // field -> sorted entries
+	vectors map[string]vectorIndex                    // field -> nearest neighbour index
+}
+
+func NewIndex(name string, prefixes []string, fields []Field) (*Index, error) {
+	if len(fields) == 0 {
+		return nil, errors.New("schema must contain at least one field")
+	}
+
+	index := &Index{
+		rwMutex:   sync.RWMutex{},
+		name:      name,
+		prefixes:  prefixes,
+		fields:    fields,
+		documents: make(map[string]map[string]string),
+		text:      make(map[string]map[string]map[string]int),
+		tags:      make(map[string]map[string]map[string]struct{}),
+		numeric:   make(map[string][]numericEntry),
+		vectors:   make(map[string]vectorIndex),
+	}
+
+	for _, field := range fields {
+		switch field.Type {
+		case TextField:
+			index.text[field.Name] = make(map[string]map[string]int)
+		case TagField:
+			index.tags[field.Name] = make(map[string]map[string]struct{})
+		case NumericField:
+			index.numeric[field.Name] = []numericEntry{}
+		case VectorField:
+			if field.Vector == nil {
+				return nil, fmt.Errorf("vector field %s has no options", field.Name)
+			}
+			index.vectors[field.Name] = newVectorIndex(field.Vector)
+		default:
+			return nil, fmt.Errorf("unknown field type %s", field.Type)
+		}
+	}
+
+	return index, nil
+}
+
+func (index *Index) Name() string {
+	return index.name
+}
+
+func (index *Index) Prefixes() []string {
+	return index.prefixes
+}
+
+func (index *Index) Fields() []Field {
+	return index.fields
+}
+
+func (index *Index) NumDocs() int {
+	index.rwMutex.RLock()
+	defer index.rwMutex.RUnlock()
+	return len(index.documents)
+}
+
+// Keys returns the keys of all the documents in the index.
+func (index *Index) Keys() []string {
+	index.rwMutex.RLock()
+	defer index.rwMutex.RUnlock()
+	keys := make([]string, 0, len(index.documents))
+	for key := range index.documents {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func (index *Index) getField(name string) (Field, bool) {
+	for _, field := range index.fields {
+		if strings.EqualFold(field.Name, name) {
+			return field, true
+		}
+	}
+	return Field{}, false
+}
+
+// Covers returns true if the key starts with any of the index's prefixes.
+func (index *Index) Covers(key string) bool {
+	if len(index.prefixes) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(index.prefixes, func(prefix string) bool {
+		return strings.HasPrefix(key, prefix)
+	})
+}
+
+// Add indexes the hash stored at key, replacing any previous entries for the key.
+func (index *Index) Add(key string, hash map[string]interface{}) {
+	index.rwMutex.Lock()
+	defer index.rwMutex.Unlock()
+
+	index.remove(key)
+
+	document := make(map[string]string)
+
+	for _, field := range index.fields {
+		raw, ok := hash[field.Name]
+		if !ok || raw == nil {
+			continue
+		}
+		value := formatValue(raw)
+
+		switch field.Type {
+		case TextField:
+			for _, term := range tokenize(value) {
+				if index.text[field.Name][term] == nil {
+					index.text[field.Name][term] = make(map[string]int)
+				}
+				index.text[field.Name][term][key] += 1
+			}
+		case TagField:
+			for _, tag := range splitTags(value, field) {
+				if index.tags[field.Name][tag] == nil {
+					index.tags[field.Name][tag] = make(map[string]struct{})
+				}
+				index.tags[field.Name][tag][key] = struct{}{}
+			}
+		case NumericField:
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				// Values that are not numbers are skipped for numeric fields
+				continue
+			}
+			entries := index.numeric[field.Name]
+			i := sort.Search(len(entries), func(i int) bool {
+				return entries[i].value >= n
+			})
+			entries = slices.Insert(entries, i, numericEntry{value: n, key: key})
+			index.numeric[field.Name] = entries
+		case VectorField:
+			vector, err := parseVector(value, field.Vector.Dim)
+			if err != nil {
+				// Values that are not vectors of the field's dimension are skipped
+				continue
+			}
+			index.vectors[field.Name].add(key, vector)
+		}
+
+		document[field.Name] = value
+	}
+
+	index.documents[key] = document
+}
+
+// Remove deletes all the index entries of the document at key.
+func (index *Index) Remove(key string) {
+	index.rwMutex.Lock()
+	defer index.rwMutex.Unlock()
+	index.remove(key)
+}
+
+func (index *Index) remove(key string) {
+	document, ok := index.documents[key]
+	if !ok {
+		return
+	}
+
+	for _, field := range index.fields {
+		value, ok := document[field.Name]
+		if !ok {
+			continue
+		}
+
+		switch field.Type {
+		case TextField:
+			for _, term := range tokenize(value) {
+				delete(index.text[field.Name][term], key)
+				if len(index.text[field.Name][term]) == 0 {
+					delete(index.text[field.Name], term)
+				}
+			}
+		case TagField:
+			for _, tag := range splitTags(value, field) {
+				delete(index.tags[field.Name][tag], key)
+				if len(index.tags[field.Name][tag]) == 0 {
+					delete(index.tags[field.Name], tag)
+				}
+			}
+		case NumericField:
+			index.numeric[field.Name] = slices.DeleteFunc(index.numeric[field.Name], func(entry numericEntry) bool {
+				return entry.key == key
+			})
+		case VectorField:
+			index.vectors[field.Name].remove(key)
+		}
+	}
+
+	delete(index.documents, key)
+}
+
+// matchTerm returns the documents containing the term in the field. If field is empty, all TEXT fields are searched.
+// Terms ending with '*' are treated as prefixes.
+func (index *Index) matchTerm(field string, term string) map[string]int {
+	res := make(map[string]int)
+
+	var fields []string
+	if field == "" {
+		for name := range index.text {
+			fields = append(fields, name)
+		}
+	} else {
+		fields = []string{field}
+	}
+
+	prefix := strings.HasSuffix(term, "*")
+	term = strings.ToLower(strings.TrimSuffix(term, "*"))
+
+	for _, name := range fields {
+		terms := index.text[name]
+		if !prefix {
+			for key, frequency := range terms[term] {
+				res[key] += frequency
+			}
+			continue
+		}
+		for t, keys := range terms {
+			if !strings.HasPrefix(t, term) {
+				continue
+			}
+			for key, frequency := range keys {
+				res[key] += frequency
+			}
+		}
+	}
+
+	return res
+}
+
+func (index *Index) matchTags(field Field, tags []string) map[string]struct{} {
+	res := make(map[string]struct{})
+	for _, tag := range tags {
+		if !field.CaseSensitive {
+			tag = strings.ToLower(tag)
+		}
+		for key := range index.tags[field.Name][tag] {
+			res[key] = struct{}{}
+		}
+	}
+	return res
+}
+
+func (index *Index) matchRange(field string, min, max float64, minExclusive, maxExclusive bool) map[string]struct{} {
+	res := make(map[string]struct{})
+	entries := index.numeric[field]
+
+	i := sort.Search(len(entries), func(i int) bool {
+		if minExclusive {
+			return entries[i].value > min
+		}
+		return entries[i].value >= min
+	})
+
+	for ; i < len(entries); i++ {
+		if entries[i].value > max || (maxExclusive && entries[i].value == max) {
+			break
+		}
+		res[entries[i].key] = struct{}{}
+	}
+
+	return res
+}
+
+// sortValue returns the value used to order the document at key when SORTBY is used.
+func (index *Index) sortValue(key string, field Field) (float64, string, bool) {
+	value, ok := index.documents[key][field.Name]
+	if !ok {
+		return 0, "", false
+	}
+	if field.Type == NumericField {
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return 0, "", false
+		}
+		return n, "", true
+	}
+	return 0, strings.ToLower(value), true
+}
+
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+func tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func splitTags(s string, field Field) []string {
+	separator := field.Separator
+	if separator == "" {
+		separator = ","
+	}
+	var tags []string
+	for _, tag := range strings.Split(s, separator) {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+		if !field.CaseSensitive {
+			tag = strings.ToLower(tag)
+		}
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+func parseBound(s string) (float64, bool, error) {
+	exclusive := false
+	if strings.HasPrefix(s, "(") {
+		exclusive = true
+		s = s[1:]
+	}
+	switch strings.ToLower(s) {
+	case "-inf":
+		return math.Inf(-1), exclusive, nil
+	case "+inf", "inf":
+		return math.Inf(1), exclusive, nil
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid numeric bound %s", s)
+	}
+	return n, exclusive, nil
+}
+
+// Search holds all the indexes defined on the server.
+type Search struct {
+	rwMutex sync.RWMutex
+	indexes map[string]*Index
+}
+
+func NewSearch() *Search {
+	return &Search{
+		rwMutex: sync.RWMutex{},
+		indexes: make(map[string]*Index),
+	}
+}
+
+func (search *Search) CreateIndex(index *Index) error {
+	search.rwMutex.Lock()
+	defer search.rwMutex.Unlock()
+
+	if _, ok := search.indexes[index.name]; ok {
+		return fmt.Errorf("index %s already exists", index.name)
+	}
+
+	search.indexes[index.name] = index
+	return nil
+}
+
+func (search *Search) GetIndex(name string) (*Index, error) {
+	search.rwMutex.RLock()
+	defer search.rwMutex.RUnlock()
+
+	index, ok := search.indexes[name]
+	if !ok {
+		return nil, fmt.Errorf("index %s does not exist", name)
+	}
+	return index, nil
+}
+
+func (search *Search) DropIndex(name string) (*Index, error) {
+	search.rwMutex.Lock()
+	defer search.rwMutex.Unlock()
+
+	index, ok := search.indexes[name]
+	if !ok {
+		return nil, fmt.Errorf("index %s does not exist", name)
+	}
+	delete(search.indexes, name)
+	return index, nil
+}
+
+func (search *Search) ListIndexes() []string {
+	search.rwMutex.RLock()
+	defer search.rwMutex.RUnlock()
+
+	var names []string
+	for name := range search.indexes {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// indexDefinition is the encoding of an index in a snapshot. Only the definition is stored, since the documents
+// are indexed again as the keys are restored.
+type indexDefinition struct {
+	Name     string   `json:"Name"`
+	Prefixes []string `json:"Prefixes"`
+	Fields   []Field  `json:"Fields"`
+}
+
+// Snapshot encodes the definitions of the indexes.
+func (search *Search) Snapshot() ([]byte, error) {
+	search.rwMutex.RLock()
+	defer search.rwMutex.RUnlock()
+
+	definitions := make([]indexDefinition, 0, len(search.indexes))
+	for _, index := range search.indexes {
+		definitions = append(definitions, indexDefinition{Name: index.name, Prefixes: index.prefixes, Fields: index.fields})
+	}
+	slices.SortFunc(definitions, func(a, b indexDefinition) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return json.Marshal(definitions)
+}
+
+// Restore replaces the indexes with empty ones created from the definitions encoded by Snapshot.
+// The indexes are filled as the keys are restored and written to the store.
+func (search *Search) Restore(b []byte) error {
+	var definitions []indexDefinition
+	if err := json.Unmarshal(b, &definitions); err != nil {
+		return err
+	}
+
+	indexes := make(map[string]*Index, len(definitions))
+	for _, definition := range definitions {
+		index, err := NewIndex(definition.Name, definition.Prefixes, definition.Fields)
+		if err != nil {
+			return fmt.Errorf("could not restore index %s: %v", definition.Name, err)
+		}
+		indexes[definition.Name] = index
+	}
+
+	search.rwMutex.Lock()
+	defer search.rwMutex.Unlock()
+	search.indexes = indexes
+
+	return nil
+}
+
+// IndexKey updates every index covering key with the key's new value.
+// It is called whenever a value is written to the store. Values that are not hashes are removed from the indexes.
+func (search *Search) IndexKey(key string, value interface{}) {
+	search.rwMutex.RLock()
+	defer search.rwMutex.RUnlock()
+
+	for _, index := range search.indexes {
+		if !index.Covers(key) {
+			continue
+		}
+		hash, ok := value.(map[string]interface{})
+		if !ok {
+			index.Remove(key)
+			continue
+		}
+		index.Add(key, hash)
+	}
+}
+
+// RemoveKey removes the key from all indexes. It is called whenever a key is deleted from the store.
+func (search *Search) RemoveKey(key string) {
+	search.rwMutex.RLock()
+	defer search.rwMutex.RUnlock()
+
+	for _, index := range search.indexes {
+		index.Remove(key)
+	}
+}
+
+// SearchResult holds the keys of the documents matching a query.
+type SearchResult struct {
+	Keys       []string
+	ScoreField string             // Name of the distance field of KNN queries
+	Scores     map[string]float64 // Distance of each key from the KNN query vector
+}
+
+// Search evaluates the query and returns the keys of the matching documents. Parameters referenced
+// with $name in a KNN clause are read from params. Results are ordered by the sortBy field if it is provided,
+// otherwise by distance for KNN queries and by relevance for other queries.
+func (index *Index) Search(query string, params map[string]string, sortBy string, descending bool) (SearchResult, error) {
+	index.rwMutex.RLock()
+	defer index.rwMutex.RUnlock()
+
+	filter, knnClause, err := splitKNN(query)
+	if err != nil {
+		return SearchResult{}, err
+	}
+
+	node, err := parseQuery(index, filter)
+	if err != nil {
+		return SearchResult{}, err
+	}
+
+	matches := node.eval(index)
+
+	if knnClause != "" {
+		knn, err := parseKNN(index, knnClause, params)
+		if err != nil {
+			return SearchResult{}, err
+		}
+
+		// The query vector is only compared against the documents that pass the filter
+		allowed := matches
+		if _, ok := node.(allNode); ok {
+			allowed = nil
+		}
+
+		result := SearchResult{ScoreField: knn.alias, Scores: make(map[string]float64)}
+		for _, neighbour := range index.vectors[knn.field.Name].search(knn.vector, knn.k, knn.efRuntime, allowed) {
+			result.Keys = append(result.Keys, neighbour.key)
+			result.Scores[neighbour.key] = neighbour.distance
+		}
+
+		if sortBy != "" && sortBy != knn.alias {
+			if err = index.sortKeys(result.Keys, sortBy, descending); err != nil {
+				return SearchResult{}, err
+			}
+		} else if descending {
+			slices.Reverse(result.Keys)
+		}
+
+		return result, nil
+	}
+
+	keys := make([]string, 0, len(matches))
+	for key := range matches {
+		keys = append(keys, key)
+	}
+
+	if sortBy == "" {
+		slices.SortFunc(keys, func(a, b string) int {
+			if matches[a] != matches[b] {
+				if matches[a] > matches[b] {
+					return -1
+				}
+				return 1
+			}
+			return strings.Compare(a, b)
+		})
+		return SearchResult{Keys: keys}, nil
+	}
+
+	if err = index.sortKeys(keys, sortBy, descending); err != nil {
+		return SearchResult{}, err
+	}
+
+	return SearchResult{Keys: keys}, nil
+}
+
+// sortKeys orders the keys by the value of the sortBy field.
+func (index *Index) sortKeys(keys []string, sortBy string, descending bool) error {
+	field, ok := index.getField(sortBy)
+	if !ok {
+		return fmt.Errorf("unknown field %s", sortBy)
+	}
+	if field.Type == VectorField {
+		return fmt.Errorf("cannot sort by VECTOR field %s", field.Name)
+	}
+
+	slices.SortStableFunc(keys, func(a, b string) int {
+		aNum, aStr, aOk := index.sortValue(a, field)
+		bNum, bStr, bOk := index.sortValue(b, field)
+		// Documents without a value for the sort field always come last
+		if !aOk || !bOk {
+			if aOk == bOk {
+				return strings.Compare(a, b)
+			}
+			if aOk {
+				return -1
+			}
+			return 1
+		}
+		c := 0
+		if field.Type == NumericField {
+			switch {
+			case aNum < bNum:
+				c = -1
+			case aNum > bNum:
+				c = 1
+			}
+		} else {
+			c = strings.Compare(aStr, bStr)
+		}
+		if c == 0 {
+			c = strings.Compare(a, b)
+		}
+		if descending {
+			return -c
+		}
+		return c
+	})
+
+	return nil
+}
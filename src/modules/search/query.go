@@ -0,0 +1,479 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// queryNode is a node of a parsed FT.SEARCH query.
+// Evaluating a node returns the matching document keys mapped to their relevance score.
+type queryNode interface {
+	eval(index *Index) map[string]float64
+}
+
+type allNode struct{}
+
+func (n allNode) eval(index *Index) map[string]float64 {
+	res := make(map[string]float64, len(index.documents))
+	for key := range index.documents {
+		res[key] = 0
+	}
+	return res
+}
+
+// termNode matches a word in a TEXT field. If field is empty, every TEXT field is searched.
+type termNode struct {
+	field string
+	term  string
+}
+
+func (n termNode) eval(index *Index) map[string]float64 {
+	res := make(map[string]float64)
+	for key, frequency := range index.matchTerm(n.field, n.term) {
+		res[key] = float64(frequency)
+	}
+	return res
+}
+
+type tagNode struct {
+	field Field
+	tags  []string
+}
+
+func (n tagNode) eval(index *Index) map[string]float64 {
+	res := make(map[string]float64)
+	for key := range index.matchTags(n.field, n.tags) {
+		res[key] = 1
+	}
+	return res
+}
+
+type rangeNode struct {
+	field        string
+	min, max     float64
+	minExclusive bool
+	maxExclusive bool
+}
+
+func (n rangeNode) eval(index *Index) map[string]float64 {
+	res := make(map[string]float64)
+	for key := range index.matchRange(n.field, n.min, n.max, n.minExclusive, n.maxExclusive) {
+		res[key] = 1
+	}
+	return res
+}
+
+type andNode struct {
+	children []queryNode
+}
+
+func (n andNode) eval(index *Index) map[string]float64 {
+	res := n.children[0].eval(index)
+	for _, child := range n.children[1:] {
+		if len(res) == 0 {
+			break
+		}
+		other := child.eval(index)
+		for key, score := range res {
+			s, ok := other[key]
+			if !ok {
+				delete(res, key)
+				continue
+			}
+			res[key] = score + s
+		}
+	}
+	return res
+}
+
+type orNode struct {
+	children []queryNode
+}
+
+func (n orNode) eval(index *Index) map[string]float64 {
+	res := make(map[string]float64)
+	for _, child := range n.children {
+		for key, score := range child.eval(index) {
+			res[key] += score
+		}
+	}
+	return res
+}
+
+type notNode struct {
+	child queryNode
+}
+
+func (n notNode) eval(index *Index) map[string]float64 {
+	excluded := n.child.eval(index)
+	res := make(map[string]float64)
+	for key := range index.documents {
+		if _, ok := excluded[key]; !ok {
+			res[key] = 0
+		}
+	}
+	return res
+}
+
+type queryParser struct {
+	index *Index
+	s     string
+	pos   int
+}
+
+// parseQuery parses the query language used by FT.SEARCH:
+//
+//	hello world              documents containing both words in any TEXT field
+//	hello | world            documents containing either word
+//	-hello                   documents that do not contain the word
+//	hel*                     prefix match
+//	"hello world"            documents containing all the words of the phrase
+//	@title:hello             word in a specific TEXT field
+//	@title:(hello | world)   group of terms applied to a specific TEXT field
+//	@tags:{red | blue}       documents with any of the tags in a TAG field
+//	@price:[10 (20]          numeric range, '(' makes a bound exclusive, -inf and +inf are allowed
+//	*                        every document in the index
+//
+// A query can be followed by a KNN clause, see parseKNN.
+func parseQuery(index *Index, query string) (queryNode, error) {
+	p := &queryParser{index: index, s: query}
+
+	p.skipSpace()
+	if p.pos == len(p.s) {
+		return nil, errors.New("query cannot be empty")
+	}
+
+	node, err := p.parseOr("")
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipSpace()
+	if p.pos != len(p.s) {
+		return nil, fmt.Errorf("syntax error at offset %d near %s", p.pos, p.s[p.pos:])
+	}
+
+	return node, nil
+}
+
+func (p *queryParser) skipSpace() {
+	for p.pos < len(p.s) && p.s[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+func (p *queryParser) peek() byte {
+	p.skipSpace()
+	if p.pos >= len(p.s) {
+		return 0
+	}
+	return p.s[p.pos]
+}
+
+func (p *queryParser) parseOr(field string) (queryNode, error) {
+	var children []queryNode
+
+	node, err := p.parseAnd(field)
+	if err != nil {
+		return nil, err
+	}
+	children = append(children, node)
+
+	for p.peek() == '|' {
+		p.pos++
+		node, err = p.parseAnd(field)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, node)
+	}
+
+	if len(children) == 1 {
+		return children[0], nil
+	}
+	return orNode{children: children}, nil
+}
+
+func (p *queryParser) parseAnd(field string) (queryNode, error) {
+	var children []queryNode
+
+	for {
+		c := p.peek()
+		if c == 0 || c == '|' || c == ')' {
+			break
+		}
+		node, err := p.parseUnary(field)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, node)
+	}
+
+	if len(children) == 0 {
+		return nil, fmt.Errorf("syntax error at offset %d", p.pos)
+	}
+	if len(children) == 1 {
+		return children[0], nil
+	}
+	return andNode{children: children}, nil
+}
+
+func (p *queryParser) parseUnary(field string) (queryNode, error) {
+	if p.peek() == '-' {
+		p.pos++
+		child, err := p.parseUnary(field)
+		if err != nil {
+			return nil, err
+		}
+		return notNode{child: child}, nil
+	}
+	return p.parseAtom(field)
+}
+
+func (p *queryParser) parseAtom(field string) (queryNode, error) {
+	switch p.peek() {
+	case '(':
+		p.pos++
+		node, err := p.parseOr(field)
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, errors.New("syntax error, expected ')'")
+		}
+		p.pos++
+		return node, nil
+
+	case '@':
+		if field != "" {
+			return nil, errors.New("syntax error, field modifiers cannot be nested")
+		}
+		p.pos++
+		return p.parseFieldExpression()
+
+	case '"':
+		return p.parsePhrase(field)
+
+	case '*':
+		if field == "" && (p.pos+1 == len(p.s) || p.s[p.pos+1] == ' ' || p.s[p.pos+1] == ')') {
+			p.pos++
+			return allNode{}, nil
+		}
+	}
+
+	term := p.readWord()
+	if term == "" {
+		return nil, fmt.Errorf("syntax error at offset %d", p.pos)
+	}
+	return termNode{field: field, term: term}, nil
+}
+
+func (p *queryParser) readWord() string {
+	start := p.pos
+	for p.pos < len(p.s) && !strings.ContainsRune(" ()|@\"{}[]:", rune(p.s[p.pos])) {
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+// parsePhrase parses a quoted phrase. Each word in the phrase must be present in the document.
+func (p *queryParser) parsePhrase(field string) (queryNode, error) {
+	p.pos++
+	end := strings.IndexByte(p.s[p.pos:], '"')
+	if end == -1 {
+		return nil, errors.New("syntax error, unterminated phrase")
+	}
+	words := tokenize(p.s[p.pos : p.pos+end])
+	p.pos += end + 1
+
+	if len(words) == 0 {
+		return nil, errors.New("syntax error, empty phrase")
+	}
+
+	var children []queryNode
+	for _, word := range words {
+		children = append(children, termNode{field: field, term: word})
+	}
+	if len(children) == 1 {
+		return children[0], nil
+	}
+	return andNode{children: children}, nil
+}
+
+func (p *queryParser) parseFieldExpression() (queryNode, error) {
+	name := p.readWord()
+	if name == "" || p.pos >= len(p.s) || p.s[p.pos] != ':' {
+		return nil, errors.New("syntax error, expected @field:")
+	}
+	p.pos++
+
+	field, ok := p.index.getField(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown field %s", name)
+	}
+
+	switch field.Type {
+	case TagField:
+		if p.peek() != '{' {
+			return nil, fmt.Errorf("syntax error, TAG field %s must be queried with {tag | ...}", field.Name)
+		}
+		p.pos++
+		end := strings.IndexByte(p.s[p.pos:], '}')
+		if end == -1 {
+			return nil, errors.New("syntax error, expected '}'")
+		}
+		var tags []string
+		for _, tag := range strings.Split(p.s[p.pos:p.pos+end], "|") {
+			tag = strings.TrimSpace(tag)
+			if tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+		p.pos += end + 1
+		return tagNode{field: field, tags: tags}, nil
+
+	case NumericField:
+		if p.peek() != '[' {
+			return nil, fmt.Errorf("syntax error, NUMERIC field %s must be queried with [min max]", field.Name)
+		}
+		p.pos++
+		end := strings.IndexByte(p.s[p.pos:], ']')
+		if end == -1 {
+			return nil, errors.New("syntax error, expected ']'")
+		}
+		bounds := strings.Fields(p.s[p.pos : p.pos+end])
+		p.pos += end + 1
+		if len(bounds) != 2 {
+			return nil, errors.New("syntax error, numeric range must have a min and max")
+		}
+		min, minExclusive, err := parseBound(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+		max, maxExclusive, err := parseBound(bounds[1])
+		if err != nil {
+			return nil, err
+		}
+		return rangeNode{
+			field:        field.Name,
+			min:          min,
+			max:          max,
+			minExclusive: minExclusive,
+			maxExclusive: maxExclusive,
+		}, nil
+
+	case VectorField:
+		return nil, fmt.Errorf("VECTOR field %s can only be queried with KNN", field.Name)
+
+	default:
+		return p.parseUnary(field.Name)
+	}
+}
+
+// splitKNN splits a query of the form filter=>[KNN ...] into the filter and the contents of the KNN clause.
+// The KNN clause is empty if the query does not have one.
+func splitKNN(query string) (string, string, error) {
+	i := strings.Index(query, "=>")
+	if i == -1 {
+		return query, "", nil
+	}
+
+	filter := strings.TrimSpace(query[:i])
+	clause := strings.TrimSpace(query[i+2:])
+	if filter == "" {
+		return "", "", errors.New("syntax error, KNN must follow a filter such as *")
+	}
+	if !strings.HasPrefix(clause, "[") || !strings.HasSuffix(clause, "]") {
+		return "", "", errors.New("syntax error, KNN clause must be enclosed in [ ]")
+	}
+
+	return filter, clause[1 : len(clause)-1], nil
+}
+
+type knnQuery struct {
+	k         int
+	field     Field
+	vector    []float32
+	efRuntime int
+	alias     string
+}
+
+// parseKNN parses the clause KNN k @field vector [EF_RUNTIME ef] [AS alias]. Any argument
+// starting with $ is replaced by the parameter of the same name. The distance of each result is
+// returned in the alias field, which defaults to __field_score.
+func parseKNN(index *Index, clause string, params map[string]string) (knnQuery, error) {
+	args := strings.Fields(clause)
+	if len(args) < 4 || !strings.EqualFold(args[0], "knn") {
+		return knnQuery{}, errors.New("syntax error, expected KNN k @field vector")
+	}
+
+	resolve := func(arg string) (string, error) {
+		if !strings.HasPrefix(arg, "$") {
+			return arg, nil
+		}
+		value, ok := params[arg[1:]]
+		if !ok {
+			return "", fmt.Errorf("no such parameter %s", arg[1:])
+		}
+		return value, nil
+	}
+
+	s, err := resolve(args[1])
+	if err != nil {
+		return knnQuery{}, err
+	}
+	k, err := strconv.Atoi(s)
+	if err != nil || k < 1 {
+		return knnQuery{}, errors.New("KNN k must be a positive integer")
+	}
+
+	if !strings.HasPrefix(args[2], "@") {
+		return knnQuery{}, errors.New("syntax error, expected @field after KNN k")
+	}
+	field, ok := index.getField(args[2][1:])
+	if !ok {
+		return knnQuery{}, fmt.Errorf("unknown field %s", args[2][1:])
+	}
+	if field.Type != VectorField {
+		return knnQuery{}, fmt.Errorf("field %s is not a VECTOR field", field.Name)
+	}
+
+	if s, err = resolve(args[3]); err != nil {
+		return knnQuery{}, err
+	}
+	vector, err := parseVector(s, field.Vector.Dim)
+	if err != nil {
+		return knnQuery{}, err
+	}
+
+	query := knnQuery{
+		k:         k,
+		field:     field,
+		vector:    vector,
+		efRuntime: field.Vector.EfRuntime,
+		alias:     fmt.Sprintf("__%s_score", field.Name),
+	}
+
+	for i := 4; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return knnQuery{}, fmt.Errorf("%s must be followed by a value", args[i])
+		}
+		switch strings.ToUpper(args[i]) {
+		case "EF_RUNTIME":
+			if s, err = resolve(args[i+1]); err != nil {
+				return knnQuery{}, err
+			}
+			if query.efRuntime, err = strconv.Atoi(s); err != nil || query.efRuntime < 1 {
+				return knnQuery{}, errors.New("EF_RUNTIME must be a positive integer")
+			}
+		case "AS":
+			query.alias = args[i+1]
+		default:
+			return knnQuery{}, fmt.Errorf("unknown KNN argument %s", args[i])
+		}
+	}
+
+	return query, nil
+}
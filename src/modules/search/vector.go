@@ -0,0 +1,545 @@
+package search
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type VectorAlgorithm string
+
+const (
+	FlatAlgorithm VectorAlgorithm = "FLAT"
+	HNSWAlgorithm VectorAlgorithm = "HNSW"
+)
+
+type DistanceMetric string
+
+const (
+	CosineMetric       DistanceMetric = "COSINE"
+	L2Metric           DistanceMetric = "L2"
+	InnerProductMetric DistanceMetric = "IP"
+)
+
+const (
+	DefaultM              = 16
+	DefaultEfConstruction = 200
+	DefaultEfRuntime      = 10
+
+	maxVectorDim = 32768
+	maxHNSWLevel = 16
+)
+
+// VectorOptions are the attributes of a VECTOR field.
+type VectorOptions struct {
+	Algorithm      VectorAlgorithm
+	Dim            int
+	Metric         DistanceMetric
+	M              int // Only applies to HNSW
+	EfConstruction int // Only applies to HNSW
+	EfRuntime      int // Only applies to HNSW
+}
+
+// parseVectorOptions parses the attributes following VECTOR in a schema:
+// FLAT|HNSW nargs TYPE FLOAT32 DIM dim DISTANCE_METRIC COSINE|L2|IP [M m] [EF_CONSTRUCTION ef] [EF_RUNTIME ef].
+// Returns the options and the number of arguments consumed.
+func parseVectorOptions(args []string) (*VectorOptions, int, error) {
+	if len(args) < 2 {
+		return nil, 0, errors.New("VECTOR must be followed by an algorithm and the number of attributes")
+	}
+
+	options := &VectorOptions{
+		Algorithm:      VectorAlgorithm(strings.ToUpper(args[0])),
+		M:              DefaultM,
+		EfConstruction: DefaultEfConstruction,
+		EfRuntime:      DefaultEfRuntime,
+	}
+	if options.Algorithm != FlatAlgorithm && options.Algorithm != HNSWAlgorithm {
+		return nil, 0, fmt.Errorf("vector algorithm must be FLAT or HNSW, got %s", args[0])
+	}
+
+	nargs, err := strconv.Atoi(args[1])
+	if err != nil || nargs < 0 || nargs%2 != 0 || 2+nargs > len(args) {
+		return nil, 0, errors.New("invalid number of vector attributes")
+	}
+
+	for i := 2; i < 2+nargs; i += 2 {
+		name, value := strings.ToUpper(args[i]), args[i+1]
+		positive := func() (int, error) {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("%s must be a positive integer", name)
+			}
+			return n, nil
+		}
+		switch {
+		case name == "TYPE":
+			if !strings.EqualFold(value, "float32") {
+				return nil, 0, errors.New("only FLOAT32 vectors are supported")
+			}
+		case name == "DIM":
+			if options.Dim, err = positive(); err != nil {
+				return nil, 0, err
+			}
+			if options.Dim > maxVectorDim {
+				return nil, 0, fmt.Errorf("DIM must not be greater than %d", maxVectorDim)
+			}
+		case name == "DISTANCE_METRIC":
+			options.Metric = DistanceMetric(strings.ToUpper(value))
+			if !slices.Contains([]DistanceMetric{CosineMetric, L2Metric, InnerProductMetric}, options.Metric) {
+				return nil, 0, fmt.Errorf("distance metric must be COSINE, L2 or IP, got %s", value)
+			}
+		case name == "M" && options.Algorithm == HNSWAlgorithm:
+			if options.M, err = positive(); err != nil {
+				return nil, 0, err
+			}
+			if options.M < 2 || options.M > 512 {
+				return nil, 0, errors.New("M must be between 2 and 512")
+			}
+		case name == "EF_CONSTRUCTION" && options.Algorithm == HNSWAlgorithm:
+			if options.EfConstruction, err = positive(); err != nil {
+				return nil, 0, err
+			}
+		case name == "EF_RUNTIME" && options.Algorithm == HNSWAlgorithm:
+			if options.EfRuntime, err = positive(); err != nil {
+				return nil, 0, err
+			}
+		default:
+			return nil, 0, fmt.Errorf("unknown vector attribute %s", args[i])
+		}
+	}
+
+	if options.Dim == 0 || options.Metric == "" {
+		return nil, 0, errors.New("vector fields require DIM and DISTANCE_METRIC")
+	}
+
+	return options, 2 + nargs, nil
+}
+
+// parseVector reads a vector of dim values. The value can either be a list of numbers separated
+// by commas or spaces, or a blob of little endian FLOAT32 values.
+func parseVector(s string, dim int) ([]float32, error) {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '[' || r == ']'
+	})
+	if len(fields) == dim {
+		vector := make([]float32, dim)
+		ok := true
+		for i, field := range fields {
+			f, err := strconv.ParseFloat(field, 32)
+			if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+				ok = false
+				break
+			}
+			vector[i] = float32(f)
+		}
+		if ok {
+			return vector, nil
+		}
+	}
+
+	if len(s) == dim*4 {
+		vector := make([]float32, dim)
+		for i := range vector {
+			vector[i] = math.Float32frombits(binary.LittleEndian.Uint32([]byte(s[i*4 : i*4+4])))
+			if math.IsNaN(float64(vector[i])) || math.IsInf(float64(vector[i]), 0) {
+				return nil, errors.New("vector values must be finite")
+			}
+		}
+		return vector, nil
+	}
+
+	return nil, fmt.Errorf("expected a vector of %d FLOAT32 values", dim)
+}
+
+// distance returns the distance between two vectors, lower is closer. L2 is the squared euclidean
+// distance, IP is 1 minus the inner product and COSINE is 1 minus the cosine similarity.
+func distance(metric DistanceMetric, a, b []float32) float64 {
+	switch metric {
+	case L2Metric:
+		var sum float64
+		for i := range a {
+			d := float64(a[i]) - float64(b[i])
+			sum += d * d
+		}
+		return sum
+	case InnerProductMetric:
+		var dot float64
+		for i := range a {
+			dot += float64(a[i]) * float64(b[i])
+		}
+		return 1 - dot
+	default:
+		var dot, normA, normB float64
+		for i := range a {
+			dot += float64(a[i]) * float64(b[i])
+			normA += float64(a[i]) * float64(a[i])
+			normB += float64(b[i]) * float64(b[i])
+		}
+		if normA == 0 || normB == 0 {
+			return 1
+		}
+		return 1 - dot/(math.Sqrt(normA)*math.Sqrt(normB))
+	}
+}
+
+type vectorResult struct {
+	key      string
+	distance float64
+}
+
+func compareResults(a, b vectorResult) int {
+	switch {
+	case a.distance < b.distance:
+		return -1
+	case a.distance > b.distance:
+		return 1
+	}
+	return strings.Compare(a.key, b.key)
+}
+
+// vectorIndex finds the nearest neighbours of a vector among the vectors of a field.
+type vectorIndex interface {
+	add(key string, vector []float32)
+	remove(key string)
+	// search returns up to k of the nearest vectors ordered by distance. If allowed is not nil,
+	// only the keys in allowed are returned.
+	search(query []float32, k int, efRuntime int, allowed map[string]float64) []vectorResult
+}
+
+func newVectorIndex(options *VectorOptions) vectorIndex {
+	if options.Algorithm == HNSWAlgorithm {
+		return newHNSWIndex(options)
+	}
+	return &flatIndex{metric: options.Metric, vectors: make(map[string][]float32)}
+}
+
+// bruteForce compares the query against every vector in the candidates.
+func bruteForce(metric DistanceMetric, query []float32, k int, candidates map[string][]float32, allowed map[string]float64) []vectorResult {
+	var results []vectorResult
+	if allowed != nil && len(allowed) < len(candidates) {
+		for key := range allowed {
+			if vector, ok := candidates[key]; ok {
+				results = append(results, vectorResult{key: key, distance: distance(metric, query, vector)})
+			}
+		}
+	} else {
+		for key, vector := range candidates {
+			if allowed != nil {
+				if _, ok := allowed[key]; !ok {
+					continue
+				}
+			}
+			results = append(results, vectorResult{key: key, distance: distance(metric, query, vector)})
+		}
+	}
+	slices.SortFunc(results, compareResults)
+	if len(results) > k {
+		results = results[:k]
+	}
+	return results
+}
+
+// flatIndex is an exact index that compares the query against every vector.
+type flatIndex struct {
+	metric  DistanceMetric
+	vectors map[string][]float32
+}
+
+func (index *flatIndex) add(key string, vector []float32) {
+	index.vectors[key] = vector
+}
+
+func (index *flatIndex) remove(key string) {
+	delete(index.vectors, key)
+}
+
+func (index *flatIndex) search(query []float32, k int, efRuntime int, allowed map[string]float64) []vectorResult {
+	return bruteForce(index.metric, query, k, index.vectors, allowed)
+}
+
+type hnswNode struct {
+	key       string
+	vector    []float32
+	neighbors [][]*hnswNode            // Outgoing links of each level
+	inbound   []map[*hnswNode]struct{} // Nodes that link to this node at each level
+}
+
+func (node *hnswNode) level() int {
+	return len(node.neighbors) - 1
+}
+
+// hnswIndex is an approximate index based on Hierarchical Navigable Small World graphs.
+// Node levels are derived from a hash of the key rather than drawn at random, so that every node
+// in the cluster that applies the same writes builds the same graph.
+type hnswIndex struct {
+	metric         DistanceMetric
+	m              int
+	efConstruction int
+	levelFactor    float64
+	nodes          map[string]*hnswNode
+	vectors        map[string][]float32
+	entry          *hnswNode
+}
+
+func newHNSWIndex(options *VectorOptions) *hnswIndex {
+	return &hnswIndex{
+		metric:         options.Metric,
+		m:              options.M,
+		efConstruction: options.EfConstruction,
+		levelFactor:    1 / math.Log(float64(options.M)),
+		nodes:          make(map[string]*hnswNode),
+		vectors:        make(map[string][]float32),
+	}
+}
+
+func (index *hnswIndex) maxConnections(level int) int {
+	if level == 0 {
+		return index.m * 2
+	}
+	return index.m
+}
+
+func (index *hnswIndex) randomLevel(key string) int {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	u := (float64(h.Sum64()>>11) + 1) / (1 << 53)
+	return min(int(-math.Log(u)*index.levelFactor), maxHNSWLevel)
+}
+
+func (index *hnswIndex) distance(query []float32, node *hnswNode) float64 {
+	return distance(index.metric, query, node.vector)
+}
+
+// setNeighbors replaces the links of the node at the level, keeping the inbound links up to date.
+func (index *hnswIndex) setNeighbors(node *hnswNode, level int, neighbors []*hnswNode) {
+	for _, neighbor := range node.neighbors[level] {
+		delete(neighbor.inbound[level], node)
+	}
+	node.neighbors[level] = neighbors
+	for _, neighbor := range neighbors {
+		neighbor.inbound[level][node] = struct{}{}
+	}
+}
+
+// closest returns the closest n candidates to the vector. Ties are broken by key so that the
+// result does not depend on the order of the candidates.
+func (index *hnswIndex) closest(vector []float32, candidates []*hnswNode, n int) []*hnswNode {
+	results := make([]vectorResult, len(candidates))
+	byKey := make(map[string]*hnswNode, len(candidates))
+	for i, candidate := range candidates {
+		results[i] = vectorResult{key: candidate.key, distance: index.distance(vector, candidate)}
+		byKey[candidate.key] = candidate
+	}
+	slices.SortFunc(results, compareResults)
+	results = slices.CompactFunc(results, func(a, b vectorResult) bool { return a.key == b.key })
+	if len(results) > n {
+		results = results[:n]
+	}
+	nodes := make([]*hnswNode, len(results))
+	for i, result := range results {
+		nodes[i] = byKey[result.key]
+	}
+	return nodes
+}
+
+func (index *hnswIndex) add(key string, vector []float32) {
+	index.remove(key)
+
+	level := index.randomLevel(key)
+	node := &hnswNode{
+		key:       key,
+		vector:    vector,
+		neighbors: make([][]*hnswNode, level+1),
+		inbound:   make([]map[*hnswNode]struct{}, level+1),
+	}
+	for l := range node.inbound {
+		node.inbound[l] = make(map[*hnswNode]struct{})
+	}
+	index.nodes[key] = node
+	index.vectors[key] = vector
+
+	if index.entry == nil {
+		index.entry = node
+		return
+	}
+
+	entry := index.entry
+	for l := entry.level(); l > level; l-- {
+		entry = index.searchLayer(vector, entry, 1, l, nil)[0].node
+	}
+
+	for l := min(level, index.entry.level()); l >= 0; l-- {
+		candidates := index.searchLayer(vector, entry, index.efConstruction, l, nil)
+		nodes := make([]*hnswNode, len(candidates))
+		for i, candidate := range candidates {
+			nodes[i] = candidate.node
+		}
+		index.setNeighbors(node, l, index.closest(vector, nodes, index.m))
+		for _, neighbor := range node.neighbors[l] {
+			links := append(slices.Clone(neighbor.neighbors[l]), node)
+			if len(links) > index.maxConnections(l) {
+				links = index.closest(neighbor.vector, links, index.maxConnections(l))
+			}
+			index.setNeighbors(neighbor, l, links)
+		}
+		entry = candidates[0].node
+	}
+
+	if level > index.entry.level() {
+		index.entry = node
+	}
+}
+
+func (index *hnswIndex) remove(key string) {
+	node, ok := index.nodes[key]
+	if !ok {
+		return
+	}
+	delete(index.nodes, key)
+	delete(index.vectors, key)
+
+	for l := range node.neighbors {
+		// Reconnect the nodes that linked to the removed node using the removed node's links
+		var affected []*hnswNode
+		for neighbor := range node.inbound[l] {
+			affected = append(affected, neighbor)
+		}
+		slices.SortFunc(affected, func(a, b *hnswNode) int { return strings.Compare(a.key, b.key) })
+
+		for _, neighbor := range affected {
+			candidates := slices.DeleteFunc(slices.Clone(neighbor.neighbors[l]), func(n *hnswNode) bool { return n == node })
+			for _, n := range node.neighbors[l] {
+				if n != neighbor && n != node {
+					candidates = append(candidates, n)
+				}
+			}
+			index.setNeighbors(neighbor, l, index.closest(neighbor.vector, candidates, index.maxConnections(l)))
+		}
+		index.setNeighbors(node, l, nil)
+	}
+
+	if index.entry == node {
+		index.entry = nil
+		for _, n := range index.nodes {
+			if index.entry == nil || n.level() > index.entry.level() ||
+				(n.level() == index.entry.level() && n.key < index.entry.key) {
+				index.entry = n
+			}
+		}
+	}
+}
+
+func (index *hnswIndex) search(query []float32, k int, efRuntime int, allowed map[string]float64) []vectorResult {
+	if index.entry == nil {
+		return nil
+	}
+
+	ef := max(efRuntime, k)
+
+	// When few vectors pass the filter, comparing against each of them is cheaper and exact
+	if allowed != nil && len(allowed) <= ef*index.maxConnections(0) {
+		return bruteForce(index.metric, query, k, index.vectors, allowed)
+	}
+
+	entry := index.entry
+	for l := entry.level(); l > 0; l-- {
+		entry = index.searchLayer(query, entry, 1, l, nil)[0].node
+	}
+
+	candidates := index.searchLayer(query, entry, ef, 0, allowed)
+	results := make([]vectorResult, 0, len(candidates))
+	for _, candidate := range candidates {
+		results = append(results, vectorResult{key: candidate.node.key, distance: candidate.distance})
+	}
+	slices.SortFunc(results, compareResults)
+	if len(results) > k {
+		results = results[:k]
+	}
+	return results
+}
+
+type hnswCandidate struct {
+	node     *hnswNode
+	distance float64
+}
+
+// candidateHeap is a heap of candidates, ordered closest first unless furthest is set.
+type candidateHeap struct {
+	items    []hnswCandidate
+	furthest bool
+}
+
+func (h *candidateHeap) Len() int { return len(h.items) }
+func (h *candidateHeap) Less(i, j int) bool {
+	c := compareResults(
+		vectorResult{key: h.items[i].node.key, distance: h.items[i].distance},
+		vectorResult{key: h.items[j].node.key, distance: h.items[j].distance},
+	)
+	if h.furthest {
+		return c > 0
+	}
+	return c < 0
+}
+func (h *candidateHeap) Swap(i, j int)      { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *candidateHeap) Push(x interface{}) { h.items = append(h.items, x.(hnswCandidate)) }
+func (h *candidateHeap) Pop() interface{} {
+	item := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return item
+}
+
+// searchLayer returns up to ef of the closest nodes to the query at the level, closest first.
+// If allowed is not nil, every node is traversed but only the allowed nodes are returned.
+func (index *hnswIndex) searchLayer(query []float32, entry *hnswNode, ef int, level int, allowed map[string]float64) []hnswCandidate {
+	isAllowed := func(node *hnswNode) bool {
+		if allowed == nil {
+			return true
+		}
+		_, ok := allowed[node.key]
+		return ok
+	}
+
+	visited := map[*hnswNode]struct{}{entry: {}}
+	first := hnswCandidate{node: entry, distance: index.distance(query, entry)}
+	candidates := &candidateHeap{items: []hnswCandidate{first}}
+	results := &candidateHeap{furthest: true}
+	if isAllowed(entry) {
+		results.items = append(results.items, first)
+	}
+
+	for candidates.Len() > 0 {
+		current := heap.Pop(candidates).(hnswCandidate)
+		if results.Len() >= ef && current.distance > results.items[0].distance {
+			break
+		}
+		for _, neighbor := range current.node.neighbors[level] {
+			if _, ok := visited[neighbor]; ok {
+				continue
+			}
+			visited[neighbor] = struct{}{}
+			candidate := hnswCandidate{node: neighbor, distance: index.distance(query, neighbor)}
+			if results.Len() < ef || candidate.distance < results.items[0].distance {
+				heap.Push(candidates, candidate)
+				if isAllowed(neighbor) {
+					heap.Push(results, candidate)
+					if results.Len() > ef {
+						heap.Pop(results)
+					}
+				}
+			}
+		}
+	}
+
+	res := make([]hnswCandidate, results.Len())
+	for i := len(res) - 1; i >= 0; i-- {
+		res[i] = heap.Pop(results).(hnswCandidate)
+	}
+	return res
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/kelvinmwinuka/memstore/src/utils"
 	"net"
 	"slices"
+	"strconv"
 	"strings"
 )
 
@@ -29,6 +30,13 @@ func (p Plugin) Description() string {
 	return p.description
 }
 
+// SnapshotDecoders implements utils.SnapshotPlugin.
+func (p Plugin) SnapshotDecoders() map[string]utils.SnapshotDecoder {
+	return map[string]utils.SnapshotDecoder{
+		"set": DecodeSnapshot,
+	}
+}
+
 func handleSADD(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
 	if len(cmd) < 3 {
 		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
@@ -44,6 +52,7 @@ func handleSADD(ctx context.Context, cmd []string, server utils.Server, conn *ne
 			return nil, err
 		}
 		server.SetValue(ctx, key, set)
+		server.NotifyKeyspaceEvent(ctx, utils.SetEvents, "sadd", key)
 		server.KeyUnlock(key)
 		return []byte(fmt.Sprintf(":%d\r\n\r\n", len(cmd[2:]))), nil
 	}
@@ -60,6 +69,9 @@ func handleSADD(ctx context.Context, cmd []string, server utils.Server, conn *ne
 	}
 
 	count := set.Add(cmd[2:])
+	if count > 0 {
+		server.NotifyKeyspaceEvent(ctx, utils.SetEvents, "sadd", key)
+	}
 
 	return []byte(fmt.Sprintf(":%d\r\n\n", count)), nil
 }
@@ -193,6 +205,7 @@ func handleSDIFFSTORE(ctx context.Context, cmd []string, server utils.Server, co
 			return nil, err
 		}
 		server.SetValue(ctx, destination, diff)
+		server.NotifyKeyspaceEvent(ctx, utils.SetEvents, "sdiffstore", destination)
 		server.KeyUnlock(destination)
 		return []byte(res), nil
 	}
@@ -201,6 +214,7 @@ func handleSDIFFSTORE(ctx context.Context, cmd []string, server utils.Server, co
 		return nil, err
 	}
 	server.SetValue(ctx, destination, diff)
+	server.NotifyKeyspaceEvent(ctx, utils.SetEvents, "sdiffstore", destination)
 	server.KeyUnlock(destination)
 
 	return []byte(res), nil
@@ -280,7 +294,7 @@ func handleSINTERCARD(ctx context.Context, cmd []string, server utils.Server, co
 			return nil, errors.New("provide limit after LIMIT keyword")
 		}
 
-		if l, ok := utils.AdaptType(cmd[limitIdx]).(int); !ok {
+		if l, err := strconv.Atoi(cmd[limitIdx]); err != nil {
 			return nil, errors.New("limit must be an integer")
 		} else {
 			limit = l
@@ -390,6 +404,7 @@ func handleSINTERSTORE(ctx context.Context, cmd []string, server utils.Server, c
 	}
 
 	server.SetValue(ctx, destination, intersect)
+	server.NotifyKeyspaceEvent(ctx, utils.SetEvents, "sinterstore", destination)
 	server.KeyUnlock(destination)
 
 	return []byte(fmt.Sprintf(":%d\r\n\r\n", intersect.Cardinality())), nil
@@ -554,6 +569,10 @@ func handleSMOVE(ctx context.Context, cmd []string, server utils.Server, conn *n
 	}
 
 	res := sourceSet.Move(destinationSet, member)
+	if res == 1 {
+		server.NotifyKeyspaceEvent(ctx, utils.SetEvents, "srem", source)
+		server.NotifyKeyspaceEvent(ctx, utils.SetEvents, "sadd", destination)
+	}
 
 	return []byte(fmt.Sprintf(":%d\r\n\r\n", res)), nil
 }
@@ -567,8 +586,8 @@ func handleSPOP(ctx context.Context, cmd []string, server utils.Server, conn *ne
 	count := 1
 
 	if len(cmd) == 3 {
-		c, ok := utils.AdaptType(cmd[2]).(int)
-		if !ok {
+		c, err := strconv.Atoi(cmd[2])
+		if err != nil {
 			return nil, errors.New("count must be an integer")
 		}
 		count = c
@@ -590,6 +609,9 @@ func handleSPOP(ctx context.Context, cmd []string, server utils.Server, conn *ne
 	}
 
 	members := set.Pop(count)
+	if len(members) > 0 {
+		server.NotifyKeyspaceEvent(ctx, utils.SetEvents, "spop", key)
+	}
 
 	res := fmt.Sprintf("*%d", len(members))
 	for i, m := range members {
@@ -611,8 +633,8 @@ func handleSRANDMEMBER(ctx context.Context, cmd []string, server utils.Server, c
 	count := 1
 
 	if len(cmd) == 3 {
-		c, ok := utils.AdaptType(cmd[2]).(int)
-		if !ok {
+		c, err := strconv.Atoi(cmd[2])
+		if err != nil {
 			return nil, errors.New("count must be an integer")
 		}
 		count = c
@@ -670,6 +692,9 @@ func handleSREM(ctx context.Context, cmd []string, server utils.Server, conn *ne
 	}
 
 	count := set.Remove(members)
+	if count > 0 {
+		server.NotifyKeyspaceEvent(ctx, utils.SetEvents, "srem", key)
+	}
 
 	return []byte(fmt.Sprintf(":%d\r\n\r\n", count)), nil
 }
@@ -781,6 +806,7 @@ func handleSUNIONSTORE(ctx context.Context, cmd []string, server utils.Server, c
 	defer server.KeyUnlock(destination)
 
 	server.SetValue(ctx, destination, union)
+	server.NotifyKeyspaceEvent(ctx, utils.SetEvents, "sunionstore", destination)
 	return []byte(fmt.Sprintf(":%d\r\n\r\n", union.Cardinality())), nil
 }
 
@@ -1,8 +1,11 @@
 package set
 
 import (
+	"encoding/binary"
+	"errors"
 	"github.com/kelvinmwinuka/memstore/src/utils"
 	"math/rand"
+	"slices"
 )
 
 type Set struct {
@@ -167,3 +170,48 @@ func (set *Set) Move(destination *Set, e string) int {
 	destination.Add([]string{e})
 	return 1
 }
+
+// SnapshotType implements utils.SnapshotEncoder.
+func (set *Set) SnapshotType() string {
+	return "set"
+}
+
+// MarshalBinary implements utils.SnapshotEncoder. The set is encoded as its cardinality followed by
+// each member in sorted order, prefixed with its length.
+func (set *Set) MarshalBinary() ([]byte, error) {
+	members := set.GetAll()
+	slices.Sort(members)
+	b := binary.AppendUvarint(nil, uint64(len(members)))
+	for _, e := range members {
+		b = binary.AppendUvarint(b, uint64(len(e)))
+		b = append(b, e...)
+	}
+	return b, nil
+}
+
+// DecodeSnapshot restores a set that was encoded with MarshalBinary.
+func DecodeSnapshot(b []byte) (interface{}, error) {
+	errInvalid := errors.New("invalid set snapshot")
+
+	cardinality, n := binary.Uvarint(b)
+	if n <= 0 {
+		return nil, errInvalid
+	}
+	b = b[n:]
+
+	set := NewSet([]string{})
+	for i := uint64(0); i < cardinality; i++ {
+		size, n := binary.Uvarint(b)
+		if n <= 0 || size > uint64(len(b)-n) {
+			return nil, errInvalid
+		}
+		b = b[n:]
+		set.Add([]string{string(b[:size])})
+		b = b[size:]
+	}
+	if len(b) != 0 || set.Cardinality() != int(cardinality) {
+		return nil, errInvalid
+	}
+
+	return set, nil
+}
@@ -0,0 +1,214 @@
+package sketch
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"math"
+)
+
+// CountMinSketch estimates the frequency of items in a stream using depth rows of width counters.
+// Estimates are never lower than the real count.
+type CountMinSketch struct {
+	width    uint64
+	depth    uint64
+	count    uint64
+	counters []uint64 // depth rows of width counters
+}
+
+func NewCountMinSketch(width, depth uint64) (*CountMinSketch, error) {
+	if width < 1 || depth < 1 {
+		return nil, errors.New("width and depth must be greater than 0")
+	}
+	if width > maxCounters/depth {
+		return nil, errors.New("sketch is too large")
+	}
+	return &CountMinSketch{
+		width:    width,
+		depth:    depth,
+		counters: make([]uint64, width*depth),
+	}, nil
+}
+
+// NewCountMinSketchByProb creates a sketch where estimates exceed the real count by at most
+// errorRate of the total count, with the given probability of exceeding that bound.
+func NewCountMinSketchByProb(errorRate, probability float64) (*CountMinSketch, error) {
+	if errorRate <= 0 || errorRate >= 1 {
+		return nil, errors.New("error must be between 0 and 1 exclusive")
+	}
+	if probability <= 0 || probability >= 1 {
+		return nil, errors.New("probability must be between 0 and 1 exclusive")
+	}
+	width := uint64(math.Ceil(2 / errorRate))
+	depth := uint64(math.Ceil(math.Log(probability) / math.Log(0.5)))
+	return NewCountMinSketch(width, depth)
+}
+
+func hash(item string) (uint64, uint64) {
+	h := fnv.New128a()
+	_, _ = h.Write([]byte(item))
+	sum := h.Sum(nil)
+	return binary.BigEndian.Uint64(sum[:8]), binary.BigEndian.Uint64(sum[8:]) | 1
+}
+
+func (cms *CountMinSketch) index(row uint64, h1, h2 uint64) uint64 {
+	return row*cms.width + (h1+row*h2)%cms.width
+}
+
+// IncrBy increments the item's counters and returns the new estimate.
+func (cms *CountMinSketch) IncrBy(item string, increment uint64) uint64 {
+	h1, h2 := hash(item)
+	estimate := uint64(math.MaxUint64)
+	for row := uint64(0); row < cms.depth; row++ {
+		i := cms.index(row, h1, h2)
+		cms.counters[i] = saturatingAdd(cms.counters[i], increment)
+		estimate = min(estimate, cms.counters[i])
+	}
+	cms.count = saturatingAdd(cms.count, increment)
+	return estimate
+}
+
+func (cms *CountMinSketch) Query(item string) uint64 {
+	h1, h2 := hash(item)
+	estimate := uint64(math.MaxUint64)
+	for row := uint64(0); row < cms.depth; row++ {
+		estimate = min(estimate, cms.counters[cms.index(row, h1, h2)])
+	}
+	return estimate
+}
+
+// Merge sets the sketch to the weighted sum of the sources. All the sketches must have the same dimensions.
+func (cms *CountMinSketch) Merge(sources []*CountMinSketch, weights []uint64) error {
+	for _, source := range sources {
+		if source.width != cms.width || source.depth != cms.depth {
+			return errors.New("sketches must have the same width and depth")
+		}
+	}
+
+	counters := make([]uint64, len(cms.counters))
+	var count uint64
+	for s, source := range sources {
+		for i, c := range source.counters {
+			counters[i] = saturatingAdd(counters[i], saturatingMul(c, weights[s]))
+		}
+		count = saturatingAdd(count, saturatingMul(source.count, weights[s]))
+	}
+
+	cms.counters = counters
+	cms.count = count
+	return nil
+}
+
+func (cms *CountMinSketch) Width() uint64 {
+	return cms.width
+}
+
+func (cms *CountMinSketch) Depth() uint64 {
+	return cms.depth
+}
+
+// Count returns the total of all the increments.
+func (cms *CountMinSketch) Count() uint64 {
+	return cms.count
+}
+
+// SnapshotType implements utils.SnapshotEncoder.
+func (cms *CountMinSketch) SnapshotType() string {
+	return "cms"
+}
+
+// MarshalBinary implements utils.SnapshotEncoder. Counters are written as varints since most of them are small.
+func (cms *CountMinSketch) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 0, 16+len(cms.counters))
+	b = binary.AppendUvarint(b, cms.width)
+	b = binary.AppendUvarint(b, cms.depth)
+	b = binary.AppendUvarint(b, cms.count)
+	for _, c := range cms.counters {
+		b = binary.AppendUvarint(b, c)
+	}
+	return b, nil
+}
+
+func DecodeCountMinSketch(b []byte) (interface{}, error) {
+	r := &reader{b: b}
+	width, depth := r.uvarint(), r.uvarint()
+	if r.err != nil || width == 0 || depth == 0 || width > maxCounters/depth {
+		return nil, errors.New("invalid count-min sketch snapshot")
+	}
+	cms := &CountMinSketch{
+		width:    width,
+		depth:    depth,
+		count:    r.uvarint(),
+		counters: make([]uint64, width*depth),
+	}
+	for i := range cms.counters {
+		cms.counters[i] = r.uvarint()
+	}
+	if r.err != nil {
+		return nil, errors.New("invalid count-min sketch snapshot")
+	}
+	return cms, nil
+}
+
+func saturatingAdd(a, b uint64) uint64 {
+	if a > math.MaxUint64-b {
+		return math.MaxUint64
+	}
+	return a + b
+}
+
+func saturatingMul(a, b uint64) uint64 {
+	if a != 0 && b > math.MaxUint64/a {
+		return math.MaxUint64
+	}
+	return a * b
+}
+
+// maxCounters limits the memory a single sketch can allocate.
+const maxCounters = 1 << 27
+
+// reader decodes the snapshot encodings of this package. After the first error, reads return zero values.
+type reader struct {
+	b   []byte
+	err error
+}
+
+func (r *reader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.b)
+	if n <= 0 {
+		r.err = errors.New("unexpected end of data")
+		return 0
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *reader) uint64() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.b) < 8 {
+		r.err = errors.New("unexpected end of data")
+		return 0
+	}
+	v := binary.LittleEndian.Uint64(r.b)
+	r.b = r.b[8:]
+	return v
+}
+
+func (r *reader) string() string {
+	n := r.uvarint()
+	if r.err != nil {
+		return ""
+	}
+	if uint64(len(r.b)) < n {
+		r.err = errors.New("unexpected end of data")
+		return ""
+	}
+	s := string(r.b[:n])
+	r.b = r.b[n:]
+	return s
+}
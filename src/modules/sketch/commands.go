@@ -0,0 +1,628 @@
+package sketch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kelvinmwinuka/memstore/src/utils"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type Plugin struct {
+	name        string
+	commands    []utils.Command
+	description string
+}
+
+func (p Plugin) Name() string {
+	return p.name
+}
+
+func (p Plugin) Commands() []utils.Command {
+	return p.commands
+}
+
+func (p Plugin) Description() string {
+	return p.description
+}
+
+// SnapshotDecoders implements utils.SnapshotPlugin.
+func (p Plugin) SnapshotDecoders() map[string]utils.SnapshotDecoder {
+	return map[string]utils.SnapshotDecoder{
+		"cms":  DecodeCountMinSketch,
+		"topk": DecodeTopK,
+	}
+}
+
+// maxTopKIncrement bounds the work done by a single TOPK.INCRBY, since decay is applied once per increment.
+const maxTopKIncrement = 100000
+
+// readValue runs fn against the value at key while holding the key's read lock.
+func readValue[T any](ctx context.Context, server utils.Server, key string, kind string, fn func(value T) ([]byte, error)) ([]byte, error) {
+	if !server.KeyExists(key) {
+		return nil, fmt.Errorf("key %s does not exist", key)
+	}
+
+	if _, err := server.KeyRLock(ctx, key); err != nil {
+		return nil, err
+	}
+	defer server.KeyRUnlock(key)
+
+	value, ok := server.GetValue(key).(T)
+	if !ok {
+		return nil, fmt.Errorf("value at %s is not a %s", key, kind)
+	}
+
+	return fn(value)
+}
+
+// writeValue runs fn against the value at key while holding the key's write lock, then stores the value.
+func writeValue[T any](ctx context.Context, server utils.Server, key string, kind string, fn func(value T) ([]byte, error)) ([]byte, error) {
+	if !server.KeyExists(key) {
+		return nil, fmt.Errorf("key %s does not exist", key)
+	}
+
+	if _, err := server.KeyLock(ctx, key); err != nil {
+		return nil, err
+	}
+	defer server.KeyUnlock(key)
+
+	value, ok := server.GetValue(key).(T)
+	if !ok {
+		return nil, fmt.Errorf("value at %s is not a %s", key, kind)
+	}
+
+	res, err := fn(value)
+	if err != nil {
+		return nil, err
+	}
+
+	server.SetValue(ctx, key, value)
+	return res, nil
+}
+
+// createValue stores a new value at key. It fails if the key already exists.
+func createValue(ctx context.Context, server utils.Server, key string, value interface{}) ([]byte, error) {
+	if server.KeyExists(key) {
+		return nil, fmt.Errorf("key %s already exists", key)
+	}
+
+	if _, err := server.CreateKeyAndLock(ctx, key); err != nil {
+		return nil, err
+	}
+	defer server.KeyUnlock(key)
+
+	if server.GetValue(key) != nil {
+		return nil, fmt.Errorf("key %s already exists", key)
+	}
+
+	server.SetValue(ctx, key, value)
+
+	return []byte(utils.OK_RESPONSE), nil
+}
+
+func formatIntegers(values []uint64) []byte {
+	res := fmt.Sprintf("*%d\r\n", len(values))
+	for _, v := range values {
+		res += fmt.Sprintf(":%d\r\n", v)
+	}
+	res += "\r\n"
+	return []byte(res)
+}
+
+func formatInfo(fields []string, values []string) []byte {
+	res := fmt.Sprintf("*%d\r\n", len(fields)*2)
+	for i, field := range fields {
+		res += fmt.Sprintf("$%d\r\n%s\r\n%s", len(field), field, values[i])
+	}
+	res += "\r\n"
+	return []byte(res)
+}
+
+func handleCMSInitByDim(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) != 4 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	width, err := strconv.ParseUint(cmd[2], 10, 64)
+	if err != nil {
+		return nil, errors.New("width must be a positive integer")
+	}
+	depth, err := strconv.ParseUint(cmd[3], 10, 64)
+	if err != nil {
+		return nil, errors.New("depth must be a positive integer")
+	}
+
+	cms, err := NewCountMinSketch(width, depth)
+	if err != nil {
+		return nil, err
+	}
+
+	return createValue(ctx, server, cmd[1], cms)
+}
+
+func handleCMSInitByProb(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) != 4 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	errorRate, err := strconv.ParseFloat(cmd[2], 64)
+	if err != nil {
+		return nil, errors.New("error must be a number")
+	}
+	probability, err := strconv.ParseFloat(cmd[3], 64)
+	if err != nil {
+		return nil, errors.New("probability must be a number")
+	}
+
+	cms, err := NewCountMinSketchByProb(errorRate, probability)
+	if err != nil {
+		return nil, err
+	}
+
+	return createValue(ctx, server, cmd[1], cms)
+}
+
+func handleCMSIncrBy(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) < 4 || len(cmd[2:])%2 != 0 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	increments := make([]uint64, len(cmd[2:])/2)
+	for i := range increments {
+		increment, err := strconv.ParseUint(cmd[3+i*2], 10, 64)
+		if err != nil {
+			return nil, errors.New("increment must be a non-negative integer")
+		}
+		increments[i] = increment
+	}
+
+	return writeValue(ctx, server, cmd[1], "count-min sketch", func(cms *CountMinSketch) ([]byte, error) {
+		counts := make([]uint64, len(increments))
+		for i, increment := range increments {
+			counts[i] = cms.IncrBy(cmd[2+i*2], increment)
+		}
+		return formatIntegers(counts), nil
+	})
+}
+
+func handleCMSQuery(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) < 3 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	return readValue(ctx, server, cmd[1], "count-min sketch", func(cms *CountMinSketch) ([]byte, error) {
+		counts := make([]uint64, len(cmd[2:]))
+		for i, item := range cmd[2:] {
+			counts[i] = cms.Query(item)
+		}
+		return formatIntegers(counts), nil
+	})
+}
+
+// parseMerge parses CMS.MERGE destination numkeys source [source ...] [WEIGHTS weight [weight ...]].
+func parseMerge(cmd []string) (string, []string, []uint64, error) {
+	if len(cmd) < 4 {
+		return "", nil, nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	numKeys, err := strconv.Atoi(cmd[2])
+	if err != nil || numKeys < 1 || 3+numKeys > len(cmd) {
+		return "", nil, nil, errors.New("numkeys must be a positive integer matching the number of sources")
+	}
+	sources := cmd[3 : 3+numKeys]
+
+	weights := make([]uint64, numKeys)
+	for i := range weights {
+		weights[i] = 1
+	}
+
+	rest := cmd[3+numKeys:]
+	if len(rest) > 0 {
+		if !strings.EqualFold(rest[0], "weights") || len(rest) != numKeys+1 {
+			return "", nil, nil, errors.New("WEIGHTS must be followed by one weight for each source")
+		}
+		for i, w := range rest[1:] {
+			if weights[i], err = strconv.ParseUint(w, 10, 64); err != nil {
+				return "", nil, nil, errors.New("weight must be a non-negative integer")
+			}
+		}
+	}
+
+	return cmd[1], sources, weights, nil
+}
+
+func handleCMSMerge(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	destination, sources, weights, err := parseMerge(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	// Lock the keys in sorted order so that concurrent merges cannot deadlock
+	keys := append([]string{destination}, sources...)
+	slices.Sort(keys)
+	keys = slices.Compact(keys)
+	for _, key := range keys {
+		if !server.KeyExists(key) {
+			return nil, fmt.Errorf("key %s does not exist", key)
+		}
+	}
+	for _, key := range keys {
+		if key == destination {
+			if _, err = server.KeyLock(ctx, key); err != nil {
+				return nil, err
+			}
+			defer server.KeyUnlock(key)
+			continue
+		}
+		if _, err = server.KeyRLock(ctx, key); err != nil {
+			return nil, err
+		}
+		defer server.KeyRUnlock(key)
+	}
+
+	dest, ok := server.GetValue(destination).(*CountMinSketch)
+	if !ok {
+		return nil, fmt.Errorf("value at %s is not a count-min sketch", destination)
+	}
+
+	sketches := make([]*CountMinSketch, len(sources))
+	for i, source := range sources {
+		if sketches[i], ok = server.GetValue(source).(*CountMinSketch); !ok {
+			return nil, fmt.Errorf("value at %s is not a count-min sketch", source)
+		}
+	}
+
+	if err = dest.Merge(sketches, weights); err != nil {
+		return nil, err
+	}
+
+	server.SetValue(ctx, destination, dest)
+
+	return []byte(utils.OK_RESPONSE), nil
+}
+
+func handleCMSInfo(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) != 2 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	return readValue(ctx, server, cmd[1], "count-min sketch", func(cms *CountMinSketch) ([]byte, error) {
+		return formatInfo(
+			[]string{"width", "depth", "count"},
+			[]string{
+				fmt.Sprintf(":%d\r\n", cms.Width()),
+				fmt.Sprintf(":%d\r\n", cms.Depth()),
+				fmt.Sprintf(":%d\r\n", cms.Count()),
+			},
+		), nil
+	})
+}
+
+func handleTopKReserve(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) != 3 && len(cmd) != 6 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	k, err := strconv.ParseUint(cmd[2], 10, 64)
+	if err != nil {
+		return nil, errors.New("topk must be a positive integer")
+	}
+
+	width, depth, decay := uint64(DefaultTopKWidth), uint64(DefaultTopKDepth), DefaultTopKDecay
+	if len(cmd) == 6 {
+		if width, err = strconv.ParseUint(cmd[3], 10, 64); err != nil {
+			return nil, errors.New("width must be a positive integer")
+		}
+		if depth, err = strconv.ParseUint(cmd[4], 10, 64); err != nil {
+			return nil, errors.New("depth must be a positive integer")
+		}
+		if decay, err = strconv.ParseFloat(cmd[5], 64); err != nil {
+			return nil, errors.New("decay must be a number")
+		}
+	}
+
+	topk, err := NewTopK(k, width, depth, decay)
+	if err != nil {
+		return nil, err
+	}
+
+	return createValue(ctx, server, cmd[1], topk)
+}
+
+func handleTopKAdd(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) < 3 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	var items []string
+	var increments []uint64
+
+	if strings.EqualFold(cmd[0], "topk.incrby") {
+		if len(cmd[2:])%2 != 0 {
+			return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+		}
+		for i := 2; i < len(cmd); i += 2 {
+			increment, err := strconv.ParseUint(cmd[i+1], 10, 64)
+			if err != nil || increment < 1 || increment > maxTopKIncrement {
+				return nil, fmt.Errorf("increment must be an integer between 1 and %d", maxTopKIncrement)
+			}
+			items = append(items, cmd[i])
+			increments = append(increments, increment)
+		}
+	} else {
+		items = cmd[2:]
+		for range items {
+			increments = append(increments, 1)
+		}
+	}
+
+	return writeValue(ctx, server, cmd[1], "topk", func(topk *TopK) ([]byte, error) {
+		res := fmt.Sprintf("*%d\r\n", len(items))
+		for i, item := range items {
+			if expelled, ok := topk.IncrBy(item, increments[i]); ok {
+				res += fmt.Sprintf("$%d\r\n%s\r\n", len(expelled), expelled)
+			} else {
+				res += "$-1\r\n"
+			}
+		}
+		res += "\r\n"
+		return []byte(res), nil
+	})
+}
+
+func handleTopKQuery(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) < 3 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	return readValue(ctx, server, cmd[1], "topk", func(topk *TopK) ([]byte, error) {
+		values := make([]uint64, len(cmd[2:]))
+		for i, item := range cmd[2:] {
+			if strings.EqualFold(cmd[0], "topk.count") {
+				values[i] = topk.Count(item)
+			} else if topk.Query(item) {
+				values[i] = 1
+			}
+		}
+		return formatIntegers(values), nil
+	})
+}
+
+func handleTopKList(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) < 2 || len(cmd) > 3 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	withCount := false
+	if len(cmd) == 3 {
+		if !strings.EqualFold(cmd[2], "withcount") {
+			return nil, fmt.Errorf("unknown option %s", cmd[2])
+		}
+		withCount = true
+	}
+
+	return readValue(ctx, server, cmd[1], "topk", func(topk *TopK) ([]byte, error) {
+		list := topk.List()
+		length := len(list)
+		if withCount {
+			length *= 2
+		}
+		res := fmt.Sprintf("*%d\r\n", length)
+		for _, entry := range list {
+			res += fmt.Sprintf("$%d\r\n%s\r\n", len(entry.Item), entry.Item)
+			if withCount {
+				res += fmt.Sprintf(":%d\r\n", entry.Count)
+			}
+		}
+		res += "\r\n"
+		return []byte(res), nil
+	})
+}
+
+func handleTopKInfo(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) != 2 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	return readValue(ctx, server, cmd[1], "topk", func(topk *TopK) ([]byte, error) {
+		decay := strconv.FormatFloat(topk.Decay(), 'f', -1, 64)
+		return formatInfo(
+			[]string{"k", "width", "depth", "decay"},
+			[]string{
+				fmt.Sprintf(":%d\r\n", topk.K()),
+				fmt.Sprintf(":%d\r\n", topk.Width()),
+				fmt.Sprintf(":%d\r\n", topk.Depth()),
+				fmt.Sprintf("$%d\r\n%s\r\n", len(decay), decay),
+			},
+		), nil
+	})
+}
+
+func NewModule() Plugin {
+	SketchModule := Plugin{
+		name: "SketchCommands",
+		commands: []utils.Command{
+			{
+				Command:     "cms.initbydim",
+				Categories:  []string{utils.CMSCategory, utils.WriteCategory, utils.FastCategory},
+				Description: "(CMS.INITBYDIM key width depth) Creates a count-min sketch with depth rows of width counters.",
+				Sync:        true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) != 4 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleCMSInitByDim,
+			},
+			{
+				Command:    "cms.initbyprob",
+				Categories: []string{utils.CMSCategory, utils.WriteCategory, utils.FastCategory},
+				Description: `(CMS.INITBYPROB key error probability) Creates a count-min sketch where estimates exceed the real count
+by at most error times the total count, with the given probability of exceeding that bound.`,
+				Sync: true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) != 4 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleCMSInitByProb,
+			},
+			{
+				Command:     "cms.incrby",
+				Categories:  []string{utils.CMSCategory, utils.WriteCategory, utils.FastCategory},
+				Description: "(CMS.INCRBY key item increment [item increment ...]) Increases the count of each item and returns the new estimates.",
+				Sync:        true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 4 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleCMSIncrBy,
+			},
+			{
+				Command:     "cms.query",
+				Categories:  []string{utils.CMSCategory, utils.ReadCategory, utils.FastCategory},
+				Description: "(CMS.QUERY key item [item ...]) Returns the estimated count of each item.",
+				Sync:        false,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 3 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleCMSQuery,
+			},
+			{
+				Command:    "cms.merge",
+				Categories: []string{utils.CMSCategory, utils.WriteCategory, utils.SlowCategory},
+				Description: `(CMS.MERGE destination numkeys source [source ...] [WEIGHTS weight [weight ...]])
+Replaces the destination sketch with the weighted sum of the source sketches. All the sketches must have the same dimensions.`,
+				Sync: true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					destination, sources, _, err := parseMerge(cmd)
+					if err != nil {
+						return nil, err
+					}
+					return append([]string{destination}, sources...), nil
+				},
+				HandlerFunc: handleCMSMerge,
+			},
+			{
+				Command:     "cms.info",
+				Categories:  []string{utils.CMSCategory, utils.ReadCategory, utils.FastCategory},
+				Description: "(CMS.INFO key) Returns the width, depth and total count of the sketch.",
+				Sync:        false,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) != 2 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleCMSInfo,
+			},
+			{
+				Command:    "topk.reserve",
+				Categories: []string{utils.TopKCategory, utils.WriteCategory, utils.FastCategory},
+				Description: `(TOPK.RESERVE key topk [width depth decay]) Creates a structure that tracks the topk most frequent items.
+The default width is 8, depth is 7 and decay is 0.9.`,
+				Sync: true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) != 3 && len(cmd) != 6 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleTopKReserve,
+			},
+			{
+				Command:    "topk.add",
+				Categories: []string{utils.TopKCategory, utils.WriteCategory, utils.FastCategory},
+				Description: `(TOPK.ADD key item [item ...]) Adds the items to the structure.
+Returns the item that was expelled from the top k by each added item, or nil if no item was expelled.`,
+				Sync: true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 3 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleTopKAdd,
+			},
+			{
+				Command:    "topk.incrby",
+				Categories: []string{utils.TopKCategory, utils.WriteCategory, utils.FastCategory},
+				Description: `(TOPK.INCRBY key item increment [item increment ...]) Increases the count of each item.
+Returns the item that was expelled from the top k by each item, or nil if no item was expelled.`,
+				Sync: true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 4 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleTopKAdd,
+			},
+			{
+				Command:     "topk.query",
+				Categories:  []string{utils.TopKCategory, utils.ReadCategory, utils.FastCategory},
+				Description: "(TOPK.QUERY key item [item ...]) Returns 1 for each item that is in the top k, otherwise 0.",
+				Sync:        false,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 3 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleTopKQuery,
+			},
+			{
+				Command:     "topk.count",
+				Categories:  []string{utils.TopKCategory, utils.ReadCategory, utils.FastCategory},
+				Description: "(TOPK.COUNT key item [item ...]) Returns the estimated count of each item.",
+				Sync:        false,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 3 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleTopKQuery,
+			},
+			{
+				Command:     "topk.list",
+				Categories:  []string{utils.TopKCategory, utils.ReadCategory, utils.FastCategory},
+				Description: "(TOPK.LIST key [WITHCOUNT]) Returns the top k items from the most to the least frequent.",
+				Sync:        false,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 2 || len(cmd) > 3 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleTopKList,
+			},
+			{
+				Command:     "topk.info",
+				Categories:  []string{utils.TopKCategory, utils.ReadCategory, utils.FastCategory},
+				Description: "(TOPK.INFO key) Returns the parameters of the structure.",
+				Sync:        false,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) != 2 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleTopKInfo,
+			},
+		},
+		description: "Handle count-min sketch and top-k commands",
+	}
+	return SketchModule
+}
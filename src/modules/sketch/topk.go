@@ -0,0 +1,263 @@
+package sketch
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"math"
+	"slices"
+	"strings"
+)
+
+const (
+	DefaultTopKWidth = 8
+	DefaultTopKDepth = 7
+	DefaultTopKDecay = 0.9
+
+	minDecayProbability = 1e-9
+)
+
+type bucket struct {
+	fingerprint uint32
+	count       uint64
+}
+
+type TopKItem struct {
+	Item  string
+	Count uint64
+}
+
+// TopK tracks the k most frequent items of a stream using the HeavyKeeper algorithm.
+// Each item is counted in one bucket per row. When an item collides with a different
+// item's bucket, the bucket's count decays with probability decay^count, so that
+// frequent items keep their buckets while infrequent items are replaced.
+type TopK struct {
+	k       uint64
+	width   uint64
+	depth   uint64
+	decay   float64
+	buckets []bucket // depth rows of width buckets
+	heap    []TopKItem
+	// The decay decisions are drawn from a generator stored with the structure, so that
+	// every node in the cluster applying the same commands makes the same decisions.
+	seed uint64
+}
+
+func NewTopK(k, width, depth uint64, decay float64) (*TopK, error) {
+	if k < 1 || width < 1 || depth < 1 {
+		return nil, errors.New("topk, width and depth must be greater than 0")
+	}
+	if width > maxCounters/depth || k > maxCounters {
+		return nil, errors.New("topk is too large")
+	}
+	if decay <= 0 || decay > 1 {
+		return nil, errors.New("decay must be between 0 exclusive and 1 inclusive")
+	}
+	return &TopK{
+		k:       k,
+		width:   width,
+		depth:   depth,
+		decay:   decay,
+		buckets: make([]bucket, width*depth),
+		seed:    0x9e3779b97f4a7c15,
+	}, nil
+}
+
+// random returns a pseudo-random number in [0, 1) using xorshift64*.
+func (topk *TopK) random() float64 {
+	topk.seed ^= topk.seed >> 12
+	topk.seed ^= topk.seed << 25
+	topk.seed ^= topk.seed >> 27
+	return float64((topk.seed*0x2545f4914f6cdd1d)>>11) / (1 << 53)
+}
+
+func fingerprint(item string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(item))
+	return h.Sum32()
+}
+
+// IncrBy counts the item increment times. If the item enters the top k and another item
+// is expelled from it, the expelled item is returned.
+func (topk *TopK) IncrBy(item string, increment uint64) (expelled string, ok bool) {
+	h1, h2 := hash(item)
+	fp := fingerprint(item)
+
+	var estimate uint64
+	for row := uint64(0); row < topk.depth; row++ {
+		b := &topk.buckets[row*topk.width+(h1+row*h2)%topk.width]
+
+		switch {
+		case b.count == 0:
+			b.fingerprint = fp
+			b.count = increment
+		case b.fingerprint == fp:
+			b.count = saturatingAdd(b.count, increment)
+		default:
+			for remaining := increment; remaining > 0; remaining-- {
+				probability := math.Pow(topk.decay, float64(b.count))
+				if probability < minDecayProbability {
+					// The bucket belongs to a heavy item that will practically never decay
+					break
+				}
+				if topk.random() < probability {
+					b.count -= 1
+					if b.count == 0 {
+						b.fingerprint = fp
+						b.count = remaining
+						break
+					}
+				}
+			}
+		}
+
+		if b.fingerprint == fp {
+			estimate = max(estimate, b.count)
+		}
+	}
+
+	if i := slices.IndexFunc(topk.heap, func(entry TopKItem) bool { return entry.Item == item }); i != -1 {
+		topk.heap[i].Count = max(topk.heap[i].Count, estimate)
+		return "", false
+	}
+
+	if estimate == 0 {
+		return "", false
+	}
+
+	if uint64(len(topk.heap)) < topk.k {
+		topk.heap = append(topk.heap, TopKItem{Item: item, Count: estimate})
+		return "", false
+	}
+
+	i := topk.minIndex()
+	if estimate > topk.heap[i].Count {
+		expelled = topk.heap[i].Item
+		topk.heap[i] = TopKItem{Item: item, Count: estimate}
+		return expelled, true
+	}
+
+	return "", false
+}
+
+// minIndex returns the index of the item with the lowest count. Ties are broken by the item itself
+// so that the choice does not depend on the order of the slice.
+func (topk *TopK) minIndex() int {
+	res := 0
+	for i, entry := range topk.heap {
+		if entry.Count < topk.heap[res].Count ||
+			(entry.Count == topk.heap[res].Count && entry.Item > topk.heap[res].Item) {
+			res = i
+		}
+	}
+	return res
+}
+
+// Query reports whether the item is currently in the top k.
+func (topk *TopK) Query(item string) bool {
+	return slices.ContainsFunc(topk.heap, func(entry TopKItem) bool { return entry.Item == item })
+}
+
+// Count returns the estimated count of the item.
+func (topk *TopK) Count(item string) uint64 {
+	h1, h2 := hash(item)
+	fp := fingerprint(item)
+	var count uint64
+	for row := uint64(0); row < topk.depth; row++ {
+		b := topk.buckets[row*topk.width+(h1+row*h2)%topk.width]
+		if b.fingerprint == fp {
+			count = max(count, b.count)
+		}
+	}
+	return count
+}
+
+// List returns the top k items ordered from the most to the least frequent.
+func (topk *TopK) List() []TopKItem {
+	list := slices.Clone(topk.heap)
+	slices.SortFunc(list, func(a, b TopKItem) int {
+		if a.Count != b.Count {
+			if a.Count > b.Count {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.Item, b.Item)
+	})
+	return list
+}
+
+func (topk *TopK) K() uint64 {
+	return topk.k
+}
+
+func (topk *TopK) Width() uint64 {
+	return topk.width
+}
+
+func (topk *TopK) Depth() uint64 {
+	return topk.depth
+}
+
+func (topk *TopK) Decay() float64 {
+	return topk.decay
+}
+
+// SnapshotType implements utils.SnapshotEncoder.
+func (topk *TopK) SnapshotType() string {
+	return "topk"
+}
+
+// MarshalBinary implements utils.SnapshotEncoder.
+func (topk *TopK) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 0, 48+len(topk.buckets)*6+len(topk.heap)*16)
+	b = binary.AppendUvarint(b, topk.k)
+	b = binary.AppendUvarint(b, topk.width)
+	b = binary.AppendUvarint(b, topk.depth)
+	b = binary.LittleEndian.AppendUint64(b, math.Float64bits(topk.decay))
+	b = binary.LittleEndian.AppendUint64(b, topk.seed)
+	for _, bucket := range topk.buckets {
+		b = binary.AppendUvarint(b, uint64(bucket.fingerprint))
+		b = binary.AppendUvarint(b, bucket.count)
+	}
+	b = binary.AppendUvarint(b, uint64(len(topk.heap)))
+	for _, entry := range topk.heap {
+		b = binary.AppendUvarint(b, uint64(len(entry.Item)))
+		b = append(b, entry.Item...)
+		b = binary.AppendUvarint(b, entry.Count)
+	}
+	return b, nil
+}
+
+func DecodeTopK(b []byte) (interface{}, error) {
+	invalid := errors.New("invalid topk snapshot")
+
+	r := &reader{b: b}
+	k, width, depth := r.uvarint(), r.uvarint(), r.uvarint()
+	decay := math.Float64frombits(r.uint64())
+	if r.err != nil {
+		return nil, invalid
+	}
+
+	topk, err := NewTopK(k, width, depth, decay)
+	if err != nil {
+		return nil, invalid
+	}
+	topk.seed = r.uint64()
+	for i := range topk.buckets {
+		topk.buckets[i].fingerprint = uint32(r.uvarint())
+		topk.buckets[i].count = r.uvarint()
+	}
+	size := r.uvarint()
+	if size > k {
+		return nil, invalid
+	}
+	for i := uint64(0); i < size && r.err == nil; i++ {
+		topk.heap = append(topk.heap, TopKItem{Item: r.string(), Count: r.uvarint()})
+	}
+
+	if r.err != nil {
+		return nil, invalid
+	}
+	return topk, nil
+}
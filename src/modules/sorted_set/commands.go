@@ -1,12 +1,10 @@
 package sorted_set
 
 import (
-	"cmp"
 	"context"
 	"errors"
 	"fmt"
 	"github.com/kelvinmwinuka/memstore/src/utils"
-	"math"
 	"net"
 	"slices"
 	"strconv"
@@ -32,6 +30,13 @@ func (p Plugin) Description() string {
 	return p.description
 }
 
+// SnapshotDecoders implements utils.SnapshotPlugin.
+func (p Plugin) SnapshotDecoders() map[string]utils.SnapshotDecoder {
+	return map[string]utils.SnapshotDecoder{
+		"sorted_set": DecodeSnapshot,
+	}
+}
+
 func handleZADD(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
 	if len(cmd) < 4 {
 		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
@@ -46,19 +51,10 @@ func handleZADD(ctx context.Context, cmd []string, server utils.Server, conn *ne
 
 	// Find the first valid score and this will be the start of the score/member pairs
 	var membersStartIndex int
-	for i := 0; i < len(cmd); i++ {
-		if membersStartIndex != 0 {
-			break
-		}
-		switch utils.AdaptType(cmd[i]).(type) {
-		case string:
-			if utils.Contains([]string{"-inf", "+inf"}, strings.ToLower(cmd[i])) {
-				membersStartIndex = i
-			}
-		case float64:
-			membersStartIndex = i
-		case int:
+	for i := 2; i < len(cmd); i++ {
+		if _, err := parseScore(cmd[i]); err == nil {
 			membersStartIndex = i
+			break
 		}
 	}
 
@@ -72,39 +68,14 @@ func handleZADD(ctx context.Context, cmd []string, server utils.Server, conn *ne
 		if i%2 != 0 {
 			continue
 		}
-		score := utils.AdaptType(cmd[membersStartIndex:][i])
-		switch score.(type) {
-		default:
+		score, err := parseScore(cmd[membersStartIndex:][i])
+		if err != nil {
 			return nil, errors.New("invalid score in score/member list")
-		case string:
-			var s float64
-			if strings.ToLower(score.(string)) == "-inf" {
-				s = math.Inf(-1)
-				members = append(members, MemberParam{
-					value: Value(cmd[membersStartIndex:][i+1]),
-					score: Score(s),
-				})
-			}
-			if strings.ToLower(score.(string)) == "+inf" {
-				s = math.Inf(1)
-				members = append(members, MemberParam{
-					value: Value(cmd[membersStartIndex:][i+1]),
-					score: Score(s),
-				})
-			}
-		case float64:
-			s, _ := score.(float64)
-			members = append(members, MemberParam{
-				value: Value(cmd[membersStartIndex:][i+1]),
-				score: Score(s),
-			})
-		case int:
-			s, _ := score.(int)
-			members = append(members, MemberParam{
-				value: Value(cmd[membersStartIndex:][i+1]),
-				score: Score(s),
-			})
 		}
+		members = append(members, MemberParam{
+			value: Value(cmd[membersStartIndex:][i+1]),
+			score: score,
+		})
 	}
 
 	// Parse options using membersStartIndex as the upper limit
@@ -140,12 +111,17 @@ func handleZADD(ctx context.Context, cmd []string, server utils.Server, conn *ne
 		defer server.KeyUnlock(key)
 		set, ok := server.GetValue(key).(*SortedSet)
 		if !ok {
-			return nil, fmt.Errorf("value at %s is not a sorted set")
+			return nil, fmt.Errorf("value at %s is not a sorted set", key)
 		}
 		count, err := set.AddOrUpdate(members, updatePolicy, comparison, changed, incr)
 		if err != nil {
 			return nil, err
 		}
+		if incr != nil {
+			server.NotifyKeyspaceEvent(ctx, utils.SortedSetEvents, "zincr", key)
+		} else {
+			server.NotifyKeyspaceEvent(ctx, utils.SortedSetEvents, "zadd", key)
+		}
 		// If INCR option is provided, return the new score value
 		if incr != nil {
 			m := set.Get(members[0].value)
@@ -164,6 +140,7 @@ func handleZADD(ctx context.Context, cmd []string, server utils.Server, conn *ne
 
 	set := NewSortedSet(members)
 	server.SetValue(ctx, key, set)
+	server.NotifyKeyspaceEvent(ctx, utils.SortedSetEvents, "zadd", key)
 
 	return []byte(fmt.Sprintf(":%d\r\n\r\n", set.Cardinality())), nil
 }
@@ -199,47 +176,21 @@ func handleZCOUNT(ctx context.Context, cmd []string, server utils.Server, conn *
 
 	key := cmd[1]
 
-	minimum := Score(math.Inf(-1))
-	switch utils.AdaptType(cmd[2]).(type) {
-	default:
+	minimum, err := parseScore(cmd[2])
+	if err != nil {
 		return nil, errors.New("min constraint must be a double")
-	case string:
-		if strings.ToLower(cmd[2]) == "+inf" {
-			minimum = Score(math.Inf(1))
-		} else {
-			return nil, errors.New("min constraint must be a double")
-		}
-	case float64:
-		s, _ := utils.AdaptType(cmd[2]).(float64)
-		minimum = Score(s)
-	case int:
-		s, _ := utils.AdaptType(cmd[2]).(int)
-		minimum = Score(s)
 	}
 
-	maximum := Score(math.Inf(1))
-	switch utils.AdaptType(cmd[3]).(type) {
-	default:
+	maximum, err := parseScore(cmd[3])
+	if err != nil {
 		return nil, errors.New("max constraint must be a double")
-	case string:
-		if strings.ToLower(cmd[3]) == "-inf" {
-			maximum = Score(math.Inf(-1))
-		} else {
-			return nil, errors.New("max constraint must be a double")
-		}
-	case float64:
-		s, _ := utils.AdaptType(cmd[3]).(float64)
-		maximum = Score(s)
-	case int:
-		s, _ := utils.AdaptType(cmd[3]).(int)
-		maximum = Score(s)
 	}
 
 	if !server.KeyExists(key) {
 		return []byte("*0\r\n\r\n"), nil
 	}
 
-	_, err := server.KeyRLock(ctx, key)
+	_, err = server.KeyRLock(ctx, key)
 	if err != nil {
 		return nil, err
 	}
@@ -250,14 +201,7 @@ func handleZCOUNT(ctx context.Context, cmd []string, server utils.Server, conn *
 		return nil, fmt.Errorf("value at %s is not a sorted set", key)
 	}
 
-	var members []MemberParam
-	for _, m := range set.GetAll() {
-		if m.score >= minimum && m.score <= maximum {
-			members = append(members, m)
-		}
-	}
-
-	return []byte(fmt.Sprintf(":%d\r\n\r\n", len(members))), nil
+	return []byte(fmt.Sprintf(":%d\r\n\r\n", set.CountByScore(minimum, maximum))), nil
 }
 
 func handleZLEXCOUNT(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
@@ -283,25 +227,12 @@ func handleZLEXCOUNT(ctx context.Context, cmd []string, server utils.Server, con
 		return nil, fmt.Errorf("value at %s is not a sorted set", key)
 	}
 
-	members := set.GetAll()
-
-	// Check if all members has the same score
-	for i := 0; i < len(members)-2; i++ {
-		if members[i].score != members[i+1].score {
-			return []byte("+(nil)\r\n\r\n"), nil
-		}
-	}
-
-	count := 0
-
-	for _, m := range members {
-		if slices.Contains([]int{1, 0}, compareLex(string(m.value), minimum)) &&
-			slices.Contains([]int{-1, 0}, compareLex(string(m.value), maximum)) {
-			count += 1
-		}
+	// Lexicographical ranges require all the members to have the same score
+	if !set.uniformScores() {
+		return []byte("+(nil)\r\n\r\n"), nil
 	}
 
-	return []byte(fmt.Sprintf(":%d\r\n\r\n", count)), nil
+	return []byte(fmt.Sprintf(":%d\r\n\r\n", set.CountByLex(Value(minimum), Value(maximum)))), nil
 }
 
 func handleZDIFF(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
@@ -435,6 +366,7 @@ func handleZDIFFSTORE(ctx context.Context, cmd []string, server utils.Server, co
 	defer server.KeyUnlock(destination)
 
 	server.SetValue(ctx, destination, diff)
+	server.NotifyKeyspaceEvent(ctx, utils.SortedSetEvents, "zdiffstore", destination)
 
 	return []byte(fmt.Sprintf(":%d\r\n\r\n", diff.Cardinality())), nil
 }
@@ -446,25 +378,10 @@ func handleZINCRBY(ctx context.Context, cmd []string, server utils.Server, conn
 
 	key := cmd[1]
 	member := Value(cmd[3])
-	var increment Score
 
-	switch utils.AdaptType(cmd[2]).(type) {
-	default:
+	increment, err := parseScore(cmd[2])
+	if err != nil {
 		return nil, errors.New("increment must be a double")
-	case string:
-		if strings.EqualFold("-inf", strings.ToLower(cmd[2])) {
-			increment = Score(math.Inf(-1))
-		} else if strings.EqualFold("+inf", strings.ToLower(cmd[2])) {
-			increment = Score(math.Inf(1))
-		} else {
-			return nil, errors.New("increment must be a double")
-		}
-	case float64:
-		s, _ := utils.AdaptType(cmd[2]).(float64)
-		increment = Score(s)
-	case int:
-		s, _ := utils.AdaptType(cmd[2]).(int)
-		increment = Score(s)
 	}
 
 	if server.KeyExists(key) {
@@ -482,10 +399,11 @@ func handleZINCRBY(ctx context.Context, cmd []string, server utils.Server, conn
 		if err != nil {
 			return nil, err
 		}
+		server.NotifyKeyspaceEvent(ctx, utils.SortedSetEvents, "zincr", key)
 		return []byte(fmt.Sprintf("+%f\r\n\r\n", set.Get(member).score)), nil
 	}
 
-	_, err := server.CreateKeyAndLock(ctx, key)
+	_, err = server.CreateKeyAndLock(ctx, key)
 	if err != nil {
 		return nil, err
 	}
@@ -498,6 +416,7 @@ func handleZINCRBY(ctx context.Context, cmd []string, server utils.Server, conn
 		},
 	})
 	server.SetValue(ctx, key, set)
+	server.NotifyKeyspaceEvent(ctx, utils.SortedSetEvents, "zincr", key)
 
 	return []byte(fmt.Sprintf("+%f\r\n\r\n", set.Get(member).score)), nil
 }
@@ -635,6 +554,7 @@ func handleZINTERSTORE(ctx context.Context, cmd []string, server utils.Server, c
 	defer server.KeyUnlock(destination)
 
 	server.SetValue(ctx, destination, intersect)
+	server.NotifyKeyspaceEvent(ctx, utils.SortedSetEvents, "zinterstore", destination)
 
 	return []byte(fmt.Sprintf(":%d\r\n\r\n", intersect.Cardinality())), nil
 }
@@ -707,13 +627,16 @@ func handleZMPOP(ctx context.Context, cmd []string, server utils.Server, conn *n
 				server.KeyUnlock(key)
 				return nil, err
 			}
+			if popped.Cardinality() > 0 {
+				server.NotifyKeyspaceEvent(ctx, utils.SortedSetEvents, "zpop"+policy, key)
+			}
 			server.KeyUnlock(key)
 			if popped.Cardinality() == 0 {
 				return []byte("+(nil)\r\n\r\n"), nil
 			}
 
 			res := fmt.Sprintf("*%d", popped.Cardinality())
-			for i, m := range popped.GetAll() {
+			for i, m := range popped.RangeByRank(0, -1, policy == "max") {
 				s := fmt.Sprintf("%s %f", m.value, m.score)
 				res += fmt.Sprintf("\r\n$%d\r\n%s", len(s), s)
 				if i == popped.Cardinality()-1 {
@@ -768,9 +691,12 @@ func handleZPOP(ctx context.Context, cmd []string, server utils.Server, conn *ne
 	if err != nil {
 		return nil, err
 	}
+	if popped.Cardinality() > 0 {
+		server.NotifyKeyspaceEvent(ctx, utils.SortedSetEvents, "zpop"+policy, key)
+	}
 
 	res := fmt.Sprintf("*%d", popped.Cardinality())
-	for i, m := range popped.GetAll() {
+	for i, m := range popped.RangeByRank(0, -1, policy == "max") {
 		s := fmt.Sprintf("%s %f", m.value, m.score)
 		res += fmt.Sprintf("\r\n$%d\r\n%s", len(s), s)
 		if i == popped.Cardinality()-1 {
@@ -905,26 +831,17 @@ func handleZRANK(ctx context.Context, cmd []string, server utils.Server, conn *n
 		return nil, fmt.Errorf("value at %s is not a sorted set", key)
 	}
 
-	members := set.GetAll()
-	slices.SortFunc(members, func(a, b MemberParam) int {
-		if strings.EqualFold(cmd[0], "zrevrank") {
-			return cmp.Compare(b.score, a.score)
-		}
-		return cmp.Compare(a.score, b.score)
-	})
+	rank, ok := set.Rank(Value(member), strings.EqualFold(cmd[0], "zrevrank"))
+	if !ok {
+		return []byte("+(nil)\r\n\r\n"), nil
+	}
 
-	for i := 0; i < len(members); i++ {
-		if members[i].value == Value(member) {
-			if withscores {
-				score := strconv.FormatFloat(float64(members[i].score), 'f', -1, 64)
-				return []byte(fmt.Sprintf("*2\r\n:%d\r\n$%d\r\n%s\r\n\r\n", i, len(score), score)), nil
-			} else {
-				return []byte(fmt.Sprintf(":%d\r\n\r\n", i)), nil
-			}
-		}
+	if withscores {
+		score := strconv.FormatFloat(float64(set.Get(Value(member)).score), 'f', -1, 64)
+		return []byte(fmt.Sprintf("*2\r\n:%d\r\n$%d\r\n%s\r\n\r\n", rank, len(score), score)), nil
 	}
 
-	return []byte("+(nil)\r\n\r\n"), nil
+	return []byte(fmt.Sprintf(":%d\r\n\r\n", rank)), nil
 }
 
 func handleZREM(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
@@ -955,6 +872,9 @@ func handleZREM(ctx context.Context, cmd []string, server utils.Server, conn *ne
 			deletedCount += 1
 		}
 	}
+	if deletedCount > 0 {
+		server.NotifyKeyspaceEvent(ctx, utils.SortedSetEvents, "zrem", key)
+	}
 
 	return []byte(fmt.Sprintf(":%d\r\n\r\n", deletedCount)), nil
 }
@@ -988,7 +908,6 @@ func handleZREMRANGEBYSCORE(ctx context.Context, cmd []string, server utils.Serv
 		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
 	}
 
-	deletedCount := 0
 	key := cmd[1]
 
 	minimum, err := strconv.ParseFloat(cmd[2], 64)
@@ -1015,11 +934,9 @@ func handleZREMRANGEBYSCORE(ctx context.Context, cmd []string, server utils.Serv
 		return nil, fmt.Errorf("value at %s is not a sorted set", key)
 	}
 
-	for _, m := range set.GetAll() {
-		if m.score >= Score(minimum) && m.score <= Score(maximum) {
-			set.Remove(m.value)
-			deletedCount += 1
-		}
+	deletedCount := set.RemoveRangeByScore(Score(minimum), Score(maximum))
+	if deletedCount > 0 {
+		server.NotifyKeyspaceEvent(ctx, utils.SortedSetEvents, "zremrangebyscore", key)
 	}
 
 	return []byte(fmt.Sprintf(":%d\r\n\r\n", deletedCount)), nil
@@ -1067,23 +984,13 @@ func handleZREMRANGEBYRANK(ctx context.Context, cmd []string, server utils.Serve
 		return nil, errors.New("indices out of bounds")
 	}
 
-	members := set.GetAll()
-	slices.SortFunc(members, func(a, b MemberParam) int {
-		return cmp.Compare(a.score, b.score)
-	})
-
-	deletedCount := 0
+	if start > stop {
+		start, stop = stop, start
+	}
 
-	if start < stop {
-		for i := start; i <= stop; i++ {
-			set.Remove(members[i].value)
-			deletedCount += 1
-		}
-	} else {
-		for i := stop; i <= start; i++ {
-			set.Remove(members[i].value)
-			deletedCount += 1
-		}
+	deletedCount := set.RemoveRangeByRank(start, stop)
+	if deletedCount > 0 {
+		server.NotifyKeyspaceEvent(ctx, utils.SortedSetEvents, "zremrangebyrank", key)
 	}
 
 	return []byte(fmt.Sprintf(":%d\r\n\r\n", deletedCount)), nil
@@ -1113,24 +1020,14 @@ func handleZREMRANGEBYLEX(ctx context.Context, cmd []string, server utils.Server
 		return nil, fmt.Errorf("value at %s is not a sorted set", key)
 	}
 
-	members := set.GetAll()
-
 	// Check if all the members have the same score. If not, return nil
-	for i := 0; i < len(members)-1; i++ {
-		if members[i].score != members[i+1].score {
-			return []byte("+(nil)\r\n\r\n"), nil
-		}
+	if !set.uniformScores() {
+		return []byte("+(nil)\r\n\r\n"), nil
 	}
 
-	deletedCount := 0
-
-	// All the members have the same score
-	for _, m := range members {
-		if slices.Contains([]int{1, 0}, compareLex(string(m.value), minimum)) &&
-			slices.Contains([]int{-1, 0}, compareLex(string(m.value), maximum)) {
-			set.Remove(m.value)
-			deletedCount += 1
-		}
+	deletedCount := set.RemoveRangeByLex(Value(minimum), Value(maximum))
+	if deletedCount > 0 {
+		server.NotifyKeyspaceEvent(ctx, utils.SortedSetEvents, "zremrangebylex", key)
 	}
 
 	return []byte(fmt.Sprintf(":%d\r\n\r\n", deletedCount)), nil
@@ -1142,69 +1039,17 @@ func handleZRANGE(ctx context.Context, cmd []string, server utils.Server, conn *
 	}
 
 	key := cmd[1]
-	policy := "byscore"
-	scoreStart := math.Inf(-1) // Lower bound if policy is "byscore"
-	scoreStop := math.Inf(1)   // Upper bound if policy is "byfloat"
-	lexStart := cmd[2]         // Lower bound if policy is "bylex"
-	lexStop := cmd[3]          // Upper bound if policy is "bylex"
-	offset := 0
-	count := -1
-
-	withscores := slices.ContainsFunc(cmd[4:], func(s string) bool {
-		return strings.EqualFold(s, "withscores")
-	})
-
-	reverse := slices.ContainsFunc(cmd[4:], func(s string) bool {
-		return strings.EqualFold(s, "rev")
-	})
-
-	if slices.ContainsFunc(cmd[4:], func(s string) bool {
-		return strings.EqualFold(s, "bylex")
-	}) {
-		policy = "bylex"
-	} else {
-		// policy is "byscore" make sure start and stop are valid float values
-		fStart, err := strconv.ParseFloat(cmd[2], 64)
-		if err != nil {
-			return nil, err
-		}
-		scoreStart = fStart
-		fStop, err := strconv.ParseFloat(cmd[3], 64)
-		if err != nil {
-			return nil, err
-		}
-		scoreStop = fStop
-	}
 
-	if slices.ContainsFunc(cmd[4:], func(s string) bool {
-		return strings.EqualFold(s, "limit")
-	}) {
-		limitIdx := slices.IndexFunc(cmd[4:], func(s string) bool {
-			return strings.EqualFold(s, "limit")
-		})
-		if limitIdx != -1 && limitIdx > len(cmd[4:])-3 {
-			return nil, errors.New("limit should contain offset and count as integers")
-		}
-		o, err := strconv.Atoi(cmd[4:][limitIdx+1])
-		if err != nil {
-			return nil, err
-		}
-		if o < 0 {
-			return nil, errors.New("offset must be >= 0")
-		}
-		offset = o
-		c, err := strconv.Atoi(cmd[4:][limitIdx+2])
-		if err != nil {
-			return nil, err
-		}
-		count = c
+	opts, err := parseRangeOptions(cmd[2], cmd[3], cmd[4:])
+	if err != nil {
+		return nil, err
 	}
 
 	if !server.KeyExists(key) {
 		return []byte("+(nil)\r\n\r\n"), nil
 	}
 
-	_, err := server.KeyRLock(ctx, key)
+	_, err = server.KeyRLock(ctx, key)
 	if err != nil {
 		return nil, err
 	}
@@ -1215,62 +1060,14 @@ func handleZRANGE(ctx context.Context, cmd []string, server utils.Server, conn *
 		return nil, fmt.Errorf("value at %s is not a sorted set", key)
 	}
 
-	if offset > set.Cardinality() {
-		return []byte("*0\r\n\r\n"), nil
-	}
-	if count < 0 {
-		count = set.Cardinality() - offset
-	}
-
-	members := set.GetAll()
-	if strings.EqualFold(policy, "byscore") {
-		slices.SortFunc(members, func(a, b MemberParam) int {
-			// Do a score sort
-			if reverse {
-				return cmp.Compare(b.score, a.score)
-			}
-			return cmp.Compare(a.score, b.score)
-		})
-	}
-	if strings.EqualFold(policy, "bylex") {
-		// If policy is BYLEX, all the elements must have the same score
-		for i := 0; i < len(members)-1; i++ {
-			if members[i].score != members[i+1].score {
-				return []byte("*0\r\n\r\n"), nil
-			}
-		}
-		slices.SortFunc(members, func(a, b MemberParam) int {
-			if reverse {
-				return compareLex(string(b.value), string(a.value))
-			}
-			return compareLex(string(a.value), string(b.value))
-		})
-	}
-
-	var resultMembers []MemberParam
-
-	for i := offset; i <= count; i++ {
-		if i >= len(members) {
-			break
-		}
-		if strings.EqualFold(policy, "byscore") {
-			if members[i].score >= Score(scoreStart) && members[i].score <= Score(scoreStop) {
-				resultMembers = append(resultMembers, members[i])
-			}
-			continue
-		}
-		if slices.Contains([]int{1, 0}, compareLex(string(members[i].value), lexStart)) &&
-			slices.Contains([]int{-1, 0}, compareLex(string(members[i].value), lexStop)) {
-			resultMembers = append(resultMembers, members[i])
-		}
-	}
+	resultMembers := rangeMembers(set, opts)
 
 	res := fmt.Sprintf("*%d", len(resultMembers))
 	if len(resultMembers) == 0 {
 		res += "\r\n\r\n"
 	}
 	for i, m := range resultMembers {
-		if withscores {
+		if opts.withscores {
 			score := strconv.FormatFloat(float64(m.score), 'f', -1, 64)
 			s := fmt.Sprintf("%s %s", m.value, score)
 			res += fmt.Sprintf("\r\n$%d\r\n%s", len(s), s)
@@ -1292,62 +1089,17 @@ func handleZRANGESTORE(ctx context.Context, cmd []string, server utils.Server, c
 
 	destination := cmd[1]
 	source := cmd[2]
-	policy := "byscore"
-	scoreStart := math.Inf(-1) // Lower bound if policy is "byscore"
-	scoreStop := math.Inf(1)   // Upper bound if policy is "byfloat"
-	lexStart := cmd[3]         // Lower bound if policy is "bylex"
-	lexStop := cmd[4]          // Upper bound if policy is "bylex"
-	offset := 0
-	count := -1
-
-	reverse := slices.ContainsFunc(cmd[5:], func(s string) bool {
-		return strings.EqualFold(s, "rev")
-	})
-
-	if slices.ContainsFunc(cmd[5:], func(s string) bool {
-		return strings.EqualFold(s, "bylex")
-	}) {
-		policy = "bylex"
-	} else {
-		// policy is "byscore" make sure start and stop are valid float values
-		fStart, err := strconv.ParseFloat(cmd[3], 64)
-		if err != nil {
-			return nil, err
-		}
-		scoreStart = fStart
-		fStop, err := strconv.ParseFloat(cmd[4], 64)
-		if err != nil {
-			return nil, err
-		}
-		scoreStop = fStop
-	}
 
-	if slices.ContainsFunc(cmd[5:], func(s string) bool {
-		return strings.EqualFold(s, "limit")
-	}) {
-		limitIdx := slices.IndexFunc(cmd[5:], func(s string) bool {
-			return strings.EqualFold(s, "limit")
-		})
-		if limitIdx != -1 && limitIdx > len(cmd[5:])-3 {
-			return nil, errors.New("limit should contain offset and count as integers")
-		}
-		o, err := strconv.Atoi(cmd[5:][limitIdx+1])
-		if err != nil {
-			return nil, err
-		}
-		offset = o
-		c, err := strconv.Atoi(cmd[5:][limitIdx+2])
-		if err != nil {
-			return nil, err
-		}
-		count = c
+	opts, err := parseRangeOptions(cmd[3], cmd[4], cmd[5:])
+	if err != nil {
+		return nil, err
 	}
 
 	if !server.KeyExists(source) {
 		return []byte("+(nil)\r\n\r\n"), nil
 	}
 
-	_, err := server.KeyRLock(ctx, source)
+	_, err = server.KeyRLock(ctx, source)
 	if err != nil {
 		return nil, err
 	}
@@ -1358,57 +1110,7 @@ func handleZRANGESTORE(ctx context.Context, cmd []string, server utils.Server, c
 		return nil, fmt.Errorf("value at %s is not a sorted set", source)
 	}
 
-	if offset > set.Cardinality() {
-		return []byte("*0\r\n\r\n"), nil
-	}
-	if count < 0 {
-		count = set.Cardinality() - offset
-	}
-
-	members := set.GetAll()
-	if strings.EqualFold(policy, "byscore") {
-		slices.SortFunc(members, func(a, b MemberParam) int {
-			// Do a score sort
-			if reverse {
-				return cmp.Compare(b.score, a.score)
-			}
-			return cmp.Compare(a.score, b.score)
-		})
-	}
-	if strings.EqualFold(policy, "bylex") {
-		// If policy is BYLEX, all the elements must have the same score
-		for i := 0; i < len(members)-1; i++ {
-			if members[i].score != members[i+1].score {
-				return []byte("*0\r\n\r\n"), nil
-			}
-		}
-		slices.SortFunc(members, func(a, b MemberParam) int {
-			if reverse {
-				return compareLex(string(b.value), string(a.value))
-			}
-			return compareLex(string(a.value), string(b.value))
-		})
-	}
-
-	var resultMembers []MemberParam
-
-	for i := offset; i <= count; i++ {
-		if i >= len(members) {
-			break
-		}
-		if strings.EqualFold(policy, "byscore") {
-			if members[i].score >= Score(scoreStart) && members[i].score <= Score(scoreStop) {
-				resultMembers = append(resultMembers, members[i])
-			}
-			continue
-		}
-		if slices.Contains([]int{1, 0}, compareLex(string(members[i].value), lexStart)) &&
-			slices.Contains([]int{-1, 0}, compareLex(string(members[i].value), lexStop)) {
-			resultMembers = append(resultMembers, members[i])
-		}
-	}
-
-	newSortedSet := NewSortedSet(resultMembers)
+	newSortedSet := NewSortedSet(rangeMembers(set, opts))
 
 	if server.KeyExists(destination) {
 		_, err := server.KeyLock(ctx, destination)
@@ -1424,6 +1126,7 @@ func handleZRANGESTORE(ctx context.Context, cmd []string, server utils.Server, c
 	defer server.KeyUnlock(destination)
 
 	server.SetValue(ctx, destination, newSortedSet)
+	server.NotifyKeyspaceEvent(ctx, utils.SortedSetEvents, "zrangestore", destination)
 
 	return []byte(fmt.Sprintf(":%d\r\n\r\n", newSortedSet.Cardinality())), nil
 }
@@ -1561,6 +1264,7 @@ func handleZUNIONSTORE(ctx context.Context, cmd []string, server utils.Server, c
 	defer server.KeyUnlock(destination)
 
 	server.SetValue(ctx, destination, union)
+	server.NotifyKeyspaceEvent(ctx, utils.SortedSetEvents, "zunionstore", destination)
 
 	return []byte(fmt.Sprintf(":%d\r\n\r\n", union.Cardinality())), nil
 }
@@ -0,0 +1,217 @@
+package sorted_set
+
+import (
+	"cmp"
+	"math/rand"
+)
+
+const (
+	skiplistMaxLevel = 32
+	skiplistP        = 0.25
+)
+
+type skiplistLevel struct {
+	forward *skiplistNode
+	// span is the number of nodes between this node and forward on level 0, counting forward itself.
+	span int
+}
+
+type skiplistNode struct {
+	value    Value
+	score    Score
+	backward *skiplistNode
+	levels   []skiplistLevel
+}
+
+// compare orders the node against the member with the given score and value.
+// Members are ordered by score, and members with equal scores are ordered by value.
+func (n *skiplistNode) compare(score Score, value Value) int {
+	if c := cmp.Compare(n.score, score); c != 0 {
+		return c
+	}
+	return cmp.Compare(n.value, value)
+}
+
+// skiplist keeps the members of a sorted set in order. Each level records the span it skips,
+// so the rank of a node is the sum of the spans along the path to it.
+// Ranks are 1-based, and the header has rank 0.
+type skiplist struct {
+	header *skiplistNode
+	tail   *skiplistNode
+	length int
+	level  int
+}
+
+func newSkiplist() *skiplist {
+	return &skiplist{
+		header: &skiplistNode{levels: make([]skiplistLevel, skiplistMaxLevel)},
+		level:  1,
+	}
+}
+
+func randomLevel() int {
+	level := 1
+	for level < skiplistMaxLevel && rand.Float64() < skiplistP {
+		level++
+	}
+	return level
+}
+
+// insert adds a member. The member must not already be in the list.
+func (sl *skiplist) insert(score Score, value Value) {
+	var update [skiplistMaxLevel]*skiplistNode
+	var rank [skiplistMaxLevel]int
+
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		if i < sl.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for x.levels[i].forward != nil && x.levels[i].forward.compare(score, value) < 0 {
+			rank[i] += x.levels[i].span
+			x = x.levels[i].forward
+		}
+		update[i] = x
+	}
+
+	level := randomLevel()
+	if level > sl.level {
+		for i := sl.level; i < level; i++ {
+			rank[i] = 0
+			update[i] = sl.header
+			update[i].levels[i].span = sl.length
+		}
+		sl.level = level
+	}
+
+	x = &skiplistNode{value: value, score: score, levels: make([]skiplistLevel, level)}
+	for i := 0; i < level; i++ {
+		x.levels[i].forward = update[i].levels[i].forward
+		update[i].levels[i].forward = x
+		x.levels[i].span = update[i].levels[i].span - (rank[0] - rank[i])
+		update[i].levels[i].span = rank[0] - rank[i] + 1
+	}
+	for i := level; i < sl.level; i++ {
+		update[i].levels[i].span++
+	}
+
+	if update[0] != sl.header {
+		x.backward = update[0]
+	}
+	if x.levels[0].forward != nil {
+		x.levels[0].forward.backward = x
+	} else {
+		sl.tail = x
+	}
+	sl.length++
+}
+
+// deleteNode unlinks x, where update holds the last node before x on every level.
+func (sl *skiplist) deleteNode(x *skiplistNode, update []*skiplistNode) {
+	for i := 0; i < sl.level; i++ {
+		if update[i].levels[i].forward == x {
+			update[i].levels[i].span += x.levels[i].span - 1
+			update[i].levels[i].forward = x.levels[i].forward
+		} else {
+			update[i].levels[i].span--
+		}
+	}
+	if x.levels[0].forward != nil {
+		x.levels[0].forward.backward = x.backward
+	} else {
+		sl.tail = x.backward
+	}
+	for sl.level > 1 && sl.header.levels[sl.level-1].forward == nil {
+		sl.level--
+	}
+	sl.length--
+}
+
+// delete removes a member and reports whether it was found.
+func (sl *skiplist) delete(score Score, value Value) bool {
+	var update [skiplistMaxLevel]*skiplistNode
+
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && x.levels[i].forward.compare(score, value) < 0 {
+			x = x.levels[i].forward
+		}
+		update[i] = x
+	}
+
+	x = x.levels[0].forward
+	if x == nil || x.compare(score, value) != 0 {
+		return false
+	}
+	sl.deleteNode(x, update[:])
+	return true
+}
+
+// deleteRange removes the nodes with ranks from start to stop inclusive and returns them.
+func (sl *skiplist) deleteRange(start, stop int) []*skiplistNode {
+	var update [skiplistMaxLevel]*skiplistNode
+
+	traversed := 0
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && traversed+x.levels[i].span < start {
+			traversed += x.levels[i].span
+			x = x.levels[i].forward
+		}
+		update[i] = x
+	}
+
+	var removed []*skiplistNode
+	x = x.levels[0].forward
+	for rank := traversed + 1; x != nil && rank <= stop; rank++ {
+		next := x.levels[0].forward
+		sl.deleteNode(x, update[:])
+		removed = append(removed, x)
+		x = next
+	}
+	return removed
+}
+
+// seek returns the last node for which before returns true, along with its rank.
+// before must hold for a prefix of the list. If it holds for no node, the header and rank 0 are returned.
+func (sl *skiplist) seek(before func(n *skiplistNode) bool) (*skiplistNode, int) {
+	rank := 0
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && before(x.levels[i].forward) {
+			rank += x.levels[i].span
+			x = x.levels[i].forward
+		}
+	}
+	return x, rank
+}
+
+// rank returns the rank of a member, or 0 if it is not in the list.
+func (sl *skiplist) rank(score Score, value Value) int {
+	x, rank := sl.seek(func(n *skiplistNode) bool {
+		return n.compare(score, value) <= 0
+	})
+	if x != sl.header && x.compare(score, value) == 0 {
+		return rank
+	}
+	return 0
+}
+
+// byRank returns the node with the given rank, or nil if the rank is out of range.
+func (sl *skiplist) byRank(rank int) *skiplistNode {
+	if rank < 1 || rank > sl.length {
+		return nil
+	}
+	traversed := 0
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && traversed+x.levels[i].span <= rank {
+			traversed += x.levels[i].span
+			x = x.levels[i].forward
+		}
+		if traversed == rank {
+			return x
+		}
+	}
+	return nil
+}
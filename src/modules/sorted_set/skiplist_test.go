@@ -0,0 +1,238 @@
+package sorted_set
+
+import (
+	"cmp"
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+type skiplistMember struct {
+	score Score
+	value Value
+}
+
+func compareMembers(a, b skiplistMember) int {
+	if c := cmp.Compare(a.score, b.score); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.value, b.value)
+}
+
+// checkSkiplist compares the skiplist with the expected members, which must be sorted,
+// and checks the spans, backward links and tail of the list.
+func checkSkiplist(t *testing.T, sl *skiplist, expected []skiplistMember) {
+	t.Helper()
+
+	if sl.length != len(expected) {
+		t.Fatalf("expected length %d, got %d", len(expected), sl.length)
+	}
+
+	ranks := map[*skiplistNode]int{sl.header: 0}
+	var prev *skiplistNode
+	i := 0
+	for x := sl.header.levels[0].forward; x != nil; x = x.levels[0].forward {
+		if i >= len(expected) {
+			t.Fatalf("list holds more than %d members", len(expected))
+		}
+		if x.score != expected[i].score || x.value != expected[i].value {
+			t.Fatalf("expected %v at rank %d, got {%v %v}", expected[i], i+1, x.score, x.value)
+		}
+		if x.backward != prev {
+			t.Fatalf("backward link of rank %d is wrong", i+1)
+		}
+		i++
+		ranks[x] = i
+		prev = x
+	}
+	if sl.tail != prev {
+		t.Fatal("the tail is not the last node")
+	}
+
+	for level := 0; level < sl.level; level++ {
+		for x := sl.header; x != nil; x = x.levels[level].forward {
+			forward := x.levels[level].forward
+			expectedSpan := sl.length - ranks[x]
+			if forward != nil {
+				expectedSpan = ranks[forward] - ranks[x]
+			}
+			if x.levels[level].span != expectedSpan {
+				t.Fatalf("span of rank %d on level %d: expected %d, got %d",
+					ranks[x], level, expectedSpan, x.levels[level].span)
+			}
+		}
+	}
+	if sl.level > 1 && sl.header.levels[sl.level-1].forward == nil {
+		t.Fatalf("top level %d is empty", sl.level)
+	}
+}
+
+func TestSkiplist(t *testing.T) {
+	members := []skiplistMember{
+		{score: 1, value: "a"},
+		{score: 2, value: "b"},
+		{score: 2, value: "c"},
+		{score: 3, value: "d"},
+		{score: -1, value: "e"},
+	}
+
+	tests := []struct {
+		name     string
+		run      func(sl *skiplist)
+		expected []skiplistMember
+	}{
+		{
+			name:     "members are ordered by score and then by value",
+			run:      func(sl *skiplist) {},
+			expected: []skiplistMember{members[4], members[0], members[1], members[2], members[3]},
+		},
+		{
+			name: "delete a member in the middle",
+			run: func(sl *skiplist) {
+				sl.delete(2, "b")
+			},
+			expected: []skiplistMember{members[4], members[0], members[2], members[3]},
+		},
+		{
+			name: "delete the head and the tail",
+			run: func(sl *skiplist) {
+				sl.delete(-1, "e")
+				sl.delete(3, "d")
+			},
+			expected: []skiplistMember{members[0], members[1], members[2]},
+		},
+		{
+			name: "a member is not deleted with the wrong score",
+			run: func(sl *skiplist) {
+				sl.delete(5, "a")
+			},
+			expected: []skiplistMember{members[4], members[0], members[1], members[2], members[3]},
+		},
+		{
+			name: "delete a range of ranks",
+			run: func(sl *skiplist) {
+				sl.deleteRange(2, 4)
+			},
+			expected: []skiplistMember{members[4], members[3]},
+		},
+		{
+			name: "delete a range past the end",
+			run: func(sl *skiplist) {
+				sl.deleteRange(4, 10)
+			},
+			expected: []skiplistMember{members[4], members[0], members[1]},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sl := newSkiplist()
+			for _, m := range members {
+				sl.insert(m.score, m.value)
+			}
+			test.run(sl)
+			checkSkiplist(t, sl, test.expected)
+		})
+	}
+}
+
+func TestSkiplistRank(t *testing.T) {
+	sl := newSkiplist()
+	for i, value := range []Value{"a", "b", "c"} {
+		sl.insert(Score(i), value)
+	}
+
+	tests := []struct {
+		score Score
+		value Value
+		rank  int
+	}{
+		{score: 0, value: "a", rank: 1},
+		{score: 2, value: "c", rank: 3},
+		{score: 1, value: "x", rank: 0},
+		{score: 5, value: "c", rank: 0},
+		{score: 1.5, value: "b", rank: 0},
+	}
+
+	for _, test := range tests {
+		if rank := sl.rank(test.score, test.value); rank != test.rank {
+			t.Errorf("rank(%v, %s): expected %d, got %d", test.score, test.value, test.rank, rank)
+		}
+	}
+
+	for rank, value := range []Value{"a", "b", "c"} {
+		if x := sl.byRank(rank + 1); x == nil || x.value != value {
+			t.Errorf("byRank(%d): expected %s, got %v", rank+1, value, x)
+		}
+	}
+	if sl.byRank(0) != nil || sl.byRank(4) != nil {
+		t.Error("expected ranks out of range to return nil")
+	}
+}
+
+// TestSkiplistRandom applies random operations to a skiplist and to a sorted slice, and checks that they
+// stay the same.
+func TestSkiplistRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	sl := newSkiplist()
+	var expected []skiplistMember
+
+	for op := 0; op < 20000; op++ {
+		m := skiplistMember{score: Score(rng.Intn(100)), value: Value(fmt.Sprintf("m%d", rng.Intn(500)))}
+		i, found := slices.BinarySearchFunc(expected, m, compareMembers)
+
+		switch n := rng.Intn(100); {
+		case n < 50:
+			if found {
+				continue
+			}
+			sl.insert(m.score, m.value)
+			expected = slices.Insert(expected, i, m)
+		case n < 75:
+			if deleted := sl.delete(m.score, m.value); deleted != found {
+				t.Fatalf("delete(%v, %s): expected %v, got %v", m.score, m.value, found, deleted)
+			}
+			if found {
+				expected = slices.Delete(expected, i, i+1)
+			}
+		case n < 80:
+			if len(expected) == 0 {
+				continue
+			}
+			start := rng.Intn(len(expected)) + 1
+			stop := start + rng.Intn(10)
+			removed := sl.deleteRange(start, stop)
+			end := min(stop, len(expected))
+			for j, x := range removed {
+				if x.score != expected[start-1+j].score || x.value != expected[start-1+j].value {
+					t.Fatalf("deleteRange(%d, %d) removed {%v %v} at %d", start, stop, x.score, x.value, j)
+				}
+			}
+			if len(removed) != end-start+1 {
+				t.Fatalf("deleteRange(%d, %d): expected %d removed, got %d", start, stop, end-start+1, len(removed))
+			}
+			expected = slices.Delete(expected, start-1, end)
+		default:
+			expectedRank := 0
+			if found {
+				expectedRank = i + 1
+			}
+			if rank := sl.rank(m.score, m.value); rank != expectedRank {
+				t.Fatalf("rank(%v, %s): expected %d, got %d", m.score, m.value, expectedRank, rank)
+			}
+			if len(expected) > 0 {
+				r := rng.Intn(len(expected)) + 1
+				if x := sl.byRank(r); x == nil || x.score != expected[r-1].score || x.value != expected[r-1].value {
+					t.Fatalf("byRank(%d): expected %v, got %v", r, expected[r-1], x)
+				}
+			}
+		}
+
+		if op%100 == 0 {
+			checkSkiplist(t, sl, expected)
+		}
+	}
+
+	checkSkiplist(t, sl, expected)
+}
@@ -1,7 +1,7 @@
 package sorted_set
 
 import (
-	"cmp"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"github.com/kelvinmwinuka/memstore/src/utils"
@@ -28,81 +28,97 @@ type MemberParam struct {
 	score Score
 }
 
+// SortedSet keeps a score for each member and a skiplist of the members in score order,
+// so that lookups by member and by rank or score range are both cheap.
 type SortedSet struct {
-	members map[Value]MemberObject
+	members map[Value]Score
+	list    *skiplist
 }
 
 func NewSortedSet(members []MemberParam) *SortedSet {
 	s := &SortedSet{
-		members: make(map[Value]MemberObject),
+		members: make(map[Value]Score),
+		list:    newSkiplist(),
 	}
 	for _, m := range members {
-		s.members[m.value] = MemberObject{
-			value:  m.value,
-			score:  m.score,
-			exists: true,
-		}
+		s.put(m.value, m.score)
 	}
 	return s
 }
 
+// put sets the score of a member, adding the member if it does not exist.
+func (set *SortedSet) put(v Value, score Score) {
+	if math.IsNaN(float64(score)) {
+		// NaN cannot be ordered. It can only come from adding opposite infinities, which Redis treats as 0.
+		score = 0
+	}
+	if old, ok := set.members[v]; ok {
+		if old == score {
+			return
+		}
+		set.list.delete(old, v)
+	}
+	set.list.insert(score, v)
+	set.members[v] = score
+}
+
 func (set *SortedSet) Contains(m Value) bool {
-	return set.members[m].exists
+	_, ok := set.members[m]
+	return ok
 }
 
 func (set *SortedSet) Get(v Value) MemberObject {
-	return set.members[v]
+	score, ok := set.members[v]
+	if !ok {
+		return MemberObject{}
+	}
+	return MemberObject{
+		value:  v,
+		score:  score,
+		exists: true,
+	}
 }
 
 func (set *SortedSet) GetRandom(count int) []MemberParam {
-	var res []MemberParam
-
-	members := set.GetAll()
+	n := set.Cardinality()
 
-	if utils.AbsInt(count) >= len(members) {
-		return members
+	if utils.AbsInt(count) >= n {
+		return set.GetAll()
 	}
 
-	var n int
+	res := make([]MemberParam, 0, utils.AbsInt(count))
 
 	if count < 0 {
-		// If count is negative, allow repeat numbers
+		// If count is negative, allow repeat members
 		for i := 0; i < utils.AbsInt(count); i++ {
-			n = rand.Intn(len(members))
-			res = append(res, members[n])
+			x := set.list.byRank(rand.Intn(n) + 1)
+			res = append(res, MemberParam{value: x.value, score: x.score})
 		}
-	} else {
-		// If count is positive only allow unique values
-		for i := 0; i < utils.AbsInt(count); {
-			n = rand.Intn(len(members))
-			if !slices.ContainsFunc(res, func(m MemberParam) bool {
-				return m.value == members[n].value
-			}) {
-				res = append(res, members[n])
-				slices.DeleteFunc(members, func(m MemberParam) bool {
-					return m.value == members[n].value
-				})
-				i++
-			}
+		return res
+	}
+
+	// If count is positive only allow unique members
+	picked := make(map[int]struct{}, count)
+	for len(res) < count {
+		rank := rand.Intn(n) + 1
+		if _, ok := picked[rank]; ok {
+			continue
 		}
+		picked[rank] = struct{}{}
+		x := set.list.byRank(rank)
+		res = append(res, MemberParam{value: x.value, score: x.score})
 	}
 
 	return res
 }
 
+// GetAll returns all the members ordered from the lowest score to the highest.
 func (set *SortedSet) GetAll() []MemberParam {
-	var res []MemberParam
-	for k, v := range set.members {
-		res = append(res, MemberParam{
-			value: k,
-			score: v.score,
-		})
-	}
-	return res
+	return set.collect(0, set.Cardinality()-1, false)
 }
 
 func (set *SortedSet) Cardinality() int {
-	return len(set.GetAll())
+	return len(set.members)
 }
 
 func (set *SortedSet) AddOrUpdate(
@@ -138,14 +154,10 @@ func (set *SortedSet) AddOrUpdate(
 			if !set.Contains(m.value) {
 				return count, fmt.Errorf("cannot increment member %s as it does not exist in the sorted set", m.value)
 			}
-			if utils.Contains([]Score{Score(math.Inf(-1)), Score(math.Inf(1))}, set.members[m.value].score) {
+			if utils.Contains([]Score{Score(math.Inf(-1)), Score(math.Inf(1))}, set.members[m.value]) {
 				return count, errors.New("cannot increment -inf or +inf")
 			}
-			set.members[m.value] = MemberObject{
-				value:  m.value,
-				score:  set.members[m.value].score + m.score,
-				exists: true,
-			}
+			set.put(m.value, set.members[m.value]+m.score)
 			if strings.EqualFold(ch, "ch") {
 				count += 1
 			}
@@ -157,11 +169,7 @@ func (set *SortedSet) AddOrUpdate(
 		if strings.EqualFold(policy, "xx") {
 			// Only update existing elements, do not add new elements
 			if set.Contains(m.value) {
-				set.members[m.value] = MemberObject{
-					value:  m.value,
-					score:  compareScores(set.members[m.value].score, m.score, comp),
-					exists: true,
-				}
+				set.put(m.value, compareScores(set.members[m.value], m.score, comp))
 				if strings.EqualFold(ch, "ch") {
 					count += 1
 				}
@@ -171,34 +179,34 @@ func (set *SortedSet) AddOrUpdate(
 		if strings.EqualFold(policy, "nx") {
 			// Only add new elements, do not update existing elements
 			if !set.Contains(m.value) {
-				set.members[m.value] = MemberObject{
-					value:  m.value,
-					score:  m.score,
-					exists: true,
-				}
+				set.put(m.value, m.score)
 				count += 1
 			}
 			continue
 		}
 		// Policy not specified, just set the elements and scores
-		if set.members[m.value].score != m.score || !set.members[m.value].exists {
+		score, ok := set.members[m.value]
+		if !ok {
+			set.put(m.value, m.score)
 			count += 1
+			continue
 		}
-		set.members[m.value] = MemberObject{
-			value:  m.value,
-			score:  compareScores(set.members[m.value].score, m.score, comp),
-			exists: true,
+		if score != m.score {
+			count += 1
 		}
+		set.put(m.value, compareScores(score, m.score, comp))
 	}
 	return count, nil
 }
 
 func (set *SortedSet) Remove(v Value) bool {
-	if set.Contains(v) {
-		delete(set.members, v)
-		return true
+	score, ok := set.members[v]
+	if !ok {
+		return false
 	}
-	return false
+	set.list.delete(score, v)
+	delete(set.members, v)
+	return true
 }
 
 func (set *SortedSet) Subtract(others []*SortedSet) *SortedSet {
@@ -314,26 +322,213 @@ func (set *SortedSet) Pop(count int, policy string) (*SortedSet, error) {
 		return popped, nil
 	}
 
-	members := set.GetAll()
+	for i := 0; i < count && set.Cardinality() > 0; i++ {
+		x := set.list.header.levels[0].forward
+		if strings.EqualFold(policy, "max") {
+			x = set.list.tail
+		}
+		set.Remove(x.value)
+		popped.put(x.value, x.score)
+	}
+
+	return popped, nil
+}
 
-	slices.SortFunc(members, func(a, b MemberParam) int {
-		if strings.EqualFold(policy, "min") {
-			return cmp.Compare(a.score, b.score)
+// collect returns the members with 0-based ranks from first to last inclusive,
+// walking backwards from last if reverse is set.
+func (set *SortedSet) collect(first, last int, reverse bool) []MemberParam {
+	first, last = max(first, 0), min(last, set.Cardinality()-1)
+	if first > last {
+		return []MemberParam{}
+	}
+	res := make([]MemberParam, 0, last-first+1)
+	if reverse {
+		for x := set.list.byRank(last + 1); len(res) < cap(res); x = x.backward {
+			res = append(res, MemberParam{value: x.value, score: x.score})
 		}
-		return cmp.Compare(b.score, a.score)
-	})
-
-	for i := 0; i < count; i++ {
-		if i < len(members) {
-			set.Remove(members[i].value)
-			_, err := popped.AddOrUpdate([]MemberParam{members[i]}, nil, nil, nil, nil)
-			if err != nil {
-				fmt.Println(err.Error())
-				// TODO: Add all the removed elements back if we encounter an error
-				return nil, err
-			}
+		return res
+	}
+	for x := set.list.byRank(first + 1); len(res) < cap(res); x = x.levels[0].forward {
+		res = append(res, MemberParam{value: x.value, score: x.score})
+	}
+	return res
+}
+
+// limit narrows the 0-based rank range from first to last down to count members after skipping offset.
+// The offset is counted from last if reverse is set. A negative count means no limit.
+func limit(first, last, offset, count int, reverse bool) (int, int) {
+	if reverse {
+		last -= offset
+		if count >= 0 {
+			first = max(first, last-count+1)
 		}
+		return first, last
+	}
+	first += offset
+	if count >= 0 {
+		last = min(last, first+count-1)
 	}
+	return first, last
+}
 
-	return popped, nil
+// normaliseRanks turns start and stop into 0-based ranks, where negative values count back from the highest rank.
+// If reverse is set, rank 0 is the member with the highest score.
+func (set *SortedSet) normaliseRanks(start, stop int, reverse bool) (int, int) {
+	n := set.Cardinality()
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if reverse {
+		start, stop = n-1-stop, n-1-start
+	}
+	return start, stop
+}
+
+// scoreRanks returns the 0-based rank range of the members with scores between minimum and maximum inclusive.
+func (set *SortedSet) scoreRanks(minimum, maximum Score) (int, int) {
+	_, first := set.list.seek(func(n *skiplistNode) bool { return n.score < minimum })
+	_, last := set.list.seek(func(n *skiplistNode) bool { return n.score <= maximum })
+	return first, last - 1
+}
+
+// lexRanks returns the 0-based rank range of the members between minimum and maximum inclusive.
+// It is only meaningful when all the members have the same score.
+func (set *SortedSet) lexRanks(minimum, maximum Value) (int, int) {
+	_, first := set.list.seek(func(n *skiplistNode) bool { return n.value < minimum })
+	_, last := set.list.seek(func(n *skiplistNode) bool { return n.value <= maximum })
+	return first, last - 1
+}
+
+// uniformScores reports whether all the members have the same score, which lexicographical ranges require.
+func (set *SortedSet) uniformScores() bool {
+	return set.Cardinality() == 0 || set.list.header.levels[0].forward.score == set.list.tail.score
+}
+
+// Rank returns the 0-based rank of a member ordered from the lowest score,
+// or from the highest score if reverse is set. ok is false if the member does not exist.
+func (set *SortedSet) Rank(v Value, reverse bool) (rank int, ok bool) {
+	score, ok := set.members[v]
+	if !ok {
+		return 0, false
+	}
+	rank = set.list.rank(score, v) - 1
+	if reverse {
+		rank = set.Cardinality() - 1 - rank
+	}
+	return rank, true
+}
+
+// RangeByRank returns the members with ranks from start to stop inclusive. Negative ranks count back from the end.
+// If reverse is set, the ranks are counted from the highest score and the members are returned in that order.
+func (set *SortedSet) RangeByRank(start, stop int, reverse bool) []MemberParam {
+	first, last := set.normaliseRanks(start, stop, reverse)
+	return set.collect(first, last, reverse)
+}
+
+// RangeByScore returns up to count members with scores between minimum and maximum inclusive, after skipping offset.
+// A negative count means no limit. If reverse is set, the members are returned from the highest score.
+func (set *SortedSet) RangeByScore(minimum, maximum Score, offset, count int, reverse bool) []MemberParam {
+	first, last := set.scoreRanks(minimum, maximum)
+	first, last = limit(first, last, offset, count, reverse)
+	return set.collect(first, last, reverse)
+}
+
+// RangeByLex returns up to count members between minimum and maximum inclusive, after skipping offset.
+// A negative count means no limit. If reverse is set, the members are returned in reverse order.
+func (set *SortedSet) RangeByLex(minimum, maximum Value, offset, count int, reverse bool) []MemberParam {
+	first, last := set.lexRanks(minimum, maximum)
+	first, last = limit(first, last, offset, count, reverse)
+	return set.collect(first, last, reverse)
+}
+
+// CountByScore returns the number of members with scores between minimum and maximum inclusive.
+func (set *SortedSet) CountByScore(minimum, maximum Score) int {
+	first, last := set.scoreRanks(minimum, maximum)
+	return max(last-first+1, 0)
+}
+
+// CountByLex returns the number of members between minimum and maximum inclusive.
+func (set *SortedSet) CountByLex(minimum, maximum Value) int {
+	first, last := set.lexRanks(minimum, maximum)
+	return max(last-first+1, 0)
+}
+
+// removeRanks removes the members with 0-based ranks from first to last inclusive and returns how many were removed.
+func (set *SortedSet) removeRanks(first, last int) int {
+	first, last = max(first, 0), min(last, set.Cardinality()-1)
+	if first > last {
+		return 0
+	}
+	removed := set.list.deleteRange(first+1, last+1)
+	for _, x := range removed {
+		delete(set.members, x.value)
+	}
+	return len(removed)
+}
+
+// RemoveRangeByRank removes the members with ranks from start to stop inclusive. Negative ranks count back from the end.
+func (set *SortedSet) RemoveRangeByRank(start, stop int) int {
+	return set.removeRanks(set.normaliseRanks(start, stop, false))
+}
+
+// RemoveRangeByScore removes the members with scores between minimum and maximum inclusive.
+func (set *SortedSet) RemoveRangeByScore(minimum, maximum Score) int {
+	return set.removeRanks(set.scoreRanks(minimum, maximum))
+}
+
+// RemoveRangeByLex removes the members between minimum and maximum inclusive.
+func (set *SortedSet) RemoveRangeByLex(minimum, maximum Value) int {
+	return set.removeRanks(set.lexRanks(minimum, maximum))
+}
+
+// SnapshotType implements utils.SnapshotEncoder.
+func (set *SortedSet) SnapshotType() string {
+	return "sorted_set"
+}
+
+// MarshalBinary implements utils.SnapshotEncoder. The set is encoded as its cardinality followed by
+// each member in order, as the score's IEEE 754 bits and then the value prefixed with its length.
+func (set *SortedSet) MarshalBinary() ([]byte, error) {
+	b := binary.AppendUvarint(nil, uint64(set.Cardinality()))
+	for x := set.list.header.levels[0].forward; x != nil; x = x.levels[0].forward {
+		b = binary.BigEndian.AppendUint64(b, math.Float64bits(float64(x.score)))
+		b = binary.AppendUvarint(b, uint64(len(x.value)))
+		b = append(b, x.value...)
+	}
+	return b, nil
+}
+
+// DecodeSnapshot restores a sorted set that was encoded with MarshalBinary.
+func DecodeSnapshot(b []byte) (interface{}, error) {
+	errInvalid := errors.New("invalid sorted set snapshot")
+
+	cardinality, n := binary.Uvarint(b)
+	if n <= 0 {
+		return nil, errInvalid
+	}
+	b = b[n:]
+
+	set := NewSortedSet([]MemberParam{})
+	for i := uint64(0); i < cardinality; i++ {
+		if len(b) < 8 {
+			return nil, errInvalid
+		}
+		score := Score(math.Float64frombits(binary.BigEndian.Uint64(b)))
+		b = b[8:]
+		size, n := binary.Uvarint(b)
+		if n <= 0 || size > uint64(len(b)-n) {
+			return nil, errInvalid
+		}
+		b = b[n:]
+		set.put(Value(b[:size]), score)
+		b = b[size:]
+	}
+	if len(b) != 0 || set.Cardinality() != int(cardinality) {
+		return nil, errInvalid
+	}
+
+	return set, nil
 }
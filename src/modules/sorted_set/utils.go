@@ -1,9 +1,10 @@
 package sorted_set
 
 import (
-	"cmp"
 	"errors"
+	"fmt"
 	"github.com/kelvinmwinuka/memstore/src/utils"
+	"math"
 	"slices"
 	"strconv"
 	"strings"
@@ -161,31 +162,111 @@ func compareScores(old Score, new Score, comp string) Score {
 	}
 }
 
-// compareLex returns -1 when s2 is lexicographically greater than s1,
-// 0 if they're equal and 1 if s2 is lexicographically less than s1.
-func compareLex(s1 string, s2 string) int {
-	if s1 == s2 {
-		return 0
+// parseScore parses a score argument. It accepts any float, including -inf and +inf, but not NaN.
+func parseScore(s string) (Score, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) {
+		return 0, errors.New("score is not a valid float")
 	}
-	if strings.Contains(s1, s2) {
-		return 1
-	}
-	if strings.Contains(s2, s1) {
-		return -1
+	return Score(f), nil
+}
+
+// rangeOptions holds the parsed arguments of ZRANGE and ZRANGESTORE.
+type rangeOptions struct {
+	policy     string // "byrank", "byscore" or "bylex"
+	reverse    bool
+	withscores bool
+	rankStart  int
+	rankStop   int
+	scoreMin   Score
+	scoreMax   Score
+	lexMin     Value
+	lexMax     Value
+	offset     int
+	count      int
+}
+
+// parseRangeOptions parses the start and stop arguments of a range command along with its options.
+// As in Redis, the range is by rank unless BYSCORE or BYLEX is given, and with REV the
+// score and lexicographical bounds are given from the highest to the lowest.
+func parseRangeOptions(start string, stop string, options []string) (rangeOptions, error) {
+	opts := rangeOptions{policy: "byrank", count: -1}
+	hasLimit := false
+
+	for i := 0; i < len(options); i++ {
+		switch strings.ToLower(options[i]) {
+		default:
+			return rangeOptions{}, fmt.Errorf("invalid option %s", options[i])
+		case "byscore", "bylex":
+			opts.policy = strings.ToLower(options[i])
+		case "rev":
+			opts.reverse = true
+		case "withscores":
+			opts.withscores = true
+		case "limit":
+			if i+2 >= len(options) {
+				return rangeOptions{}, errors.New("limit should contain offset and count as integers")
+			}
+			o, err := strconv.Atoi(options[i+1])
+			if err != nil {
+				return rangeOptions{}, err
+			}
+			if o < 0 {
+				return rangeOptions{}, errors.New("offset must be >= 0")
+			}
+			c, err := strconv.Atoi(options[i+2])
+			if err != nil {
+				return rangeOptions{}, err
+			}
+			opts.offset, opts.count = o, c
+			hasLimit = true
+			i += 2
+		}
 	}
 
-	limit := len(s1)
-	if len(s2) < limit {
-		limit = len(s2)
+	if opts.reverse && opts.policy != "byrank" {
+		start, stop = stop, start
 	}
 
-	var c int
-	for i := 0; i < limit; i++ {
-		c = cmp.Compare(s1[i], s2[i])
-		if c != 0 {
-			break
+	switch opts.policy {
+	case "byrank":
+		if hasLimit {
+			return rangeOptions{}, errors.New("LIMIT is only supported with BYSCORE or BYLEX")
+		}
+		var err error
+		if opts.rankStart, err = strconv.Atoi(start); err != nil {
+			return rangeOptions{}, errors.New("start and stop must be integers")
+		}
+		if opts.rankStop, err = strconv.Atoi(stop); err != nil {
+			return rangeOptions{}, errors.New("start and stop must be integers")
+		}
+	case "byscore":
+		var err error
+		if opts.scoreMin, err = parseScore(start); err != nil {
+			return rangeOptions{}, errors.New("min and max must be doubles")
+		}
+		if opts.scoreMax, err = parseScore(stop); err != nil {
+			return rangeOptions{}, errors.New("min and max must be doubles")
 		}
+	case "bylex":
+		opts.lexMin, opts.lexMax = Value(start), Value(stop)
 	}
 
-	return c
+	return opts, nil
+}
+
+// rangeMembers returns the members of the set selected by the range options.
+func rangeMembers(set *SortedSet, opts rangeOptions) []MemberParam {
+	switch opts.policy {
+	case "byscore":
+		return set.RangeByScore(opts.scoreMin, opts.scoreMax, opts.offset, opts.count, opts.reverse)
+	case "bylex":
+		// If policy is BYLEX, all the elements must have the same score
+		if !set.uniformScores() {
+			return []MemberParam{}
+		}
+		return set.RangeByLex(opts.lexMin, opts.lexMax, opts.offset, opts.count, opts.reverse)
+	default:
+		return set.RangeByRank(opts.rankStart, opts.rankStop, opts.reverse)
+	}
 }
@@ -5,8 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"github.com/kelvinmwinuka/memstore/src/utils"
+	"math"
 	"net"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type Plugin struct {
@@ -34,8 +37,8 @@ func handleSetRange(ctx context.Context, cmd []string, server utils.Server, conn
 
 	key := cmd[1]
 
-	offset, ok := utils.AdaptType(cmd[2]).(int64)
-	if !ok {
+	offset, err := strconv.ParseInt(cmd[2], 10, 64)
+	if err != nil {
 		return nil, errors.New("offset must be integer")
 	}
 
@@ -46,6 +49,7 @@ func handleSetRange(ctx context.Context, cmd []string, server utils.Server, conn
 			return nil, err
 		}
 		server.SetValue(ctx, key, newStr)
+		server.NotifyKeyspaceEvent(ctx, utils.StringEvents, "setrange", key)
 		server.KeyUnlock(key)
 		return []byte(fmt.Sprintf(":%d\r\n\n", len(newStr))), nil
 	}
@@ -63,24 +67,28 @@ func handleSetRange(ctx context.Context, cmd []string, server utils.Server, conn
 	if offset >= int64(len(str)) {
 		newStr = str + newStr
 		server.SetValue(ctx, key, newStr)
+		server.NotifyKeyspaceEvent(ctx, utils.StringEvents, "setrange", key)
 		return []byte(fmt.Sprintf(":%d\r\n\n", len(newStr))), nil
 	}
 
 	if offset < 0 {
 		newStr = newStr + str
 		server.SetValue(ctx, key, newStr)
+		server.NotifyKeyspaceEvent(ctx, utils.StringEvents, "setrange", key)
 		return []byte(fmt.Sprintf(":%d\r\n\n", len(newStr))), nil
 	}
 
 	if offset == 0 {
 		newStr = newStr + strings.Join(strings.Split(str, "")[1:], "")
 		server.SetValue(ctx, key, newStr)
+		server.NotifyKeyspaceEvent(ctx, utils.StringEvents, "setrange", key)
 		return []byte(fmt.Sprintf(":%d\r\n\n", len(newStr))), nil
 	}
 
 	if offset == int64(len(str))-1 {
 		newStr = strings.Join(strings.Split(str, "")[0:len(str)-1], "") + newStr
 		server.SetValue(ctx, key, newStr)
+		server.NotifyKeyspaceEvent(ctx, utils.StringEvents, "setrange", key)
 		return []byte(fmt.Sprintf(":%d\r\n\n", len(newStr))), nil
 	}
 
@@ -89,6 +97,7 @@ func handleSetRange(ctx context.Context, cmd []string, server utils.Server, conn
 
 	newStr = strings.Join(newStrArr, "")
 	server.SetValue(ctx, key, newStr)
+	server.NotifyKeyspaceEvent(ctx, utils.StringEvents, "setrange", key)
 
 	return []byte(fmt.Sprintf(":%d\r\n\n", len(newStr))), nil
 }
@@ -125,11 +134,11 @@ func handleSubStr(ctx context.Context, cmd []string, server utils.Server, conn *
 
 	key := cmd[1]
 
-	start, startOk := utils.AdaptType(cmd[2]).(int64)
-	end, endOk := utils.AdaptType(cmd[3]).(int64)
+	start, startErr := strconv.ParseInt(cmd[2], 10, 64)
+	end, endErr := strconv.ParseInt(cmd[3], 10, 64)
 	reversed := false
 
-	if !startOk || !endOk {
+	if startErr != nil || endErr != nil {
 		return nil, errors.New("start and end indices must be integers")
 	}
 
@@ -181,6 +190,348 @@ func handleSubStr(ctx context.Context, cmd []string, server utils.Server, conn *
 	return []byte(fmt.Sprintf("$%d\r\n%s\r\n\n", len(str), str)), nil
 }
 
+// integerValue returns the value as a 64-bit integer. A missing value counts as 0.
+func integerValue(key string, value interface{}) (int64, error) {
+	switch v := value.(type) {
+	case nil:
+		return 0, nil
+	case string:
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return n, nil
+		}
+	}
+	return 0, fmt.Errorf("value at key %s is not an integer or out of range", key)
+}
+
+// floatValue returns the value as a float64. A missing value counts as 0.
+func floatValue(key string, value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case nil:
+		return 0, nil
+	case string:
+		if f, err := strconv.ParseFloat(v, 64); err == nil && !math.IsNaN(f) && !math.IsInf(f, 0) {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("value at key %s is not a valid float", key)
+}
+
+// lockOrCreateKey write-locks the key, creating it if it does not exist yet.
+func lockOrCreateKey(ctx context.Context, server utils.Server, key string) error {
+	if !server.KeyExists(key) {
+		_, err := server.CreateKeyAndLock(ctx, key)
+		return err
+	}
+	_, err := server.KeyLock(ctx, key)
+	return err
+}
+
+// readString returns the string stored at the key, or ok == false if the key does not exist.
+func readString(ctx context.Context, server utils.Server, key string) (value string, ok bool, err error) {
+	if !server.KeyExists(key) {
+		return "", false, nil
+	}
+	if _, err = server.KeyRLock(ctx, key); err != nil {
+		return "", false, err
+	}
+	defer server.KeyRUnlock(key)
+	value, ok = server.GetValue(key).(string)
+	if !ok {
+		return "", false, fmt.Errorf("value at key %s is not a string", key)
+	}
+	return value, true, nil
+}
+
+func handleIncrBy(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	command := strings.ToLower(cmd[0])
+
+	var delta int64 = 1
+	switch command {
+	case "incr", "decr":
+		if len(cmd) != 2 {
+			return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+		}
+	default:
+		if len(cmd) != 3 {
+			return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+		}
+		n, err := strconv.ParseInt(cmd[2], 10, 64)
+		if err != nil {
+			return nil, errors.New("increment must be an integer")
+		}
+		delta = n
+	}
+	if command == "decr" || command == "decrby" {
+		if delta == math.MinInt64 {
+			return nil, errors.New("decrement would overflow")
+		}
+		delta = -delta
+	}
+
+	key := cmd[1]
+
+	if err := lockOrCreateKey(ctx, server, key); err != nil {
+		return nil, err
+	}
+	defer server.KeyUnlock(key)
+
+	current, err := integerValue(key, server.GetValue(key))
+	if err != nil {
+		return nil, err
+	}
+
+	if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+		return nil, errors.New("increment or decrement would overflow")
+	}
+
+	result := current + delta
+	server.SetValue(ctx, key, strconv.FormatInt(result, 10))
+	server.NotifyKeyspaceEvent(ctx, utils.StringEvents, "incrby", key)
+
+	return []byte(fmt.Sprintf(":%d\r\n\n", result)), nil
+}
+
+func handleIncrByFloat(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) != 3 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	key := cmd[1]
+
+	delta, err := strconv.ParseFloat(cmd[2], 64)
+	if err != nil || math.IsNaN(delta) || math.IsInf(delta, 0) {
+		return nil, errors.New("increment must be a valid float")
+	}
+
+	if err = lockOrCreateKey(ctx, server, key); err != nil {
+		return nil, err
+	}
+	defer server.KeyUnlock(key)
+
+	current, err := floatValue(key, server.GetValue(key))
+	if err != nil {
+		return nil, err
+	}
+
+	result := current + delta
+	if math.IsNaN(result) || math.IsInf(result, 0) {
+		return nil, errors.New("increment would produce NaN or Infinity")
+	}
+
+	str := strconv.FormatFloat(result, 'f', -1, 64)
+	server.SetValue(ctx, key, str)
+	server.NotifyKeyspaceEvent(ctx, utils.StringEvents, "incrbyfloat", key)
+
+	return []byte(fmt.Sprintf("$%d\r\n%s\r\n\n", len(str), str)), nil
+}
+
+func handleAppend(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) != 3 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	key := cmd[1]
+
+	if err := lockOrCreateKey(ctx, server, key); err != nil {
+		return nil, err
+	}
+	defer server.KeyUnlock(key)
+
+	str := ""
+	if value := server.GetValue(key); value != nil {
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("value at key %s is not a string", key)
+		}
+		str = s
+	}
+
+	str += cmd[2]
+	server.SetValue(ctx, key, str)
+	server.NotifyKeyspaceEvent(ctx, utils.StringEvents, "append", key)
+
+	return []byte(fmt.Sprintf(":%d\r\n\n", len(str))), nil
+}
+
+func handleGetSet(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) != 3 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	key := cmd[1]
+
+	if err := lockOrCreateKey(ctx, server, key); err != nil {
+		return nil, err
+	}
+	defer server.KeyUnlock(key)
+
+	value := server.GetValue(key)
+	old, ok := value.(string)
+	if value != nil && !ok {
+		return nil, fmt.Errorf("value at key %s is not a string", key)
+	}
+
+	server.SetValue(ctx, key, cmd[2])
+	server.SetExpiry(ctx, key, time.Time{})
+	server.NotifyKeyspaceEvent(ctx, utils.StringEvents, "set", key)
+
+	if value == nil {
+		return []byte("$-1\r\n\n"), nil
+	}
+	return []byte(fmt.Sprintf("$%d\r\n%s\r\n\n", len(old), old)), nil
+}
+
+func handleGetDel(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) != 2 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	key := cmd[1]
+
+	if !server.KeyExists(key) {
+		return []byte("$-1\r\n\n"), nil
+	}
+
+	// The value is read and the key deleted under one lock, so a write in between is never lost
+	if _, err := server.KeyLock(ctx, key); err != nil {
+		return nil, err
+	}
+	value, ok := server.GetValue(key).(string)
+	if !ok {
+		server.KeyUnlock(key)
+		return nil, fmt.Errorf("value at key %s is not a string", key)
+	}
+	server.DeleteLockedKey(ctx, key)
+	server.NotifyKeyspaceEvent(ctx, utils.GenericEvents, "del", key)
+
+	return []byte(fmt.Sprintf("$%d\r\n%s\r\n\n", len(value), value)), nil
+}
+
+func handleGetEx(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) < 2 || len(cmd) > 4 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	key := cmd[1]
+
+	var expireAt time.Time
+	persist := false
+
+	switch {
+	case len(cmd) == 3 && strings.EqualFold(cmd[2], "persist"):
+		persist = true
+	case len(cmd) == 4:
+		t, err := utils.ParseExpiry(utils.Now(ctx), cmd[2], cmd[3])
+		if err != nil {
+			return nil, err
+		}
+		expireAt = t
+	case len(cmd) != 2:
+		return nil, errors.New("GETEX accepts one of EX, PX, EXAT, PXAT or PERSIST")
+	}
+
+	if !server.KeyExists(key) {
+		return []byte("$-1\r\n\n"), nil
+	}
+
+	if _, err := server.KeyLock(ctx, key); err != nil {
+		return nil, err
+	}
+	defer server.KeyUnlock(key)
+
+	value, ok := server.GetValue(key).(string)
+	if !ok {
+		return nil, fmt.Errorf("value at key %s is not a string", key)
+	}
+
+	if persist {
+		if _, ok := server.GetExpiry(key); ok {
+			server.SetExpiry(ctx, key, time.Time{})
+			server.NotifyKeyspaceEvent(ctx, utils.GenericEvents, "persist", key)
+		}
+	} else if !expireAt.IsZero() {
+		server.SetExpiry(ctx, key, expireAt)
+		server.NotifyKeyspaceEvent(ctx, utils.GenericEvents, "expire", key)
+	}
+
+	return []byte(fmt.Sprintf("$%d\r\n%s\r\n\n", len(value), value)), nil
+}
+
+func handleLCS(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) < 3 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	withLen, withIdx, withMatchLen := false, false, false
+	minMatchLen := 0
+
+	for i := 3; i < len(cmd); i++ {
+		switch strings.ToLower(cmd[i]) {
+		default:
+			return nil, fmt.Errorf("unknown option %s", cmd[i])
+		case "len":
+			withLen = true
+		case "idx":
+			withIdx = true
+		case "withmatchlen":
+			withMatchLen = true
+		case "minmatchlen":
+			if i+1 >= len(cmd) {
+				return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+			}
+			n, err := strconv.Atoi(cmd[i+1])
+			if err != nil {
+				return nil, errors.New("minmatchlen must be an integer")
+			}
+			minMatchLen = max(n, 0)
+			i++
+		}
+	}
+
+	if withLen && withIdx {
+		return nil, errors.New("if you want both the length and indexes, please just use IDX")
+	}
+
+	a, _, err := readString(ctx, server, cmd[1])
+	if err != nil {
+		return nil, err
+	}
+	b, _, err := readString(ctx, server, cmd[2])
+	if err != nil {
+		return nil, err
+	}
+
+	lcs, matches, err := longestCommonSubsequence(a, b, minMatchLen)
+	if err != nil {
+		return nil, err
+	}
+
+	if withLen {
+		return []byte(fmt.Sprintf(":%d\r\n\n", len(lcs))), nil
+	}
+
+	if !withIdx {
+		return []byte(fmt.Sprintf("$%d\r\n%s\r\n\n", len(lcs), lcs)), nil
+	}
+
+	res := fmt.Sprintf("*4\r\n$7\r\nmatches\r\n*%d\r\n", len(matches))
+	for _, match := range matches {
+		if withMatchLen {
+			res += "*3\r\n"
+		} else {
+			res += "*2\r\n"
+		}
+		res += fmt.Sprintf("*2\r\n:%d\r\n:%d\r\n", match.a[0], match.a[1])
+		res += fmt.Sprintf("*2\r\n:%d\r\n:%d\r\n", match.b[0], match.b[1])
+		if withMatchLen {
+			res += fmt.Sprintf(":%d\r\n", match.length)
+		}
+	}
+	res += fmt.Sprintf("$3\r\nlen\r\n:%d\r\n\r\n", len(lcs))
+
+	return []byte(res), nil
+}
+
 func NewModule() Plugin {
 	StringModule := Plugin{
 		name: "StringCommands",
@@ -237,6 +588,136 @@ func NewModule() Plugin {
 				},
 				HandlerFunc: handleSubStr,
 			},
+			{
+				Command:     "incr",
+				Categories:  []string{utils.StringCategory, utils.WriteCategory, utils.FastCategory},
+				Description: "(INCR key) Increments the integer value at the key by 1. A missing key is treated as 0.",
+				Sync:        true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) != 2 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return []string{cmd[1]}, nil
+				},
+				HandlerFunc: handleIncrBy,
+			},
+			{
+				Command:     "incrby",
+				Categories:  []string{utils.StringCategory, utils.WriteCategory, utils.FastCategory},
+				Description: "(INCRBY key increment) Increments the integer value at the key by the given amount. A missing key is treated as 0.",
+				Sync:        true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) != 3 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return []string{cmd[1]}, nil
+				},
+				HandlerFunc: handleIncrBy,
+			},
+			{
+				Command:     "decr",
+				Categories:  []string{utils.StringCategory, utils.WriteCategory, utils.FastCategory},
+				Description: "(DECR key) Decrements the integer value at the key by 1. A missing key is treated as 0.",
+				Sync:        true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) != 2 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return []string{cmd[1]}, nil
+				},
+				HandlerFunc: handleIncrBy,
+			},
+			{
+				Command:     "decrby",
+				Categories:  []string{utils.StringCategory, utils.WriteCategory, utils.FastCategory},
+				Description: "(DECRBY key decrement) Decrements the integer value at the key by the given amount. A missing key is treated as 0.",
+				Sync:        true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) != 3 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return []string{cmd[1]}, nil
+				},
+				HandlerFunc: handleIncrBy,
+			},
+			{
+				Command:     "incrbyfloat",
+				Categories:  []string{utils.StringCategory, utils.WriteCategory, utils.FastCategory},
+				Description: "(INCRBYFLOAT key increment) Increments the numeric value at the key by the given floating point amount. A missing key is treated as 0.",
+				Sync:        true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) != 3 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return []string{cmd[1]}, nil
+				},
+				HandlerFunc: handleIncrByFloat,
+			},
+			{
+				Command:     "append",
+				Categories:  []string{utils.StringCategory, utils.WriteCategory, utils.FastCategory},
+				Description: "(APPEND key value) Appends the value to the string at the key and returns the new length. Creates the key if it doesn't exist.",
+				Sync:        true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) != 3 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return []string{cmd[1]}, nil
+				},
+				HandlerFunc: handleAppend,
+			},
+			{
+				Command:     "getset",
+				Categories:  []string{utils.StringCategory, utils.WriteCategory, utils.FastCategory},
+				Description: "(GETSET key value) Sets the key to the value and returns the previous value, or nil if the key did not exist.",
+				Sync:        true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) != 3 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return []string{cmd[1]}, nil
+				},
+				HandlerFunc: handleGetSet,
+			},
+			{
+				Command:     "getdel",
+				Categories:  []string{utils.StringCategory, utils.WriteCategory, utils.FastCategory},
+				Description: "(GETDEL key) Returns the value at the key and deletes the key.",
+				Sync:        true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) != 2 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return []string{cmd[1]}, nil
+				},
+				HandlerFunc: handleGetDel,
+			},
+			{
+				Command:     "getex",
+				Categories:  []string{utils.StringCategory, utils.WriteCategory, utils.FastCategory},
+				Description: "(GETEX key [EX seconds | PX milliseconds | EXAT unix-time-seconds | PXAT unix-time-milliseconds | PERSIST]) Returns the value at the key and optionally sets or removes its expiry.",
+				Sync:        true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 2 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return []string{cmd[1]}, nil
+				},
+				HandlerFunc: handleGetEx,
+			},
+			{
+				Command:     "lcs",
+				Categories:  []string{utils.StringCategory, utils.ReadCategory, utils.SlowCategory},
+				Description: "(LCS key1 key2 [LEN] [IDX] [MINMATCHLEN len] [WITHMATCHLEN]) Returns the longest common subsequence of the strings at the two keys, its length, or the matching ranges.",
+				Sync:        false,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 3 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:3], nil
+				},
+				HandlerFunc: handleLCS,
+			},
 		},
 		description: "Handle basic STRING commands",
 	}
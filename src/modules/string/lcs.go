@@ -0,0 +1,87 @@
+package str
+
+import "errors"
+
+// maxLCSCells caps the size of the dynamic programming table built by LCS.
+const maxLCSCells = 1 << 26
+
+// lcsMatch is a matching range in both strings. Positions are inclusive byte offsets.
+type lcsMatch struct {
+	a      [2]int
+	b      [2]int
+	length int
+}
+
+// longestCommonSubsequence returns the longest common subsequence of a and b together with
+// the contiguous ranges that make it up, from the end of the strings to the start.
+// Ranges shorter than minMatchLen are left out of the matches but not out of the subsequence.
+func longestCommonSubsequence(a, b string, minMatchLen int) (string, []lcsMatch, error) {
+	aLen, bLen := len(a), len(b)
+	if (aLen+1)*(bLen+1) > maxLCSCells {
+		return "", nil, errors.New("strings are too long to compare")
+	}
+
+	width := bLen + 1
+	dp := make([]uint32, (aLen+1)*width)
+	for i := 1; i <= aLen; i++ {
+		for j := 1; j <= bLen; j++ {
+			if a[i-1] == b[j-1] {
+				dp[i*width+j] = dp[(i-1)*width+j-1] + 1
+				continue
+			}
+			dp[i*width+j] = max(dp[(i-1)*width+j], dp[i*width+j-1])
+		}
+	}
+
+	idx := int(dp[aLen*width+bLen])
+	result := make([]byte, idx)
+	var matches []lcsMatch
+
+	// Walk back through the table, tracking the current contiguous range in both strings.
+	// aStart == aLen means that there is no range in progress.
+	aStart, aEnd, bStart, bEnd := aLen, 0, 0, 0
+	i, j := aLen, bLen
+	for i > 0 && j > 0 {
+		emit := false
+		if a[i-1] == b[j-1] {
+			result[idx-1] = a[i-1]
+			if aStart == aLen {
+				aStart, aEnd, bStart, bEnd = i-1, i-1, j-1, j-1
+			} else if aStart == i && bStart == j {
+				aStart--
+				bStart--
+			} else {
+				emit = true
+			}
+			if aStart == 0 || bStart == 0 {
+				emit = true
+			}
+			idx--
+			i--
+			j--
+		} else {
+			if dp[(i-1)*width+j] > dp[i*width+j-1] {
+				i--
+			} else {
+				j--
+			}
+			if aStart != aLen {
+				emit = true
+			}
+		}
+
+		if emit {
+			length := aEnd - aStart + 1
+			if minMatchLen == 0 || length >= minMatchLen {
+				matches = append(matches, lcsMatch{
+					a:      [2]int{aStart, aEnd},
+					b:      [2]int{bStart, bEnd},
+					length: length,
+				})
+			}
+			aStart = aLen
+		}
+	}
+
+	return string(result), matches, nil
+}
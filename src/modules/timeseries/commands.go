@@ -0,0 +1,860 @@
+package timeseries
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kelvinmwinuka/memstore/src/utils"
+	"math"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type Plugin struct {
+	name        string
+	commands    []utils.Command
+	description string
+}
+
+func (p Plugin) Name() string {
+	return p.name
+}
+
+func (p Plugin) Commands() []utils.Command {
+	return p.commands
+}
+
+func (p Plugin) Description() string {
+	return p.description
+}
+
+// SnapshotDecoders implements utils.SnapshotPlugin.
+func (p Plugin) SnapshotDecoders() map[string]utils.SnapshotDecoder {
+	return map[string]utils.SnapshotDecoder{
+		"timeseries": DecodeSnapshot,
+	}
+}
+
+type options struct {
+	retention   int64
+	policy      string
+	onDuplicate string
+	labels      map[string]string
+	timestamp   string
+}
+
+// parseOptions parses the allowed options of the series commands. LABELS consumes the rest of the arguments.
+func parseOptions(args []string, allowed ...string) (options, error) {
+	opts := options{}
+	for i := 0; i < len(args); i += 2 {
+		option := strings.ToLower(args[i])
+		if !slices.Contains(allowed, option) {
+			return opts, fmt.Errorf("unknown option %s", args[i])
+		}
+		if option == "labels" {
+			labels := args[i+1:]
+			if len(labels) == 0 || len(labels)%2 != 0 {
+				return opts, errors.New("LABELS must be followed by label value pairs")
+			}
+			opts.labels = map[string]string{}
+			for j := 0; j < len(labels); j += 2 {
+				opts.labels[labels[j]] = labels[j+1]
+			}
+			break
+		}
+		if i+1 >= len(args) {
+			return opts, fmt.Errorf("%s must be followed by a value", strings.ToUpper(option))
+		}
+		value := args[i+1]
+		switch option {
+		case "retention":
+			retention, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || retention < 0 {
+				return opts, errors.New("RETENTION must be a non-negative integer")
+			}
+			opts.retention = retention
+		case "duplicate_policy", "on_duplicate":
+			policy := strings.ToLower(value)
+			if !slices.Contains(policies, policy) {
+				return opts, fmt.Errorf("unknown duplicate policy %s", value)
+			}
+			if option == "duplicate_policy" {
+				opts.policy = policy
+			} else {
+				opts.onDuplicate = policy
+			}
+		case "timestamp":
+			opts.timestamp = value
+		}
+	}
+	return opts, nil
+}
+
+// parseTimestamp parses a timestamp in milliseconds. * is the time at which the command was issued.
+func parseTimestamp(ctx context.Context, s string) (int64, error) {
+	if s == "*" {
+		return utils.Now(ctx).UnixMilli(), nil
+	}
+	timestamp, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || timestamp < 0 {
+		return 0, errors.New("timestamp must be a non-negative integer or *")
+	}
+	return timestamp, nil
+}
+
+func parseValue(s string) (float64, error) {
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, errors.New("value must be a finite number")
+	}
+	return value, nil
+}
+
+// lockSeries locks the series at key for writing. If the key does not exist and opts is not nil,
+// a series is created with the options. The returned function unlocks the key.
+func lockSeries(ctx context.Context, server utils.Server, key string, opts *options) (*Series, func(), error) {
+	if !server.KeyExists(key) {
+		if opts == nil {
+			return nil, nil, fmt.Errorf("key %s does not exist", key)
+		}
+		series, err := NewSeries(opts.retention, opts.policy, opts.labels)
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, err = server.CreateKeyAndLock(ctx, key); err != nil {
+			return nil, nil, err
+		}
+		if server.GetValue(key) == nil {
+			server.SetValue(ctx, key, series)
+		}
+	} else if _, err := server.KeyLock(ctx, key); err != nil {
+		return nil, nil, err
+	}
+
+	series, ok := server.GetValue(key).(*Series)
+	if !ok {
+		server.KeyUnlock(key)
+		return nil, nil, fmt.Errorf("value at %s is not a time series", key)
+	}
+
+	return series, func() { server.KeyUnlock(key) }, nil
+}
+
+// readSeries runs fn against the series at key while holding the key's read lock.
+func readSeries(ctx context.Context, server utils.Server, key string, fn func(series *Series) ([]byte, error)) ([]byte, error) {
+	if !server.KeyExists(key) {
+		return nil, fmt.Errorf("key %s does not exist", key)
+	}
+
+	if _, err := server.KeyRLock(ctx, key); err != nil {
+		return nil, err
+	}
+	defer server.KeyRUnlock(key)
+
+	series, ok := server.GetValue(key).(*Series)
+	if !ok {
+		return nil, fmt.Errorf("value at %s is not a time series", key)
+	}
+
+	return fn(series)
+}
+
+// applyCompactions adds the compacted samples to their destination series. It must be called after
+// the source series is unlocked, so that a source and destination are never locked at the same time.
+// Destinations that no longer exist are skipped.
+func applyCompactions(ctx context.Context, server utils.Server, compactions []Compaction) {
+	for _, compaction := range compactions {
+		if !server.KeyExists(compaction.Destination) {
+			continue
+		}
+		if _, err := server.KeyLock(ctx, compaction.Destination); err != nil {
+			continue
+		}
+		if series, ok := server.GetValue(compaction.Destination).(*Series); ok {
+			if _, err := series.Add(compaction.Sample.Timestamp, compaction.Sample.Value, PolicyLast); err == nil {
+				server.SetValue(ctx, compaction.Destination, series)
+			}
+		}
+		server.KeyUnlock(compaction.Destination)
+	}
+}
+
+// addSample adds a sample to the series at key and applies the resulting compactions.
+func addSample(ctx context.Context, server utils.Server, key string, timestamp int64, value float64, opts *options) error {
+	series, unlock, err := lockSeries(ctx, server, key, opts)
+	if err != nil {
+		return err
+	}
+
+	policy := ""
+	if opts != nil {
+		policy = opts.onDuplicate
+	}
+
+	compactions, err := series.Add(timestamp, value, policy)
+	if err == nil {
+		server.SetValue(ctx, key, series)
+	}
+	unlock()
+
+	applyCompactions(ctx, server, compactions)
+	return err
+}
+
+func formatValue(value float64) string {
+	s := strconv.FormatFloat(value, 'f', -1, 64)
+	return fmt.Sprintf("$%d\r\n%s\r\n", len(s), s)
+}
+
+func formatSamples(samples []Sample) string {
+	res := fmt.Sprintf("*%d\r\n", len(samples))
+	for _, sample := range samples {
+		res += fmt.Sprintf("*2\r\n:%d\r\n%s", sample.Timestamp, formatValue(sample.Value))
+	}
+	return res
+}
+
+func formatLabels(series *Series) string {
+	names, labels := series.Labels()
+	res := fmt.Sprintf("*%d\r\n", len(names))
+	for _, name := range names {
+		res += fmt.Sprintf("*2\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n", len(name), name, len(labels[name]), labels[name])
+	}
+	return res
+}
+
+func handleCreate(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) < 2 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	key := cmd[1]
+
+	opts, err := parseOptions(cmd[2:], "retention", "duplicate_policy", "labels")
+	if err != nil {
+		return nil, err
+	}
+
+	series, err := NewSeries(opts.retention, opts.policy, opts.labels)
+	if err != nil {
+		return nil, err
+	}
+
+	if server.KeyExists(key) {
+		return nil, fmt.Errorf("key %s already exists", key)
+	}
+
+	if _, err = server.CreateKeyAndLock(ctx, key); err != nil {
+		return nil, err
+	}
+	defer server.KeyUnlock(key)
+
+	if server.GetValue(key) != nil {
+		return nil, fmt.Errorf("key %s already exists", key)
+	}
+
+	server.SetValue(ctx, key, series)
+
+	return []byte(utils.OK_RESPONSE), nil
+}
+
+func handleAdd(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) < 4 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	timestamp, err := parseTimestamp(ctx, cmd[2])
+	if err != nil {
+		return nil, err
+	}
+	value, err := parseValue(cmd[3])
+	if err != nil {
+		return nil, err
+	}
+	opts, err := parseOptions(cmd[4:], "retention", "on_duplicate", "labels")
+	if err != nil {
+		return nil, err
+	}
+
+	if err = addSample(ctx, server, cmd[1], timestamp, value, &opts); err != nil {
+		return nil, err
+	}
+
+	return []byte(fmt.Sprintf(":%d\r\n\r\n", timestamp)), nil
+}
+
+func handleMAdd(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) < 4 || len(cmd[1:])%3 != 0 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	res := fmt.Sprintf("*%d\r\n", len(cmd[1:])/3)
+	for i := 1; i < len(cmd); i += 3 {
+		timestamp, err := parseTimestamp(ctx, cmd[i+1])
+		if err == nil {
+			var value float64
+			if value, err = parseValue(cmd[i+2]); err == nil {
+				err = addSample(ctx, server, cmd[i], timestamp, value, nil)
+			}
+		}
+		if err != nil {
+			res += fmt.Sprintf("-%s\r\n", err.Error())
+			continue
+		}
+		res += fmt.Sprintf(":%d\r\n", timestamp)
+	}
+	res += "\r\n"
+
+	return []byte(res), nil
+}
+
+func handleIncrBy(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) < 3 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	key := cmd[1]
+
+	increment, err := parseValue(cmd[2])
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(cmd[0], "ts.decrby") {
+		increment = -increment
+	}
+
+	opts, err := parseOptions(cmd[3:], "timestamp", "retention", "duplicate_policy", "labels")
+	if err != nil {
+		return nil, err
+	}
+	if opts.timestamp == "" {
+		opts.timestamp = "*"
+	}
+	timestamp, err := parseTimestamp(ctx, opts.timestamp)
+	if err != nil {
+		return nil, err
+	}
+
+	series, unlock, err := lockSeries(ctx, server, key, &opts)
+	if err != nil {
+		return nil, err
+	}
+
+	value := increment
+	if last, ok := series.Last(); ok {
+		if timestamp < last.Timestamp {
+			unlock()
+			return nil, fmt.Errorf("timestamp must be equal to or later than the latest timestamp %d", last.Timestamp)
+		}
+		value += last.Value
+	}
+
+	compactions, err := series.Add(timestamp, value, PolicyLast)
+	if err == nil {
+		server.SetValue(ctx, key, series)
+	}
+	unlock()
+
+	applyCompactions(ctx, server, compactions)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(fmt.Sprintf(":%d\r\n\r\n", timestamp)), nil
+}
+
+func handleGet(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) != 2 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	return readSeries(ctx, server, cmd[1], func(series *Series) ([]byte, error) {
+		last, ok := series.Last()
+		if !ok {
+			return []byte("*0\r\n\r\n"), nil
+		}
+		return []byte(fmt.Sprintf("*2\r\n:%d\r\n%s\r\n", last.Timestamp, formatValue(last.Value))), nil
+	})
+}
+
+type rangeQuery struct {
+	from        int64
+	to          int64
+	count       int
+	aggregation string
+	bucket      int64
+	withLabels  bool
+	filters     []Filter
+}
+
+// parseRange parses from to [COUNT count] [AGGREGATION aggregation bucket]. When multi is true,
+// WITHLABELS and FILTER filter... are also accepted and at least one filter is required.
+func parseRange(args []string, multi bool) (rangeQuery, error) {
+	query := rangeQuery{count: -1}
+
+	if len(args) < 2 {
+		return query, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	bound := func(s string, infinity string, value int64) (int64, error) {
+		if s == infinity {
+			return value, nil
+		}
+		timestamp, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid timestamp %s", s)
+		}
+		return timestamp, nil
+	}
+	var err error
+	if query.from, err = bound(args[0], "-", 0); err != nil {
+		return query, err
+	}
+	if query.to, err = bound(args[1], "+", math.MaxInt64); err != nil {
+		return query, err
+	}
+
+	for i := 2; i < len(args); i++ {
+		switch option := strings.ToLower(args[i]); {
+		case option == "count":
+			if i+1 >= len(args) {
+				return query, errors.New("COUNT must be followed by a count")
+			}
+			if query.count, err = strconv.Atoi(args[i+1]); err != nil || query.count < 0 {
+				return query, errors.New("COUNT must be a non-negative integer")
+			}
+			i += 1
+		case option == "aggregation":
+			if i+2 >= len(args) {
+				return query, errors.New("AGGREGATION must be followed by an aggregation and a bucket duration")
+			}
+			query.aggregation = strings.ToLower(args[i+1])
+			if !ValidAggregation(query.aggregation) {
+				return query, fmt.Errorf("unknown aggregation %s", args[i+1])
+			}
+			if query.bucket, err = strconv.ParseInt(args[i+2], 10, 64); err != nil || query.bucket < 1 {
+				return query, errors.New("bucket duration must be a positive integer")
+			}
+			i += 2
+		case multi && option == "withlabels":
+			query.withLabels = true
+		case multi && option == "filter":
+			if i+1 >= len(args) {
+				return query, errors.New("FILTER must be followed by at least one filter")
+			}
+			for _, s := range args[i+1:] {
+				filter, err := ParseFilter(s)
+				if err != nil {
+					return query, err
+				}
+				query.filters = append(query.filters, filter)
+			}
+			i = len(args)
+		default:
+			return query, fmt.Errorf("unknown option %s", args[i])
+		}
+	}
+
+	if multi && len(query.filters) == 0 {
+		return query, errors.New("FILTER is required")
+	}
+
+	return query, nil
+}
+
+func (query rangeQuery) samples(series *Series, reverse bool) []Sample {
+	samples := series.Range(query.from, query.to)
+	if query.aggregation != "" {
+		samples = Aggregate(samples, query.aggregation, query.bucket)
+	}
+	if reverse {
+		samples = slices.Clone(samples)
+		slices.Reverse(samples)
+	}
+	if query.count >= 0 && query.count < len(samples) {
+		samples = samples[:query.count]
+	}
+	return samples
+}
+
+func handleRange(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) < 4 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	query, err := parseRange(cmd[2:], false)
+	if err != nil {
+		return nil, err
+	}
+
+	return readSeries(ctx, server, cmd[1], func(series *Series) ([]byte, error) {
+		samples := query.samples(series, strings.EqualFold(cmd[0], "ts.revrange"))
+		return []byte(formatSamples(samples) + "\r\n"), nil
+	})
+}
+
+func handleMRange(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) < 5 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	query, err := parseRange(cmd[1:], true)
+	if err != nil {
+		return nil, err
+	}
+
+	reverse := strings.EqualFold(cmd[0], "ts.mrevrange")
+
+	keys := server.GetAllKeys(ctx)
+	slices.Sort(keys)
+
+	var entries []string
+	for _, key := range keys {
+		if _, err := server.KeyRLock(ctx, key); err != nil {
+			// The key was deleted after the keys were listed
+			continue
+		}
+		if series, ok := server.GetValue(key).(*Series); ok && series.Matches(query.filters) {
+			entry := fmt.Sprintf("*3\r\n$%d\r\n%s\r\n", len(key), key)
+			if query.withLabels {
+				entry += formatLabels(series)
+			} else {
+				entry += "*0\r\n"
+			}
+			entry += formatSamples(query.samples(series, reverse))
+			entries = append(entries, entry)
+		}
+		server.KeyRUnlock(key)
+	}
+
+	res := fmt.Sprintf("*%d\r\n", len(entries))
+	res += strings.Join(entries, "")
+	res += "\r\n"
+
+	return []byte(res), nil
+}
+
+func handleInfo(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) != 2 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	return readSeries(ctx, server, cmd[1], func(series *Series) ([]byte, error) {
+		samples := series.Samples()
+		var first, last int64
+		if len(samples) > 0 {
+			first, last = samples[0].Timestamp, samples[len(samples)-1].Timestamp
+		}
+
+		bulk := func(s string) string {
+			return fmt.Sprintf("$%d\r\n%s\r\n", len(s), s)
+		}
+
+		source := "$-1\r\n"
+		if series.Source() != "" {
+			source = bulk(series.Source())
+		}
+
+		rules := series.Rules()
+		formattedRules := fmt.Sprintf("*%d\r\n", len(rules))
+		for _, rule := range rules {
+			formattedRules += fmt.Sprintf("*3\r\n%s:%d\r\n%s", bulk(rule.Destination), rule.Bucket, bulk(rule.Aggregation))
+		}
+
+		info := []struct {
+			name  string
+			value string
+		}{
+			{"totalSamples", fmt.Sprintf(":%d\r\n", len(samples))},
+			{"firstTimestamp", fmt.Sprintf(":%d\r\n", first)},
+			{"lastTimestamp", fmt.Sprintf(":%d\r\n", last)},
+			{"retentionTime", fmt.Sprintf(":%d\r\n", series.Retention())},
+			{"duplicatePolicy", bulk(series.DuplicatePolicy())},
+			{"labels", formatLabels(series)},
+			{"sourceKey", source},
+			{"rules", formattedRules},
+		}
+
+		res := fmt.Sprintf("*%d\r\n", len(info)*2)
+		for _, field := range info {
+			res += bulk(field.name) + field.value
+		}
+		res += "\r\n"
+
+		return []byte(res), nil
+	})
+}
+
+func handleCreateRule(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) != 6 || !strings.EqualFold(cmd[3], "aggregation") {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	source, destination := cmd[1], cmd[2]
+	if source == destination {
+		return nil, errors.New("the source and destination series must be different")
+	}
+
+	aggregation := strings.ToLower(cmd[4])
+	if !ValidAggregation(aggregation) {
+		return nil, fmt.Errorf("unknown aggregation %s", cmd[4])
+	}
+	bucket, err := strconv.ParseInt(cmd[5], 10, 64)
+	if err != nil || bucket < 1 {
+		return nil, errors.New("bucket duration must be a positive integer")
+	}
+
+	// The source and destination are locked one after the other, never together, so that
+	// rule changes cannot deadlock with compactions, which lock the source before the destination.
+	dest, unlock, err := lockSeries(ctx, server, destination, nil)
+	if err != nil {
+		return nil, err
+	}
+	if dest.Source() == source {
+		unlock()
+		return nil, fmt.Errorf("a compaction rule into %s already exists", destination)
+	}
+	err = dest.SetSource(source)
+	unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	src, unlock, err := lockSeries(ctx, server, source, nil)
+	if err == nil {
+		err = src.AddRule(destination, aggregation, bucket)
+		unlock()
+	}
+	if err != nil {
+		// Undo the change to the destination
+		if dest, unlock, e := lockSeries(ctx, server, destination, nil); e == nil {
+			if dest.Source() == source {
+				_ = dest.SetSource("")
+			}
+			unlock()
+		}
+		return nil, err
+	}
+
+	return []byte(utils.OK_RESPONSE), nil
+}
+
+func handleDeleteRule(ctx context.Context, cmd []string, server utils.Server, conn *net.Conn) ([]byte, error) {
+	if len(cmd) != 3 {
+		return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+	}
+
+	source, destination := cmd[1], cmd[2]
+
+	src, unlock, err := lockSeries(ctx, server, source, nil)
+	if err != nil {
+		return nil, err
+	}
+	deleted := src.DeleteRule(destination)
+	unlock()
+	if !deleted {
+		return nil, fmt.Errorf("there is no compaction rule from %s into %s", source, destination)
+	}
+
+	if dest, unlock, err := lockSeries(ctx, server, destination, nil); err == nil {
+		if dest.Source() == source {
+			_ = dest.SetSource("")
+		}
+		unlock()
+	}
+
+	return []byte(utils.OK_RESPONSE), nil
+}
+
+func NewModule() Plugin {
+	TimeSeriesModule := Plugin{
+		name: "TimeSeriesCommands",
+		commands: []utils.Command{
+			{
+				Command:    "ts.create",
+				Categories: []string{utils.TimeSeriesCategory, utils.WriteCategory, utils.FastCategory},
+				Description: `(TS.CREATE key [RETENTION retention] [DUPLICATE_POLICY BLOCK|FIRST|LAST|MIN|MAX|SUM] [LABELS label value ...])
+Creates an empty time series. Samples older than the retention period in milliseconds, relative to the latest sample, are removed.
+A retention of 0, the default, keeps every sample. The duplicate policy decides what happens when a sample is added at an existing timestamp.`,
+				Sync: true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 2 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleCreate,
+			},
+			{
+				Command:    "ts.add",
+				Categories: []string{utils.TimeSeriesCategory, utils.WriteCategory, utils.FastCategory},
+				Description: `(TS.ADD key timestamp value [RETENTION retention] [ON_DUPLICATE policy] [LABELS label value ...])
+Adds a sample to the time series, creating the series with the given options if it does not exist.
+A timestamp of * uses the current time in milliseconds. ON_DUPLICATE overrides the duplicate policy of the series.`,
+				Sync: true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 4 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleAdd,
+			},
+			{
+				Command:     "ts.madd",
+				Categories:  []string{utils.TimeSeriesCategory, utils.WriteCategory, utils.FastCategory},
+				Description: "(TS.MADD key timestamp value [key timestamp value ...]) Adds samples to existing time series. Returns the timestamp or an error for each sample.",
+				Sync:        true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 4 || len(cmd[1:])%3 != 0 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					var keys []string
+					for i := 1; i < len(cmd); i += 3 {
+						keys = append(keys, cmd[i])
+					}
+					return keys, nil
+				},
+				HandlerFunc: handleMAdd,
+			},
+			{
+				Command:    "ts.incrby",
+				Categories: []string{utils.TimeSeriesCategory, utils.WriteCategory, utils.FastCategory},
+				Description: `(TS.INCRBY key increment [TIMESTAMP timestamp] [RETENTION retention] [DUPLICATE_POLICY policy] [LABELS label value ...])
+Adds a sample with the latest value increased by increment. The timestamp defaults to the current time and must not be earlier than the latest sample.`,
+				Sync: true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 3 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleIncrBy,
+			},
+			{
+				Command:    "ts.decrby",
+				Categories: []string{utils.TimeSeriesCategory, utils.WriteCategory, utils.FastCategory},
+				Description: `(TS.DECRBY key decrement [TIMESTAMP timestamp] [RETENTION retention] [DUPLICATE_POLICY policy] [LABELS label value ...])
+Adds a sample with the latest value decreased by decrement. The timestamp defaults to the current time and must not be earlier than the latest sample.`,
+				Sync: true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 3 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleIncrBy,
+			},
+			{
+				Command:     "ts.get",
+				Categories:  []string{utils.TimeSeriesCategory, utils.ReadCategory, utils.FastCategory},
+				Description: "(TS.GET key) Returns the latest sample of the time series.",
+				Sync:        false,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) != 2 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleGet,
+			},
+			{
+				Command:    "ts.range",
+				Categories: []string{utils.TimeSeriesCategory, utils.ReadCategory, utils.SlowCategory},
+				Description: `(TS.RANGE key from to [COUNT count] [AGGREGATION AVG|SUM|MIN|MAX|COUNT|FIRST|LAST bucket])
+Returns the samples between from and to inclusive, in ascending order. - and + are the earliest and latest timestamps.
+With AGGREGATION, the samples are grouped into buckets of the given duration in milliseconds and each bucket is aggregated into one sample.`,
+				Sync: false,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 4 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleRange,
+			},
+			{
+				Command:    "ts.revrange",
+				Categories: []string{utils.TimeSeriesCategory, utils.ReadCategory, utils.SlowCategory},
+				Description: `(TS.REVRANGE key from to [COUNT count] [AGGREGATION AVG|SUM|MIN|MAX|COUNT|FIRST|LAST bucket])
+Returns the samples between from and to inclusive, in descending order.`,
+				Sync: false,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) < 4 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleRange,
+			},
+			{
+				Command:    "ts.mrange",
+				Categories: []string{utils.TimeSeriesCategory, utils.ReadCategory, utils.SlowCategory},
+				Description: `(TS.MRANGE from to [COUNT count] [AGGREGATION aggregation bucket] [WITHLABELS] FILTER filter [filter ...])
+Returns the samples of every time series matching all the filters, in ascending order. A filter is one of label=value, label!=value,
+label=(value,...) or label!=(value,...). An empty value matches series without the label.`,
+				Sync: false,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					return []string{}, nil
+				},
+				HandlerFunc: handleMRange,
+			},
+			{
+				Command:    "ts.mrevrange",
+				Categories: []string{utils.TimeSeriesCategory, utils.ReadCategory, utils.SlowCategory},
+				Description: `(TS.MREVRANGE from to [COUNT count] [AGGREGATION aggregation bucket] [WITHLABELS] FILTER filter [filter ...])
+Returns the samples of every time series matching all the filters, in descending order.`,
+				Sync: false,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					return []string{}, nil
+				},
+				HandlerFunc: handleMRange,
+			},
+			{
+				Command:     "ts.info",
+				Categories:  []string{utils.TimeSeriesCategory, utils.ReadCategory, utils.FastCategory},
+				Description: "(TS.INFO key) Returns information about the time series and its compaction rules.",
+				Sync:        false,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) != 2 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:2], nil
+				},
+				HandlerFunc: handleInfo,
+			},
+			{
+				Command:    "ts.createrule",
+				Categories: []string{utils.TimeSeriesCategory, utils.WriteCategory, utils.FastCategory},
+				Description: `(TS.CREATERULE source destination AGGREGATION AVG|SUM|MIN|MAX|COUNT|FIRST|LAST bucket)
+Downsamples new samples of the source series into the existing destination series. When a sample is added to a later bucket,
+the samples of the previous bucket are aggregated and added to the destination. Samples older than the current bucket are not compacted.`,
+				Sync: true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) != 6 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:3], nil
+				},
+				HandlerFunc: handleCreateRule,
+			},
+			{
+				Command:     "ts.deleterule",
+				Categories:  []string{utils.TimeSeriesCategory, utils.WriteCategory, utils.FastCategory},
+				Description: "(TS.DELETERULE source destination) Deletes the compaction rule from source into destination.",
+				Sync:        true,
+				KeyExtractionFunc: func(cmd []string) ([]string, error) {
+					if len(cmd) != 3 {
+						return nil, errors.New(utils.WRONG_ARGS_RESPONSE)
+					}
+					return cmd[1:3], nil
+				},
+				HandlerFunc: handleDeleteRule,
+			},
+		},
+		description: "Handle time series commands",
+	}
+	return TimeSeriesModule
+}
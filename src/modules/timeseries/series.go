@@ -0,0 +1,486 @@
+package timeseries
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const (
+	PolicyBlock = "block"
+	PolicyFirst = "first"
+	PolicyLast  = "last"
+	PolicyMin   = "min"
+	PolicyMax   = "max"
+	PolicySum   = "sum"
+)
+
+var policies = []string{PolicyBlock, PolicyFirst, PolicyLast, PolicyMin, PolicyMax, PolicySum}
+
+var aggregations = []string{"avg", "sum", "min", "max", "count", "first", "last"}
+
+type Sample struct {
+	Timestamp int64
+	Value     float64
+}
+
+// Rule downsamples the samples of a series into the destination series. Each bucket of the
+// source is aggregated and added to the destination once a sample arrives in a later bucket.
+type Rule struct {
+	Destination string
+	Aggregation string
+	Bucket      int64
+	open        bool
+	bucketStart int64 // Start of the bucket that has not been written to the destination yet
+}
+
+// Compaction is a sample that a rule has produced for its destination series.
+type Compaction struct {
+	Destination string
+	Sample      Sample
+}
+
+// Series is a sequence of samples ordered by timestamp.
+type Series struct {
+	retention       int64 // Maximum age of a sample relative to the latest sample in milliseconds, 0 keeps every sample
+	duplicatePolicy string
+	labels          map[string]string
+	source          string // Key of the series that compacts into this one, if any
+	rules           []*Rule
+	samples         []Sample
+}
+
+func NewSeries(retention int64, duplicatePolicy string, labels map[string]string) (*Series, error) {
+	if retention < 0 {
+		return nil, errors.New("retention must be a non-negative integer")
+	}
+	if duplicatePolicy == "" {
+		duplicatePolicy = PolicyBlock
+	}
+	if !slices.Contains(policies, duplicatePolicy) {
+		return nil, fmt.Errorf("unknown duplicate policy %s", duplicatePolicy)
+	}
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	return &Series{
+		retention:       retention,
+		duplicatePolicy: duplicatePolicy,
+		labels:          labels,
+	}, nil
+}
+
+func (series *Series) search(timestamp int64) int {
+	return sort.Search(len(series.samples), func(i int) bool {
+		return series.samples[i].Timestamp >= timestamp
+	})
+}
+
+// Last returns the latest sample. ok is false if the series is empty.
+func (series *Series) Last() (sample Sample, ok bool) {
+	if len(series.samples) == 0 {
+		return Sample{}, false
+	}
+	return series.samples[len(series.samples)-1], true
+}
+
+// Add inserts a sample. If a sample already exists at the timestamp, the policy decides the resulting
+// value; an empty policy uses the series' duplicate policy. Returns the compactions that are due.
+func (series *Series) Add(timestamp int64, value float64, policy string) ([]Compaction, error) {
+	if timestamp < 0 {
+		return nil, errors.New("timestamp must be a non-negative integer")
+	}
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return nil, errors.New("value must be a finite number")
+	}
+	if last, ok := series.Last(); ok && series.retention > 0 && timestamp < last.Timestamp-series.retention {
+		return nil, errors.New("timestamp is older than the retention period")
+	}
+
+	if policy == "" {
+		policy = series.duplicatePolicy
+	}
+
+	i := series.search(timestamp)
+	if i < len(series.samples) && series.samples[i].Timestamp == timestamp {
+		current := &series.samples[i].Value
+		switch policy {
+		case PolicyBlock:
+			return nil, fmt.Errorf("a sample already exists at timestamp %d", timestamp)
+		case PolicyFirst:
+		case PolicyLast:
+			*current = value
+		case PolicyMin:
+			*current = math.Min(*current, value)
+		case PolicyMax:
+			*current = math.Max(*current, value)
+		case PolicySum:
+			if math.IsInf(*current+value, 0) {
+				return nil, errors.New("sum is out of range")
+			}
+			*current += value
+		}
+	} else {
+		series.samples = slices.Insert(series.samples, i, Sample{Timestamp: timestamp, Value: value})
+	}
+
+	compactions := series.compact(timestamp)
+	series.trim()
+	return compactions, nil
+}
+
+// compact closes the buckets of each rule that end before the bucket of the timestamp.
+// Samples added to a bucket that has already been closed are not compacted.
+func (series *Series) compact(timestamp int64) []Compaction {
+	var compactions []Compaction
+	for _, rule := range series.rules {
+		bucketStart := timestamp - timestamp%rule.Bucket
+		if !rule.open {
+			rule.open = true
+			rule.bucketStart = bucketStart
+			continue
+		}
+		if bucketStart <= rule.bucketStart {
+			continue
+		}
+		samples := series.Range(rule.bucketStart, rule.bucketStart+rule.Bucket-1)
+		if len(samples) > 0 {
+			compactions = append(compactions, Compaction{
+				Destination: rule.Destination,
+				Sample:      Sample{Timestamp: rule.bucketStart, Value: aggregate(samples, rule.Aggregation)},
+			})
+		}
+		rule.bucketStart = bucketStart
+	}
+	return compactions
+}
+
+// trim removes the samples that are older than the retention period, keeping the samples of open buckets.
+func (series *Series) trim() {
+	last, ok := series.Last()
+	if !ok || series.retention == 0 {
+		return
+	}
+	cutoff := last.Timestamp - series.retention
+	for _, rule := range series.rules {
+		if rule.open {
+			cutoff = min(cutoff, rule.bucketStart)
+		}
+	}
+	if i := series.search(cutoff); i > 0 {
+		series.samples = slices.Delete(series.samples, 0, i)
+	}
+}
+
+// Range returns the samples with timestamps between from and to inclusive.
+func (series *Series) Range(from, to int64) []Sample {
+	if from > to {
+		return nil
+	}
+	start := series.search(from)
+	end := sort.Search(len(series.samples), func(i int) bool {
+		return series.samples[i].Timestamp > to
+	})
+	return series.samples[start:end]
+}
+
+func aggregate(samples []Sample, aggregation string) float64 {
+	switch aggregation {
+	case "avg":
+		return aggregate(samples, "sum") / float64(len(samples))
+	case "sum":
+		sum := 0.0
+		for _, sample := range samples {
+			sum += sample.Value
+		}
+		return sum
+	case "min":
+		res := samples[0].Value
+		for _, sample := range samples[1:] {
+			res = math.Min(res, sample.Value)
+		}
+		return res
+	case "max":
+		res := samples[0].Value
+		for _, sample := range samples[1:] {
+			res = math.Max(res, sample.Value)
+		}
+		return res
+	case "count":
+		return float64(len(samples))
+	case "first":
+		return samples[0].Value
+	default: // last
+		return samples[len(samples)-1].Value
+	}
+}
+
+// Aggregate groups the samples into buckets of the given size, aligned to timestamp 0, and
+// returns one sample per bucket timestamped with the start of the bucket.
+func Aggregate(samples []Sample, aggregation string, bucket int64) []Sample {
+	var res []Sample
+	for start := 0; start < len(samples); {
+		bucketStart := samples[start].Timestamp - samples[start].Timestamp%bucket
+		end := start + 1
+		for end < len(samples) && samples[end].Timestamp < bucketStart+bucket {
+			end += 1
+		}
+		res = append(res, Sample{Timestamp: bucketStart, Value: aggregate(samples[start:end], aggregation)})
+		start = end
+	}
+	return res
+}
+
+func ValidAggregation(aggregation string) bool {
+	return slices.Contains(aggregations, aggregation)
+}
+
+// AddRule adds a compaction rule into the destination series.
+func (series *Series) AddRule(destination string, aggregation string, bucket int64) error {
+	if series.source != "" {
+		return errors.New("the source series is the destination of another compaction rule")
+	}
+	if slices.ContainsFunc(series.rules, func(rule *Rule) bool { return rule.Destination == destination }) {
+		return fmt.Errorf("a compaction rule into %s already exists", destination)
+	}
+	series.rules = append(series.rules, &Rule{Destination: destination, Aggregation: aggregation, Bucket: bucket})
+	return nil
+}
+
+// DeleteRule removes the compaction rule into the destination series. Returns false if there is no such rule.
+func (series *Series) DeleteRule(destination string) bool {
+	i := slices.IndexFunc(series.rules, func(rule *Rule) bool { return rule.Destination == destination })
+	if i == -1 {
+		return false
+	}
+	series.rules = slices.Delete(series.rules, i, i+1)
+	return true
+}
+
+// SetSource marks the series as the destination of a compaction rule of the source series.
+// Passing an empty source clears it.
+func (series *Series) SetSource(source string) error {
+	if source == "" {
+		series.source = ""
+		return nil
+	}
+	if series.source != "" && series.source != source {
+		return errors.New("the destination series is already the destination of another compaction rule")
+	}
+	if len(series.rules) > 0 {
+		return errors.New("the destination series has compaction rules of its own")
+	}
+	series.source = source
+	return nil
+}
+
+func (series *Series) Source() string {
+	return series.source
+}
+
+func (series *Series) Rules() []Rule {
+	rules := make([]Rule, len(series.rules))
+	for i, rule := range series.rules {
+		rules[i] = *rule
+	}
+	return rules
+}
+
+// Labels returns the label names in sorted order along with the labels.
+func (series *Series) Labels() ([]string, map[string]string) {
+	names := make([]string, 0, len(series.labels))
+	for name := range series.labels {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names, series.labels
+}
+
+func (series *Series) Retention() int64 {
+	return series.retention
+}
+
+func (series *Series) DuplicatePolicy() string {
+	return series.duplicatePolicy
+}
+
+func (series *Series) Samples() []Sample {
+	return series.samples
+}
+
+// Filter matches a label against a set of values. A label that is not set matches the empty value.
+type Filter struct {
+	Label  string
+	Values []string
+	Negate bool
+}
+
+// ParseFilter parses label=value, label!=value, label=(value,...) and label!=(value,...).
+// An empty value matches series without the label.
+func ParseFilter(s string) (Filter, error) {
+	i := strings.Index(s, "=")
+	if i < 1 {
+		return Filter{}, fmt.Errorf("invalid filter %s", s)
+	}
+	filter := Filter{Label: s[:i]}
+	if strings.HasSuffix(filter.Label, "!") {
+		filter.Negate = true
+		filter.Label = strings.TrimSuffix(filter.Label, "!")
+	}
+	value := s[i+1:]
+	if strings.HasPrefix(value, "(") && strings.HasSuffix(value, ")") {
+		filter.Values = strings.Split(value[1:len(value)-1], ",")
+	} else {
+		filter.Values = []string{value}
+	}
+	if filter.Label == "" {
+		return Filter{}, fmt.Errorf("invalid filter %s", s)
+	}
+	return filter, nil
+}
+
+func (series *Series) Matches(filters []Filter) bool {
+	for _, filter := range filters {
+		if slices.Contains(filter.Values, series.labels[filter.Label]) == filter.Negate {
+			return false
+		}
+	}
+	return true
+}
+
+// SnapshotType implements utils.SnapshotEncoder.
+func (series *Series) SnapshotType() string {
+	return "timeseries"
+}
+
+// MarshalBinary implements utils.SnapshotEncoder. Timestamps are delta encoded as varints.
+func (series *Series) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 0, 64+len(series.samples)*10)
+	appendString := func(s string) {
+		b = binary.AppendUvarint(b, uint64(len(s)))
+		b = append(b, s...)
+	}
+
+	b = binary.AppendUvarint(b, uint64(series.retention))
+	appendString(series.duplicatePolicy)
+	appendString(series.source)
+
+	names, labels := series.Labels()
+	b = binary.AppendUvarint(b, uint64(len(names)))
+	for _, name := range names {
+		appendString(name)
+		appendString(labels[name])
+	}
+
+	b = binary.AppendUvarint(b, uint64(len(series.rules)))
+	for _, rule := range series.rules {
+		appendString(rule.Destination)
+		appendString(rule.Aggregation)
+		b = binary.AppendUvarint(b, uint64(rule.Bucket))
+		if rule.open {
+			b = append(b, 1)
+		} else {
+			b = append(b, 0)
+		}
+		b = binary.AppendUvarint(b, uint64(rule.bucketStart))
+	}
+
+	b = binary.AppendUvarint(b, uint64(len(series.samples)))
+	previous := int64(0)
+	for _, sample := range series.samples {
+		b = binary.AppendUvarint(b, uint64(sample.Timestamp-previous))
+		b = binary.LittleEndian.AppendUint64(b, math.Float64bits(sample.Value))
+		previous = sample.Timestamp
+	}
+
+	return b, nil
+}
+
+// DecodeSnapshot restores a series that was encoded with MarshalBinary.
+func DecodeSnapshot(b []byte) (interface{}, error) {
+	invalid := errors.New("invalid time series snapshot")
+	var err error
+
+	uvarint := func() uint64 {
+		if err != nil {
+			return 0
+		}
+		v, n := binary.Uvarint(b)
+		if n <= 0 || v > math.MaxInt64 {
+			err = invalid
+			return 0
+		}
+		b = b[n:]
+		return v
+	}
+	str := func() string {
+		n := uvarint()
+		if err != nil || uint64(len(b)) < n {
+			err = invalid
+			return ""
+		}
+		s := string(b[:n])
+		b = b[n:]
+		return s
+	}
+
+	retention := int64(uvarint())
+	policy := str()
+	source := str()
+
+	labels := map[string]string{}
+	for n := uvarint(); n > 0 && err == nil; n-- {
+		name := str()
+		labels[name] = str()
+	}
+
+	series, e := NewSeries(retention, policy, labels)
+	if err != nil || e != nil {
+		return nil, invalid
+	}
+	series.source = source
+
+	for n := uvarint(); n > 0 && err == nil; n-- {
+		rule := &Rule{Destination: str(), Aggregation: str(), Bucket: int64(uvarint())}
+		if err == nil && len(b) > 0 {
+			rule.open = b[0] == 1
+			b = b[1:]
+		} else {
+			err = invalid
+		}
+		rule.bucketStart = int64(uvarint())
+		if rule.Bucket < 1 || !ValidAggregation(rule.Aggregation) {
+			err = invalid
+		}
+		series.rules = append(series.rules, rule)
+	}
+
+	n := uvarint()
+	if err == nil && n > uint64(len(b))/9 {
+		return nil, invalid
+	}
+	series.samples = make([]Sample, 0, n)
+	previous := int64(0)
+	for ; n > 0 && err == nil; n-- {
+		timestamp := previous + int64(uvarint())
+		if len(b) < 8 {
+			err = invalid
+			break
+		}
+		series.samples = append(series.samples, Sample{
+			Timestamp: timestamp,
+			Value:     math.Float64frombits(binary.LittleEndian.Uint64(b)),
+		})
+		b = b[8:]
+		previous = timestamp
+	}
+
+	if err != nil {
+		return nil, invalid
+	}
+	return series, nil
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"context"
+
+	"github.com/kelvinmwinuka/memstore/src/utils"
+)
+
+// NotifyKeyspaceEvent publishes the event on the key's keyspace channel and the key on the event's keyevent
+// channel, depending on the notifyKeyspaceEvents config. Nothing is done unless the class of the event is enabled.
+// Write commands are applied on every node in a cluster, so each node only publishes to its own subscribers.
+func (server *Server) NotifyKeyspaceEvent(ctx context.Context, class utils.KeyspaceEventClass, event string, key string) {
+	if !server.keyspaceEvents.Enabled(class) {
+		return
+	}
+	if server.keyspaceEvents&utils.KeyspaceChannel != 0 {
+		server.PubSub.Publish(ctx, event, nil, "__keyspace@0__:"+key)
+	}
+	if server.keyspaceEvents&utils.KeyeventChannel != 0 {
+		server.PubSub.Publish(ctx, key, nil, "__keyevent@0__:"+event)
+	}
+}
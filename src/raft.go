@@ -97,7 +97,8 @@ func (server *Server) RaftInit(ctx context.Context) {
 					Address:  raft.ServerAddress(addr),
 				},
 			},
-		}).Error(); err != nil {
+		}).Error(); err != nil && !errors.Is(err, raft.ErrCantBootstrap) {
+			// ErrCantBootstrap means the node is restarting with existing state, which is restored from the logs and snapshots
 			log.Fatal(err)
 		}
 	}
@@ -119,24 +120,21 @@ func (server *Server) Apply(log *raft.Log) interface{} {
 
 		ctx := context.WithValue(context.Background(), utils.ContextServerID("ServerID"), request.ServerID)
 		ctx = context.WithValue(ctx, utils.ContextConnID("ConnectionID"), request.ConnectionID)
-
-		// Handle command
-		command, err := server.getCommand(request.CMD[0])
-		if err != nil {
-			return utils.ApplyResponse{
-				Error:    err,
-				Response: nil,
-			}
+		if !log.AppendedAt.IsZero() {
+			ctx = context.WithValue(ctx, utils.ContextTime("Time"), log.AppendedAt)
 		}
 
-		handler := command.HandlerFunc
+		if request.ExpireKey != "" && len(request.ExpireFields) > 0 {
+			server.expireFields(ctx, request.ExpireKey, request.ExpireFields, utils.Now(ctx))
+			return utils.ApplyResponse{}
+		}
 
-		subCommand, ok := utils.GetSubCommand(command, request.CMD).(utils.SubCommand)
-		if ok {
-			handler = subCommand.HandlerFunc
+		if request.ExpireKey != "" {
+			server.expireKey(ctx, request.ExpireKey, utils.Now(ctx))
+			return utils.ApplyResponse{}
 		}
 
-		if res, err := handler(ctx, request.CMD, server, nil); err != nil {
+		if res, err := server.runCommand(ctx, request.CMD); err != nil {
 			return utils.ApplyResponse{
 				Error:    err,
 				Response: nil,
@@ -152,9 +150,161 @@ func (server *Server) Apply(log *raft.Log) interface{} {
 	return nil
 }
 
-// Implements raft.FSM interface
+// runCommand runs the handler of the command without a connection, as when a replicated command is applied.
+func (server *Server) runCommand(ctx context.Context, cmd []string) ([]byte, error) {
+	command, err := server.getCommand(cmd[0])
+	if err != nil {
+		return nil, err
+	}
+
+	handler := command.HandlerFunc
+
+	subCommand, ok := utils.GetSubCommand(command, cmd).(utils.SubCommand)
+	if ok {
+		handler = subCommand.HandlerFunc
+	}
+
+	return handler(ctx, cmd, server, nil)
+}
+
+// raftApply appends the command to the raft log and returns the response of the command once it has been applied.
+// Only the leader can append to the log.
+func (server *Server) raftApply(ctx context.Context, cmd []string) ([]byte, error) {
+	if !server.isRaftLeader() {
+		// TODO: Forward message to leader and wait for a response
+		return nil, errors.New("not cluster leader, cannot carry out command")
+	}
+
+	serverId, _ := ctx.Value(utils.ContextServerID("ServerID")).(string)
+	connectionId, _ := ctx.Value(utils.ContextConnID("ConnectionID")).(string)
+
+	b, err := json.Marshal(utils.ApplyRequest{
+		ServerID:     serverId,
+		ConnectionID: connectionId,
+		CMD:          cmd,
+	})
+	if err != nil {
+		return nil, errors.New("could not parse request")
+	}
+
+	applyFuture := server.raft.Apply(b, 500*time.Millisecond)
+	if err := applyFuture.Error(); err != nil {
+		return nil, err
+	}
+
+	r, ok := applyFuture.Response().(utils.ApplyResponse)
+	if !ok {
+		return nil, fmt.Errorf("unprocessable entity %v", r)
+	}
+	if r.Error != nil {
+		return nil, r.Error
+	}
+
+	return r.Response, nil
+}
+
+// Replicate implements pubsub.Cluster and utils.Server. It applies the command on every node through the raft log,
+// or runs it on this node if the server is not part of a cluster.
+func (server *Server) Replicate(ctx context.Context, cmd []string) ([]byte, error) {
+	if !server.IsInCluster() {
+		return server.runCommand(ctx, cmd)
+	}
+	return server.raftApply(ctx, cmd)
+}
+
+// Implements raft.FSM interface. The state is encoded here rather than in Persist, since raft does not apply
+// commands while Snapshot runs but may apply them while Persist writes the snapshot out.
 func (server *Server) Snapshot() (raft.FSMSnapshot, error) {
-	return server, nil
+	b, err := server.encodeSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	return &fsmSnapshot{data: b}, nil
+}
+
+// fsmSnapshot is the server state captured by Snapshot.
+type fsmSnapshot struct {
+	data []byte
+}
+
+// Implements FSMSnapshot interface
+func (snapshot *fsmSnapshot) Persist(sink raft.SnapshotSink) error {
+	if _, err := sink.Write(snapshot.data); err != nil {
+		sink.Cancel()
+		return err
+	}
+	return sink.Close()
+}
+
+// Implements FSMSnapshot interface
+func (snapshot *fsmSnapshot) Release() {}
+
+// snapshotVersion is the version of the snapshot format. Snapshots without a version are a map of keys to entries.
+const snapshotVersion = 2
+
+// serverSnapshot is the encoding of the server state in a raft snapshot.
+type serverSnapshot struct {
+	Version int                      `json:"Version"`
+	Keys    map[string]snapshotEntry `json:"Keys"`
+	PubSub  json.RawMessage          `json:"PubSub,omitempty"` // The retained messages of durable channels
+	Search  json.RawMessage          `json:"Search,omitempty"` // The definitions of the search indexes
+	// LastVersion is the version assigned by the last write, so that versions are not reused after a restore
+	LastVersion uint64 `json:"LastVersion,omitempty"`
+}
+
+// snapshotEntry is the encoding of a single key in a snapshot.
+type snapshotEntry struct {
+	Type     string `json:"Type"`
+	Data     []byte `json:"Data"`
+	ExpireAt int64  `json:"ExpireAt,omitempty"` // Unix time in milliseconds
+	Version  uint64 `json:"Version,omitempty"`
+	// FieldExpireAt holds the expiry times of the fields of a hash, as Unix time in milliseconds
+	FieldExpireAt map[string]int64 `json:"FieldExpireAt,omitempty"`
+}
+
+// encodeSnapshotValue encodes a stored value. It returns an error if the value's type does not support snapshots.
+func encodeSnapshotValue(value interface{}) (snapshotEntry, error) {
+	switch v := value.(type) {
+	case string:
+		return snapshotEntry{Type: "string", Data: []byte(v)}, nil
+	case map[string]interface{}:
+		// Hash fields are always stored as strings
+		b, err := json.Marshal(v)
+		if err != nil {
+			return snapshotEntry{}, err
+		}
+		return snapshotEntry{Type: "hash", Data: b}, nil
+	case utils.SnapshotEncoder:
+		b, err := v.MarshalBinary()
+		if err != nil {
+			return snapshotEntry{}, err
+		}
+		return snapshotEntry{Type: v.SnapshotType(), Data: b}, nil
+	}
+	return snapshotEntry{}, fmt.Errorf("cannot snapshot value of type %T", value)
+}
+
+func (server *Server) decodeSnapshotValue(entry snapshotEntry) (interface{}, error) {
+	switch entry.Type {
+	case "string", "integer", "float":
+		// Older snapshots stored numeric values separately. Values are now always kept as the raw string.
+		return string(entry.Data), nil
+	case "hash":
+		var fields map[string]string
+		if err := json.Unmarshal(entry.Data, &fields); err != nil {
+			return nil, err
+		}
+		hash := make(map[string]interface{}, len(fields))
+		for field, value := range fields {
+			hash[field] = value
+		}
+		return hash, nil
+	}
+	decoder, ok := server.snapshotDecoders[entry.Type]
+	if !ok {
+		return nil, fmt.Errorf("no snapshot decoder for type %s", entry.Type)
+	}
+	return decoder(entry.Data)
 }
 
 // Implements raft.FSM interface
@@ -165,47 +315,141 @@ func (server *Server) Restore(snapshot io.ReadCloser) error {
 		return err
 	}
 
-	data := make(map[string]interface{})
+	var data serverSnapshot
 
-	if err := json.Unmarshal(b, &data); err != nil {
-		return err
+	if err := json.Unmarshal(b, &data); err != nil || data.Version != snapshotVersion {
+		// Fall back to the format without a version
+		data = serverSnapshot{Keys: make(map[string]snapshotEntry)}
+		if err := json.Unmarshal(b, &data.Keys); err != nil {
+			return err
+		}
+	}
+
+	// Every value is decoded before anything is replaced, so that a snapshot that cannot be restored
+	// leaves the current state alone
+	values := make(map[string]interface{}, len(data.Keys))
+	for k, entry := range data.Keys {
+		v, err := server.decodeSnapshotValue(entry)
+		if err != nil {
+			return fmt.Errorf("could not restore key %s: %v", k, err)
+		}
+		values[k] = v
+	}
+
+	if len(data.PubSub) == 0 {
+		// The snapshot has no durable channels, so none are kept
+		data.PubSub = json.RawMessage("{}")
+	}
+	if err := server.PubSub.Restore(data.PubSub); err != nil {
+		return fmt.Errorf("could not restore pubsub: %v", err)
+	}
+
+	// The indexes are restored empty, and are filled again as the keys are written back
+	if len(data.Search) == 0 {
+		data.Search = json.RawMessage("[]")
+	}
+	if err := server.Search.Restore(data.Search); err != nil {
+		return fmt.Errorf("could not restore search: %v", err)
+	}
+
+	ctx := context.Background()
+
+	// The snapshot replaces the whole state, so the keys that are not in it must not survive the restore.
+	// Deleting a key also drops its expiry, version and search index entries.
+	for _, k := range server.GetAllKeys(ctx) {
+		if err := server.DeleteKey(ctx, k); err != nil {
+			return err
+		}
+	}
+
+	for k, entry := range data.Keys {
+		if _, err = server.CreateKeyAndLock(ctx, k); err != nil {
+			return err
+		}
+		server.SetValue(ctx, k, values[k])
+		if entry.ExpireAt != 0 {
+			server.SetExpiry(ctx, k, time.UnixMilli(entry.ExpireAt))
+		}
+		for field, expireAt := range entry.FieldExpireAt {
+			server.SetFieldExpiry(ctx, k, field, time.UnixMilli(expireAt))
+		}
+		if entry.Version != 0 {
+			server.versionLock.Lock()
+			server.versions[k] = entry.Version
+			server.versionLock.Unlock()
+		}
+		server.KeyUnlock(k)
 	}
 
-	for k, v := range data {
-		server.keyLocks[k].Lock()
-		server.SetValue(context.Background(), k, v)
-		server.keyLocks[k].Unlock()
+	// Older snapshots do not have the last version, so it is at least the highest version of a restored key
+	lastVersion := data.LastVersion
+	for _, entry := range data.Keys {
+		lastVersion = max(lastVersion, entry.Version)
 	}
+	server.versionLock.Lock()
+	server.lastVersion = lastVersion
+	server.versionLock.Unlock()
 
 	return nil
 }
 
-// Implements FSMSnapshot interface
-func (server *Server) Persist(sink raft.SnapshotSink) error {
-	data := map[string]interface{}{}
+// encodeSnapshot encodes the server state as a serverSnapshot.
+func (server *Server) encodeSnapshot() ([]byte, error) {
+	data := serverSnapshot{
+		Version: snapshotVersion,
+		Keys:    make(map[string]snapshotEntry),
+	}
 
-	// TODO: Copy current store contents
+	ctx := context.Background()
 
-	o, err := json.Marshal(data)
+	for _, k := range server.GetAllKeys(ctx) {
+		if _, err := server.KeyRLock(ctx, k); err != nil {
+			// The key was deleted after the keys were listed
+			continue
+		}
+		value := server.GetValue(k)
+		entry, err := encodeSnapshotValue(value)
+		if expireAt, expires := server.GetExpiry(k); expires {
+			entry.ExpireAt = expireAt.UnixMilli()
+		}
+		if hash, isHash := value.(map[string]interface{}); isHash {
+			for field := range hash {
+				if expireAt, expires := server.GetFieldExpiry(k, field); expires {
+					if entry.FieldExpireAt == nil {
+						entry.FieldExpireAt = make(map[string]int64)
+					}
+					entry.FieldExpireAt[field] = expireAt.UnixMilli()
+				}
+			}
+		}
+		entry.Version = server.GetVersion(k)
+		server.KeyRUnlock(k)
 
+		if err != nil {
+			return nil, fmt.Errorf("could not snapshot key %s: %v", k, err)
+		}
+		data.Keys[k] = entry
+	}
+
+	pubsub, err := server.PubSub.Snapshot()
 	if err != nil {
-		sink.Cancel()
-		return err
+		return nil, err
 	}
+	data.PubSub = pubsub
 
-	if _, err = sink.Write(o); err != nil {
-		sink.Cancel()
-		return err
+	search, err := server.Search.Snapshot()
+	if err != nil {
+		return nil, err
 	}
+	data.Search = search
 
-	// TODO: Store data in separate snapshot file
+	server.versionLock.RLock()
+	data.LastVersion = server.lastVersion
+	server.versionLock.RUnlock()
 
-	return nil
+	return json.Marshal(data)
 }
 
-// Implements FSMSnapshot interface
-func (server *Server) Release() {}
-
 func (server *Server) isRaftLeader() bool {
 	return server.raft.State() == raft.Leader
 }
@@ -11,23 +11,26 @@ import (
 )
 
 type Config struct {
-	TLS                bool   `json:"tls" yaml:"tls"`
-	Key                string `json:"key" yaml:"key"`
-	Cert               string `json:"cert" yaml:"cert"`
-	Port               uint16 `json:"port" yaml:"port"`
-	HTTP               bool   `json:"http" yaml:"http"`
-	PluginDir          string `json:"plugins" yaml:"plugins"`
-	ServerID           string `json:"serverId" yaml:"serverId"`
-	JoinAddr           string `json:"joinAddr" yaml:"joinAddr"`
-	BindAddr           string `json:"bindAddr" yaml:"bindAddr"`
-	RaftBindPort       uint16 `json:"raftPort" yaml:"raftPort"`
-	MemberListBindPort uint16 `json:"mlPort" yaml:"mlPort"`
-	InMemory           bool   `json:"inMemory" yaml:"inMemory"`
-	DataDir            string `json:"dataDir" yaml:"dataDir"`
-	BootstrapCluster   bool   `json:"BootstrapCluster" yaml:"bootstrapCluster"`
-	AclConfig          string `json:"AclConfig" yaml:"AclConfig"`
-	RequirePass        bool   `json:"requirePass" yaml:"requirePass"`
-	Password           string `json:"password" yaml:"password"`
+	TLS                     bool   `json:"tls" yaml:"tls"`
+	Key                     string `json:"key" yaml:"key"`
+	Cert                    string `json:"cert" yaml:"cert"`
+	Port                    uint16 `json:"port" yaml:"port"`
+	HTTP                    bool   `json:"http" yaml:"http"`
+	PluginDir               string `json:"plugins" yaml:"plugins"`
+	ServerID                string `json:"serverId" yaml:"serverId"`
+	JoinAddr                string `json:"joinAddr" yaml:"joinAddr"`
+	BindAddr                string `json:"bindAddr" yaml:"bindAddr"`
+	RaftBindPort            uint16 `json:"raftPort" yaml:"raftPort"`
+	MemberListBindPort      uint16 `json:"mlPort" yaml:"mlPort"`
+	InMemory                bool   `json:"inMemory" yaml:"inMemory"`
+	DataDir                 string `json:"dataDir" yaml:"dataDir"`
+	BootstrapCluster        bool   `json:"BootstrapCluster" yaml:"bootstrapCluster"`
+	AclConfig               string `json:"AclConfig" yaml:"AclConfig"`
+	RequirePass             bool   `json:"requirePass" yaml:"requirePass"`
+	Password                string `json:"password" yaml:"password"`
+	PubSubCompat            bool   `json:"pubSubCompat" yaml:"pubSubCompat"`
+	ClientOutputBufferLimit string `json:"clientOutputBufferLimit" yaml:"clientOutputBufferLimit"`
+	NotifyKeyspaceEvents    string `json:"notifyKeyspaceEvents" yaml:"notifyKeyspaceEvents"`
 }
 
 func GetConfig() (Config, error) {
@@ -58,6 +61,30 @@ func GetConfig() (Config, error) {
 It is a plain text value by default but you can provide a SHA256 hash by adding a '#' before the hash.`,
 	)
 
+	pubSubCompat := flag.Bool(
+		"pubSubCompat",
+		false,
+		`Whether pub/sub should behave like Redis. Messages are sent as message arrays without waiting for an ACK,
+and a subscribed connection may only run (P)SUBSCRIBE, (P)UNSUBSCRIBE, PING and QUIT. Default is false.`,
+	)
+
+	clientOutputBufferLimit := flag.String(
+		"clientOutputBufferLimit",
+		DefaultClientOutputBufferLimit,
+		`The limits of the output queued for each class of client, as "class hard soft seconds" for the normal and pubsub
+classes. A client is disconnected when its queued output goes over the hard limit, or stays over the soft limit for
+the number of seconds. Sizes may carry a kb, mb or gb suffix, and 0 disables a limit. Limits for the replica class
+are accepted for compatibility with Redis but ignored, since replicas follow the leader over Raft.`,
+	)
+
+	notifyKeyspaceEvents := flag.String(
+		"notifyKeyspaceEvents",
+		"",
+		`The keyspace notifications to publish, as flags in the style of Redis' notify-keyspace-events. K publishes on
+__keyspace@0__:<key> and E on __keyevent@0__:<event>, and g, $, l, s, h, z, x and e select generic, string, list,
+set, hash, sorted set, expired and evicted events. A is an alias for g$lshzxe. Empty disables notifications.`,
+	)
+
 	config := flag.String(
 		"config",
 		"",
@@ -67,23 +94,26 @@ It is a plain text value by default but you can provide a SHA256 hash by adding
 	flag.Parse()
 
 	conf := Config{
-		TLS:                *tls,
-		Key:                *key,
-		Cert:               *cert,
-		HTTP:               *http,
-		PluginDir:          *pluginDir,
-		Port:               uint16(*port),
-		ServerID:           *serverId,
-		JoinAddr:           *joinAddr,
-		BindAddr:           *bindAddr,
-		RaftBindPort:       uint16(*raftBindPort),
-		MemberListBindPort: uint16(*mlBindPort),
-		InMemory:           *inMemory,
-		DataDir:            *dataDir,
-		BootstrapCluster:   *bootstrapCluster,
-		AclConfig:          *aclConfig,
-		RequirePass:        *requirePass,
-		Password:           *password,
+		TLS:                     *tls,
+		Key:                     *key,
+		Cert:                    *cert,
+		HTTP:                    *http,
+		PluginDir:               *pluginDir,
+		Port:                    uint16(*port),
+		ServerID:                *serverId,
+		JoinAddr:                *joinAddr,
+		BindAddr:                *bindAddr,
+		RaftBindPort:            uint16(*raftBindPort),
+		MemberListBindPort:      uint16(*mlBindPort),
+		InMemory:                *inMemory,
+		DataDir:                 *dataDir,
+		BootstrapCluster:        *bootstrapCluster,
+		AclConfig:               *aclConfig,
+		RequirePass:             *requirePass,
+		Password:                *password,
+		PubSubCompat:            *pubSubCompat,
+		ClientOutputBufferLimit: *clientOutputBufferLimit,
+		NotifyKeyspaceEvents:    *notifyKeyspaceEvents,
 	}
 
 	if len(*config) > 0 {
@@ -119,5 +149,13 @@ It is a plain text value by default but you can provide a SHA256 hash by adding
 		err = errors.New("password cannot be empty if requirePass is etc to true")
 	}
 
+	if _, limitErr := ParseClientOutputBufferLimits(conf.ClientOutputBufferLimit); limitErr != nil {
+		err = limitErr
+	}
+
+	if _, eventsErr := ParseKeyspaceEvents(conf.NotifyKeyspaceEvents); eventsErr != nil {
+		err = eventsErr
+	}
+
 	return conf, err
 }
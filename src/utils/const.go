@@ -4,22 +4,30 @@ const (
 	AdminCategory       = "admin"
 	BitmapCategory      = "bitmap"
 	BlockingCategory    = "blocking"
+	BloomCategory       = "bloom"
+	CMSCategory         = "cms"
 	ConnectionCategory  = "connection"
+	CuckooCategory      = "cuckoo"
 	DangerousCategory   = "dangerous"
 	GeoCategory         = "geo"
+	GraphCategory       = "graph"
 	HashCategory        = "hash"
 	HyperLogLogCategory = "hyperloglog"
+	JSONCategory        = "json"
 	FastCategory        = "fast"
 	KeyspaceCategory    = "keyspace"
 	ListCategory        = "list"
 	PubSubCategory      = "pubsub"
 	ReadCategory        = "read"
 	ScriptingCategory   = "scripting"
+	SearchCategory      = "search"
 	SetCategory         = "set"
 	SortedSetCategory   = "sortedset"
 	SlowCategory        = "slow"
 	StreamCategory      = "stream"
 	StringCategory      = "string"
+	TimeSeriesCategory  = "timeseries"
+	TopKCategory        = "topk"
 	TransactionCategory = "transaction"
 	WriteCategory       = "write"
 )
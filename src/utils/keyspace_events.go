@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"fmt"
+)
+
+// KeyspaceEventClass is a set of keyspace notification flags, as configured with notifyKeyspaceEvents.
+type KeyspaceEventClass uint16
+
+const (
+	KeyspaceChannel KeyspaceEventClass = 1 << iota // K: publish events on __keyspace@0__:<key>
+	KeyeventChannel                                // E: publish keys on __keyevent@0__:<event>
+	GenericEvents                                  // g: commands that apply to any type of key, such as expire and del
+	StringEvents                                   // $
+	ListEvents                                     // l
+	SetEvents                                      // s
+	HashEvents                                     // h
+	SortedSetEvents                                // z
+	ExpiredEvents                                  // x: keys deleted because they expired
+	EvictedEvents                                  // e: keys deleted to free memory, which the server does not do yet
+)
+
+// AllKeyspaceEvents is the set of event classes selected by the A flag.
+const AllKeyspaceEvents = GenericEvents | StringEvents | ListEvents | SetEvents | HashEvents | SortedSetEvents |
+	ExpiredEvents | EvictedEvents
+
+var keyspaceEventFlags = []struct {
+	flag  rune
+	class KeyspaceEventClass
+}{
+	{'K', KeyspaceChannel}, {'E', KeyeventChannel}, {'g', GenericEvents}, {'$', StringEvents}, {'l', ListEvents},
+	{'s', SetEvents}, {'h', HashEvents}, {'z', SortedSetEvents}, {'x', ExpiredEvents}, {'e', EvictedEvents},
+}
+
+// ParseKeyspaceEvents parses notification flags in the style of Redis' notify-keyspace-events, such as "KEA" or "Kx".
+// K and E select the channels that events are published on, and the other flags select the classes of events to
+// publish. A is an alias for g$lshzxe. Nothing is published unless K or E is given along with at least one class.
+func ParseKeyspaceEvents(flags string) (KeyspaceEventClass, error) {
+	var classes KeyspaceEventClass
+	for _, r := range flags {
+		if r == 'A' {
+			classes |= AllKeyspaceEvents
+			continue
+		}
+		found := false
+		for _, f := range keyspaceEventFlags {
+			if f.flag == r {
+				classes |= f.class
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown keyspace event flag %q, must be one of K, E, g, $, l, s, h, z, x, e or A", r)
+		}
+	}
+	return classes, nil
+}
+
+// Enabled reports whether events of the class are published on at least one channel.
+func (classes KeyspaceEventClass) Enabled(class KeyspaceEventClass) bool {
+	return classes&class != 0 && classes&(KeyspaceChannel|KeyeventChannel) != 0
+}
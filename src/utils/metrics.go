@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"maps"
+	"sync"
+)
+
+// Metrics counts events on the server, such as clients disconnected for going over their output buffer limit.
+type Metrics struct {
+	mut      sync.Mutex
+	counters map[string]uint64
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		mut:      sync.Mutex{},
+		counters: make(map[string]uint64),
+	}
+}
+
+// Incr adds one to the counter.
+func (metrics *Metrics) Incr(name string) {
+	metrics.mut.Lock()
+	defer metrics.mut.Unlock()
+	metrics.counters[name]++
+}
+
+// Get returns the value of the counter, which is 0 if it was never incremented.
+func (metrics *Metrics) Get(name string) uint64 {
+	metrics.mut.Lock()
+	defer metrics.mut.Unlock()
+	return metrics.counters[name]
+}
+
+// Counters returns a copy of every counter.
+func (metrics *Metrics) Counters() map[string]uint64 {
+	metrics.mut.Lock()
+	defer metrics.mut.Unlock()
+	return maps.Clone(metrics.counters)
+}
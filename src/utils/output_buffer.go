@@ -0,0 +1,235 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Client classes that output buffer limits are configured for.
+const (
+	NormalClient = "normal"
+	PubSubClient = "pubsub"
+)
+
+// replicaClient is the class of Redis replicas. Replicas here follow the leader over Raft rather than connecting as
+// clients, so its limits are accepted to let Redis settings be reused, but are ignored.
+const replicaClient = "replica"
+
+// DefaultClientOutputBufferLimit is the default value of the clientOutputBufferLimit config.
+// Normal clients are not limited, since they only receive replies to the commands that they send.
+const DefaultClientOutputBufferLimit = "normal 0 0 0 pubsub 32mb 8mb 60"
+
+// OutputBufferLimit limits the output that is queued for a client. A client is disconnected as soon as its queued
+// output goes over Hard, or once its queued output has stayed over Soft for SoftDuration. A zero limit does not apply.
+type OutputBufferLimit struct {
+	Hard         int
+	Soft         int
+	SoftDuration time.Duration
+}
+
+// ParseClientOutputBufferLimits parses limits in the form "class hard soft seconds [class hard soft seconds ...]".
+// Sizes are in bytes and may carry a kb, mb or gb suffix. Classes that are not given have no limits.
+// Limits for the replica class are parsed but left out of the result, since no client is a replica.
+func ParseClientOutputBufferLimits(s string) (map[string]OutputBufferLimit, error) {
+	fields := strings.Fields(s)
+	if len(fields)%4 != 0 {
+		return nil, errors.New("client output buffer limits must be given as class, hard limit, soft limit and soft seconds")
+	}
+
+	limits := make(map[string]OutputBufferLimit)
+	for i := 0; i < len(fields); i += 4 {
+		class := strings.ToLower(fields[i])
+		if !Contains([]string{NormalClient, PubSubClient, replicaClient}, class) {
+			return nil, fmt.Errorf("unknown client class %s, must be normal, pubsub or replica", fields[i])
+		}
+		hard, err := parseMemorySize(fields[i+1])
+		if err != nil {
+			return nil, err
+		}
+		soft, err := parseMemorySize(fields[i+2])
+		if err != nil {
+			return nil, err
+		}
+		seconds, err := strconv.Atoi(fields[i+3])
+		if err != nil || seconds < 0 {
+			return nil, fmt.Errorf("soft seconds must be a positive integer, got %s", fields[i+3])
+		}
+		if class == replicaClient {
+			continue
+		}
+		limits[class] = OutputBufferLimit{Hard: hard, Soft: soft, SoftDuration: time.Duration(seconds) * time.Second}
+	}
+	return limits, nil
+}
+
+func parseMemorySize(s string) (int, error) {
+	units := []struct {
+		suffix string
+		size   int
+	}{{"gb", 1 << 30}, {"mb", 1 << 20}, {"kb", 1 << 10}, {"b", 1}}
+
+	lower := strings.ToLower(s)
+	multiplier := 1
+	for _, unit := range units {
+		if strings.HasSuffix(lower, unit.suffix) {
+			lower = strings.TrimSuffix(lower, unit.suffix)
+			multiplier = unit.size
+			break
+		}
+	}
+	n, err := strconv.Atoi(lower)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid memory size %s", s)
+	}
+	return n * multiplier, nil
+}
+
+var ErrOutputBufferLimit = errors.New("client output buffer limit reached")
+
+// OutputBuffer queues the output of a connection so that a client that reads slowly does not block the
+// goroutines that write to it. A single goroutine writes the queued output to the connection in order.
+// When the queued output goes over the limits of the client's class, the connection is closed.
+// Reads and the other methods of net.Conn go straight to the connection.
+type OutputBuffer struct {
+	net.Conn
+	mut       sync.Mutex
+	cond      *sync.Cond
+	queue     [][]byte
+	size      int       // The number of queued bytes, including the ones being written
+	softSince time.Time // When the queued output went over the soft limit, zero if it is under
+	err       error     // Why the connection was closed, nil while it is open
+	closing   bool      // Set by Close, the connection is closed once the queued output is written
+	limits    map[string]OutputBufferLimit
+	class     string // The class of the client, whose limits apply
+	onLimit   func(class string)
+}
+
+// NewOutputBuffer starts writing the output queued for conn, which belongs to a normal client.
+// onLimit is called with the class of the client when it is disconnected for going over the limits.
+func NewOutputBuffer(conn net.Conn, limits map[string]OutputBufferLimit, onLimit func(class string)) *OutputBuffer {
+	buffer := &OutputBuffer{
+		Conn:    conn,
+		mut:     sync.Mutex{},
+		queue:   [][]byte{},
+		limits:  limits,
+		class:   NormalClient,
+		onLimit: onLimit,
+	}
+	buffer.cond = sync.NewCond(&buffer.mut)
+	go buffer.flush()
+	return buffer
+}
+
+// SetClass changes the class of the client, for example when it subscribes to a channel.
+func (buffer *OutputBuffer) SetClass(class string) {
+	buffer.mut.Lock()
+	defer buffer.mut.Unlock()
+	buffer.class = class
+}
+
+// Write queues b to be written to the connection. It only fails once the connection is closed.
+func (buffer *OutputBuffer) Write(b []byte) (int, error) {
+	buffer.mut.Lock()
+
+	if buffer.err != nil || buffer.closing {
+		buffer.mut.Unlock()
+		return 0, net.ErrClosed
+	}
+
+	buffer.queue = append(buffer.queue, append([]byte{}, b...))
+	buffer.size += len(b)
+
+	if buffer.overLimit(time.Now()) {
+		buffer.closeLocked(ErrOutputBufferLimit)
+		class := buffer.class
+		buffer.mut.Unlock()
+		buffer.onLimit(class)
+		return 0, ErrOutputBufferLimit
+	}
+
+	buffer.cond.Signal()
+	buffer.mut.Unlock()
+	return len(b), nil
+}
+
+// overLimit reports whether the queued output breaks the limits of the client's class. The caller must hold mut.
+func (buffer *OutputBuffer) overLimit(now time.Time) bool {
+	limit := buffer.limits[buffer.class]
+	if limit.Hard > 0 && buffer.size > limit.Hard {
+		return true
+	}
+	if limit.Soft == 0 || buffer.size <= limit.Soft {
+		buffer.softSince = time.Time{}
+		return false
+	}
+	if buffer.softSince.IsZero() {
+		buffer.softSince = now
+	}
+	return now.Sub(buffer.softSince) >= limit.SoftDuration
+}
+
+// flush writes the queued output to the connection until it is closed.
+func (buffer *OutputBuffer) flush() {
+	buffer.mut.Lock()
+	defer buffer.mut.Unlock()
+
+	for {
+		for len(buffer.queue) == 0 && buffer.err == nil && !buffer.closing {
+			buffer.cond.Wait()
+		}
+		if buffer.err != nil {
+			return
+		}
+		if len(buffer.queue) == 0 {
+			buffer.closeLocked(net.ErrClosed)
+			return
+		}
+
+		queue := buffer.queue
+		buffer.queue = [][]byte{}
+
+		buffer.mut.Unlock()
+		bufs := net.Buffers(queue)
+		n, err := bufs.WriteTo(buffer.Conn)
+		buffer.mut.Lock()
+
+		buffer.size -= int(n)
+		if buffer.size <= buffer.limits[buffer.class].Soft {
+			buffer.softSince = time.Time{}
+		}
+		if err != nil {
+			buffer.closeLocked(err)
+			return
+		}
+	}
+}
+
+// closeLocked closes the connection and drops the queued output. The caller must hold mut.
+func (buffer *OutputBuffer) closeLocked(err error) {
+	if buffer.err != nil {
+		return
+	}
+	buffer.err = err
+	buffer.queue = nil
+	buffer.Conn.Close()
+	buffer.cond.Broadcast()
+}
+
+// Close closes the connection once the queued output has been written. A client that does not read
+// the output within a second is disconnected straight away.
+func (buffer *OutputBuffer) Close() error {
+	buffer.mut.Lock()
+	defer buffer.mut.Unlock()
+	if buffer.err != nil || buffer.closing {
+		return nil
+	}
+	buffer.closing = true
+	buffer.Conn.SetWriteDeadline(time.Now().Add(time.Second))
+	buffer.cond.Signal()
+	return nil
+}
@@ -3,6 +3,7 @@ package utils
 import (
 	"context"
 	"net"
+	"time"
 )
 
 type Server interface {
@@ -12,20 +13,43 @@ type Server interface {
 	KeyRUnlock(key string)
 	KeyExists(key string) bool
 	CreateKeyAndLock(ctx context.Context, key string) (bool, error)
+	DeleteKey(ctx context.Context, key string) error
+	DeleteLockedKey(ctx context.Context, key string)
 	GetValue(key string) interface{}
 	SetValue(ctx context.Context, key string, value interface{})
+	GetVersion(key string) uint64
+	GetExpiry(key string) (time.Time, bool)
+	SetExpiry(ctx context.Context, key string, expireAt time.Time)
+	GetFieldExpiry(key string, field string) (time.Time, bool)
+	SetFieldExpiry(ctx context.Context, key string, field string, expireAt time.Time)
+	ExpiredFields(key string) []string
+	GetAllKeys(ctx context.Context) []string
 	GetAllCommands(ctx context.Context) []Command
 	GetACL() interface{}
 	GetPubSub() interface{}
+	GetSearch() interface{}
+	GetMetrics() *Metrics
+	NotifyKeyspaceEvent(ctx context.Context, class KeyspaceEventClass, event string, key string)
+	// Replicate runs the command on every node through the raft log, or only on this node if the server
+	// is not part of a cluster. The command must be one that is synced across the cluster.
+	Replicate(ctx context.Context, cmd []string) ([]byte, error)
 }
 
 type ContextServerID string
 type ContextConnID string
 
+// ContextTime carries the time at which a replicated command was first appended to the raft log,
+// so that every node applying the command uses the same clock. See Now.
+type ContextTime string
+
 type ApplyRequest struct {
 	ServerID     string   `json:"ServerID"`
 	ConnectionID string   `json:"ConnectionID"`
 	CMD          []string `json:"CMD"`
+	// ExpireKey is set instead of CMD when the leader replicates the expiry of a key.
+	ExpireKey string `json:"ExpireKey,omitempty"`
+	// ExpireFields is set along with ExpireKey when only these fields of the hash at ExpireKey expire.
+	ExpireFields []string `json:"ExpireFields,omitempty"`
 }
 
 type ApplyResponse struct {
@@ -60,3 +84,18 @@ type Plugin interface {
 	Commands() []Command
 	Description() string
 }
+
+// SnapshotEncoder is implemented by stored values that can be written to raft snapshots.
+type SnapshotEncoder interface {
+	SnapshotType() string
+	MarshalBinary() ([]byte, error)
+}
+
+// SnapshotDecoder restores a value written by a SnapshotEncoder.
+type SnapshotDecoder func(b []byte) (interface{}, error)
+
+// SnapshotPlugin is implemented by plugins that store values with their own snapshot encoding.
+// The decoders are keyed by the value returned from SnapshotType.
+type SnapshotPlugin interface {
+	SnapshotDecoders() map[string]SnapshotDecoder
+}
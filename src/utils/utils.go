@@ -3,9 +3,11 @@ package utils
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"fmt"
-	"math/big"
+	"math"
 	"net"
+	"strconv"
 	"strings"
 	"time"
 
@@ -13,22 +15,41 @@ import (
 	"github.com/tidwall/resp"
 )
 
-func AdaptType(s string) interface{} {
-	// Adapt the type of the parameter to string, float64 or int
-	n, _, err := big.ParseFloat(s, 10, 256, big.RoundingMode(big.Exact))
-
-	if err != nil {
-		return s
+// Now returns the time at which the command being handled was issued. Commands that are replicated
+// through raft carry the leader's time in the context, so handlers should prefer this to time.Now
+// whenever the time is stored.
+func Now(ctx context.Context) time.Time {
+	if t, ok := ctx.Value(ContextTime("Time")).(time.Time); ok {
+		return t
 	}
+	return time.Now()
+}
 
-	if n.IsInt() {
-		i, _ := n.Int64()
-		return int(i)
+// ParseExpiry converts an EX, PX, EXAT or PXAT option and its value into the time at which a key expires.
+// Relative expiry options are added to now.
+func ParseExpiry(now time.Time, option string, value string) (time.Time, error) {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n <= 0 {
+		return time.Time{}, fmt.Errorf("invalid expire time in '%s' option", strings.ToLower(option))
+	}
+	switch strings.ToLower(option) {
+	case "ex":
+		if n > math.MaxInt64/int64(time.Second) {
+			return time.Time{}, fmt.Errorf("invalid expire time in '%s' option", strings.ToLower(option))
+		}
+		return now.Add(time.Duration(n) * time.Second), nil
+	case "px":
+		if n > math.MaxInt64/int64(time.Millisecond) {
+			return time.Time{}, fmt.Errorf("invalid expire time in '%s' option", strings.ToLower(option))
+		}
+		return now.Add(time.Duration(n) * time.Millisecond), nil
+	case "exat":
+		return time.Unix(n, 0), nil
+	case "pxat":
+		return time.UnixMilli(n), nil
+	default:
+		return time.Time{}, fmt.Errorf("unknown expiry option %s", option)
 	}
-
-	f, _ := n.Float64()
-
-	return f
 }
 
 func Contains[T comparable](arr []T, elem T) bool {